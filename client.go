@@ -4,12 +4,15 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io"
 	"log/slog"
 	"os"
 	"strings"
 	"time"
 
+	"github.com/containerd/stargz-snapshotter/estargz"
 	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
 	"oras.land/oras-go/v2/registry/remote/credentials"
 
 	"github.com/meigma/blobber/core"
@@ -33,6 +36,7 @@ type Client struct {
 	plainHTTP bool
 	userAgent string
 	descCache bool
+	platform  *ocispec.Platform
 
 	// cache configuration (opt-in)
 	cacheDir           string
@@ -42,6 +46,10 @@ type Client struct {
 	cacheTTL           time.Duration
 	cacheVerifyOnRead  bool
 
+	// parallel download configuration (opt-in)
+	parallelDownloads int
+	chunkSize         int64
+
 	// signing configuration (opt-in)
 	signer   Signer
 	verifier Verifier
@@ -89,6 +97,12 @@ func NewClient(opts ...ClientOption) (*Client, error) {
 	if c.descCache {
 		regOpts = append(regOpts, registry.WithDescriptorCache(true))
 	}
+	if c.platform != nil {
+		regOpts = append(regOpts, registry.WithPlatform(*c.platform))
+	}
+	if c.parallelDownloads > 1 {
+		regOpts = append(regOpts, registry.WithParallelDownload(c.parallelDownloads, c.chunkSize))
+	}
 
 	registryClient := registry.New(regOpts...)
 	c.registry = registryClient
@@ -103,6 +117,7 @@ func NewClient(opts ...ClientOption) (*Client, error) {
 			return nil, fmt.Errorf("create cache: %w", err)
 		}
 		cacheInstance.SetVerifyOnRead(c.cacheVerifyOnRead)
+		cacheInstance.SetParallelDownload(c.parallelDownloads, c.chunkSize)
 		c.cache = cacheInstance
 	}
 
@@ -122,7 +137,9 @@ func NewClient(opts ...ClientOption) (*Client, error) {
 // returning. Returns ErrNoSignature if no signatures are found, or ErrSignatureInvalid
 // if verification fails.
 //
-// The layer digest is verified while downloading for integrity.
+// Multi-layer images are presented as a merged overlay view of all layers.
+//
+// The layer digests are verified while downloading for integrity.
 func (c *Client) OpenImage(ctx context.Context, ref string) (*Image, error) {
 	// Verify signature if verifier configured
 	if c.verifier != nil {
@@ -137,13 +154,57 @@ func (c *Client) OpenImage(ctx context.Context, ref string) (*Image, error) {
 	if c.cache != nil {
 		return c.openImageCached(ctx, ref)
 	}
+	return c.openFetchedImage(ctx, ref)
+}
+
+// ListFiles returns the entries of the image at ref, as Image.List does,
+// without downloading file contents. Without a cache, only the TOC of each
+// layer is fetched with range requests where the registry supports them.
+//
+// If a verifier is configured (via WithVerifier), signatures are verified
+// first, as with OpenImage.
+func (c *Client) ListFiles(ctx context.Context, ref string) ([]FileEntry, error) {
+	if c.verifier != nil {
+		verifiedRef, err := c.verifySignature(ctx, ref)
+		if err != nil {
+			return nil, err
+		}
+		ref = verifiedRef
+	}
 
-	// Resolve descriptor so we can verify the downloaded blob digest.
-	desc, err := c.registry.ResolveLayer(ctx, ref)
+	img, err := c.openSelectiveImage(ctx, ref)
+	if err != nil {
+		return nil, err
+	}
+	defer img.Close()
+
+	return img.List()
+}
+
+// openFetchedImage opens an image whose layers are downloaded in full,
+// without signature verification or the cache.
+func (c *Client) openFetchedImage(ctx context.Context, ref string) (*Image, error) {
+	// Resolve descriptors so we can verify the downloaded blob digests.
+	descs, err := c.registry.ResolveLayers(ctx, ref)
 	if err != nil {
 		return nil, fmt.Errorf("resolve %s: %w", ref, err)
 	}
 
+	layers := make([]*imageLayer, 0, len(descs))
+	for _, desc := range descs {
+		layer, err := c.fetchImageLayer(ctx, ref, desc)
+		if err != nil {
+			closeLayers(layers, c.logger)
+			return nil, err
+		}
+		layers = append(layers, layer)
+	}
+
+	return newImageFromLayers(ref, layers, c.validator, c.logger), nil
+}
+
+// fetchImageLayer downloads a layer blob from the registry into a temp file.
+func (c *Client) fetchImageLayer(ctx context.Context, ref string, desc LayerDescriptor) (*imageLayer, error) {
 	// Pull the blob from registry directly
 	blob, err := c.registry.FetchBlob(ctx, ref, desc)
 	if err != nil {
@@ -151,42 +212,133 @@ func (c *Client) OpenImage(ctx context.Context, ref string) (*Image, error) {
 	}
 	defer blob.Close()
 
-	// Create Image with cached reader
-	img, err := newImageFromBlobWithDigest(ref, blob, desc.Size, desc.Digest, c.validator, c.logger)
+	layer, err := openBlobLayer(blob, desc.Size, desc.Digest, desc.TOCDigest)
 	if err != nil {
 		return nil, fmt.Errorf("open image %s: %w", ref, err)
 	}
+	return layer, nil
+}
 
-	return img, nil
+// openRemoteImage opens an image whose layers are read with range requests,
+// without downloading or caching the blobs. Reading the TOCs only fetches
+// the eStargz footers and TOCs. The image is pinned to the resolved manifest
+// digest and is only readable while ctx is live.
+func (c *Client) openRemoteImage(ctx context.Context, ref string) (*Image, error) {
+	if c.verifier != nil {
+		verifiedRef, err := c.verifySignature(ctx, ref)
+		if err != nil {
+			return nil, err
+		}
+		ref = verifiedRef
+	}
+	return c.openRangeImage(ctx, ref)
 }
 
-// openImageCached opens an image using the cache.
-func (c *Client) openImageCached(ctx context.Context, ref string) (*Image, error) {
-	var desc LayerDescriptor
-	var err error
+// openRangeImage is openRemoteImage without signature verification, for
+// callers that have already verified ref.
+func (c *Client) openRangeImage(ctx context.Context, ref string) (*Image, error) {
+	descs, err := c.registry.ResolveLayers(ctx, ref)
+	if err != nil {
+		return nil, fmt.Errorf("resolve %s: %w", ref, err)
+	}
+	ref = digestReference(ref, descs[0].ManifestDigest)
 
-	// Try TTL-based resolution first
-	if c.cacheTTL > 0 {
-		if cachedDesc, ok := c.cache.LookupByRef(ref, c.cacheTTL); ok {
-			if c.hasCachedBlob(cachedDesc) {
-				c.logger.Debug("using TTL-cached descriptor", "ref", ref, "digest", cachedDesc.Digest)
-				desc = cachedDesc
-			}
+	layers := make([]*imageLayer, 0, len(descs))
+	for _, desc := range descs {
+		layer, err := openHandleLayer(&remoteBlob{ctx: ctx, registry: c.registry, ref: ref, desc: desc}, desc.Digest, desc.TOCDigest)
+		if err != nil {
+			closeLayers(layers, c.logger)
+			return nil, fmt.Errorf("open image %s: %w", ref, err)
 		}
+		layers = append(layers, layer)
+	}
+
+	return newImageFromLayers(ref, layers, c.validator, c.logger), nil
+}
+
+// openSelectiveImage opens ref for reading individual files: through the cache
+// if configured, with range requests otherwise, and by downloading the
+// layers if the registry does not support range requests.
+func (c *Client) openSelectiveImage(ctx context.Context, ref string) (*Image, error) {
+	if c.cache != nil {
+		return c.openImageCached(ctx, ref)
+	}
+	img, err := c.openRangeImage(ctx, ref)
+	if errors.Is(err, core.ErrRangeNotSupported) {
+		c.logger.Debug("range reads unavailable, downloading layers", "ref", ref, "error", err)
+		return c.openFetchedImage(ctx, ref)
 	}
+	return img, err
+}
 
-	// If no valid TTL cache hit, resolve from registry
-	if desc.Digest == "" {
-		desc, err = c.registry.ResolveLayer(ctx, ref)
+// remoteBlob is a BlobHandle that reads a registry blob with range requests.
+type remoteBlob struct {
+	ctx      context.Context
+	registry contracts.Registry
+	ref      string
+	desc     LayerDescriptor
+}
+
+// ReadAt fetches len(p) bytes at off from the registry.
+func (b *remoteBlob) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, fmt.Errorf("negative offset %d", off)
+	}
+	if off >= b.desc.Size {
+		return 0, io.EOF
+	}
+	length := min(int64(len(p)), b.desc.Size-off)
+
+	rc, err := b.registry.FetchBlobRange(b.ctx, b.ref, b.desc, off, length)
+	if err != nil {
+		return 0, err
+	}
+	defer rc.Close()
+
+	n, err := io.ReadFull(rc, p[:length])
+	if err != nil {
+		return n, err
+	}
+	if length < int64(len(p)) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// Size returns the blob size.
+func (b *remoteBlob) Size() int64 { return b.desc.Size }
+
+// Complete reports false: remote blobs are never stored locally.
+func (b *remoteBlob) Complete() bool { return false }
+
+// Close is a no-op; each read uses its own request.
+func (b *remoteBlob) Close() error { return nil }
+
+// openImageCached opens an image using the cache.
+func (c *Client) openImageCached(ctx context.Context, ref string) (*Image, error) {
+	descs, err := c.resolveLayersCached(ctx, ref)
+	if err != nil {
+		return nil, err
+	}
+
+	layers := make([]*imageLayer, 0, len(descs))
+	for _, desc := range descs {
+		layer, err := c.openCachedLayer(ctx, ref, desc)
 		if err != nil {
-			return nil, fmt.Errorf("resolve %s: %w", ref, err)
+			closeLayers(layers, c.logger)
+			return nil, err
 		}
-		// Update the reference index
-		c.cache.UpdateRefIndex(ref, desc)
+		layers = append(layers, layer)
 	}
 
+	return newImageFromLayers(ref, layers, c.validator, c.logger), nil
+}
+
+// openCachedLayer opens a layer blob through the cache.
+func (c *Client) openCachedLayer(ctx context.Context, ref string, desc LayerDescriptor) (*imageLayer, error) {
 	// Get blob handle from cache
 	var handle contracts.BlobHandle
+	var err error
 	if c.lazyLoading {
 		// Lazy loading: fetch bytes on-demand via ReadAt
 		handle, err = c.cache.OpenLazy(ctx, ref, desc)
@@ -198,19 +350,72 @@ func (c *Client) openImageCached(ctx context.Context, ref string) (*Image, error
 		return nil, fmt.Errorf("open cached blob %s: %w", ref, err)
 	}
 
+	// Create the layer from the cached handle
+	layer, err := openHandleLayer(handle, desc.Digest, desc.TOCDigest)
+	if err != nil {
+		handle.Close()
+		return nil, fmt.Errorf("open image %s: %w", ref, err)
+	}
+
 	// Start background prefetch if enabled and blob is not complete
 	if c.backgroundPrefetch && !handle.Complete() {
+		c.prefetchLayer(ctx, ref, desc, layer)
+	}
+
+	return layer, nil
+}
+
+// prefetchLayer downloads a layer in the background. If the layer has a
+// prefetch landmark, the prioritized region before it is fetched first
+// through the lazy handle, so prioritized files are available locally as
+// soon as possible. The rest of the blob follows.
+func (c *Client) prefetchLayer(ctx context.Context, ref string, desc LayerDescriptor, layer *imageLayer) {
+	p, ok := layer.blobHandle.(contracts.RangePrefetcher)
+	landmark, found := layer.esr.Lookup(estargz.PrefetchLandmark)
+	if !ok || !found || landmark.Offset <= 0 {
 		c.cache.Prefetch(ctx, ref, desc)
+		return
 	}
 
-	// Create Image from the cached handle
-	img, err := newImageFromHandle(ref, handle, c.validator, c.logger)
+	go func() {
+		c.logger.Debug("prefetching prioritized files", "digest", desc.Digest, "bytes", landmark.Offset)
+		if err := p.PrefetchRange(0, landmark.Offset); err != nil {
+			c.logger.Debug("prefetch of prioritized files failed", "digest", desc.Digest, "error", err)
+		}
+		c.cache.Prefetch(ctx, ref, desc)
+	}()
+}
+
+// resolveLayersCached resolves the layers of ref, using the cache's reference
+// index when the TTL allows and every layer blob is fully cached.
+// Registry resolutions are recorded in the reference index.
+func (c *Client) resolveLayersCached(ctx context.Context, ref string) ([]LayerDescriptor, error) {
+	// Try TTL-based resolution first
+	if c.cacheTTL > 0 {
+		if cached, ok := c.cache.LookupLayersByRef(ref, c.cacheTTL); ok && c.hasCachedBlobs(cached) {
+			c.logger.Debug("using TTL-cached descriptor", "ref", ref, "digest", cached[len(cached)-1].Digest)
+			return cached, nil
+		}
+	}
+
+	// No valid TTL cache hit, resolve from registry
+	layers, err := c.registry.ResolveLayers(ctx, ref)
 	if err != nil {
-		handle.Close()
-		return nil, fmt.Errorf("open image %s: %w", ref, err)
+		return nil, fmt.Errorf("resolve %s: %w", ref, err)
 	}
+	// Update the reference index
+	c.cache.UpdateRefIndexLayers(ref, layers)
+	return layers, nil
+}
 
-	return img, nil
+// hasCachedBlobs checks if every layer blob is fully cached.
+func (c *Client) hasCachedBlobs(layers []LayerDescriptor) bool {
+	for _, desc := range layers {
+		if !c.hasCachedBlob(desc) {
+			return false
+		}
+	}
+	return true
 }
 
 // hasCachedBlob checks if a blob with the given descriptor is fully cached.
@@ -249,12 +454,12 @@ func (c *Client) verifySignature(ctx context.Context, ref string) (string, error
 
 	// Resolve to the platform-specific manifest
 	pinnedIndexRef := digestReference(ref, indexDigest)
-	layerDesc, err := c.registry.ResolveLayer(ctx, pinnedIndexRef)
+	layers, err := c.registry.ResolveLayers(ctx, pinnedIndexRef)
 	if err != nil {
 		return "", fmt.Errorf("resolve %s: %w", ref, err)
 	}
 
-	platformDigest := layerDesc.ManifestDigest
+	platformDigest := layers[0].ManifestDigest
 	if platformDigest == "" {
 		return "", fmt.Errorf("no manifest digest for %s", ref)
 	}
@@ -1,15 +1,25 @@
 package blobber
 
 import (
+	"bytes"
 	"context"
+	"crypto/rand"
 	"io"
+	"log/slog"
+	"slices"
 	"testing"
+	"testing/fstest"
+	"time"
 
+	"github.com/containerd/stargz-snapshotter/estargz"
 	"github.com/opencontainers/go-digest"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
 	"github.com/meigma/blobber/core"
+	"github.com/meigma/blobber/internal/archive"
+	"github.com/meigma/blobber/internal/cache"
+	"github.com/meigma/blobber/internal/safepath"
 )
 
 func TestDigestReference(t *testing.T) {
@@ -139,7 +149,7 @@ type mockVerifyRegistry struct {
 	indexDigest   string
 	platformBytes []byte
 
-	// layerDescriptor returned by ResolveLayer
+	// layerDescriptor returned by ResolveLayer and ResolveLayers
 	layerDesc core.LayerDescriptor
 
 	// referrers returned by FetchReferrers, keyed by subject digest
@@ -153,6 +163,14 @@ func (m *mockVerifyRegistry) Push(_ context.Context, _ string, _ io.Reader, _ *c
 	return "", nil
 }
 
+func (m *mockVerifyRegistry) PushIndex(_ context.Context, _ string, _ []core.IndexManifest, _ core.TagCondition) (string, error) {
+	return "", nil
+}
+
+func (m *mockVerifyRegistry) Copy(_ context.Context, _, _ string, _ core.TagCondition) (string, error) {
+	return "", nil
+}
+
 func (m *mockVerifyRegistry) Pull(_ context.Context, _ string) (io.ReadCloser, int64, error) {
 	return nil, 0, nil
 }
@@ -166,6 +184,10 @@ func (m *mockVerifyRegistry) ResolveLayer(_ context.Context, _ string) (core.Lay
 	return m.layerDesc, nil
 }
 
+func (m *mockVerifyRegistry) ResolveLayers(_ context.Context, _ string) ([]core.LayerDescriptor, error) {
+	return []core.LayerDescriptor{m.layerDesc}, nil
+}
+
 //nolint:nilnil // unused mock method
 func (m *mockVerifyRegistry) FetchBlob(_ context.Context, _ string, _ core.LayerDescriptor) (io.ReadCloser, error) {
 	return nil, nil
@@ -440,3 +462,96 @@ func TestVerifySignature_CustomSignerType(t *testing.T) {
 	require.NoError(t, err)
 	assert.Equal(t, digestReference("test/repo:tag", manifestDigest), verifiedRef)
 }
+
+func TestWithPlatform(t *testing.T) {
+	t.Parallel()
+
+	c := &Client{}
+	require.NoError(t, WithPlatform("linux/arm64/v8")(c))
+	require.NotNil(t, c.platform)
+	assert.Equal(t, "linux", c.platform.OS)
+	assert.Equal(t, "arm64", c.platform.Architecture)
+	assert.Equal(t, "v8", c.platform.Variant)
+
+	assert.Error(t, WithPlatform("arm64")(&Client{}), "platform without os should be rejected")
+}
+
+func TestOpenImage_PrefetchesPrioritizedFiles(t *testing.T) {
+	t.Parallel()
+
+	fsys := fstest.MapFS{
+		"a.txt":   &fstest.MapFile{Data: []byte("cold"), Mode: 0o644},
+		"bin/app": &fstest.MapFile{Data: []byte("hot"), Mode: 0o755},
+	}
+	result, err := archive.NewBuilder(nil).Build(context.Background(), fsys, GzipCompression(), &core.BuildOptions{
+		PrioritizedFiles: []string{"bin/app"},
+	})
+	require.NoError(t, err)
+	defer result.Blob.Close()
+	data, err := io.ReadAll(result.Blob)
+	require.NoError(t, err)
+
+	esr, err := estargz.Open(io.NewSectionReader(bytes.NewReader(data), 0, int64(len(data))))
+	require.NoError(t, err)
+	landmark, ok := esr.Lookup(estargz.PrefetchLandmark)
+	require.True(t, ok)
+
+	reg := newMockPullRegistry(t, fsys)
+	reg.blob = data
+	reg.layerDesc.Digest = digest.FromBytes(data).String()
+	reg.layerDesc.Size = int64(len(data))
+
+	blobCache, err := cache.New(t.TempDir(), reg, nil)
+	require.NoError(t, err)
+	c := &Client{
+		registry:           reg,
+		cache:              blobCache,
+		lazyLoading:        true,
+		backgroundPrefetch: true,
+		validator:          safepath.NewValidator(),
+		logger:             slog.New(slog.DiscardHandler),
+	}
+
+	img, err := c.openImageCached(context.Background(), "test/repo:v1")
+	require.NoError(t, err)
+	defer img.Close()
+
+	// The prioritized region is fetched as one range from the start of the blob.
+	assert.Eventually(t, func() bool {
+		reg.mu.Lock()
+		defer reg.mu.Unlock()
+		return slices.Contains(reg.ranges, [2]int64{0, landmark.Offset})
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// The landmark is not part of the image contents.
+	entries, err := img.List()
+	require.NoError(t, err)
+	for _, e := range entries {
+		assert.NotEqual(t, estargz.PrefetchLandmark, e.Path())
+	}
+}
+
+func TestListFiles_ReadsOnlyTOC(t *testing.T) {
+	t.Parallel()
+
+	large := make([]byte, 512*1024)
+	_, err := rand.Read(large)
+	require.NoError(t, err)
+
+	reg := newMockPullRegistry(t, fstest.MapFS{
+		"large.bin":       &fstest.MapFile{Data: large, Mode: 0o644},
+		"config/app.yaml": &fstest.MapFile{Data: []byte("key: value"), Mode: 0o644},
+	})
+	c := &Client{registry: reg, validator: safepath.NewValidator(), logger: slog.New(slog.DiscardHandler)}
+
+	entries, err := c.ListFiles(context.Background(), "test/repo:v1")
+	require.NoError(t, err)
+	var paths []string
+	for _, e := range entries {
+		paths = append(paths, e.Path())
+	}
+	assert.ElementsMatch(t, []string{"config", "config/app.yaml", "large.bin"}, paths)
+
+	assert.Zero(t, reg.fullFetches, "layers must not be downloaded")
+	assert.Less(t, reg.rangeBytes, int64(len(large))/4, "only the TOC is fetched")
+}
@@ -115,6 +115,10 @@ func completePullArgs(cmd *cobra.Command, args []string, toComplete string) ([]s
 // - First arg: local directory (filesystem directory completion)
 // - Second arg: image reference (no completion - user must type it)
 func completePushArgs(_ *cobra.Command, args []string, _ string) ([]string, cobra.ShellCompDirective) {
+	if len(pushPlatforms) > 0 {
+		// Directories are given with --platform; the only arg is the image reference
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
 	switch len(args) {
 	case 0:
 		// First arg is the source directory
@@ -123,7 +127,7 @@ func completePushArgs(_ *cobra.Command, args []string, _ string) ([]string, cobr
 		// Second arg is the image reference - no automatic completion
 		return nil, cobra.ShellCompDirectiveNoFileComp
 	default:
-		// No more args expected
+		// Further args are additional references
 		return nil, cobra.ShellCompDirectiveNoFileComp
 	}
 }
@@ -0,0 +1,80 @@
+package cli
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"github.com/meigma/blobber"
+)
+
+var copyReferrers bool
+
+var copyCmd = &cobra.Command{
+	Use:     "copy <source> <destination>",
+	Aliases: []string{"promote"},
+	Short:   "Copy an image between registries",
+	GroupID: "core",
+	Long: `Copy transfers an image from one OCI registry reference to another, for
+example to promote an artifact from a staging registry to production.
+
+The manifest, config, and layer blobs are copied registry to registry, without
+extracting or storing anything locally. Blobs already present at the
+destination are skipped, blobs on the same registry are mounted across
+repositories, and other blobs are streamed from the source. An image index is
+copied with all its platform manifests.
+
+The source is resolved to a digest first, so a tag moved during the copy does
+not mix two images. With --verify, the source signature is verified before
+anything is copied.
+
+Use --referrers to copy signatures, SBOMs, and other referrers of the image
+along with it. Use --sign to sign the image again at the destination.
+
+The copied manifest digest is printed on success; it is the same at both ends.
+
+Examples:
+  blobber copy ghcr.io/org/app:v1 registry.example.com/org/app:v1
+  blobber promote staging.example.com/org/app:v1 prod.example.com/org/app:v1 --referrers
+  blobber copy ghcr.io/org/staging:v1 ghcr.io/org/prod:v1 --verify --verify-issuer https://token.actions.githubusercontent.com --verify-subject https://github.com/org/repo/.github/workflows/release.yml@refs/heads/main
+  blobber copy ghcr.io/org/app:v1 registry.example.com/org/app:v1 --sign`,
+	Args:              cobra.ExactArgs(2),
+	RunE:              runCopy,
+	ValidArgsFunction: completeImageRef,
+}
+
+func init() {
+	copyCmd.Flags().BoolVar(&copyReferrers, "referrers", false, "Copy signatures, SBOMs, and other referrers along with the image")
+	rootCmd.AddCommand(copyCmd)
+}
+
+func runCopy(_ *cobra.Command, args []string) error {
+	srcRef, dstRef := args[0], args[1]
+
+	var opts []blobber.CopyOption
+	if copyReferrers {
+		opts = append(opts, blobber.WithReferrers())
+	}
+	if viper.GetBool("sign.enabled") {
+		opts = append(opts, blobber.WithResign())
+	}
+
+	// Create client
+	client, err := newClient()
+	if err != nil {
+		return err
+	}
+
+	// Set up signal handling
+	ctx, cancel := signalContext()
+	defer cancel()
+
+	digest, err := client.Copy(ctx, srcRef, dstRef, opts...)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println(digest)
+	return nil
+}
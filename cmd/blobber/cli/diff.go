@@ -0,0 +1,95 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/meigma/blobber"
+)
+
+var diffContent bool
+
+var diffCmd = &cobra.Command{
+	Use:     "diff <reference-a> <reference-b>",
+	Short:   "Show differences between two OCI images",
+	GroupID: "core",
+	Long: `Diff compares the files of two OCI registry images and reports added,
+removed, modified and mode-changed entries.
+
+Only the eStargz indexes are compared: files are matched by the content
+digests recorded in the index, so no file content is downloaded. With
+--content, unified diffs of changed text files are printed as well, which
+downloads just those files. With the cache disabled (--no-cache), layers are
+downloaded in full.
+
+Each line shows the kind of change and the path:
+  added     the entry only exists in <reference-b>
+  removed   the entry only exists in <reference-a>
+  modified  the content, type or link target differs
+  mode      only the permissions differ
+
+Examples:
+  blobber diff ghcr.io/org/config:v1 ghcr.io/org/config:v2
+  blobber diff --content ghcr.io/org/config:staging ghcr.io/org/config:prod`,
+	Args:              cobra.ExactArgs(2),
+	RunE:              runDiff,
+	ValidArgsFunction: completeImageRef,
+}
+
+func init() {
+	diffCmd.Flags().BoolVar(&diffContent, "content", false, "Show unified diffs of changed text files")
+	rootCmd.AddCommand(diffCmd)
+}
+
+func runDiff(_ *cobra.Command, args []string) error {
+	// Create client; only the indexes are fetched unless --content is set
+	client, err := newClient(blobber.WithLazyLoading(true))
+	if err != nil {
+		return err
+	}
+
+	// Set up signal handling
+	ctx, cancel := signalContext()
+	defer cancel()
+
+	// Open images
+	imgA, err := client.OpenImage(ctx, args[0])
+	if err != nil {
+		return err
+	}
+	defer imgA.Close()
+
+	imgB, err := client.OpenImage(ctx, args[1])
+	if err != nil {
+		return err
+	}
+	defer imgB.Close()
+
+	changes, err := blobber.Diff(imgA, imgB)
+	if err != nil {
+		return err
+	}
+
+	for _, c := range changes {
+		printChange(os.Stdout, c)
+		if diffContent {
+			if err := blobber.WriteContentDiff(os.Stdout, imgA, imgB, c); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// printChange prints the kind and path of a change. Mode changes also show
+// the old and new modes.
+func printChange(w io.Writer, c blobber.Change) {
+	if c.Kind == blobber.ChangeModeChanged {
+		fmt.Fprintf(w, "%-8s  %s  %s -> %s\n", c.Kind, c.Path, formatMode(c.Old.Mode()), formatMode(c.New.Mode()))
+		return
+	}
+	fmt.Fprintf(w, "%-8s  %s\n", c.Kind, c.Path)
+}
@@ -0,0 +1,104 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/meigma/blobber"
+)
+
+var (
+	exportOutput string
+	exportFormat string
+)
+
+var exportCmd = &cobra.Command{
+	Use:     "export <reference>",
+	Short:   "Export an OCI image as a tar archive",
+	GroupID: "core",
+	Long: `Export writes the contents of an OCI registry image as a standard tar archive.
+
+Multi-layer images are exported as their merged view. The eStargz index and
+landmark entries are omitted, so the archive can be consumed by any tar tool.
+
+The archive is written to stdout unless --output is set. The format is
+inferred from the output file extension (.tar, .tar.gz/.tgz, .tar.zst) and
+can be overridden with --format.
+
+Examples:
+  blobber export ghcr.io/org/config:v1 -o config.tar.gz
+  blobber export ghcr.io/org/rootfs:v1 | docker import - rootfs:v1
+  blobber export --format tar.zst ghcr.io/org/config:v1 > config.tar.zst`,
+	Args:              cobra.ExactArgs(1),
+	RunE:              runExport,
+	ValidArgsFunction: completeImageRef,
+}
+
+func init() {
+	exportCmd.Flags().StringVarP(&exportOutput, "output", "o", "", "Write the archive to a file instead of stdout")
+	exportCmd.Flags().StringVar(&exportFormat, "format", "", "Archive format: tar, tar.gz, or tar.zst (default: from --output extension, else tar)")
+	rootCmd.AddCommand(exportCmd)
+}
+
+func runExport(_ *cobra.Command, args []string) error {
+	ref := args[0]
+
+	format, err := resolveExportFormat()
+	if err != nil {
+		return err
+	}
+
+	// Create client
+	client, err := newClient()
+	if err != nil {
+		return err
+	}
+
+	// Set up signal handling
+	ctx, cancel := signalContext()
+	defer cancel()
+
+	// Open image
+	img, err := client.OpenImage(ctx, ref)
+	if err != nil {
+		return err
+	}
+	defer img.Close()
+
+	if exportOutput == "" {
+		return img.WriteTar(os.Stdout, blobber.WithExportFormat(format))
+	}
+	return exportToFile(img, exportOutput, format)
+}
+
+// resolveExportFormat returns the format from --format, or infers it from --output.
+func resolveExportFormat() (blobber.ExportFormat, error) {
+	if exportFormat != "" {
+		return blobber.ParseExportFormat(exportFormat)
+	}
+	if exportOutput != "" {
+		return blobber.ExportFormatFromPath(exportOutput), nil
+	}
+	return blobber.ExportTar, nil
+}
+
+// exportToFile writes the image archive to path, removing the partial file on failure.
+func exportToFile(img *blobber.Image, path string, format blobber.ExportFormat) error {
+	f, err := os.Create(path) //nolint:gosec // G304: path is user-provided CLI argument
+	if err != nil {
+		return fmt.Errorf("create output file: %w", err)
+	}
+
+	writeErr := img.WriteTar(f, blobber.WithExportFormat(format))
+	closeErr := f.Close()
+	if writeErr == nil && closeErr != nil {
+		writeErr = fmt.Errorf("close output file: %w", closeErr)
+	}
+	if writeErr != nil {
+		os.Remove(path)
+		return writeErr
+	}
+	return nil
+}
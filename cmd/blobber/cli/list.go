@@ -7,6 +7,7 @@ import (
 	"os"
 	"strconv"
 	"text/tabwriter"
+	"time"
 
 	"github.com/dustin/go-humanize"
 	"github.com/spf13/cobra"
@@ -15,8 +16,9 @@ import (
 )
 
 var (
-	listLong  bool
-	listHuman bool
+	listLong   bool
+	listHuman  bool
+	listDigest bool
 )
 
 var listCmd = &cobra.Command{
@@ -28,10 +30,15 @@ var listCmd = &cobra.Command{
 
 This leverages eStargz format to read only the table of contents.
 
+The long format shows the mode, owner, group, size and modification time
+recorded in the archive, and the target of symbolic links. --digest adds
+the content digest of each regular file, for integrity checks.
+
 Examples:
   blobber ls ghcr.io/org/config:v1
   blobber ls -l ghcr.io/org/config:v1
-  blobber ls -lH ghcr.io/org/config:v1`,
+  blobber ls -lH ghcr.io/org/config:v1
+  blobber ls --digest ghcr.io/org/config:v1`,
 	Args:              cobra.ExactArgs(1),
 	RunE:              runList,
 	ValidArgsFunction: completeImageRef,
@@ -40,6 +47,7 @@ Examples:
 func init() {
 	listCmd.Flags().BoolVarP(&listLong, "long", "l", false, "Use long listing format")
 	listCmd.Flags().BoolVarP(&listHuman, "human-readable", "H", false, "Print sizes in human-readable format")
+	listCmd.Flags().BoolVar(&listDigest, "digest", false, "Show the content digest of each file")
 	rootCmd.AddCommand(listCmd)
 }
 
@@ -79,25 +87,68 @@ func runList(_ *cobra.Command, args []string) error {
 	return nil
 }
 
-// printShortListing prints just the file paths.
+// printShortListing prints the file paths, preceded by their digests with --digest.
 func printShortListing(w io.Writer, entries []blobber.FileEntry) {
 	for _, entry := range entries {
+		if listDigest {
+			fmt.Fprintf(w, "%s  %s\n", formatDigest(entry), entry.Path())
+			continue
+		}
 		fmt.Fprintln(w, entry.Path())
 	}
 }
 
-// printLongListing prints mode, size, and path in ls -l style format.
+// printLongListing prints mode, owner, group, size, mtime, and path in ls -l
+// style format, with the digest before the path with --digest.
 func printLongListing(w io.Writer, entries []blobber.FileEntry) {
 	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
 	for _, entry := range entries {
-		fmt.Fprintf(tw, "%s\t%s\t%s\n",
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t",
 			formatMode(entry.Mode()),
+			formatOwner(entry.Uname, entry.UID),
+			formatOwner(entry.Gname, entry.GID),
 			formatSize(entry),
-			entry.Path())
+			formatModTime(entry.FileModTime))
+		if listDigest {
+			fmt.Fprintf(tw, "%s\t", formatDigest(entry))
+		}
+		fmt.Fprintln(tw, formatName(entry))
 	}
 	tw.Flush()
 }
 
+// formatName formats the path of an entry, with the target of symbolic links.
+func formatName(entry blobber.FileEntry) string {
+	if entry.Type()&fs.ModeSymlink != 0 {
+		return entry.Path() + " -> " + entry.LinkTarget
+	}
+	return entry.Path()
+}
+
+// formatOwner formats an owner or group, preferring the name to the ID.
+func formatOwner(name string, id int) string {
+	if name != "" {
+		return name
+	}
+	return strconv.Itoa(id)
+}
+
+// formatModTime formats a modification time in UTC, or "-" if unknown.
+func formatModTime(t time.Time) string {
+	if t.IsZero() {
+		return "-"
+	}
+	return t.UTC().Format("2006-01-02 15:04")
+}
+
+// formatDigest formats the content digest of an entry, or "-" if it has none.
+func formatDigest(entry blobber.FileEntry) string {
+	if entry.Digest == "" {
+		return "-"
+	}
+	return entry.Digest
+}
+
 // formatMode converts fs.FileMode to symbolic format (e.g., "-rw-r--r--").
 func formatMode(mode fs.FileMode) string {
 	buf := make([]byte, 10)
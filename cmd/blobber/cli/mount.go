@@ -0,0 +1,80 @@
+package cli
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"github.com/meigma/blobber"
+	"github.com/meigma/blobber/mount"
+)
+
+var mountAllowOther bool
+
+var mountCmd = &cobra.Command{
+	Use:     "mount <reference> <mountpoint>",
+	Short:   "Mount an OCI image as a read-only filesystem",
+	GroupID: "core",
+	Long: `Mount exposes the contents of an OCI registry image as a read-only FUSE
+filesystem at an existing directory.
+
+Files are fetched lazily through the blob cache: browsing the mount only
+downloads the eStargz index, and reading a file downloads just the byte
+ranges that are read. This makes it practical to explore large images
+without pulling them. With the cache disabled (--no-cache), layers are
+downloaded in full before mounting.
+
+The command runs in the foreground until interrupted (Ctrl-C), or until the
+mountpoint is unmounted with fusermount -u or umount. Mounting requires FUSE
+and is only supported on Linux.
+
+Examples:
+  blobber mount ghcr.io/org/datasets:v1 /mnt/datasets
+  blobber mount --allow-other ghcr.io/org/models:v2 /srv/models`,
+	Args:              cobra.ExactArgs(2),
+	RunE:              runMount,
+	ValidArgsFunction: completeImageRef,
+}
+
+func init() {
+	mountCmd.Flags().BoolVar(&mountAllowOther, "allow-other", false, "Allow other users to access the mount (requires user_allow_other in /etc/fuse.conf)")
+	rootCmd.AddCommand(mountCmd)
+}
+
+func runMount(_ *cobra.Command, args []string) error {
+	ref := args[0]
+	mountpoint := args[1]
+
+	// Create client; files are only fetched when read
+	client, err := newClient(blobber.WithLazyLoading(true))
+	if err != nil {
+		return err
+	}
+
+	// Set up signal handling; cancelling unmounts the filesystem
+	ctx, cancel := signalContext()
+	defer cancel()
+
+	// Open image
+	img, err := client.OpenImage(ctx, ref)
+	if err != nil {
+		return err
+	}
+	defer img.Close()
+
+	opts := []mount.Option{
+		mount.WithFSName(ref),
+		mount.WithAllowOther(mountAllowOther),
+	}
+	if viper.GetBool("verbose") {
+		opts = append(opts, mount.WithLogger(
+			slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelDebug})),
+		))
+	}
+
+	fmt.Fprintf(os.Stderr, "Mounting %s at %s (press Ctrl-C to unmount)\n", ref, mountpoint)
+	return mount.Mount(ctx, img.FS(), mountpoint, opts...)
+}
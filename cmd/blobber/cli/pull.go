@@ -9,9 +9,20 @@ import (
 	"github.com/spf13/cobra"
 
 	"github.com/meigma/blobber"
+	"github.com/meigma/blobber/internal/archive"
 )
 
-var pullOverwrite bool
+var (
+	pullOverwrite      bool
+	pullAtomic         bool
+	pullInclude        []string
+	pullExclude        []string
+	pullAllowDevices   bool
+	pullAllowFIFOs     bool
+	pullPreserveTimes  bool
+	pullPreserveOwners bool
+	pullPreserveXattrs bool
+)
 
 var pullCmd = &cobra.Command{
 	Use:     "pull <reference> <directory>",
@@ -22,6 +33,26 @@ var pullCmd = &cobra.Command{
 By default, files are merged into the destination directory. If a file already
 exists, the operation fails. Use --overwrite to replace existing files.
 
+With --atomic, the image is extracted into a staging directory next to the
+destination, which then replaces the destination as a whole: files not in the
+image are removed, and if the pull fails the previous contents are left
+untouched. A destination that is a symbolic link is flipped to the new
+directory.
+
+Use --include and --exclude to pull only matching files. Patterns use glob
+syntax; a pattern matching a directory selects everything below it, and
+patterns without a slash match at any depth. For eStargz images, only the
+matching files are downloaded.
+
+Hard links are restored. Device and FIFO nodes are only created with
+--allow-devices and --allow-fifos; otherwise images containing them fail to
+pull. Creating devices usually requires root.
+
+Permissions are always restored. Use --preserve-times, --preserve-ownership,
+and --preserve-xattrs to also restore modification times, owners (only when
+running as root), and extended attributes (trusted.* and security.* only
+when running as root).
+
 Use --verify to verify the artifact's Sigstore signature before pulling.
 Specify --verify-issuer and --verify-subject to require a specific signer identity,
 or use --verify-unsafe to accept any valid signer identity (unsafe).
@@ -29,6 +60,8 @@ or use --verify-unsafe to accept any valid signer identity (unsafe).
 Examples:
   blobber pull ghcr.io/org/config:v1 ./config
   blobber pull ghcr.io/org/data:latest ./data --overwrite
+  blobber pull ghcr.io/org/config:v2 /etc/app --atomic
+  blobber pull ghcr.io/org/bundle:v1 ./docs --include docs --exclude '*.pdf'
   blobber pull ghcr.io/org/data:latest ./data --verify --verify-issuer https://accounts.google.com --verify-subject user@example.com
   blobber pull ghcr.io/org/data:latest ./data --verify --verify-unsafe`,
 	Args:              cobra.ExactArgs(2),
@@ -38,6 +71,14 @@ Examples:
 
 func init() {
 	pullCmd.Flags().BoolVar(&pullOverwrite, "overwrite", false, "Overwrite existing files")
+	pullCmd.Flags().BoolVar(&pullAtomic, "atomic", false, "Replace the destination as a whole, only if the pull succeeds")
+	pullCmd.Flags().StringArrayVar(&pullInclude, "include", nil, "Only pull files matching the glob pattern (repeatable)")
+	pullCmd.Flags().StringArrayVar(&pullExclude, "exclude", nil, "Skip files matching the glob pattern (repeatable)")
+	pullCmd.Flags().BoolVar(&pullAllowDevices, "allow-devices", false, "Create character and block devices")
+	pullCmd.Flags().BoolVar(&pullAllowFIFOs, "allow-fifos", false, "Create named pipes (FIFOs)")
+	pullCmd.Flags().BoolVar(&pullPreserveTimes, "preserve-times", false, "Restore file modification times")
+	pullCmd.Flags().BoolVar(&pullPreserveOwners, "preserve-ownership", false, "Restore file owners and groups (requires root)")
+	pullCmd.Flags().BoolVar(&pullPreserveXattrs, "preserve-xattrs", false, "Restore extended attributes")
 	rootCmd.AddCommand(pullCmd)
 }
 
@@ -45,6 +86,11 @@ func runPull(_ *cobra.Command, args []string) error {
 	ref := args[0]
 	destDir := args[1]
 
+	filter, err := archive.NewFilter(pullInclude, pullExclude)
+	if err != nil {
+		return err
+	}
+
 	// Create client
 	client, err := newClient()
 	if err != nil {
@@ -55,14 +101,17 @@ func runPull(_ *cobra.Command, args []string) error {
 	ctx, cancel := signalContext()
 	defer cancel()
 
-	// Handle file conflicts
-	if err := handlePullConflicts(ctx, client, ref, destDir, pullOverwrite); err != nil {
-		return err
-	}
+	// An atomic pull replaces the destination instead of merging into it
+	if !pullAtomic {
+		// Handle file conflicts
+		if err := handlePullConflicts(ctx, client, ref, destDir, filter, pullOverwrite); err != nil {
+			return err
+		}
 
-	// Ensure destination directory exists
-	if err := os.MkdirAll(destDir, 0o750); err != nil {
-		return fmt.Errorf("cannot create destination directory: %w", err)
+		// Ensure destination directory exists
+		if err := os.MkdirAll(destDir, 0o750); err != nil {
+			return fmt.Errorf("cannot create destination directory: %w", err)
+		}
 	}
 
 	// Set up progress tracking
@@ -71,31 +120,52 @@ func runPull(_ *cobra.Command, args []string) error {
 
 	// Build pull options
 	var pullOpts []blobber.PullOption
+	if pullAtomic {
+		pullOpts = append(pullOpts, blobber.WithAtomic())
+	}
 	if progressCallback != nil {
 		pullOpts = append(pullOpts, blobber.WithPullProgress(progressCallback))
 	}
+	if len(pullInclude) > 0 {
+		pullOpts = append(pullOpts, blobber.WithInclude(pullInclude...))
+	}
+	if len(pullExclude) > 0 {
+		pullOpts = append(pullOpts, blobber.WithExclude(pullExclude...))
+	}
+	if pullAllowDevices || pullAllowFIFOs {
+		pullOpts = append(pullOpts, blobber.WithExtractTypes(blobber.ExtractTypes{
+			CharDevices:  pullAllowDevices,
+			BlockDevices: pullAllowDevices,
+			FIFOs:        pullAllowFIFOs,
+		}))
+	}
+
+	if pullPreserveTimes {
+		pullOpts = append(pullOpts, blobber.WithPreserveTimes())
+	}
+	if pullPreserveOwners {
+		pullOpts = append(pullOpts, blobber.WithPreserveOwnership())
+	}
+	if pullPreserveXattrs {
+		pullOpts = append(pullOpts, blobber.WithPreserveXattrs())
+	}
 
 	// Pull
 	return client.Pull(ctx, ref, destDir, pullOpts...)
 }
 
 // handlePullConflicts checks for and handles file conflicts.
+// Only files selected by filter (nil for all files) are considered.
 // If overwrite is false, returns an error if conflicts exist.
 // If overwrite is true, removes conflicting files.
-func handlePullConflicts(ctx context.Context, client *blobber.Client, ref, destDir string, overwrite bool) error {
+func handlePullConflicts(ctx context.Context, client *blobber.Client, ref, destDir string, filter *archive.Filter, overwrite bool) error {
 	// Only check if destination directory exists
 	if _, err := os.Stat(destDir); os.IsNotExist(err) {
 		return nil
 	}
 
-	// Open image to get file list
-	img, err := client.OpenImage(ctx, ref)
-	if err != nil {
-		return err
-	}
-	defer img.Close()
-
-	entries, err := img.List()
+	// List the image from its TOC, so no file content is downloaded
+	entries, err := client.ListFiles(ctx, ref)
 	if err != nil {
 		return err
 	}
@@ -103,7 +173,7 @@ func handlePullConflicts(ctx context.Context, client *blobber.Client, ref, destD
 	// Find conflicts
 	var conflicts []string
 	for _, entry := range entries {
-		if entry.IsDir() {
+		if entry.IsDir() || !filter.Match(entry.Path()) {
 			continue
 		}
 		fullPath := filepath.Join(destDir, entry.Path())
@@ -1,61 +1,165 @@
 package cli
 
 import (
+	"bufio"
+	"context"
+	"errors"
 	"fmt"
+	"io/fs"
 	"os"
+	"path/filepath"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/spf13/cobra"
 
 	"github.com/meigma/blobber"
 )
 
-var pushCompression string
+var (
+	pushCompression  string
+	pushPlatforms    []string
+	pushBase         string
+	pushReproducible bool
+	pushPrioritize   []string
+	pushIfChanged    bool
+	pushExpect       string
+	pushIfNotExists  bool
+)
+
+// prefetchFileName is the file in a pushed directory listing the files to
+// prioritize when --prioritize is not given.
+const prefetchFileName = ".blobberprefetch"
 
 var pushCmd = &cobra.Command{
-	Use:     "push <directory> <reference>",
+	Use:     "push <directory|archive|-> <reference> [reference...]",
 	Short:   "Push a directory to an OCI registry",
 	GroupID: "core",
 	Long: `Push uploads a directory of files to an OCI registry as an eStargz image.
 
+The source may also be a tar archive (.tar, .tar.gz, or .tgz), or "-" to read
+a tar stream (optionally gzip-compressed) from stdin. Archive entries are
+checked for unsafe paths and symlinks before anything is uploaded.
+
+Give more than one reference to publish the same image under several tags,
+repositories, or registries. A reference without a repository (e.g.
+"latest") is a tag in the repository of the first reference. The image is
+built and uploaded once, to the first reference; the other destinations
+receive only the manifest, with blobs mounted within a registry or copied
+between registries. Destinations on different registries are pushed
+concurrently, and each failed destination is reported.
+
+Use --platform os/arch[/variant]=<directory> (repeatable) instead of the
+directory argument to push one image per platform under a single tag. The tag
+then points to an OCI image index, and pulls select the matching platform.
+
+Use --base <reference> for an incremental push: only files that are new or
+changed relative to the base image are uploaded, as a new layer on top of it.
+
+Use --reproducible to make identical inputs produce identical digests: file
+mtimes and timestamps are set to $SOURCE_DATE_EPOCH (Unix seconds, default 0),
+ownership is cleared, and permissions are normalized.
+
+Use --prioritize <path> (repeatable) to place files at the start of the layer,
+marked by an eStargz prefetch landmark. Lazy clients with background prefetch
+download these files first. Without --prioritize, paths are read from a
+.blobberprefetch file in the pushed directory, one per line ("#" starts a
+comment). Prioritizing is not supported for tar sources.
+
+Use --if-changed to skip the push when the tag already holds the same content:
+the files are compared with the tag's index (or, with --reproducible, the
+built layer with the tag's layer), and the existing digest is printed without
+uploading, retagging, or signing anything. Not supported with --base or
+--platform.
+
+Use --expect-digest <digest> to move the tag only if it still points to that
+manifest, or --if-not-exists to create the tag only if it does not exist yet.
+The tag is checked again right before it is moved, and the push fails with a
+tag conflict otherwise; content already uploaded stays untagged.
+
 Use --sign to sign the artifact with Sigstore (keyless). This requires OIDC
-authentication (e.g., via browser or OIDC token).
+authentication (e.g., via browser or OIDC token). For multi-platform pushes,
+every platform manifest and the index are signed.
 
 Examples:
   blobber push ./config ghcr.io/org/config:v1
   blobber push ./data ghcr.io/org/data:latest --compression zstd
-  blobber push ./data ghcr.io/org/data:latest --sign`,
-	Args:              cobra.ExactArgs(2),
+  blobber push ./dist ghcr.io/org/dist:v1.2.3 v1.2 latest registry.example.com/org/dist:v1.2.3
+  blobber push ./data ghcr.io/org/data:latest --sign
+  blobber push ./dist.tar.gz ghcr.io/org/dist:v1
+  tar c -C ./build . | blobber push - ghcr.io/org/build:v1
+  blobber push ./data ghcr.io/org/data:v2 --base ghcr.io/org/data:v1
+  blobber push ./app ghcr.io/org/app:v1 --prioritize bin/app --prioritize etc
+  SOURCE_DATE_EPOCH=$(git log -1 --format=%ct) blobber push ./data ghcr.io/org/data:v1 --reproducible
+  blobber push ./config ghcr.io/org/config:latest --if-changed --sign
+  blobber push ./config ghcr.io/org/config:prod --expect-digest sha256:4f1c...
+  blobber push ./release ghcr.io/org/release:v1.2.0 --if-not-exists
+  blobber push --platform linux/amd64=./dist/amd64 --platform linux/arm64=./dist/arm64 ghcr.io/org/plugin:v1`,
+	Args:              pushArgs,
 	RunE:              runPush,
 	ValidArgsFunction: completePushArgs,
 }
 
 func init() {
 	pushCmd.Flags().StringVar(&pushCompression, "compression", "gzip", "Compression algorithm (gzip, zstd)")
+	pushCmd.Flags().StringVar(&pushBase, "base", "", "Push only changes relative to this base image")
+	pushCmd.Flags().BoolVar(&pushReproducible, "reproducible", false, "Normalize timestamps, ownership, and permissions for deterministic digests")
+	pushCmd.Flags().StringArrayVar(&pushPrioritize, "prioritize", nil, "Place a file or directory first for lazy prefetching (repeatable)")
+	pushCmd.Flags().BoolVar(&pushIfChanged, "if-changed", false, "Skip the push if the tag already holds the same content")
+	pushCmd.Flags().StringVar(&pushExpect, "expect-digest", "", "Fail unless the tag points to this manifest digest before it is moved")
+	pushCmd.Flags().BoolVar(&pushIfNotExists, "if-not-exists", false, "Fail if the tag already exists")
+	pushCmd.Flags().StringArrayVar(&pushPlatforms, "platform", nil, "Push a directory for a platform as os/arch[/variant]=<directory> (repeatable)")
 	rootCmd.AddCommand(pushCmd)
 }
 
+// pushArgs validates positional arguments: a multi-platform push takes only
+// references, since directories are given with --platform.
+func pushArgs(cmd *cobra.Command, args []string) error {
+	if len(pushPlatforms) > 0 {
+		return cobra.MinimumNArgs(1)(cmd, args)
+	}
+	return cobra.MinimumNArgs(2)(cmd, args)
+}
+
 func runPush(_ *cobra.Command, args []string) error {
-	dir := args[0]
-	ref := args[1]
+	if pushExpect != "" && pushIfNotExists {
+		return errors.New("--expect-digest cannot be used with --if-not-exists")
+	}
 
-	// Validate directory exists and is a directory
-	info, err := os.Stat(dir)
-	if err != nil {
-		if os.IsNotExist(err) {
-			return fmt.Errorf("directory not found: %s", dir)
+	var source string
+	var refs []string
+	var platforms map[string]fs.FS
+	if len(pushPlatforms) > 0 {
+		if pushBase != "" {
+			return errors.New("--base cannot be used with --platform")
+		}
+		if pushIfChanged {
+			return errors.New("--if-changed cannot be used with --platform")
+		}
+		refs = args
+		var err error
+		if platforms, err = parsePlatformDirs(pushPlatforms); err != nil {
+			return err
+		}
+	} else {
+		source, refs = args[0], args[1:]
+		if !isTarSource(source) {
+			if err := validateDir(source); err != nil {
+				return err
+			}
 		}
-		return fmt.Errorf("cannot access directory: %w", err)
-	}
-	if !info.IsDir() {
-		return fmt.Errorf("not a directory: %s", dir)
 	}
 
-	// Parse compression option
-	compression, err := parseCompression(pushCompression)
+	// Build push options
+	pushOpts, err := pushOptions(source)
 	if err != nil {
 		return err
 	}
+	ref := refs[0]
+	if len(refs) > 1 {
+		pushOpts = append(pushOpts, blobber.WithTags(refs[1:]...))
+	}
 
 	// Create client
 	client, err := newClient()
@@ -70,18 +174,26 @@ func runPush(_ *cobra.Command, args []string) error {
 	// Set up progress tracking
 	progressCallback, finishProgress := newPushProgress()
 	defer finishProgress()
-
-	// Build push options
-	pushOpts := []blobber.PushOption{
-		blobber.WithCompression(compression),
-	}
 	if progressCallback != nil {
 		pushOpts = append(pushOpts, blobber.WithPushProgress(progressCallback))
 	}
 
 	// Push
-	digest, err := client.Push(ctx, ref, os.DirFS(dir), pushOpts...)
+	var digest string
+	switch {
+	case platforms != nil:
+		digest, err = client.PushIndex(ctx, ref, platforms, pushOpts...)
+	case isTarSource(source):
+		digest, err = pushTarSource(ctx, client, ref, source, pushOpts)
+	default:
+		digest, err = client.Push(ctx, ref, blobber.DirFS(source), pushOpts...)
+	}
 	if err != nil {
+		// The image was pushed, but some of the other destinations failed.
+		if digest != "" {
+			fmt.Println()
+			fmt.Println(digest)
+		}
 		return err
 	}
 
@@ -91,6 +203,153 @@ func runPush(_ *cobra.Command, args []string) error {
 	return nil
 }
 
+// pushOptions builds the push options from the command flags.
+// source is the pushed directory or archive, or empty for multi-platform pushes.
+func pushOptions(source string) ([]blobber.PushOption, error) {
+	compression, err := parseCompression(pushCompression)
+	if err != nil {
+		return nil, err
+	}
+
+	opts := []blobber.PushOption{
+		blobber.WithCompression(compression),
+	}
+	if pushBase != "" {
+		opts = append(opts, blobber.WithBaseImage(pushBase))
+	}
+	if pushReproducible {
+		epoch, err := sourceDateEpoch()
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, blobber.WithReproducible(epoch))
+	}
+	if pushIfChanged {
+		opts = append(opts, blobber.WithSkipIfUnchanged())
+	}
+	if pushExpect != "" {
+		opts = append(opts, blobber.WithExpectedDigest(pushExpect))
+	}
+	if pushIfNotExists {
+		opts = append(opts, blobber.WithIfNotExists())
+	}
+
+	prioritized := pushPrioritize
+	if len(prioritized) == 0 && source != "" && !isTarSource(source) {
+		if prioritized, err = readPrefetchFile(filepath.Join(source, prefetchFileName)); err != nil {
+			return nil, err
+		}
+	}
+	if len(prioritized) > 0 {
+		opts = append(opts, blobber.WithPrioritizedFiles(prioritized...))
+	}
+	return opts, nil
+}
+
+// readPrefetchFile reads the paths listed in a .blobberprefetch file.
+// Blank lines and lines starting with "#" are ignored. A missing file lists nothing.
+func readPrefetchFile(name string) ([]string, error) {
+	//nolint:gosec // G304: name is the prefetch file of the directory being pushed
+	f, err := os.Open(name)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("open %s: %w", prefetchFileName, err)
+	}
+	defer f.Close()
+
+	var paths []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		paths = append(paths, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("read %s: %w", prefetchFileName, err)
+	}
+	return paths, nil
+}
+
+// isTarSource reports whether a push source is a tar stream: "-" for stdin,
+// or a .tar, .tar.gz, or .tgz file.
+func isTarSource(source string) bool {
+	return source == "-" ||
+		strings.HasSuffix(source, ".tar") ||
+		strings.HasSuffix(source, ".tar.gz") ||
+		strings.HasSuffix(source, ".tgz")
+}
+
+// pushTarSource pushes a tar stream read from stdin ("-") or a tarball file.
+func pushTarSource(ctx context.Context, client *blobber.Client, ref, source string, opts []blobber.PushOption) (string, error) {
+	if source == "-" {
+		return client.PushTar(ctx, ref, os.Stdin, opts...)
+	}
+
+	f, err := os.Open(source)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", fmt.Errorf("archive not found: %s", source)
+		}
+		return "", fmt.Errorf("cannot open archive: %w", err)
+	}
+	defer f.Close()
+
+	return client.PushTar(ctx, ref, f, opts...)
+}
+
+// sourceDateEpoch returns the timestamp for reproducible pushes from the
+// SOURCE_DATE_EPOCH environment variable, defaulting to the Unix epoch.
+func sourceDateEpoch() (time.Time, error) {
+	value := os.Getenv("SOURCE_DATE_EPOCH")
+	if value == "" {
+		return time.Unix(0, 0), nil
+	}
+	seconds, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid SOURCE_DATE_EPOCH %q: must be Unix seconds", value)
+	}
+	return time.Unix(seconds, 0), nil
+}
+
+// validateDir checks that dir exists and is a directory.
+func validateDir(dir string) error {
+	info, err := os.Stat(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return fmt.Errorf("directory not found: %s", dir)
+		}
+		return fmt.Errorf("cannot access directory: %w", err)
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("not a directory: %s", dir)
+	}
+	return nil
+}
+
+// parsePlatformDirs converts --platform os/arch[/variant]=<directory> values
+// to the per-platform sources of a multi-platform push.
+func parsePlatformDirs(values []string) (map[string]fs.FS, error) {
+	platforms := make(map[string]fs.FS, len(values))
+	for _, v := range values {
+		platform, dir, ok := strings.Cut(v, "=")
+		if !ok || platform == "" || dir == "" {
+			return nil, fmt.Errorf("invalid --platform %q (must be os/arch[/variant]=<directory>)", v)
+		}
+		if _, dup := platforms[platform]; dup {
+			return nil, fmt.Errorf("duplicate --platform %s", platform)
+		}
+		if err := validateDir(dir); err != nil {
+			return nil, err
+		}
+		platforms[platform] = blobber.DirFS(dir)
+	}
+	return platforms, nil
+}
+
 // parseCompression converts the --compression flag value to a Compression.
 func parseCompression(s string) (blobber.Compression, error) {
 	switch strings.ToLower(s) {
@@ -63,6 +63,7 @@ func init() {
 	rootCmd.PersistentFlags().String("progress", "auto", "Progress bar mode: auto, tty, or plain")
 	rootCmd.PersistentFlags().Duration("cache-ttl", 0, "TTL for cache validation (e.g., 5m, 1h)")
 	rootCmd.PersistentFlags().Bool("cache-verify", false, "Re-verify cached blobs on read (slower, defends against cache poisoning)")
+	rootCmd.PersistentFlags().String("platform", "", "Platform to select from multi-platform images (os/arch[/variant], e.g., linux/arm64/v8)")
 
 	// Signing flags
 	rootCmd.PersistentFlags().Bool("sign", false, "Sign artifacts using Sigstore")
@@ -93,6 +94,8 @@ func init() {
 	//nolint:errcheck
 	viper.BindPFlag("cache.verify", rootCmd.PersistentFlags().Lookup("cache-verify"))
 	//nolint:errcheck
+	viper.BindPFlag("platform", rootCmd.PersistentFlags().Lookup("platform"))
+	//nolint:errcheck
 	viper.BindPFlag("sign.enabled", rootCmd.PersistentFlags().Lookup("sign"))
 	//nolint:errcheck
 	viper.BindPFlag("sign.key", rootCmd.PersistentFlags().Lookup("sign-key"))
@@ -171,11 +174,16 @@ func Execute() error {
 }
 
 // newClient creates a blobber client with configured options.
-func newClient() (*blobber.Client, error) {
+// Extra options are applied after the configured ones.
+func newClient(extra ...blobber.ClientOption) (*blobber.Client, error) {
 	opts := []blobber.ClientOption{
 		blobber.WithInsecure(viper.GetBool("insecure")),
 	}
 
+	if platform := viper.GetString("platform"); platform != "" {
+		opts = append(opts, blobber.WithPlatform(platform))
+	}
+
 	if viper.GetBool("verbose") {
 		opts = append(opts, blobber.WithLogger(
 			slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelDebug})),
@@ -233,6 +241,7 @@ func newClient() (*blobber.Client, error) {
 		opts = append(opts, blobber.WithVerifier(verifier))
 	}
 
+	opts = append(opts, extra...)
 	return blobber.NewClient(opts...)
 }
 
@@ -343,6 +352,10 @@ func formatError(err error) string {
 		return "Error: signature verification failed (artifact may be tampered)"
 	case errors.Is(err, blobber.ErrNoSignature):
 		return "Error: no signature found (use --verify with signed artifacts)"
+	case errors.Is(err, blobber.ErrPlatformNotFound):
+		return fmt.Sprintf("Error: platform not available (check --platform): %v", err)
+	case errors.Is(err, blobber.ErrTagConflict):
+		return fmt.Sprintf("Error: tag conflict (the tag was not moved): %v", err)
 	case errors.Is(err, context.Canceled):
 		return "Error: operation canceled"
 	default:
@@ -0,0 +1,130 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"github.com/meigma/blobber"
+	"github.com/meigma/blobber/serve"
+)
+
+// serveShutdownTimeout bounds how long in-flight requests may take to finish
+// after the server is interrupted.
+const serveShutdownTimeout = 10 * time.Second
+
+var serveAddr string
+
+var serveCmd = &cobra.Command{
+	Use:     "serve <reference>",
+	Short:   "Serve an OCI image over HTTP",
+	GroupID: "core",
+	Long: `Serve exposes the contents of an OCI registry image over HTTP, with
+directory listings, Range requests and ETags.
+
+Files are fetched lazily through the blob cache: a request downloads just
+the byte ranges it returns, so static sites and model files can be hosted
+straight from registry artifacts without pulling them first. Each file's
+ETag is its content digest from the eStargz index.
+
+Tags are re-resolved periodically so new pushes are picked up without a
+restart: every --cache-ttl when a TTL is set, otherwise every minute.
+Digest references are never re-resolved. Requests in progress finish on the
+version they started with.
+
+The command runs in the foreground until interrupted (Ctrl-C).
+
+Examples:
+  blobber serve ghcr.io/org/site:latest
+  blobber serve --addr 127.0.0.1:9000 --cache-ttl 5m ghcr.io/org/models:v2`,
+	Args:              cobra.ExactArgs(1),
+	RunE:              runServe,
+	ValidArgsFunction: completeImageRef,
+}
+
+func init() {
+	serveCmd.Flags().StringVar(&serveAddr, "addr", ":8080", "Address to listen on")
+	rootCmd.AddCommand(serveCmd)
+}
+
+func runServe(_ *cobra.Command, args []string) error {
+	ref := args[0]
+
+	// Create client; files are only fetched when requested
+	client, err := newClient(blobber.WithLazyLoading(true))
+	if err != nil {
+		return err
+	}
+
+	// Set up signal handling; cancelling stops the server
+	ctx, cancel := signalContext()
+	defer cancel()
+
+	// Re-resolve tags with the reference index TTL
+	refresh := viper.GetDuration("cache.ttl")
+	if refresh <= 0 {
+		refresh = serve.DefaultRefresh
+	}
+	if strings.Contains(ref, "@") {
+		refresh = 0
+	}
+
+	opts := []serve.Option{serve.WithRefresh(refresh)}
+	if viper.GetBool("verbose") {
+		opts = append(opts, serve.WithLogger(
+			slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelDebug})),
+		))
+	}
+
+	// Open image
+	srv, err := serve.New(ctx, func(ctx context.Context) (serve.Image, error) {
+		img, err := client.OpenImage(ctx, ref)
+		if err != nil {
+			return nil, err
+		}
+		return img, nil
+	}, opts...)
+	if err != nil {
+		return err
+	}
+	defer srv.Close()
+
+	ln, err := net.Listen("tcp", serveAddr)
+	if err != nil {
+		return fmt.Errorf("listen: %w", err)
+	}
+
+	httpSrv := &http.Server{
+		Handler:           srv,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	done := make(chan error, 1)
+	go func() { done <- httpSrv.Serve(ln) }()
+
+	fmt.Fprintf(os.Stderr, "Serving %s on http://%s (press Ctrl-C to stop)\n", ref, ln.Addr())
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+	}
+
+	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), serveShutdownTimeout)
+	defer shutdownCancel()
+	if err := httpSrv.Shutdown(shutdownCtx); err != nil {
+		return fmt.Errorf("shutdown: %w", err)
+	}
+	if err := <-done; !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,101 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/meigma/blobber"
+)
+
+var (
+	syncDryRun  bool
+	syncInclude []string
+	syncExclude []string
+)
+
+var syncCmd = &cobra.Command{
+	Use:     "sync <reference> <directory>",
+	Short:   "Make a local directory mirror an OCI image",
+	GroupID: "core",
+	Long: `Sync makes a local directory mirror an OCI registry image exactly.
+
+Unlike pull, which merges files into the destination, sync also removes local
+files that are not in the image. Local files are compared with the image's
+eStargz index by type, permissions, size and content digest: only changed
+files are downloaded, with range requests where the registry supports them,
+and permission changes are applied in place.
+
+Each change is printed with its kind and path:
+  added     the entry was created
+  removed   the entry was deleted
+  modified  the entry was replaced
+  mode      only the permissions were changed
+
+Use --dry-run to print the planned changes without applying them. Use
+--include and --exclude to synchronize only matching paths; other local files
+are left alone, along with the directories that contain them.
+
+Examples:
+  blobber sync ghcr.io/org/config:v2 ./config
+  blobber sync --dry-run ghcr.io/org/config:v2 ./config
+  blobber sync ghcr.io/org/site:latest ./public --exclude '*.log'`,
+	Args:              cobra.ExactArgs(2),
+	RunE:              runSync,
+	ValidArgsFunction: completePullArgs,
+}
+
+func init() {
+	syncCmd.Flags().BoolVar(&syncDryRun, "dry-run", false, "Print the planned changes without applying them")
+	syncCmd.Flags().StringArrayVar(&syncInclude, "include", nil, "Only sync paths matching the glob pattern (repeatable)")
+	syncCmd.Flags().StringArrayVar(&syncExclude, "exclude", nil, "Skip paths matching the glob pattern (repeatable)")
+	rootCmd.AddCommand(syncCmd)
+}
+
+func runSync(_ *cobra.Command, args []string) error {
+	ref := args[0]
+	destDir := args[1]
+
+	// Create client
+	client, err := newClient()
+	if err != nil {
+		return err
+	}
+
+	// Set up signal handling
+	ctx, cancel := signalContext()
+	defer cancel()
+
+	var opts []blobber.PullOption
+	if len(syncInclude) > 0 {
+		opts = append(opts, blobber.WithInclude(syncInclude...))
+	}
+	if len(syncExclude) > 0 {
+		opts = append(opts, blobber.WithExclude(syncExclude...))
+	}
+
+	var changes []blobber.Change
+	if syncDryRun {
+		changes, err = client.PlanSync(ctx, ref, destDir, opts...)
+	} else {
+		// Set up progress tracking
+		progressCallback, finishProgress := newPullProgress()
+		if progressCallback != nil {
+			opts = append(opts, blobber.WithPullProgress(progressCallback))
+		}
+		changes, err = client.Sync(ctx, ref, destDir, opts...)
+		finishProgress()
+	}
+	if err != nil {
+		return err
+	}
+
+	for _, c := range changes {
+		printChange(os.Stdout, c)
+	}
+	if syncDryRun && len(changes) > 0 {
+		fmt.Fprintf(os.Stderr, "dry run: %d changes not applied\n", len(changes))
+	}
+	return nil
+}
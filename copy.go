@@ -0,0 +1,117 @@
+package blobber
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// Copy copies the image at srcRef to dstRef, registry to registry, without
+// extracting or storing it locally. Both refs must be fully qualified; dstRef
+// may name another repository or registry. Returns the manifest digest, which
+// is the same at both ends.
+//
+// The manifest, config, and layer blobs are transferred as they are. Blobs
+// already present at the destination are skipped, blobs on the same registry
+// are mounted across repositories, and other blobs are streamed from the
+// source. An image index is copied with all its platform manifests.
+//
+// The source is pinned by digest before anything is copied. If a verifier is
+// configured (via WithVerifier), its signature is verified first. With
+// WithReferrers, signatures and other referrers are copied along; with
+// WithResign, the image is signed again at the destination.
+func (c *Client) Copy(ctx context.Context, srcRef, dstRef string, opts ...CopyOption) (string, error) {
+	cfg := &copyConfig{}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	if cfg.resign && c.signer == nil {
+		return "", errors.New("copy: re-signing requires a signer")
+	}
+
+	// Pin the source so that verification and copying see the same image.
+	srcManifest, srcDigest, err := c.registry.FetchManifest(ctx, srcRef)
+	if err != nil {
+		return "", fmt.Errorf("fetch manifest for %s: %w", srcRef, err)
+	}
+	src := digestReference(srcRef, srcDigest)
+
+	if c.verifier != nil {
+		if _, err := c.verifySignature(ctx, src); err != nil {
+			return "", err
+		}
+	}
+
+	manifestDigest, err := c.registry.Copy(ctx, src, dstRef, TagCondition{})
+	if err != nil {
+		return "", fmt.Errorf("copy %s to %s: %w", srcRef, dstRef, err)
+	}
+	c.logger.Debug("copied image", "source", src, "destination", dstRef)
+
+	if !cfg.referrers && !cfg.resign {
+		return manifestDigest, nil
+	}
+
+	// Platform manifests of an index carry their own referrers and signatures.
+	manifests, err := childManifests(srcManifest)
+	if err != nil {
+		return "", fmt.Errorf("parse manifest for %s: %w", srcRef, err)
+	}
+	manifests = append(manifests, manifestDigest)
+
+	if cfg.referrers {
+		for _, d := range manifests {
+			if err := c.copyReferrers(ctx, src, dstRef, d); err != nil {
+				return "", fmt.Errorf("copy referrers of %s: %w", d, err)
+			}
+		}
+	}
+
+	if cfg.resign {
+		created := time.Now().UTC()
+		for _, d := range manifests {
+			if _, err := c.signAndStoreReferrer(ctx, dstRef, d, created); err != nil {
+				return "", fmt.Errorf("sign %s: %w", dstRef, err)
+			}
+		}
+	}
+
+	return manifestDigest, nil
+}
+
+// childManifests returns the digests of the platform manifests listed by an
+// image index, or nothing for an image manifest.
+func childManifests(manifest []byte) ([]string, error) {
+	// Image manifests have no manifests field.
+	var index ocispec.Index
+	if err := json.Unmarshal(manifest, &index); err != nil {
+		return nil, err
+	}
+	digests := make([]string, 0, len(index.Manifests))
+	for _, m := range index.Manifests {
+		digests = append(digests, m.Digest.String())
+	}
+	return digests, nil
+}
+
+// copyReferrers copies the referrers of subjectDigest, and their own
+// referrers, from the repository of src to the repository of dst.
+func (c *Client) copyReferrers(ctx context.Context, src, dst, subjectDigest string) error {
+	referrers, err := c.registry.FetchReferrers(ctx, src, subjectDigest, "")
+	if err != nil {
+		return err
+	}
+	for _, r := range referrers {
+		if _, err := c.registry.Copy(ctx, digestReference(src, r.Digest), digestReference(dst, r.Digest), TagCondition{}); err != nil {
+			return fmt.Errorf("copy %s: %w", r.Digest, err)
+		}
+		if err := c.copyReferrers(ctx, src, dst, r.Digest); err != nil {
+			return err
+		}
+	}
+	return nil
+}
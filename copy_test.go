@@ -0,0 +1,105 @@
+package blobber
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"testing"
+
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/meigma/blobber/core"
+)
+
+func TestCopy(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	manifestDigest := digest.FromString("manifest").String()
+	sigDigest := digest.FromString("signature").String()
+	attestationDigest := digest.FromString("attestation").String()
+	newRegistry := func() *mockPushRegistry {
+		reg := &mockPushRegistry{tagged: []byte(`{"mediaType":"application/vnd.oci.image.manifest.v1+json"}`), taggedDigest: manifestDigest}
+		reg.referrers = map[string][]core.Referrer{
+			manifestDigest: {{Digest: sigDigest, ArtifactType: SignatureArtifactType}},
+			sigDigest:      {{Digest: attestationDigest}},
+		}
+		return reg
+	}
+	source := "ghcr.io/org/staging@" + manifestDigest
+
+	t.Run("image only", func(t *testing.T) {
+		t.Parallel()
+		reg := newRegistry()
+		c := &Client{registry: reg, logger: slog.New(slog.DiscardHandler)}
+		got, err := c.Copy(ctx, "ghcr.io/org/staging:v1", "registry.example.com/org/prod:v1")
+		require.NoError(t, err)
+		assert.Equal(t, manifestDigest, got)
+		assert.Equal(t, []string{source + " -> registry.example.com/org/prod:v1"}, reg.copies)
+		assert.Empty(t, reg.signed)
+	})
+
+	t.Run("with referrers", func(t *testing.T) {
+		t.Parallel()
+		reg := newRegistry()
+		c := &Client{registry: reg, logger: slog.New(slog.DiscardHandler)}
+		_, err := c.Copy(ctx, "ghcr.io/org/staging:v1", "ghcr.io/org/prod:v1", WithReferrers())
+		require.NoError(t, err)
+		assert.Equal(t, []string{
+			source + " -> ghcr.io/org/prod:v1",
+			"ghcr.io/org/staging@" + sigDigest + " -> ghcr.io/org/prod@" + sigDigest,
+			"ghcr.io/org/staging@" + attestationDigest + " -> ghcr.io/org/prod@" + attestationDigest,
+		}, reg.copies)
+	})
+
+	t.Run("resign", func(t *testing.T) {
+		t.Parallel()
+		reg := newRegistry()
+		c := &Client{registry: reg, signer: mockTestSigner{}, logger: slog.New(slog.DiscardHandler)}
+		_, err := c.Copy(ctx, "ghcr.io/org/staging:v1", "ghcr.io/org/prod:v1", WithResign())
+		require.NoError(t, err)
+		assert.Equal(t, []string{manifestDigest}, reg.signed)
+	})
+
+	t.Run("resign without signer", func(t *testing.T) {
+		t.Parallel()
+		reg := newRegistry()
+		c := &Client{registry: reg, logger: slog.New(slog.DiscardHandler)}
+		_, err := c.Copy(ctx, "ghcr.io/org/staging:v1", "ghcr.io/org/prod:v1", WithResign())
+		require.Error(t, err)
+		assert.Empty(t, reg.copies)
+	})
+
+	t.Run("missing source", func(t *testing.T) {
+		t.Parallel()
+		reg := &mockPushRegistry{}
+		c := &Client{registry: reg, logger: slog.New(slog.DiscardHandler)}
+		_, err := c.Copy(ctx, "ghcr.io/org/staging:v1", "ghcr.io/org/prod:v1")
+		require.ErrorIs(t, err, ErrNotFound)
+		assert.Empty(t, reg.copies)
+	})
+}
+
+func TestCopy_IndexResign(t *testing.T) {
+	t.Parallel()
+
+	amd64 := digest.FromString("amd64")
+	arm64 := digest.FromString("arm64")
+	index, err := json.Marshal(ocispec.Index{
+		MediaType: ocispec.MediaTypeImageIndex,
+		Manifests: []ocispec.Descriptor{{Digest: amd64}, {Digest: arm64}},
+	})
+	require.NoError(t, err)
+	indexDigest := digest.FromBytes(index).String()
+
+	reg := &mockPushRegistry{tagged: index, taggedDigest: indexDigest}
+	c := &Client{registry: reg, signer: mockTestSigner{}, logger: slog.New(slog.DiscardHandler)}
+	got, err := c.Copy(context.Background(), "ghcr.io/org/staging:v1", "ghcr.io/org/prod:v1", WithResign())
+	require.NoError(t, err)
+	assert.Equal(t, indexDigest, got)
+	assert.Equal(t, []string{amd64.String(), arm64.String(), indexDigest}, reg.signed,
+		"platform manifests and the index are signed, as PushIndex does")
+}
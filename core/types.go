@@ -43,6 +43,15 @@ var (
 
 	// ErrNoSignature indicates no signature was found when verification was required.
 	ErrNoSignature = errors.New("blobber: no signature found")
+
+	// ErrPlatformNotFound indicates a multi-platform image has no manifest for the requested platform.
+	ErrPlatformNotFound = errors.New("blobber: no manifest for platform")
+
+	// ErrIntegrity indicates content does not match the digest that describes it.
+	ErrIntegrity = errors.New("blobber: integrity check failed")
+
+	// ErrTagConflict indicates a conditional push found the tag in an unexpected state.
+	ErrTagConflict = errors.New("blobber: tag conflict")
 )
 
 // Compression provides compression/decompression for eStargz blobs.
@@ -66,6 +75,21 @@ type BuildResult struct {
 	BlobSize int64
 }
 
+// BuildOptions controls how eStargz blobs are built. A nil *BuildOptions uses the defaults.
+type BuildOptions struct {
+	// SourceDateEpoch makes builds reproducible when set. Entry mtimes are set
+	// to this time, ownership and extended attributes are cleared, and
+	// permissions are normalized to 0644 (0755 for directories and executables). Entries are always written
+	// in lexical order, so identical inputs yield identical blobs.
+	SourceDateEpoch *time.Time
+
+	// PrioritizedFiles lists slash-separated paths, relative to the source
+	// root, that are written first and followed by the eStargz prefetch
+	// landmark. Lazy readers fetch this region up front. Directories include
+	// their whole subtree.
+	PrioritizedFiles []string
+}
+
 // ExtractLimits defines safety limits for extraction.
 type ExtractLimits struct {
 	MaxFiles     int   // Maximum number of files (0 = no limit)
@@ -73,12 +97,77 @@ type ExtractLimits struct {
 	MaxFileSize  int64 // Maximum single file size (0 = no limit)
 }
 
+// ExtractTypes selects the special file types created on extraction.
+// Regular files, directories, symbolic links, and hard links are always
+// extracted. The zero value rejects device and FIFO nodes.
+type ExtractTypes struct {
+	CharDevices  bool // Create character devices
+	BlockDevices bool // Create block devices
+	FIFOs        bool // Create named pipes
+}
+
+// IDMap translates the owners recorded in an archive to owners on the host
+// when extracting. IDs not covered by a mapping are left unchanged.
+type IDMap struct {
+	UIDs []IDMapping
+	GIDs []IDMapping
+}
+
+// IDMapping maps Size consecutive IDs starting at ArchiveID to IDs starting
+// at HostID, like the ranges of /etc/subuid.
+type IDMapping struct {
+	ArchiveID int
+	HostID    int
+	Size      int
+}
+
 // FileEntry represents a file in a remote image.
 // Implements fs.DirEntry for use with Walk.
 type FileEntry struct {
 	FilePath string
 	FileSize int64
 	FileMode fs.FileMode
+	// FileModTime is the modification time recorded in the archive.
+	// Zero if the archive does not record one.
+	FileModTime time.Time
+	// Digest is the content digest of a regular file recorded in the TOC
+	// (sha256:...). Empty for other entry types.
+	Digest string
+	// LinkTarget is the target of a symbolic link, as stored.
+	// Empty for other entry types.
+	LinkTarget string
+
+	// UID and GID are the numeric owner and group recorded in the archive.
+	UID int
+	GID int
+	// Uname and Gname are the owner and group names recorded in the archive.
+	// Empty if the archive does not record them.
+	Uname string
+	Gname string
+	// Xattrs are the extended attributes recorded in the archive, if any.
+	Xattrs map[string][]byte
+	// Chunks is the chunk layout of a regular file in the eStargz blob,
+	// ordered by offset. Empty files and other entry types have no chunks.
+	// Only filled by Image.Stat; List and Walk leave it empty.
+	Chunks []Chunk
+
+	// LayerIndex is the index of the layer the entry comes from, counted from
+	// the bottom layer of the manifest. Always 0 for single-layer images.
+	LayerIndex int
+	// LayerDigest is the digest of the layer the entry comes from (sha256:...).
+	// May be empty if the layer digest is unknown.
+	LayerDigest string
+}
+
+// Chunk is a separately compressed piece of a regular file in an eStargz
+// blob. Lazy readers fetch and verify files one chunk at a time.
+type Chunk struct {
+	// Offset is the offset of the chunk within the file.
+	Offset int64
+	// Size is the uncompressed size of the chunk.
+	Size int64
+	// Digest is the digest of the uncompressed chunk data (sha256:...).
+	Digest string
 }
 
 // Name returns the base name of the file.
@@ -119,6 +208,10 @@ type LayerDescriptor struct {
 	ManifestDigest string
 	// Platform is the target platform in os/arch[/variant] format.
 	Platform string
+	// TOCDigest is the digest of the eStargz TOC JSON, from the layer's
+	// containerd.io/snapshot/stargz/toc.digest annotation. Empty if the
+	// layer is not annotated.
+	TOCDigest string
 }
 
 // Referrer represents an OCI referrer artifact (e.g., signature, attestation).
@@ -144,6 +237,47 @@ type RegistryPushOptions struct {
 	BlobDigest string
 	// BlobSize is the pre-computed size of the compressed blob in bytes (required for streaming push).
 	BlobSize int64
+
+	// Platform is the platform recorded in the image config, in os/arch[/variant] format.
+	// Defaults to the platform of the running process.
+	Platform string
+	// SkipTag pushes the manifest by digest only, leaving the reference's tag untouched.
+	// Used for the platform manifests of an image index.
+	SkipTag bool
+
+	// Created is recorded as the creation time in the image config when set.
+	Created *time.Time
+
+	// BaseRef is an image whose layers are placed below the pushed layer.
+	// Should be pinned by digest. Base layer blobs missing from the target
+	// repository are mounted or copied. The platform defaults to the base image's platform.
+	BaseRef string
+
+	// TagCondition is checked right before the manifest is tagged.
+	// Ignored with SkipTag.
+	TagCondition TagCondition
+}
+
+// TagCondition makes tagging conditional on the current state of the tag.
+// The tag is resolved right before it is moved, and ErrTagConflict is
+// returned if the condition does not hold. The zero value tags
+// unconditionally.
+//
+// Registries cannot update tags atomically, so a concurrent writer may still
+// move the tag between the check and the update.
+type TagCondition struct {
+	// ExpectedDigest requires the tag to point to this manifest digest (sha256:...).
+	ExpectedDigest string
+	// MustNotExist requires the tag to not exist.
+	MustNotExist bool
+}
+
+// IndexManifest describes a platform-specific manifest to include in an image index.
+type IndexManifest struct {
+	// Digest is the manifest digest (sha256:...). The manifest must already exist in the repository.
+	Digest string
+	// Platform is the manifest platform in os/arch[/variant] format.
+	Platform string
 }
 
 // TOC represents the table of contents of an eStargz blob.
@@ -161,6 +295,17 @@ type TOCEntry struct {
 	LinkName   string // Target for symlinks
 	ChunkSize  int64
 	ChunkCount int
+	Digest     string // Content digest for regular files (sha256:...)
+	// ChunkDigest is the digest of the entry's first chunk (sha256:...).
+	// It equals Digest for regular files stored in a single chunk.
+	ChunkDigest string
+
+	ModTime time.Time // Zero if the archive does not record one
+	UID     int
+	GID     int
+	Uname   string
+	Gname   string
+	Xattrs  map[string][]byte
 }
 
 // ToFileEntry converts a TOCEntry to a FileEntry.
@@ -169,13 +314,22 @@ func (e *TOCEntry) ToFileEntry() FileEntry {
 		FilePath: e.Name,
 		FileSize: e.Size,
 		//nolint:gosec // G115: Mode from trusted estargz TOC entry
-		FileMode: fs.FileMode(e.Mode),
+		FileMode:    fs.FileMode(e.Mode),
+		FileModTime: e.ModTime,
+		Digest:      e.Digest,
+		LinkTarget:  e.LinkName,
+		UID:         e.UID,
+		GID:         e.GID,
+		Uname:       e.Uname,
+		Gname:       e.Gname,
+		Xattrs:      e.Xattrs,
 	}
 }
 
 // fileInfo implements fs.FileInfo for FileEntry.
 // It wraps a FileEntry to satisfy the fs.FileInfo interface returned by
 // FileEntry.Info(), enabling FileEntry to fully implement fs.DirEntry.
+// Sys returns the FileEntry.
 type fileInfo struct {
 	entry FileEntry
 }
@@ -183,9 +337,9 @@ type fileInfo struct {
 func (fi fileInfo) Name() string       { return fi.entry.FilePath }
 func (fi fileInfo) Size() int64        { return fi.entry.FileSize }
 func (fi fileInfo) Mode() fs.FileMode  { return fi.entry.FileMode }
-func (fi fileInfo) ModTime() time.Time { return time.Time{} }
+func (fi fileInfo) ModTime() time.Time { return fi.entry.FileModTime }
 func (fi fileInfo) IsDir() bool        { return fi.entry.FileMode.IsDir() }
-func (fi fileInfo) Sys() any           { return nil }
+func (fi fileInfo) Sys() any           { return fi.entry }
 
 // ReferrerPushOptions configures how a referrer artifact is pushed.
 type ReferrerPushOptions struct {
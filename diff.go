@@ -0,0 +1,192 @@
+package blobber
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/fs"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/pmezard/go-difflib/difflib"
+)
+
+// ChangeKind describes how an entry differs between two images.
+type ChangeKind string
+
+// Kinds of changes reported by Diff.
+const (
+	// ChangeAdded marks an entry that only exists in the second image.
+	ChangeAdded ChangeKind = "added"
+
+	// ChangeRemoved marks an entry that only exists in the first image.
+	ChangeRemoved ChangeKind = "removed"
+
+	// ChangeModified marks an entry whose type, content, or link target
+	// differs. Its permissions may have changed as well.
+	ChangeModified ChangeKind = "modified"
+
+	// ChangeModeChanged marks an entry whose permissions differ but whose
+	// content is the same.
+	ChangeModeChanged ChangeKind = "mode"
+)
+
+// Change is a difference between two images, as reported by Diff.
+type Change struct {
+	// Path is the path of the entry within the images.
+	Path string
+	// Kind is the kind of change.
+	Kind ChangeKind
+	// Old is the entry in the first image. Nil for added entries.
+	Old *FileEntry
+	// New is the entry in the second image. Nil for removed entries.
+	New *FileEntry
+}
+
+// maxContentDiffSize is the largest file compared by WriteContentDiff.
+const maxContentDiffSize = 1 << 20
+
+// Diff compares the merged views of two images and returns their
+// differences sorted by path.
+//
+// Only the TOCs are compared, so no file content is downloaded: regular
+// files are compared by the content digest recorded in the TOC (or by size
+// for archives without digests), symbolic links by target, and all entries
+// by type and permissions. Every added or removed entry is reported,
+// including the contents of added or removed directories.
+func Diff(a, b *Image) ([]Change, error) {
+	oldEntries, err := a.List()
+	if err != nil {
+		return nil, fmt.Errorf("list %s: %w", a.ref, err)
+	}
+	newEntries, err := b.List()
+	if err != nil {
+		return nil, fmt.Errorf("list %s: %w", b.ref, err)
+	}
+
+	// Both listings are sorted by path, so merge them.
+	var changes []Change
+	i, j := 0, 0
+	for i < len(oldEntries) || j < len(newEntries) {
+		switch {
+		case j == len(newEntries) || (i < len(oldEntries) && oldEntries[i].FilePath < newEntries[j].FilePath):
+			changes = append(changes, Change{Path: oldEntries[i].FilePath, Kind: ChangeRemoved, Old: &oldEntries[i]})
+			i++
+		case i == len(oldEntries) || newEntries[j].FilePath < oldEntries[i].FilePath:
+			changes = append(changes, Change{Path: newEntries[j].FilePath, Kind: ChangeAdded, New: &newEntries[j]})
+			j++
+		default:
+			if kind, changed := compareEntries(&oldEntries[i], &newEntries[j]); changed {
+				changes = append(changes, Change{Path: oldEntries[i].FilePath, Kind: kind, Old: &oldEntries[i], New: &newEntries[j]})
+			}
+			i++
+			j++
+		}
+	}
+	return changes, nil
+}
+
+// compareEntries compares two entries at the same path.
+func compareEntries(oldEntry, newEntry *FileEntry) (ChangeKind, bool) {
+	if !sameContent(oldEntry, newEntry) {
+		return ChangeModified, true
+	}
+	if oldEntry.FileMode != newEntry.FileMode {
+		return ChangeModeChanged, true
+	}
+	return "", false
+}
+
+// sameContent reports whether two entries have the same type and content.
+func sameContent(oldEntry, newEntry *FileEntry) bool {
+	if oldEntry.Type() != newEntry.Type() {
+		return false
+	}
+	switch {
+	case oldEntry.Type().IsRegular():
+		return oldEntry.FileSize == newEntry.FileSize && oldEntry.Digest == newEntry.Digest
+	case oldEntry.Type()&fs.ModeSymlink != 0:
+		return oldEntry.LinkTarget == newEntry.LinkTarget
+	default:
+		return true
+	}
+}
+
+// WriteContentDiff writes a unified diff of a changed regular file to w.
+// a and b are the images passed to Diff. Added and removed files are
+// compared with an empty file, named /dev/null as in git.
+//
+// Files that are not valid UTF-8 text, or larger than 1 MiB, are reported
+// with a single "Binary files ... differ" line. Changes that do not involve
+// regular file content, such as mode changes, write nothing.
+func WriteContentDiff(w io.Writer, a, b *Image, c Change) error {
+	if c.Kind == ChangeModeChanged || !isRegularOrNil(c.Old) || !isRegularOrNil(c.New) {
+		return nil
+	}
+
+	fromName, toName := "/dev/null", "/dev/null"
+	var oldData, newData []byte
+	oldText, newText := true, true
+	var err error
+	if c.Old != nil {
+		fromName = "a/" + c.Path
+		if oldData, oldText, err = readDiffContent(a, c.Old); err != nil {
+			return err
+		}
+	}
+	if c.New != nil {
+		toName = "b/" + c.Path
+		if newData, newText, err = readDiffContent(b, c.New); err != nil {
+			return err
+		}
+	}
+
+	if !oldText || !newText {
+		_, err = fmt.Fprintf(w, "Binary files %s and %s differ\n", fromName, toName)
+		return err
+	}
+	return difflib.WriteUnifiedDiff(w, difflib.UnifiedDiff{
+		A:        diffLines(oldData),
+		B:        diffLines(newData),
+		FromFile: fromName,
+		ToFile:   toName,
+		Context:  3,
+	})
+}
+
+// diffLines splits text into newline-terminated lines for difflib. A final
+// line without a newline is marked as in git, so that adding or removing the
+// newline shows up as a change.
+func diffLines(data []byte) []string {
+	lines := strings.SplitAfter(string(data), "\n")
+	if last := len(lines) - 1; lines[last] == "" {
+		lines = lines[:last]
+	} else {
+		lines[last] += "\n\\ No newline at end of file\n"
+	}
+	return lines
+}
+
+// isRegularOrNil reports whether e is absent or a regular file.
+func isRegularOrNil(e *FileEntry) bool {
+	return e == nil || e.Type().IsRegular()
+}
+
+// readDiffContent reads a file for WriteContentDiff and reports whether it
+// is text small enough to diff.
+func readDiffContent(img *Image, e *FileEntry) ([]byte, bool, error) {
+	if e.FileSize > maxContentDiffSize {
+		return nil, false, nil
+	}
+	rc, err := img.Open(e.FilePath)
+	if err != nil {
+		return nil, false, err
+	}
+	defer rc.Close()
+
+	data, err := io.ReadAll(rc)
+	if err != nil {
+		return nil, false, fmt.Errorf("read %s: %w", e.FilePath, err)
+	}
+	return data, utf8.Valid(data) && !bytes.Contains(data, []byte{0}), nil
+}
@@ -0,0 +1,133 @@
+package blobber
+
+import (
+	"bytes"
+	"io/fs"
+	"log/slog"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/meigma/blobber/internal/safepath"
+)
+
+// openTestImage builds an eStargz blob from fsys and opens it as an image.
+func openTestImage(t *testing.T, ref string, fsys fstest.MapFS) *Image {
+	t.Helper()
+	data, size := buildTestBlob(t, fsys)
+	img, err := newImageFromBlobWithDigest(ref, bytes.NewReader(data), size, "", safepath.NewValidator(), slog.New(slog.DiscardHandler))
+	require.NoError(t, err)
+	t.Cleanup(func() { img.Close() })
+	return img
+}
+
+func TestDiff(t *testing.T) {
+	t.Parallel()
+
+	oldImg := openTestImage(t, "test:v1", fstest.MapFS{
+		"same.txt":         &fstest.MapFile{Data: []byte("same"), Mode: 0o644},
+		"config.yaml":      &fstest.MapFile{Data: []byte("replicas: 1\nimage: app:v1\n"), Mode: 0o644},
+		"run.sh":           &fstest.MapFile{Data: []byte("#!/bin/sh"), Mode: 0o644},
+		"removed.txt":      &fstest.MapFile{Data: []byte("gone"), Mode: 0o644},
+		"current":          &fstest.MapFile{Data: []byte("v1"), Mode: fs.ModeSymlink | 0o777},
+		"becomes-link":     &fstest.MapFile{Data: []byte("file"), Mode: 0o644},
+		"old/dir/file.txt": &fstest.MapFile{Data: []byte("old"), Mode: 0o644},
+	})
+	newImg := openTestImage(t, "test:v2", fstest.MapFS{
+		"same.txt":     &fstest.MapFile{Data: []byte("same"), Mode: 0o644},
+		"config.yaml":  &fstest.MapFile{Data: []byte("replicas: 3\nimage: app:v1\n"), Mode: 0o644},
+		"run.sh":       &fstest.MapFile{Data: []byte("#!/bin/sh"), Mode: 0o755},
+		"added.txt":    &fstest.MapFile{Data: []byte("new"), Mode: 0o644},
+		"current":      &fstest.MapFile{Data: []byte("v2"), Mode: fs.ModeSymlink | 0o777},
+		"becomes-link": &fstest.MapFile{Data: []byte("same.txt"), Mode: fs.ModeSymlink | 0o777},
+	})
+
+	changes, err := Diff(oldImg, newImg)
+	require.NoError(t, err)
+
+	got := make(map[string]ChangeKind)
+	var paths []string
+	for _, c := range changes {
+		got[c.Path] = c.Kind
+		paths = append(paths, c.Path)
+	}
+	assert.Equal(t, map[string]ChangeKind{
+		"added.txt":        ChangeAdded,
+		"becomes-link":     ChangeModified,
+		"config.yaml":      ChangeModified,
+		"current":          ChangeModified,
+		"old":              ChangeRemoved,
+		"old/dir":          ChangeRemoved,
+		"old/dir/file.txt": ChangeRemoved,
+		"removed.txt":      ChangeRemoved,
+		"run.sh":           ChangeModeChanged,
+	}, got)
+	assert.IsIncreasing(t, paths, "changes should be sorted by path")
+
+	for _, c := range changes {
+		switch c.Kind {
+		case ChangeAdded:
+			assert.Nil(t, c.Old, c.Path)
+			assert.NotNil(t, c.New, c.Path)
+		case ChangeRemoved:
+			assert.NotNil(t, c.Old, c.Path)
+			assert.Nil(t, c.New, c.Path)
+		case ChangeModeChanged:
+			assert.Equal(t, fs.FileMode(0o644), c.Old.Mode())
+			assert.Equal(t, fs.FileMode(0o755), c.New.Mode())
+		}
+	}
+
+	// Comparing an image with itself reports nothing.
+	changes, err = Diff(oldImg, oldImg)
+	require.NoError(t, err)
+	assert.Empty(t, changes)
+}
+
+func TestDiff_Closed(t *testing.T) {
+	t.Parallel()
+
+	a := openTestImage(t, "test:v1", fstest.MapFS{"a.txt": &fstest.MapFile{Data: []byte("a")}})
+	b := openTestImage(t, "test:v2", fstest.MapFS{"a.txt": &fstest.MapFile{Data: []byte("a")}})
+	require.NoError(t, b.Close())
+
+	_, err := Diff(a, b)
+	require.ErrorIs(t, err, ErrClosed)
+}
+
+func TestWriteContentDiff(t *testing.T) {
+	t.Parallel()
+
+	oldImg := openTestImage(t, "test:v1", fstest.MapFS{
+		"config.yaml": &fstest.MapFile{Data: []byte("replicas: 1\nimage: app:v1\n"), Mode: 0o644},
+		"model.bin":   &fstest.MapFile{Data: []byte{0, 1, 2}, Mode: 0o644},
+		"run.sh":      &fstest.MapFile{Data: []byte("#!/bin/sh"), Mode: 0o644},
+		"VERSION":     &fstest.MapFile{Data: []byte("1.0"), Mode: 0o644},
+	})
+	newImg := openTestImage(t, "test:v2", fstest.MapFS{
+		"config.yaml": &fstest.MapFile{Data: []byte("replicas: 3\nimage: app:v1\n"), Mode: 0o644},
+		"model.bin":   &fstest.MapFile{Data: []byte{0, 1, 3}, Mode: 0o644},
+		"run.sh":      &fstest.MapFile{Data: []byte("#!/bin/sh"), Mode: 0o755},
+		"notes.txt":   &fstest.MapFile{Data: []byte("hello\n"), Mode: 0o644},
+		"VERSION":     &fstest.MapFile{Data: []byte("1.1"), Mode: 0o644},
+	})
+
+	changes, err := Diff(oldImg, newImg)
+	require.NoError(t, err)
+
+	diffs := make(map[string]string)
+	for _, c := range changes {
+		var buf strings.Builder
+		require.NoError(t, WriteContentDiff(&buf, oldImg, newImg, c))
+		diffs[c.Path] = buf.String()
+	}
+
+	assert.Equal(t, "--- a/config.yaml\n+++ b/config.yaml\n@@ -1,2 +1,2 @@\n-replicas: 1\n+replicas: 3\n image: app:v1\n", diffs["config.yaml"])
+	assert.Equal(t, "--- /dev/null\n+++ b/notes.txt\n@@ -0,0 +1 @@\n+hello\n", diffs["notes.txt"])
+	assert.Equal(t, "--- a/VERSION\n+++ b/VERSION\n@@ -1 +1 @@\n-1.0\n\\ No newline at end of file\n+1.1\n\\ No newline at end of file\n", diffs["VERSION"])
+	assert.Equal(t, "Binary files a/model.bin and b/model.bin differ\n", diffs["model.bin"])
+	assert.Empty(t, diffs["run.sh"], "mode changes have no content diff")
+}
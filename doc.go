@@ -14,7 +14,7 @@
 //	}
 //
 //	// Push a directory
-//	digest, err := client.Push(ctx, "ghcr.io/org/repo:v1", os.DirFS("./config"))
+//	digest, err := client.Push(ctx, "ghcr.io/org/repo:v1", blobber.DirFS("./config"))
 //
 //	// List files without downloading
 //	entries, err := client.List(ctx, "ghcr.io/org/repo:v1")
@@ -6,3 +6,7 @@ import "github.com/meigma/blobber/core"
 // Implements fs.DirEntry for use with Walk.
 // Re-exported from core package.
 type FileEntry = core.FileEntry
+
+// Chunk is a separately compressed piece of a regular file in an eStargz blob.
+// Re-exported from core package.
+type Chunk = core.Chunk
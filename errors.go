@@ -31,4 +31,13 @@ var (
 
 	// ErrNoSignature indicates no signature was found when verification was required.
 	ErrNoSignature = core.ErrNoSignature
+
+	// ErrPlatformNotFound indicates a multi-platform image has no manifest for the requested platform.
+	ErrPlatformNotFound = core.ErrPlatformNotFound
+
+	// ErrIntegrity indicates content does not match the digest that describes it.
+	ErrIntegrity = core.ErrIntegrity
+
+	// ErrTagConflict indicates a conditional push found the tag in an unexpected state.
+	ErrTagConflict = core.ErrTagConflict
 )
@@ -0,0 +1,220 @@
+package blobber
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"strings"
+
+	"github.com/containerd/stargz-snapshotter/estargz"
+	"github.com/klauspost/compress/zstd"
+
+	"github.com/meigma/blobber/internal/progress"
+)
+
+// ExportFormat selects the archive format written by Image.WriteTar.
+type ExportFormat string
+
+// Supported export formats.
+const (
+	// ExportTar writes an uncompressed tar archive (default).
+	ExportTar ExportFormat = "tar"
+
+	// ExportTarGzip writes a gzip-compressed tar archive.
+	ExportTarGzip ExportFormat = "tar.gz"
+
+	// ExportTarZstd writes a zstd-compressed tar archive.
+	ExportTarZstd ExportFormat = "tar.zst"
+)
+
+// ParseExportFormat parses an export format name.
+// Accepted names are "tar", "tar.gz" (or "tgz", "gzip"), and "tar.zst" (or "zstd").
+func ParseExportFormat(s string) (ExportFormat, error) {
+	switch strings.ToLower(s) {
+	case "tar":
+		return ExportTar, nil
+	case "tar.gz", "tgz", "gzip", "gz":
+		return ExportTarGzip, nil
+	case "tar.zst", "tar.zstd", "zstd", "zst":
+		return ExportTarZstd, nil
+	default:
+		return "", fmt.Errorf("unsupported export format %q (use tar, tar.gz, or tar.zst)", s)
+	}
+}
+
+// ExportFormatFromPath infers the export format from a file name extension.
+// Unknown extensions default to ExportTar.
+func ExportFormatFromPath(name string) ExportFormat {
+	lower := strings.ToLower(name)
+	switch {
+	case strings.HasSuffix(lower, ".tar.gz"), strings.HasSuffix(lower, ".tgz"):
+		return ExportTarGzip
+	case strings.HasSuffix(lower, ".tar.zst"), strings.HasSuffix(lower, ".tar.zstd"), strings.HasSuffix(lower, ".tzst"):
+		return ExportTarZstd
+	default:
+		return ExportTar
+	}
+}
+
+// WriteTar writes the contents of the image to w as a standard tar archive.
+// For multi-layer images, the merged view of all layers is written, so the
+// archive contains no whiteout entries. The eStargz TOC and landmark entries
+// are omitted, and hardlinks are written as regular files.
+//
+// Entries are written in lexical order with their original mode, ownership,
+// modification time, and extended attributes. The output is streamed, so it
+// can be piped directly into tools such as "docker import".
+func (img *Image) WriteTar(w io.Writer, opts ...ExportOption) error {
+	cfg := exportConfig{format: ExportTar}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	return img.writeTar(w, &cfg)
+}
+
+// writeTar writes the entries of the merged view selected by cfg to w.
+func (img *Image) writeTar(w io.Writer, cfg *exportConfig) (err error) {
+	cw, err := newExportWriter(w, cfg.format)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if closeErr := cw.Close(); closeErr != nil && err == nil {
+			err = fmt.Errorf("close %s stream: %w", cfg.format, closeErr)
+		}
+	}()
+
+	tw := tar.NewWriter(cw)
+	var written int64
+	if err := img.Walk(func(p string, _ fs.DirEntry, _ error) error {
+		if !cfg.selects(p) {
+			return nil
+		}
+		var report progress.Callback
+		if cfg.progress != nil {
+			base := written
+			report = func(n, _ int64) { cfg.progress(base + n) }
+		}
+		n, err := img.writeTarEntry(tw, p, report)
+		written += n
+		return err
+	}); err != nil {
+		return err
+	}
+	if err := tw.Close(); err != nil {
+		return fmt.Errorf("close tar: %w", err)
+	}
+	return nil
+}
+
+// selects reports whether the entry at p is written.
+func (cfg *exportConfig) selects(p string) bool {
+	if cfg.paths != nil && !cfg.paths[p] {
+		return false
+	}
+	return cfg.filter.Match(p)
+}
+
+// writeTarEntry writes a single entry of the merged view to tw and returns
+// the number of file bytes written. If report is set, it receives the bytes
+// of the file written so far. It is called from Walk, which holds the read lock.
+func (img *Image) writeTarEntry(tw *tar.Writer, p string, report progress.Callback) (int64, error) {
+	e := img.entries[p]
+
+	header, err := tocEntryToTarHeader(p, e.toc)
+	if err != nil {
+		return 0, err
+	}
+	if err := tw.WriteHeader(header); err != nil {
+		return 0, fmt.Errorf("write header %s: %w", p, err)
+	}
+	if header.Typeflag != tar.TypeReg || header.Size == 0 {
+		return 0, nil
+	}
+
+	sr, err := img.openEntry(e)
+	if err != nil {
+		return 0, fmt.Errorf("open %s: %w", p, err)
+	}
+	var src io.Reader = sr
+	if report != nil {
+		src = progress.NewReader(src, e.toc.Size, report)
+	}
+	n, err := io.Copy(tw, src)
+	if err != nil {
+		return n, fmt.Errorf("write %s: %w", p, err)
+	}
+	return n, nil
+}
+
+// tocEntryToTarHeader converts a TOC entry of the merged view to a tar header named p.
+func tocEntryToTarHeader(p string, e *estargz.TOCEntry) (*tar.Header, error) {
+	header := &tar.Header{
+		Name:     p,
+		Mode:     e.Mode,
+		Uid:      e.UID,
+		Gid:      e.GID,
+		Uname:    e.Uname,
+		Gname:    e.Gname,
+		ModTime:  e.ModTime(),
+		Devmajor: int64(e.DevMajor),
+		Devminor: int64(e.DevMinor),
+		Format:   tar.FormatPAX,
+	}
+	if len(e.Xattrs) > 0 {
+		header.PAXRecords = make(map[string]string, len(e.Xattrs))
+		for k, v := range e.Xattrs {
+			header.PAXRecords["SCHILY.xattr."+k] = string(v)
+		}
+	}
+
+	switch e.Type {
+	case "dir":
+		header.Typeflag = tar.TypeDir
+		header.Name += "/"
+	case "reg":
+		header.Typeflag = tar.TypeReg
+		header.Size = e.Size
+	case "symlink":
+		header.Typeflag = tar.TypeSymlink
+		header.Linkname = e.LinkName
+	case "char":
+		header.Typeflag = tar.TypeChar
+	case "block":
+		header.Typeflag = tar.TypeBlock
+	case "fifo":
+		header.Typeflag = tar.TypeFifo
+	default:
+		return nil, fmt.Errorf("%w: unsupported entry type %q for %s", ErrInvalidArchive, e.Type, p)
+	}
+	return header, nil
+}
+
+// newExportWriter wraps w with the compressor of format.
+// Closing the returned writer flushes the compressor but does not close w.
+func newExportWriter(w io.Writer, format ExportFormat) (io.WriteCloser, error) {
+	switch format {
+	case ExportTar, "":
+		return nopWriteCloser{w}, nil
+	case ExportTarGzip:
+		return gzip.NewWriter(w), nil
+	case ExportTarZstd:
+		zw, err := zstd.NewWriter(w)
+		if err != nil {
+			return nil, fmt.Errorf("create zstd writer: %w", err)
+		}
+		return zw, nil
+	default:
+		return nil, errors.New("unsupported export format: " + string(format))
+	}
+}
+
+// nopWriteCloser adds a no-op Close to an io.Writer.
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error { return nil }
@@ -0,0 +1,134 @@
+package blobber
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"log/slog"
+	"testing"
+	"testing/fstest"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/meigma/blobber/internal/safepath"
+)
+
+// readTarEntries decompresses an exported archive and returns its entries
+// (with contents for regular files) in archive order.
+func readTarEntries(t *testing.T, data []byte, format ExportFormat) (names []string, contents map[string]string) {
+	t.Helper()
+
+	var r io.Reader = bytes.NewReader(data)
+	switch format {
+	case ExportTarGzip:
+		zr, err := gzip.NewReader(r)
+		require.NoError(t, err)
+		defer zr.Close()
+		r = zr
+	case ExportTarZstd:
+		zr, err := zstd.NewReader(r)
+		require.NoError(t, err)
+		defer zr.Close()
+		r = zr
+	}
+
+	contents = make(map[string]string)
+	tr := tar.NewReader(r)
+	for {
+		header, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		require.NoError(t, err)
+		names = append(names, header.Name)
+		if header.Typeflag == tar.TypeReg {
+			content, err := io.ReadAll(tr)
+			require.NoError(t, err)
+			contents[header.Name] = string(content)
+		}
+	}
+	return names, contents
+}
+
+func TestImageWriteTar(t *testing.T) {
+	t.Parallel()
+
+	lowerData, lowerSize := buildTestBlob(t, fstest.MapFS{
+		"keep.txt":              &fstest.MapFile{Data: []byte("keep"), Mode: 0o644},
+		"replace.txt":           &fstest.MapFile{Data: []byte("old"), Mode: 0o644},
+		"removed.txt":           &fstest.MapFile{Data: []byte("removed"), Mode: 0o644},
+		"bin/run.sh":            &fstest.MapFile{Data: []byte("#!/bin/sh"), Mode: 0o755},
+		"empty.txt":             &fstest.MapFile{Mode: 0o644},
+		".no.prefetch.landmark": &fstest.MapFile{Data: []byte{0xf}, Mode: 0o644},
+	})
+	upperData, upperSize := buildLayerBlob(t, fstest.MapFS{
+		"replace.txt":     &fstest.MapFile{Data: []byte("new"), Mode: 0o644},
+		".wh.removed.txt": &fstest.MapFile{Mode: 0o644},
+	})
+
+	lower, err := openBlobLayer(bytes.NewReader(lowerData), lowerSize, "", "")
+	require.NoError(t, err)
+	upper, err := openBlobLayer(bytes.NewReader(upperData), upperSize, "", "")
+	require.NoError(t, err)
+	img := newImageFromLayers("test:latest", []*imageLayer{lower, upper}, safepath.NewValidator(), slog.New(slog.DiscardHandler))
+	t.Cleanup(func() { img.Close() })
+
+	for _, format := range []ExportFormat{ExportTar, ExportTarGzip, ExportTarZstd} {
+		t.Run(string(format), func(t *testing.T) {
+			t.Parallel()
+
+			var buf bytes.Buffer
+			require.NoError(t, img.WriteTar(&buf, WithExportFormat(format)))
+
+			names, contents := readTarEntries(t, buf.Bytes(), format)
+			assert.Equal(t, []string{"bin/", "bin/run.sh", "empty.txt", "keep.txt", "replace.txt"}, names)
+			assert.Equal(t, map[string]string{
+				"bin/run.sh":  "#!/bin/sh",
+				"empty.txt":   "",
+				"keep.txt":    "keep",
+				"replace.txt": "new",
+			}, contents)
+		})
+	}
+}
+
+func TestImageWriteTar_Closed(t *testing.T) {
+	t.Parallel()
+
+	data, size := buildTestBlob(t, fstest.MapFS{
+		"a.txt": &fstest.MapFile{Data: []byte("a"), Mode: 0o644},
+	})
+	img, err := newImageFromBlobWithDigest("test:latest", bytes.NewReader(data), size, "", safepath.NewValidator(), slog.New(slog.DiscardHandler))
+	require.NoError(t, err)
+	require.NoError(t, img.Close())
+
+	err = img.WriteTar(io.Discard)
+	assert.ErrorIs(t, err, ErrClosed)
+}
+
+func TestExportFormatFromPath(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]ExportFormat{
+		"out.tar":      ExportTar,
+		"out.tar.gz":   ExportTarGzip,
+		"OUT.TGZ":      ExportTarGzip,
+		"out.tar.zst":  ExportTarZstd,
+		"out.tzst":     ExportTarZstd,
+		"out":          ExportTar,
+		"dir/out.tar/": ExportTar,
+	}
+	for name, want := range tests {
+		assert.Equal(t, want, ExportFormatFromPath(name), name)
+	}
+
+	_, err := ParseExportFormat("rar")
+	require.Error(t, err)
+	format, err := ParseExportFormat("zstd")
+	require.NoError(t, err)
+	assert.Equal(t, ExportTarZstd, format)
+}
@@ -0,0 +1,302 @@
+package blobber
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"path"
+	"strings"
+	"time"
+)
+
+// maxSymlinks is the number of symbolic links followed while resolving a
+// path before giving up, matching the Linux limit.
+const maxSymlinks = 40
+
+var (
+	errNotDir      = errors.New("not a directory")
+	errIsDir       = errors.New("is a directory")
+	errNotRegular  = errors.New("not a regular file")
+	errNotSymlink  = errors.New("not a symbolic link")
+	errSymlinkLoop = errors.New("too many levels of symbolic links")
+)
+
+// Compile-time interface checks.
+var (
+	_ fs.ReadDirFS  = (*imageFS)(nil)
+	_ fs.ReadFileFS = (*imageFS)(nil)
+	_ fs.StatFS     = (*imageFS)(nil)
+	_ fs.ReadLinkFS = (*imageFS)(nil)
+)
+
+// FS returns a read-only io/fs view of the image, so it can be used with
+// fs.WalkDir, fs.Glob, http.FS, template.ParseFS and similar.
+//
+// The returned FS implements fs.ReadDirFS, fs.ReadFileFS, fs.StatFS and
+// fs.ReadLinkFS. Opened files implement io.ReaderAt and io.Seeker, and file
+// info reports the modification times recorded in the archive. The Sys
+// method of file info returns the entry's FileEntry, which carries the TOC
+// content digest and source layer.
+//
+// Symbolic links are resolved within the image: absolute targets are relative
+// to the image root, and ".." never leaves it. Lstat and ReadLink do not
+// follow a final symbolic link.
+//
+// The view is only usable while the image is open; after Close, its methods
+// return errors wrapping ErrClosed.
+func (img *Image) FS() fs.FS {
+	return &imageFS{img: img}
+}
+
+// imageFS is the io/fs view of an image.
+type imageFS struct {
+	img *Image
+}
+
+// Open implements fs.FS. Symbolic links are followed.
+func (f *imageFS) Open(name string) (fs.File, error) {
+	img := f.img
+	img.mu.RLock()
+	defer img.mu.RUnlock()
+
+	info, err := f.resolve("open", name, true)
+	if err != nil {
+		return nil, err
+	}
+	switch info.entry.toc.Type {
+	case "dir":
+		return &fsDir{info: info, entries: f.dirEntries(info.entry)}, nil
+	case "reg":
+	default:
+		return nil, &fs.PathError{Op: "open", Path: name, Err: errNotRegular}
+	}
+
+	sr, err := img.openEntry(info.entry)
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+	return &fsFile{SectionReader: sr, info: info}, nil
+}
+
+// ReadDir implements fs.ReadDirFS. Entries are sorted by name.
+func (f *imageFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	f.img.mu.RLock()
+	defer f.img.mu.RUnlock()
+
+	info, err := f.resolve("readdir", name, true)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: errNotDir}
+	}
+	return f.dirEntries(info.entry), nil
+}
+
+// ReadFile implements fs.ReadFileFS.
+func (f *imageFS) ReadFile(name string) ([]byte, error) {
+	file, err := f.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	if _, ok := file.(*fsDir); ok {
+		return nil, &fs.PathError{Op: "read", Path: name, Err: errIsDir}
+	}
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	data := make([]byte, info.Size())
+	if _, err := io.ReadFull(file, data); err != nil {
+		return nil, &fs.PathError{Op: "read", Path: name, Err: err}
+	}
+	return data, nil
+}
+
+// Stat implements fs.StatFS. Symbolic links are followed.
+func (f *imageFS) Stat(name string) (fs.FileInfo, error) {
+	f.img.mu.RLock()
+	defer f.img.mu.RUnlock()
+
+	info, err := f.resolve("stat", name, true)
+	if err != nil {
+		return nil, err
+	}
+	return info, nil
+}
+
+// Lstat implements fs.ReadLinkFS. A final symbolic link is not followed.
+func (f *imageFS) Lstat(name string) (fs.FileInfo, error) {
+	f.img.mu.RLock()
+	defer f.img.mu.RUnlock()
+
+	info, err := f.resolve("lstat", name, false)
+	if err != nil {
+		return nil, err
+	}
+	return info, nil
+}
+
+// ReadLink implements fs.ReadLinkFS.
+func (f *imageFS) ReadLink(name string) (string, error) {
+	f.img.mu.RLock()
+	defer f.img.mu.RUnlock()
+
+	info, err := f.resolve("readlink", name, false)
+	if err != nil {
+		return "", err
+	}
+	if info.entry.toc.Type != "symlink" {
+		return "", &fs.PathError{Op: "readlink", Path: name, Err: errNotSymlink}
+	}
+	return info.entry.toc.LinkName, nil
+}
+
+// resolve returns the entry at name, following symbolic links in its
+// directories and, if followLast is set, in its final element.
+// The caller must hold img.mu.
+func (f *imageFS) resolve(op, name string, followLast bool) (*fsInfo, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+	if f.img.closed {
+		return nil, &fs.PathError{Op: op, Path: name, Err: ErrClosed}
+	}
+	e, err := f.lookup(name, followLast)
+	if err != nil {
+		return nil, &fs.PathError{Op: op, Path: name, Err: err}
+	}
+	return &fsInfo{img: f.img, name: path.Base(name), entry: e}, nil
+}
+
+// lookup walks p from the root one element at a time. A symbolic link
+// restarts the walk at its target followed by the remaining elements.
+func (f *imageFS) lookup(p string, followLast bool) (*imageEntry, error) {
+	entries := f.img.entries
+	cur, ok := entries[""]
+	if !ok {
+		return nil, fs.ErrNotExist
+	}
+	rest := p
+	if rest == "." {
+		rest = ""
+	}
+
+	links := 0
+	for rest != "" {
+		var elem string
+		elem, rest, _ = strings.Cut(rest, "/")
+		if cur.toc.Type != "dir" {
+			return nil, errNotDir
+		}
+		next, ok := entries[path.Join(cur.path, elem)]
+		if !ok {
+			return nil, fs.ErrNotExist
+		}
+		if next.toc.Type != "symlink" || (rest == "" && !followLast) {
+			cur = next
+			continue
+		}
+
+		links++
+		if links > maxSymlinks {
+			return nil, errSymlinkLoop
+		}
+		base := cur.path
+		if strings.HasPrefix(next.toc.LinkName, "/") {
+			base = ""
+		}
+		rest = joinInRoot(base, next.toc.LinkName, rest)
+		cur = entries[""]
+	}
+	return cur, nil
+}
+
+// dirEntries returns the children of a directory entry.
+// The caller must hold img.mu.
+func (f *imageFS) dirEntries(dir *imageEntry) []fs.DirEntry {
+	entries := make([]fs.DirEntry, 0, len(dir.children))
+	for _, p := range dir.children {
+		entries = append(entries, &fsInfo{img: f.img, name: path.Base(p), entry: f.img.entries[p]})
+	}
+	return entries
+}
+
+// joinInRoot joins slash-separated paths relative to the image root,
+// resolving "." and ".." lexically without going above the root.
+// It returns "" for the root itself.
+func joinInRoot(elems ...string) string {
+	var parts []string
+	for _, e := range elems {
+		for part := range strings.SplitSeq(e, "/") {
+			switch part {
+			case "", ".":
+			case "..":
+				if len(parts) > 0 {
+					parts = parts[:len(parts)-1]
+				}
+			default:
+				parts = append(parts, part)
+			}
+		}
+	}
+	return strings.Join(parts, "/")
+}
+
+// fsInfo describes an entry of the merged view under the name it was
+// reached by. It implements both fs.FileInfo and fs.DirEntry; Sys returns
+// the entry's FileEntry.
+type fsInfo struct {
+	img   *Image
+	name  string
+	entry *imageEntry
+}
+
+func (i *fsInfo) Name() string               { return i.name }
+func (i *fsInfo) Size() int64                { return i.entry.toc.Size }
+func (i *fsInfo) Mode() fs.FileMode          { return i.entry.toc.Stat().Mode() }
+func (i *fsInfo) ModTime() time.Time         { return i.entry.toc.ModTime() }
+func (i *fsInfo) IsDir() bool                { return i.entry.toc.Type == "dir" }
+func (i *fsInfo) Sys() any                   { return i.img.fileEntry(i.entry) }
+func (i *fsInfo) Type() fs.FileMode          { return i.Mode().Type() }
+func (i *fsInfo) Info() (fs.FileInfo, error) { return i, nil }
+func (i *fsInfo) String() string             { return fs.FormatFileInfo(i) }
+
+// fsFile is an open regular file. Reads go straight to the layer's estargz
+// reader, so closing it is a no-op.
+type fsFile struct {
+	*io.SectionReader
+	info *fsInfo
+}
+
+func (f *fsFile) Stat() (fs.FileInfo, error) { return f.info, nil }
+func (f *fsFile) Close() error               { return nil }
+
+// fsDir is an open directory.
+type fsDir struct {
+	info    *fsInfo
+	entries []fs.DirEntry
+	offset  int
+}
+
+func (d *fsDir) Stat() (fs.FileInfo, error) { return d.info, nil }
+func (d *fsDir) Close() error               { return nil }
+
+func (d *fsDir) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.info.name, Err: errIsDir}
+}
+
+// ReadDir implements fs.ReadDirFile.
+func (d *fsDir) ReadDir(count int) ([]fs.DirEntry, error) {
+	entries := d.entries[d.offset:]
+	if count > 0 {
+		if len(entries) == 0 {
+			return nil, io.EOF
+		}
+		entries = entries[:min(count, len(entries))]
+	}
+	d.offset += len(entries)
+	return entries, nil
+}
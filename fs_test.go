@@ -0,0 +1,184 @@
+package blobber
+
+import (
+	"bytes"
+	"io"
+	"io/fs"
+	"log/slog"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/opencontainers/go-digest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/meigma/blobber/internal/safepath"
+)
+
+func symlinkFile(target string) *fstest.MapFile {
+	return &fstest.MapFile{Data: []byte(target), Mode: fs.ModeSymlink | 0o777}
+}
+
+func TestImageFS(t *testing.T) {
+	t.Parallel()
+
+	mtime := time.Date(2024, 5, 1, 12, 30, 0, 0, time.UTC)
+	data, size := buildTestBlob(t, fstest.MapFS{
+		"config.yaml":        &fstest.MapFile{Data: []byte("key: value"), Mode: 0o644, ModTime: mtime},
+		"data/a.txt":         &fstest.MapFile{Data: []byte("a"), Mode: 0o644, ModTime: mtime},
+		"data/nested/b.txt":  &fstest.MapFile{Data: []byte("b"), Mode: 0o600, ModTime: mtime},
+		"data/link":          symlinkFile("nested/b.txt"),
+		"data/nested/up":     symlinkFile("../a.txt"),
+		"abs":                symlinkFile("/data/nested"),
+		"escape":             symlinkFile("../../../config.yaml"),
+		"bin/tool":           &fstest.MapFile{Data: []byte("#!/bin/sh"), Mode: 0o755, ModTime: mtime},
+		"empty":              &fstest.MapFile{Mode: fs.ModeDir | 0o755, ModTime: mtime},
+		"implicit/dir/c.txt": &fstest.MapFile{Data: []byte("c"), Mode: 0o644, ModTime: mtime},
+	})
+
+	img, err := newImageFromBlobWithDigest("test:latest", bytes.NewReader(data), size, "", safepath.NewValidator(), slog.New(slog.DiscardHandler))
+	require.NoError(t, err)
+	t.Cleanup(func() { img.Close() })
+	fsys := img.FS()
+
+	t.Run("conforms to fs.FS", func(t *testing.T) {
+		t.Parallel()
+
+		// TestFS does not follow directory symlinks, so abs/... is not listed.
+		require.NoError(t, fstest.TestFS(fsys,
+			"config.yaml", "data/a.txt", "data/nested/b.txt", "data/link", "data/nested/up",
+			"abs", "escape", "bin/tool", "empty", "implicit/dir/c.txt",
+		))
+	})
+
+	t.Run("reports archive metadata", func(t *testing.T) {
+		t.Parallel()
+
+		info, err := fs.Stat(fsys, "config.yaml")
+		require.NoError(t, err)
+		assert.Equal(t, "config.yaml", info.Name())
+		assert.Equal(t, int64(10), info.Size())
+		assert.Equal(t, fs.FileMode(0o644), info.Mode())
+		assert.True(t, mtime.Equal(info.ModTime()), "ModTime() = %v, want %v", info.ModTime(), mtime)
+
+		entry, ok := info.Sys().(FileEntry)
+		require.True(t, ok, "Sys() should return a FileEntry")
+		assert.Equal(t, "config.yaml", entry.Path())
+		assert.Equal(t, digest.FromString("key: value").String(), entry.Digest)
+
+		info, err = fs.Stat(fsys, "empty")
+		require.NoError(t, err)
+		assert.True(t, info.IsDir())
+		assert.True(t, mtime.Equal(info.ModTime()), "ModTime() = %v, want %v", info.ModTime(), mtime)
+	})
+
+	t.Run("resolves symlinks within the image", func(t *testing.T) {
+		t.Parallel()
+
+		for name, want := range map[string]string{
+			"data/link":      "b",
+			"data/nested/up": "a",
+			"abs/b.txt":      "b",
+			"abs/up":         "a",
+			"escape":         "key: value",
+		} {
+			got, err := fs.ReadFile(fsys, name)
+			require.NoError(t, err, name)
+			assert.Equal(t, want, string(got), name)
+		}
+
+		info, err := fs.Stat(fsys, "data/link")
+		require.NoError(t, err)
+		assert.Equal(t, "link", info.Name())
+		assert.True(t, info.Mode().IsRegular())
+
+		info, err = fs.Lstat(fsys, "data/link")
+		require.NoError(t, err)
+		assert.Equal(t, fs.ModeSymlink, info.Mode().Type())
+
+		target, err := fs.ReadLink(fsys, "abs")
+		require.NoError(t, err)
+		assert.Equal(t, "/data/nested", target)
+	})
+
+	t.Run("supports random access", func(t *testing.T) {
+		t.Parallel()
+
+		f, err := fsys.Open("config.yaml")
+		require.NoError(t, err)
+		defer f.Close()
+
+		ra, ok := f.(io.ReaderAt)
+		require.True(t, ok, "file should implement io.ReaderAt")
+		buf := make([]byte, 5)
+		_, err = ra.ReadAt(buf, 5)
+		require.NoError(t, err)
+		assert.Equal(t, "value", string(buf))
+
+		seeker, ok := f.(io.Seeker)
+		require.True(t, ok, "file should implement io.Seeker")
+		_, err = seeker.Seek(3, io.SeekStart)
+		require.NoError(t, err)
+		rest, err := io.ReadAll(f)
+		require.NoError(t, err)
+		assert.Equal(t, ": value", string(rest))
+	})
+
+	t.Run("reports errors", func(t *testing.T) {
+		t.Parallel()
+
+		_, err := fsys.Open("missing")
+		require.ErrorIs(t, err, fs.ErrNotExist)
+		_, err = fsys.Open("config.yaml/child")
+		require.ErrorIs(t, err, errNotDir)
+		_, err = fsys.Open("../config.yaml")
+		require.ErrorIs(t, err, fs.ErrInvalid)
+		_, err = fs.ReadLink(fsys, "config.yaml")
+		require.ErrorIs(t, err, errNotSymlink)
+		_, err = fs.ReadFile(fsys, "data")
+		require.ErrorIs(t, err, errIsDir)
+	})
+}
+
+func TestImageFS_SymlinkLoop(t *testing.T) {
+	t.Parallel()
+
+	data, size := buildTestBlob(t, fstest.MapFS{
+		"a":        symlinkFile("b"),
+		"b":        symlinkFile("a"),
+		"dangling": symlinkFile("missing"),
+	})
+
+	img, err := newImageFromBlobWithDigest("test:latest", bytes.NewReader(data), size, "", safepath.NewValidator(), slog.New(slog.DiscardHandler))
+	require.NoError(t, err)
+	defer img.Close()
+	fsys := img.FS()
+
+	_, err = fsys.Open("a")
+	require.ErrorIs(t, err, errSymlinkLoop)
+	_, err = fsys.Open("dangling")
+	require.ErrorIs(t, err, fs.ErrNotExist)
+
+	info, err := fs.Lstat(fsys, "a")
+	require.NoError(t, err)
+	assert.Equal(t, fs.ModeSymlink, info.Mode().Type())
+}
+
+func TestImageFS_Closed(t *testing.T) {
+	t.Parallel()
+
+	data, size := buildTestBlob(t, fstest.MapFS{
+		"test.txt": &fstest.MapFile{Data: []byte("test"), Mode: 0o644},
+	})
+
+	img, err := newImageFromBlobWithDigest("test:latest", bytes.NewReader(data), size, "", safepath.NewValidator(), slog.New(slog.DiscardHandler))
+	require.NoError(t, err)
+	fsys := img.FS()
+	require.NoError(t, img.Close())
+
+	_, err = fsys.Open("test.txt")
+	require.ErrorIs(t, err, ErrClosed)
+	_, err = fs.ReadDir(fsys, ".")
+	require.ErrorIs(t, err, ErrClosed)
+}
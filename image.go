@@ -6,8 +6,11 @@ import (
 	"io"
 	"io/fs"
 	"log/slog"
+	"maps"
 	"os"
+	"path"
 	"sort"
+	"strings"
 	"sync"
 
 	"github.com/containerd/stargz-snapshotter/estargz"
@@ -20,26 +23,75 @@ import (
 // Compile-time interface check.
 var _ io.Closer = (*Image)(nil)
 
+// Whiteout markers used by OCI layers to delete entries from lower layers.
+const (
+	whiteoutPrefix = ".wh."
+	whiteoutOpaque = ".wh..wh..opq"
+)
+
 // Image represents an opened remote image for reading.
-// It caches the eStargz reader for efficient multiple file access.
+// It caches the eStargz readers for efficient multiple file access.
 // Image is safe for concurrent use.
 //
+// Multi-layer images are presented as a merged overlay view: files in later
+// layers replace files in earlier layers, and OCI whiteout entries (".wh.<name>"
+// and ".wh..wh..opq") hide entries from the layers below them.
+//
 // The caller must call Close when done to release resources.
 type Image struct {
 	mu     sync.RWMutex
 	closed bool
 
-	ref        string
+	ref     string
+	layers  []*imageLayer          // layers in manifest order (bottom first)
+	entries map[string]*imageEntry // merged overlay view keyed by path ("" is root)
+
+	validator contracts.PathValidator
+	logger    *slog.Logger
+}
+
+// imageLayer holds the blob and eStargz reader of a single layer.
+type imageLayer struct {
+	digest     string
 	blobFile   *os.File             // temp file with blob data (non-cached path)
 	blobHandle contracts.BlobHandle // cached blob handle (cached path)
 	blobSize   int64                // size of the blob
 	esr        *estargz.Reader      // cached estargz reader
+	verifier   estargz.TOCEntryVerifier
+}
 
-	validator contracts.PathValidator
-	logger    *slog.Logger
+// imageEntry is a node of the merged overlay view.
+type imageEntry struct {
+	path     string
+	toc      *estargz.TOCEntry
+	layer    int      // index into Image.layers
+	children []string // sorted child paths (directories only)
 }
 
 func newImageFromBlobWithDigest(ref string, blob io.Reader, size int64, expectedDigest string, validator contracts.PathValidator, logger *slog.Logger) (*Image, error) {
+	layer, err := openBlobLayer(blob, size, expectedDigest, "")
+	if err != nil {
+		return nil, err
+	}
+	return newImageFromLayers(ref, []*imageLayer{layer}, validator, logger), nil
+}
+
+// newImageFromLayers creates a new Image presenting the merged view of layers.
+// Layers must be ordered bottom layer first. The Image takes ownership of the layers.
+func newImageFromLayers(ref string, layers []*imageLayer, validator contracts.PathValidator, logger *slog.Logger) *Image {
+	return &Image{
+		ref:       ref,
+		layers:    layers,
+		entries:   mergeLayers(layers),
+		validator: validator,
+		logger:    logger,
+	}
+}
+
+// openBlobLayer copies a blob into a temp file and opens it as an eStargz layer.
+// If expectedDigest is set, the blob content is verified against it.
+// If tocDigest is set, the TOC is verified against it.
+func openBlobLayer(blob io.Reader, size int64, expectedDigest, tocDigest string) (*imageLayer, error) {
 	// Create temp file for blob storage
 	f, err := os.CreateTemp("", "blobber-image-*")
 	if err != nil {
@@ -73,7 +125,7 @@ func newImageFromBlobWithDigest(ref string, blob io.Reader, size int64, expected
 		if computed != expectedDigest {
 			f.Close()
 			os.Remove(tmpPath)
-			return nil, fmt.Errorf("blob digest mismatch: expected %s, got %s", expectedDigest, computed)
+			return nil, fmt.Errorf("%w: blob digest mismatch: expected %s, got %s", ErrIntegrity, expectedDigest, computed)
 		}
 	}
 
@@ -85,49 +137,225 @@ func newImageFromBlobWithDigest(ref string, blob io.Reader, size int64, expected
 	}
 
 	// Create estargz reader with zstd support
-	sr := io.NewSectionReader(f, 0, written)
-	esr, err := estargz.Open(sr, estargz.WithDecompressors(&zstdchunked.Decompressor{}))
+	esr, verifier, err := openLayerReader(io.NewSectionReader(f, 0, written), tocDigest)
 	if err != nil {
 		f.Close()
 		os.Remove(tmpPath)
-		return nil, fmt.Errorf("%w: %v", ErrInvalidArchive, err)
+		return nil, err
 	}
 
-	return &Image{
-		ref:       ref,
-		blobFile:  f,
-		blobSize:  written,
-		esr:       esr,
-		validator: validator,
-		logger:    logger,
+	return &imageLayer{
+		digest:   expectedDigest,
+		blobFile: f,
+		blobSize: written,
+		esr:      esr,
+		verifier: verifier,
 	}, nil
 }
 
-// newImageFromHandle creates a new Image from a BlobHandle.
-// Used when opening images from cache, where the blob is already on disk.
-//
-// This is a low-level constructor primarily for cache integration. Most users
-// should use Client.OpenImage instead.
-func newImageFromHandle(ref string, handle contracts.BlobHandle, validator contracts.PathValidator, logger *slog.Logger) (*Image, error) {
+// openHandleLayer opens a BlobHandle as an eStargz layer.
+// If tocDigest is set, the TOC is verified against it.
+// The handle is not closed on error; the caller retains ownership until success.
+func openHandleLayer(handle contracts.BlobHandle, layerDigest, tocDigest string) (*imageLayer, error) {
 	size := handle.Size()
 
 	// Create estargz reader directly from the handle (which implements io.ReaderAt)
-	sr := io.NewSectionReader(handle, 0, size)
-	esr, err := estargz.Open(sr, estargz.WithDecompressors(&zstdchunked.Decompressor{}))
+	esr, verifier, err := openLayerReader(io.NewSectionReader(handle, 0, size), tocDigest)
 	if err != nil {
-		return nil, fmt.Errorf("%w: %v", ErrInvalidArchive, err)
+		return nil, err
 	}
 
-	return &Image{
-		ref:        ref,
+	return &imageLayer{
+		digest:     layerDigest,
 		blobHandle: handle,
 		blobSize:   size,
 		esr:        esr,
-		validator:  validator,
-		logger:     logger,
+		verifier:   verifier,
 	}, nil
 }
 
+// openLayerReader opens an eStargz reader with zstd support and returns the
+// verifier of its chunk digests. Only the footer and TOC are read.
+//
+// If tocDigest is set, typically from the layer's toc.digest annotation, the
+// TOC must match it. Since the TOC records the digest of every chunk, this
+// makes the chunk digests as trustworthy as the manifest.
+func openLayerReader(sr *io.SectionReader, tocDigest string) (*estargz.Reader, estargz.TOCEntryVerifier, error) {
+	esr, err := estargz.Open(sr, estargz.WithDecompressors(&zstdchunked.Decompressor{}))
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: %v", ErrInvalidArchive, err)
+	}
+
+	if tocDigest != "" {
+		if got := esr.TOCDigest().String(); got != tocDigest {
+			return nil, nil, fmt.Errorf("%w: TOC digest mismatch: expected %s, got %s", ErrIntegrity, tocDigest, got)
+		}
+	}
+	// Same as esr.VerifyTOC, with the TOC digest mismatch reported as ErrIntegrity.
+	verifier, err := esr.Verifiers()
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: %v", ErrInvalidArchive, err)
+	}
+	return esr, verifier, nil
+}
+
+// close releases the resources held by the layer.
+func (l *imageLayer) close(logger *slog.Logger) error {
+	// Handle cached path (blobHandle)
+	if l.blobHandle != nil {
+		return l.blobHandle.Close()
+	}
+
+	// Handle non-cached path (blobFile)
+	if l.blobFile != nil {
+		path := l.blobFile.Name()
+		closeErr := l.blobFile.Close()
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			logger.Warn("failed to remove temp file", "path", path, "error", err)
+		}
+		return closeErr
+	}
+
+	return nil
+}
+
+// closeLayers closes all layers, used to clean up after a failed open.
+func closeLayers(layers []*imageLayer, logger *slog.Logger) {
+	for _, l := range layers {
+		if err := l.close(logger); err != nil {
+			logger.Debug("failed to close layer", "digest", l.digest, "error", err)
+		}
+	}
+}
+
+// mergeLayers builds the overlay view of the layers.
+// Later layers replace entries of earlier layers, and whiteouts remove them.
+func mergeLayers(layers []*imageLayer) map[string]*imageEntry {
+	entries := make(map[string]*imageEntry)
+
+	for i, layer := range layers {
+		root, ok := layer.esr.Lookup("")
+		if !ok {
+			continue
+		}
+		lc := collectLayer(i, root)
+
+		// Whiteouts only apply to lower layers, so process them before adding
+		// the entries of this layer.
+		for _, dir := range lc.opaques {
+			removeDescendants(entries, dir)
+		}
+		for _, p := range lc.whiteouts {
+			delete(entries, p)
+			removeDescendants(entries, p)
+		}
+
+		entries[""] = &imageEntry{path: "", toc: root, layer: i}
+		for _, e := range lc.entries {
+			if prev, ok := entries[e.path]; ok && prev.toc.Type == "dir" && e.toc.Type != "dir" {
+				removeDescendants(entries, e.path)
+			}
+			entries[e.path] = e
+		}
+	}
+
+	// Link children to their parents now that the final set of entries is known.
+	for p, e := range entries {
+		if p == "" {
+			continue
+		}
+		parent := path.Dir(p)
+		if parent == "." {
+			parent = ""
+		}
+		if pe, ok := entries[parent]; ok {
+			pe.children = append(pe.children, e.path)
+		}
+	}
+	for _, e := range entries {
+		sort.Strings(e.children)
+	}
+
+	return entries
+}
+
+// layerContents holds the entries and whiteouts found in a single layer.
+type layerContents struct {
+	entries   []*imageEntry
+	whiteouts []string // paths hidden by ".wh.<name>" entries
+	opaques   []string // directories whose lower contents are hidden
+}
+
+// collectLayer walks the TOC of a layer and separates whiteouts from regular entries.
+// Paths are derived from the tree rather than entry names so hardlinks keep their own path.
+func collectLayer(layer int, root *estargz.TOCEntry) layerContents {
+	var lc layerContents
+	var walk func(dir string, e *estargz.TOCEntry)
+	walk = func(dir string, e *estargz.TOCEntry) {
+		e.ForeachChild(func(base string, child *estargz.TOCEntry) bool {
+			childPath := path.Join(dir, base)
+			switch {
+			case isLandmark(childPath):
+				// Landmarks only delimit the prefetch region.
+			case base == whiteoutOpaque:
+				lc.opaques = append(lc.opaques, dir)
+			case strings.HasPrefix(base, whiteoutPrefix):
+				lc.whiteouts = append(lc.whiteouts, path.Join(dir, strings.TrimPrefix(base, whiteoutPrefix)))
+			default:
+				lc.entries = append(lc.entries, &imageEntry{path: childPath, toc: child, layer: layer})
+				if child.Type == "dir" {
+					walk(childPath, child)
+				}
+			}
+			return true
+		})
+	}
+	walk("", root)
+	return lc
+}
+
+// isLandmark reports whether p is an eStargz prefetch landmark entry.
+func isLandmark(p string) bool {
+	return p == estargz.PrefetchLandmark || p == estargz.NoPrefetchLandmark
+}
+
+// removeDescendants deletes all entries below dir. The root dir ("") clears
+// everything except the root itself.
+func removeDescendants(entries map[string]*imageEntry, dir string) {
+	prefix := dir + "/"
+	for p := range entries {
+		if p == "" {
+			continue
+		}
+		if dir == "" || strings.HasPrefix(p, prefix) {
+			delete(entries, p)
+		}
+	}
+}
+
+// tocEntries returns the TOC entries of the merged view keyed by path,
+// used as the base when building a diff layer on top of this image.
+func (img *Image) tocEntries() map[string]TOCEntry {
+	img.mu.RLock()
+	defer img.mu.RUnlock()
+
+	entries := make(map[string]TOCEntry, len(img.entries))
+	for p, e := range img.entries {
+		if p == "" {
+			continue
+		}
+		entries[p] = TOCEntry{
+			Name:     p,
+			Type:     e.toc.Type,
+			Size:     e.toc.Size,
+			Mode:     e.toc.Mode,
+			LinkName: e.toc.LinkName,
+			Digest:   e.toc.Digest,
+		}
+	}
+	return entries
+}
+
 // Close releases resources associated with the image.
 // After Close, all other methods will return an error.
 func (img *Image) Close() error {
@@ -139,25 +367,27 @@ func (img *Image) Close() error {
 	}
 	img.closed = true
 
-	// Handle cached path (blobHandle)
-	if img.blobHandle != nil {
-		return img.blobHandle.Close()
-	}
-
-	// Handle non-cached path (blobFile)
-	if img.blobFile != nil {
-		path := img.blobFile.Name()
-		closeErr := img.blobFile.Close()
-		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
-			img.logger.Warn("failed to remove temp file", "path", path, "error", err)
+	var errs []error
+	for _, l := range img.layers {
+		if err := l.close(img.logger); err != nil {
+			errs = append(errs, err)
 		}
-		return closeErr
 	}
+	return errors.Join(errs...)
+}
 
-	return nil
+// LayerDigests returns the digests of the image layers, bottom layer first.
+// Two opens of a reference returning the same digests present the same files.
+func (img *Image) LayerDigests() []string {
+	digests := make([]string, len(img.layers))
+	for i, l := range img.layers {
+		digests[i] = l.digest
+	}
+	return digests
 }
 
 // List returns the file listing of the image.
+// For multi-layer images, this is the merged view of all layers.
 func (img *Image) List() ([]FileEntry, error) {
 	img.mu.RLock()
 	defer img.mu.RUnlock()
@@ -166,25 +396,13 @@ func (img *Image) List() ([]FileEntry, error) {
 		return nil, ErrClosed
 	}
 
-	var entries []FileEntry
-	root, ok := img.esr.Lookup("")
-	if !ok {
-		return entries, nil
-	}
-
-	var collect func(e *estargz.TOCEntry)
-	collect = func(e *estargz.TOCEntry) {
-		if e.Name != "" {
-			entries = append(entries, tocEntryToFileEntry(e))
-		}
-		if e.Type == "dir" {
-			e.ForeachChild(func(_ string, child *estargz.TOCEntry) bool {
-				collect(child)
-				return true
-			})
+	entries := make([]FileEntry, 0, len(img.entries))
+	for p, e := range img.entries {
+		if p == "" {
+			continue
 		}
+		entries = append(entries, img.fileEntry(e))
 	}
-	collect(root)
 
 	// Sort by path for consistent output
 	sort.Slice(entries, func(i, j int) bool {
@@ -195,7 +413,13 @@ func (img *Image) List() ([]FileEntry, error) {
 }
 
 // Open returns a reader for a specific file within the image.
+// For multi-layer images, the file is read from the topmost layer containing it.
+// The returned reader also implements io.ReaderAt and io.Seeker for random access.
 // The caller is responsible for closing the returned ReadCloser.
+//
+// Each chunk of the file is verified against its digest in the TOC before
+// any of its data is returned, so only the chunks being read are downloaded.
+// Reads of corrupted data fail with ErrIntegrity.
 func (img *Image) Open(path string) (io.ReadCloser, error) {
 	img.mu.RLock()
 	defer img.mu.RUnlock()
@@ -209,27 +433,101 @@ func (img *Image) Open(path string) (io.ReadCloser, error) {
 		return nil, err
 	}
 
-	// Look up file in TOC
-	entry, ok := img.esr.Lookup(path)
+	// Look up file in the merged view
+	entry, ok := img.entries[path]
 	if !ok {
 		return nil, fmt.Errorf("%s: %w", path, ErrNotFound)
 	}
 
-	if entry.Type != "reg" {
+	if entry.toc.Type != "reg" {
 		return nil, fmt.Errorf("%s: not a regular file", path)
 	}
 
-	// Open file from estargz
-	ra, err := img.esr.OpenFile(entry.Name)
+	sr, err := img.openEntry(entry)
 	if err != nil {
 		return nil, fmt.Errorf("open %s: %w", path, err)
 	}
+	return imageFile{sr}, nil
+}
+
+// openEntry opens a regular file entry from its layer's estargz reader.
+// The SectionReader is limited to the file size, provides ReadAt and Seek,
+// and verifies the chunks it reads.
+// The caller must hold img.mu.
+func (img *Image) openEntry(entry *imageEntry) (*io.SectionReader, error) {
+	layer := img.layers[entry.layer]
+	ra, err := layer.esr.OpenFile(entry.toc.Name)
+	if err != nil {
+		return nil, err
+	}
+	vf := &verifiedFile{
+		name:     entry.path,
+		ra:       ra,
+		chunks:   chunkEntries(layer.esr, entry.toc),
+		verifier: layer.verifier,
+	}
+	return io.NewSectionReader(vf, 0, entry.toc.Size), nil
+}
+
+// imageFile is a file opened from an image. Closing it is a no-op because the
+// layer readers are owned by the image.
+type imageFile struct {
+	*io.SectionReader
+}
+
+// Close implements io.Closer.
+func (imageFile) Close() error { return nil }
+
+// Stat returns the metadata of a file, directory, or symbolic link within the
+// image, as recorded in its TOC. Symbolic links are not followed.
+func (img *Image) Stat(path string) (FileEntry, error) {
+	img.mu.RLock()
+	defer img.mu.RUnlock()
+
+	if img.closed {
+		return FileEntry{}, ErrClosed
+	}
+
+	if err := img.validator.ValidatePath(path); err != nil {
+		return FileEntry{}, err
+	}
+
+	entry, ok := img.entries[path]
+	if !ok {
+		return FileEntry{}, fmt.Errorf("%s: %w", path, ErrNotFound)
+	}
+	fe := img.fileEntry(entry)
+	fe.Chunks = img.chunks(entry)
+	return fe, nil
+}
+
+// ReadLink returns the target of a symbolic link within the image.
+// The target is returned as stored and is not resolved.
+func (img *Image) ReadLink(path string) (string, error) {
+	img.mu.RLock()
+	defer img.mu.RUnlock()
+
+	if img.closed {
+		return "", ErrClosed
+	}
+
+	if err := img.validator.ValidatePath(path); err != nil {
+		return "", err
+	}
 
-	// Wrap as ReadCloser (SectionReader is limited to entry.Size)
-	return io.NopCloser(io.NewSectionReader(ra, 0, entry.Size)), nil
+	entry, ok := img.entries[path]
+	if !ok {
+		return "", fmt.Errorf("%s: %w", path, ErrNotFound)
+	}
+	if entry.toc.Type != "symlink" {
+		return "", fmt.Errorf("%s: not a symbolic link", path)
+	}
+	return entry.toc.LinkName, nil
 }
 
 // Walk walks the file tree of the image, calling fn for each file or directory.
+// Entries are visited in lexical order. For multi-layer images, this walks the
+// merged view of all layers.
 // Errors returned by fn control traversal (e.g., fs.SkipDir, fs.SkipAll).
 func (img *Image) Walk(fn fs.WalkDirFunc) error {
 	img.mu.RLock()
@@ -239,7 +537,7 @@ func (img *Image) Walk(fn fs.WalkDirFunc) error {
 		return ErrClosed
 	}
 
-	root, ok := img.esr.Lookup("")
+	root, ok := img.entries[""]
 	if !ok {
 		return nil
 	}
@@ -247,12 +545,11 @@ func (img *Image) Walk(fn fs.WalkDirFunc) error {
 	return img.walkEntry(root, fn)
 }
 
-// walkEntry recursively walks a TOC entry tree.
-func (img *Image) walkEntry(e *estargz.TOCEntry, fn fs.WalkDirFunc) error {
+// walkEntry recursively walks an entry of the merged view.
+func (img *Image) walkEntry(e *imageEntry, fn fs.WalkDirFunc) error {
 	// Skip root entry itself
-	if e.Name != "" {
-		entry := tocEntryToFileEntry(e)
-		if err := fn(e.Name, entry, nil); err != nil {
+	if e.path != "" {
+		if err := fn(e.path, img.fileEntry(e), nil); err != nil {
 			if errors.Is(err, fs.SkipDir) {
 				return nil
 			}
@@ -263,33 +560,68 @@ func (img *Image) walkEntry(e *estargz.TOCEntry, fn fs.WalkDirFunc) error {
 		}
 	}
 
-	if e.Type == "dir" {
-		var walkErr error
-		e.ForeachChild(func(_ string, child *estargz.TOCEntry) bool {
-			if err := img.walkEntry(child, fn); err != nil {
-				if errors.Is(err, fs.SkipAll) {
-					walkErr = fs.SkipAll
-					return false
-				}
-				walkErr = err
-				return false
+	for _, childPath := range e.children {
+		if err := img.walkEntry(img.entries[childPath], fn); err != nil {
+			if errors.Is(err, fs.SkipAll) {
+				return fs.SkipAll
 			}
-			return true
-		})
-		if walkErr != nil {
-			return walkErr
+			return err
 		}
 	}
 
 	return nil
 }
 
+// fileEntry converts an entry of the merged view to a FileEntry.
+func (img *Image) fileEntry(e *imageEntry) FileEntry {
+	entry := tocEntryToFileEntry(e.toc)
+	entry.FilePath = e.path
+	entry.LayerIndex = e.layer
+	entry.LayerDigest = img.layers[e.layer].digest
+	return entry
+}
+
+// chunks returns the chunk layout of a regular file entry.
+func (img *Image) chunks(e *imageEntry) []Chunk {
+	if e.toc.Type != "reg" {
+		return nil
+	}
+	var chunks []Chunk
+	for _, ce := range chunkEntries(img.layers[e.layer].esr, e.toc) {
+		chunks = append(chunks, Chunk{Offset: ce.ChunkOffset, Size: ce.ChunkSize, Digest: ce.ChunkDigest})
+	}
+	return chunks
+}
+
+// chunkEntries returns the TOC entries of the chunks of a regular file,
+// ordered by offset.
+func chunkEntries(esr *estargz.Reader, e *estargz.TOCEntry) []*estargz.TOCEntry {
+	var chunks []*estargz.TOCEntry
+	for off := int64(0); off < e.Size; {
+		ce, ok := esr.ChunkEntryForOffset(e.Name, off)
+		if !ok || ce.ChunkSize <= 0 {
+			break
+		}
+		chunks = append(chunks, ce)
+		off = ce.ChunkOffset + ce.ChunkSize
+	}
+	return chunks
+}
+
 // tocEntryToFileEntry converts an estargz.TOCEntry to a FileEntry.
 func tocEntryToFileEntry(e *estargz.TOCEntry) FileEntry {
 	return FileEntry{
 		FilePath: e.Name,
 		FileSize: e.Size,
-		//nolint:gosec // G115: Mode from trusted estargz TOC entry
-		FileMode: fs.FileMode(e.Mode),
+		// Stat adds the type bits (directory, symlink, ...) to the tar mode.
+		FileMode:    e.Stat().Mode(),
+		FileModTime: e.ModTime(),
+		Digest:      e.Digest,
+		LinkTarget:  e.LinkName,
+		UID:         e.UID,
+		GID:         e.GID,
+		Uname:       e.Uname,
+		Gname:       e.Gname,
+		Xattrs:      maps.Clone(e.Xattrs),
 	}
 }
@@ -1,7 +1,9 @@
 package blobber
 
 import (
+	"archive/tar"
 	"bytes"
+	"compress/gzip"
 	"context"
 	"io"
 	"io/fs"
@@ -9,7 +11,10 @@ import (
 	"sync"
 	"testing"
 	"testing/fstest"
+	"time"
 
+	"github.com/containerd/stargz-snapshotter/estargz"
+	"github.com/opencontainers/go-digest"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
@@ -22,7 +27,7 @@ func buildTestBlob(t *testing.T, fsys fstest.MapFS) (data []byte, size int64) {
 	t.Helper()
 
 	builder := archive.NewBuilder(nil)
-	result, err := builder.Build(context.Background(), fsys, GzipCompression())
+	result, err := builder.Build(context.Background(), fsys, GzipCompression(), nil)
 	require.NoError(t, err, "Build() failed")
 	defer result.Blob.Close()
 
@@ -33,6 +38,25 @@ func buildTestBlob(t *testing.T, fsys fstest.MapFS) (data []byte, size int64) {
 	return data, size
 }
 
+// buildLayerBlob creates an eStargz blob from the given filesystem without the
+// checks of Build, so that it can contain whiteouts.
+func buildLayerBlob(t *testing.T, fsys fstest.MapFS) (data []byte, size int64) {
+	t.Helper()
+
+	var tarBuf bytes.Buffer
+	tw := tar.NewWriter(&tarBuf)
+	require.NoError(t, tw.AddFS(fsys))
+	require.NoError(t, tw.Close())
+
+	var buf bytes.Buffer
+	w := estargz.NewWriterWithCompressor(&buf, GzipCompression())
+	require.NoError(t, w.AppendTar(&tarBuf))
+	_, err := w.Close()
+	require.NoError(t, err)
+
+	return buf.Bytes(), int64(buf.Len())
+}
+
 func TestImageList(t *testing.T) {
 	t.Parallel()
 
@@ -107,6 +131,226 @@ func TestImageOpenNotFound(t *testing.T) {
 	assert.ErrorIs(t, err, ErrNotFound)
 }
 
+func TestImageOpenRandomAccess(t *testing.T) {
+	t.Parallel()
+
+	data, size := buildTestBlob(t, fstest.MapFS{
+		"test.txt": &fstest.MapFile{Data: []byte("0123456789"), Mode: 0o644},
+	})
+
+	img, err := newImageFromBlobWithDigest("test:latest", bytes.NewReader(data), size, "", safepath.NewValidator(), slog.New(slog.DiscardHandler))
+	require.NoError(t, err)
+	defer img.Close()
+
+	rc, err := img.Open("test.txt")
+	require.NoError(t, err)
+	defer rc.Close()
+
+	ra, ok := rc.(io.ReaderAt)
+	require.True(t, ok, "Open() result should implement io.ReaderAt")
+	buf := make([]byte, 3)
+	_, err = ra.ReadAt(buf, 4)
+	require.NoError(t, err)
+	assert.Equal(t, "456", string(buf))
+
+	seeker, ok := rc.(io.Seeker)
+	require.True(t, ok, "Open() result should implement io.Seeker")
+	_, err = seeker.Seek(8, io.SeekStart)
+	require.NoError(t, err)
+	rest, err := io.ReadAll(rc)
+	require.NoError(t, err)
+	assert.Equal(t, "89", string(rest))
+}
+
+// storedGzip is gzip compression without compression, so that test blobs
+// can be corrupted without breaking the gzip stream.
+type storedGzip struct {
+	*estargz.GzipCompressor
+	estargz.GzipDecompressor
+}
+
+func TestImageOpenVerifiesChunks(t *testing.T) {
+	t.Parallel()
+
+	// Spans two 4 MiB chunks.
+	large := bytes.Repeat([]byte("0123456789abcdef"), 5<<20/16)
+	builder := archive.NewBuilder(nil)
+	result, err := builder.Build(context.Background(), fstest.MapFS{
+		"large.bin": &fstest.MapFile{Data: large, Mode: 0o644},
+		"small.txt": &fstest.MapFile{Data: []byte("integrity marker"), Mode: 0o644},
+	}, &storedGzip{estargz.NewGzipCompressorWithLevel(gzip.NoCompression), estargz.GzipDecompressor{}}, nil)
+	require.NoError(t, err)
+	defer result.Blob.Close()
+	data, err := io.ReadAll(result.Blob)
+	require.NoError(t, err)
+
+	open := func(t *testing.T, data []byte, tocDigest string) (*Image, error) {
+		t.Helper()
+		layer, err := openBlobLayer(bytes.NewReader(data), int64(len(data)), "", tocDigest)
+		if err != nil {
+			return nil, err
+		}
+		img := newImageFromLayers("test:latest", []*imageLayer{layer}, safepath.NewValidator(), slog.New(slog.DiscardHandler))
+		t.Cleanup(func() { img.Close() })
+		return img, nil
+	}
+
+	t.Run("intact", func(t *testing.T) {
+		t.Parallel()
+
+		img, err := open(t, data, result.TOCDigest)
+		require.NoError(t, err)
+
+		rc, err := img.Open("large.bin")
+		require.NoError(t, err)
+		got, err := io.ReadAll(rc)
+		require.NoError(t, err)
+		assert.Equal(t, large, got)
+
+		// Reads across the chunk boundary.
+		buf := make([]byte, 32)
+		_, err = rc.(io.ReaderAt).ReadAt(buf, 4<<20-16)
+		require.NoError(t, err)
+		assert.Equal(t, large[4<<20-16:4<<20+16], buf)
+	})
+
+	t.Run("corrupted chunk", func(t *testing.T) {
+		t.Parallel()
+
+		corrupted := bytes.Clone(data)
+		i := bytes.Index(corrupted, []byte("integrity marker"))
+		require.Positive(t, i)
+		corrupted[i] = 'I'
+
+		img, err := open(t, corrupted, result.TOCDigest)
+		require.NoError(t, err, "only the TOC is verified when opening")
+
+		rc, err := img.Open("small.txt")
+		require.NoError(t, err)
+		_, err = io.ReadAll(rc)
+		require.ErrorIs(t, err, ErrIntegrity)
+
+		// Other files are still readable.
+		rc, err = img.Open("large.bin")
+		require.NoError(t, err)
+		got, err := io.ReadAll(rc)
+		require.NoError(t, err)
+		assert.Equal(t, large, got)
+	})
+
+	t.Run("TOC digest mismatch", func(t *testing.T) {
+		t.Parallel()
+
+		_, err := open(t, data, digest.FromString("other").String())
+		require.ErrorIs(t, err, ErrIntegrity)
+	})
+}
+
+func TestImageReadLink(t *testing.T) {
+	t.Parallel()
+
+	data, size := buildTestBlob(t, fstest.MapFS{
+		"dir/target.txt": &fstest.MapFile{Data: []byte("target"), Mode: 0o644},
+		"link":           &fstest.MapFile{Data: []byte("dir/target.txt"), Mode: fs.ModeSymlink | 0o777},
+	})
+
+	img, err := newImageFromBlobWithDigest("test:latest", bytes.NewReader(data), size, "", safepath.NewValidator(), slog.New(slog.DiscardHandler))
+	require.NoError(t, err)
+	defer img.Close()
+
+	target, err := img.ReadLink("link")
+	require.NoError(t, err)
+	assert.Equal(t, "dir/target.txt", target)
+
+	_, err = img.ReadLink("dir/target.txt")
+	require.Error(t, err, "ReadLink() of a regular file should fail")
+
+	_, err = img.ReadLink("missing")
+	require.ErrorIs(t, err, ErrNotFound)
+
+	// Entries carry their file type.
+	types := make(map[string]fs.FileMode)
+	entries, err := img.List()
+	require.NoError(t, err)
+	for _, e := range entries {
+		types[e.Path()] = e.Type()
+	}
+	assert.Equal(t, fs.ModeDir, types["dir"])
+	assert.Equal(t, fs.FileMode(0), types["dir/target.txt"])
+	assert.Equal(t, fs.ModeSymlink, types["link"])
+}
+
+func TestImageStat(t *testing.T) {
+	t.Parallel()
+
+	mtime := time.Date(2024, 5, 1, 12, 30, 0, 0, time.UTC)
+	large := bytes.Repeat([]byte("0123456789abcdef"), 5<<20/16) // spans two 4 MiB chunks
+	owner := &tar.Header{Uid: 1000, Gid: 1001, Uname: "app", Gname: "staff", Xattrs: map[string]string{"user.origin": "ci"}}
+
+	data, size := buildTestBlob(t, fstest.MapFS{
+		"config.yaml": &fstest.MapFile{Data: []byte("key: value"), Mode: 0o640, ModTime: mtime, Sys: owner},
+		"large.bin":   &fstest.MapFile{Data: large, Mode: 0o644},
+		"link":        &fstest.MapFile{Data: []byte("config.yaml"), Mode: fs.ModeSymlink | 0o777},
+	})
+
+	img, err := newImageFromBlobWithDigest("test:latest", bytes.NewReader(data), size, "", safepath.NewValidator(), slog.New(slog.DiscardHandler))
+	require.NoError(t, err)
+	defer img.Close()
+
+	entry, err := img.Stat("config.yaml")
+	require.NoError(t, err)
+	assert.Equal(t, "config.yaml", entry.Path())
+	assert.Equal(t, fs.FileMode(0o640), entry.Mode())
+	assert.True(t, mtime.Equal(entry.FileModTime), "FileModTime = %v, want %v", entry.FileModTime, mtime)
+	assert.Equal(t, 1000, entry.UID)
+	assert.Equal(t, 1001, entry.GID)
+	assert.Equal(t, "app", entry.Uname)
+	assert.Equal(t, "staff", entry.Gname)
+	assert.Equal(t, map[string][]byte{"user.origin": []byte("ci")}, entry.Xattrs)
+	assert.Equal(t, digest.FromString("key: value").String(), entry.Digest)
+	assert.Equal(t, []Chunk{{Offset: 0, Size: 10, Digest: entry.Digest}}, entry.Chunks)
+
+	// Entries own their xattrs.
+	entry.Xattrs["user.origin"] = []byte("changed")
+	entry, err = img.Stat("config.yaml")
+	require.NoError(t, err)
+	assert.Equal(t, map[string][]byte{"user.origin": []byte("ci")}, entry.Xattrs)
+
+	// Listing does not compute chunk layouts.
+	entries, err := img.List()
+	require.NoError(t, err)
+	for _, e := range entries {
+		assert.Empty(t, e.Chunks, "List() chunks of %s", e.Path())
+	}
+
+	info, err := entry.Info()
+	require.NoError(t, err)
+	assert.True(t, mtime.Equal(info.ModTime()), "Info().ModTime() = %v, want %v", info.ModTime(), mtime)
+
+	// Large files are split into chunks covering the whole file.
+	entry, err = img.Stat("large.bin")
+	require.NoError(t, err)
+	assert.Equal(t, digest.FromBytes(large).String(), entry.Digest)
+	require.Len(t, entry.Chunks, 2)
+	var covered int64
+	for _, c := range entry.Chunks {
+		assert.Equal(t, covered, c.Offset)
+		assert.Equal(t, digest.FromBytes(large[c.Offset:c.Offset+c.Size]).String(), c.Digest)
+		covered += c.Size
+	}
+	assert.Equal(t, int64(len(large)), covered)
+
+	// Symlinks are not followed.
+	entry, err = img.Stat("link")
+	require.NoError(t, err)
+	assert.Equal(t, fs.ModeSymlink, entry.Type())
+	assert.Equal(t, "config.yaml", entry.LinkTarget)
+	assert.Empty(t, entry.Chunks)
+
+	_, err = img.Stat("missing")
+	require.ErrorIs(t, err, ErrNotFound)
+}
+
 func TestImageWalk(t *testing.T) {
 	t.Parallel()
 
@@ -274,3 +518,71 @@ func TestImageMultipleOpens(t *testing.T) {
 	assert.Equal(t, "aaa", string(content1), "a.txt content mismatch")
 	assert.Equal(t, "bbb", string(content2), "b.txt content mismatch")
 }
+
+func TestImageMultiLayerOverlay(t *testing.T) {
+	t.Parallel()
+
+	lowerData, lowerSize := buildTestBlob(t, fstest.MapFS{
+		"keep.txt":        &fstest.MapFile{Data: []byte("keep"), Mode: 0o644},
+		"replace.txt":     &fstest.MapFile{Data: []byte("old"), Mode: 0o644},
+		"removed.txt":     &fstest.MapFile{Data: []byte("removed"), Mode: 0o644},
+		"gone/file.txt":   &fstest.MapFile{Data: []byte("gone"), Mode: 0o644},
+		"opaque/old.txt":  &fstest.MapFile{Data: []byte("old"), Mode: 0o644},
+		"opaque/also.txt": &fstest.MapFile{Data: []byte("also"), Mode: 0o644},
+	})
+	upperData, upperSize := buildLayerBlob(t, fstest.MapFS{
+		"replace.txt":         &fstest.MapFile{Data: []byte("new"), Mode: 0o644},
+		".wh.removed.txt":     &fstest.MapFile{Mode: 0o644},
+		".wh.gone":            &fstest.MapFile{Mode: 0o644},
+		"opaque/.wh..wh..opq": &fstest.MapFile{Mode: 0o644},
+		"opaque/new.txt":      &fstest.MapFile{Data: []byte("new"), Mode: 0o644},
+	})
+
+	lowerDigest := digest.FromBytes(lowerData).String()
+	upperDigest := digest.FromBytes(upperData).String()
+	lower, err := openBlobLayer(bytes.NewReader(lowerData), lowerSize, lowerDigest, "")
+	require.NoError(t, err)
+	upper, err := openBlobLayer(bytes.NewReader(upperData), upperSize, upperDigest, "")
+	require.NoError(t, err)
+
+	img := newImageFromLayers("test:latest", []*imageLayer{lower, upper}, safepath.NewValidator(), slog.New(slog.DiscardHandler))
+	defer img.Close()
+
+	entries, err := img.List()
+	require.NoError(t, err)
+
+	layerOf := make(map[string]FileEntry)
+	var paths []string
+	for _, e := range entries {
+		layerOf[e.Path()] = e
+		paths = append(paths, e.Path())
+	}
+	assert.Equal(t, []string{"keep.txt", "opaque", "opaque/new.txt", "replace.txt"}, paths)
+
+	assert.Equal(t, 0, layerOf["keep.txt"].LayerIndex)
+	assert.Equal(t, lowerDigest, layerOf["keep.txt"].LayerDigest)
+	assert.Equal(t, 1, layerOf["replace.txt"].LayerIndex)
+	assert.Equal(t, upperDigest, layerOf["replace.txt"].LayerDigest)
+
+	for path, want := range map[string]string{"keep.txt": "keep", "replace.txt": "new", "opaque/new.txt": "new"} {
+		rc, err := img.Open(path)
+		require.NoError(t, err, "Open(%q)", path)
+		content, err := io.ReadAll(rc)
+		rc.Close()
+		require.NoError(t, err)
+		assert.Equal(t, want, string(content), "content of %q", path)
+	}
+
+	for _, path := range []string{"removed.txt", "gone/file.txt", "opaque/old.txt", ".wh.removed.txt"} {
+		_, err := img.Open(path)
+		assert.ErrorIs(t, err, ErrNotFound, "Open(%q)", path)
+	}
+
+	var walked []string
+	err = img.Walk(func(path string, _ fs.DirEntry, _ error) error {
+		walked = append(walked, path)
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, paths, walked, "Walk should visit the merged view in lexical order")
+}
@@ -10,6 +10,9 @@ import (
 	"io/fs"
 	"log/slog"
 	"os"
+	"path"
+	"strings"
+	"time"
 
 	"github.com/containerd/stargz-snapshotter/estargz"
 	"github.com/opencontainers/go-digest"
@@ -66,7 +69,16 @@ func NewBuilder(logger *slog.Logger) *Builder {
 // The tar data is streamed through a pipe to avoid buffering the uncompressed
 // archive. The compressed output is written to a temporary file while computing
 // the blob digest and size for efficient streaming push.
-func (b *Builder) Build(ctx context.Context, src fs.FS, compression core.Compression) (*core.BuildResult, error) {
+// opts may be nil for the defaults.
+func (b *Builder) Build(ctx context.Context, src fs.FS, compression core.Compression, opts *core.BuildOptions) (*core.BuildResult, error) {
+	return b.build(ctx, compression, func(pw *io.PipeWriter) error {
+		return writeTarToPipe(ctx, pw, src, opts)
+	})
+}
+
+// build creates an eStargz blob from the tar stream produced by writeTar.
+// writeTar runs in its own goroutine and must close the pipe when done.
+func (b *Builder) build(ctx context.Context, compression core.Compression, writeTar func(pw *io.PipeWriter) error) (*core.BuildResult, error) {
 	if err := ctx.Err(); err != nil {
 		return nil, err
 	}
@@ -95,7 +107,7 @@ func (b *Builder) Build(ctx context.Context, src fs.FS, compression core.Compres
 
 	// Goroutine writes tar entries to pipe
 	go func() {
-		tarErr := writeTarToPipe(ctx, pw, src)
+		tarErr := writeTar(pw)
 		errCh <- tarErr
 	}()
 
@@ -104,9 +116,14 @@ func (b *Builder) Build(ctx context.Context, src fs.FS, compression core.Compres
 
 	// Use AppendTarLossLess to preserve exact tar bytes.
 	if err = writer.AppendTarLossLess(pr); err != nil {
-		pr.Close() // Unblock goroutine if it's still writing
-		<-errCh    // Wait for goroutine to finish
+		pr.Close()        // Unblock goroutine if it's still writing
+		tarErr := <-errCh // Wait for goroutine to finish
 		cleanup()
+		// The tar error is the root cause when the producer aborted the stream,
+		// rather than failing because the pipe was closed above.
+		if tarErr != nil && !errors.Is(tarErr, io.ErrClosedPipe) {
+			return nil, fmt.Errorf("create tar: %w", tarErr)
+		}
 		return nil, fmt.Errorf("build estargz: %w", err)
 	}
 
@@ -162,7 +179,7 @@ func (r *tempFileReader) Close() error {
 
 // writeTarToPipe writes tar entries from src to the pipe writer.
 // It closes the pipe when done, propagating any error.
-func writeTarToPipe(ctx context.Context, pw *io.PipeWriter, src fs.FS) error {
+func writeTarToPipe(ctx context.Context, pw *io.PipeWriter, src fs.FS, opts *core.BuildOptions) error {
 	var tarErr error
 	defer func() {
 		if tarErr != nil {
@@ -172,17 +189,17 @@ func writeTarToPipe(ctx context.Context, pw *io.PipeWriter, src fs.FS) error {
 		}
 	}()
 
+	prioritized, tarErr := prioritizedFiles(opts)
+	if tarErr != nil {
+		return tarErr
+	}
+
 	tw := tar.NewWriter(pw)
 	buf := make([]byte, copyBufferSize)
+	links := make(hardlinks)
 
-	tarErr = fs.WalkDir(src, ".", func(path string, d fs.DirEntry, walkErr error) error {
-		if walkErr != nil {
-			return walkErr
-		}
-		if ctx.Err() != nil {
-			return ctx.Err()
-		}
-		return addEntryToTar(ctx, tw, src, path, d, buf)
+	tarErr = writeEntries(ctx, tw, src, prioritized, func(path string, d fs.DirEntry) error {
+		return addEntryToTar(ctx, tw, src, path, d, buf, links, opts)
 	})
 	if tarErr != nil {
 		return tarErr
@@ -205,8 +222,27 @@ type lstatFS interface {
 	Lstat(name string) (fs.FileInfo, error)
 }
 
+// xattrFS is the interface for filesystems that expose extended attributes.
+type xattrFS interface {
+	fs.FS
+	Xattrs(name string) (map[string]string, error)
+}
+
+// inode identifies a file of the source filesystem.
+type inode struct {
+	dev, ino uint64
+}
+
+// hardlinks maps each source file with several links to the path its
+// content was first written at. Later paths are written as hard links to it.
+type hardlinks map[inode]string
+
 // addEntryToTar adds a single filesystem entry to the tar writer.
-func addEntryToTar(ctx context.Context, tw *tar.Writer, src fs.FS, path string, d fs.DirEntry, buf []byte) error {
+func addEntryToTar(ctx context.Context, tw *tar.Writer, src fs.FS, path string, d fs.DirEntry, buf []byte, links hardlinks, opts *core.BuildOptions) error {
+	if err := checkNotWhiteout(path); err != nil {
+		return err
+	}
+
 	// Prefer Lstat when available to avoid following symlinks.
 	if lfs, ok := src.(lstatFS); ok {
 		info, err := lfs.Lstat(path)
@@ -214,14 +250,14 @@ func addEntryToTar(ctx context.Context, tw *tar.Writer, src fs.FS, path string,
 			return fmt.Errorf("lstat %s: %w", path, err)
 		}
 		if info.Mode()&fs.ModeSymlink != 0 {
-			return addSymlinkToTar(tw, src, path, info)
+			return addSymlinkToTar(tw, src, path, info, opts)
 		}
-		return addFileInfoEntry(ctx, tw, src, path, info, buf)
+		return addFileInfoEntry(ctx, tw, src, path, info, buf, links, opts)
 	}
 
 	// Handle symlinks specially to avoid following the link
 	if d.Type()&fs.ModeSymlink != 0 {
-		return addSymlinkToTar(tw, src, path, nil)
+		return addSymlinkToTar(tw, src, path, nil, opts)
 	}
 
 	// For non-symlinks, d.Info() is safe to use
@@ -230,13 +266,22 @@ func addEntryToTar(ctx context.Context, tw *tar.Writer, src fs.FS, path string,
 		return err
 	}
 
-	return addFileInfoEntry(ctx, tw, src, path, info, buf)
+	return addFileInfoEntry(ctx, tw, src, path, info, buf, links, opts)
+}
+
+// checkNotWhiteout rejects entry names that readers would take for OCI
+// whiteouts and hide, even in the bottom layer of an image.
+func checkNotWhiteout(name string) error {
+	if strings.HasPrefix(path.Base(name), whiteoutPrefix) {
+		return fmt.Errorf("%w: %s: names starting with %q are reserved for whiteouts", core.ErrInvalidArchive, name, whiteoutPrefix)
+	}
+	return nil
 }
 
 // addSymlinkToTar adds a symlink entry to the tar writer.
 // It uses Lstat to get the symlink's own metadata (not following the link)
 // and ReadLink to get the target path.
-func addSymlinkToTar(tw *tar.Writer, src fs.FS, path string, info fs.FileInfo) error {
+func addSymlinkToTar(tw *tar.Writer, src fs.FS, path string, info fs.FileInfo, opts *core.BuildOptions) error {
 	if info == nil {
 		var err error
 		// Get symlink metadata without following
@@ -257,23 +302,44 @@ func addSymlinkToTar(tw *tar.Writer, src fs.FS, path string, info fs.FileInfo) e
 		return err
 	}
 	header.Name = path
+	if err := addXattrs(header, src, path); err != nil {
+		return err
+	}
+	normalizeHeader(header, opts)
 
 	return tw.WriteHeader(header)
 }
 
-func addFileInfoEntry(ctx context.Context, tw *tar.Writer, src fs.FS, path string, info fs.FileInfo, buf []byte) error {
+func addFileInfoEntry(ctx context.Context, tw *tar.Writer, src fs.FS, path string, info fs.FileInfo, buf []byte, links hardlinks, opts *core.BuildOptions) error {
 	header, err := tar.FileInfoHeader(info, "")
 	if err != nil {
 		return err
 	}
 	header.Name = path
 
+	// Files with several links are stored once; other names link to the first.
+	if id, ok := fileIdentity(info); ok {
+		if first, seen := links[id]; seen {
+			header.Typeflag = tar.TypeLink
+			header.Linkname = first
+			header.Size = 0
+		} else {
+			links[id] = path
+		}
+	}
+	if header.Typeflag != tar.TypeLink {
+		if err := addXattrs(header, src, path); err != nil {
+			return err
+		}
+	}
+	normalizeHeader(header, opts)
+
 	if err := tw.WriteHeader(header); err != nil {
 		return err
 	}
 
 	// Copy file content for regular files
-	if info.Mode().IsRegular() {
+	if header.Typeflag == tar.TypeReg {
 		if err := copyFileToTar(ctx, src, path, tw, buf); err != nil {
 			return err
 		}
@@ -281,6 +347,63 @@ func addFileInfoEntry(ctx context.Context, tw *tar.Writer, src fs.FS, path strin
 	return nil
 }
 
+// normalizeHeader strips the host-specific metadata of a header for
+// reproducible builds. It is a no-op unless opts sets SourceDateEpoch.
+func normalizeHeader(header *tar.Header, opts *core.BuildOptions) {
+	if opts == nil || opts.SourceDateEpoch == nil {
+		return
+	}
+
+	header.ModTime = opts.SourceDateEpoch.UTC().Truncate(time.Second)
+	header.AccessTime = time.Time{}
+	header.ChangeTime = time.Time{}
+	header.Uid, header.Gid = 0, 0
+	header.Uname, header.Gname = "", ""
+	header.PAXRecords = nil
+	header.Format = tar.FormatUnknown
+
+	switch {
+	case header.Typeflag == tar.TypeSymlink:
+		header.Mode = 0o777
+	case header.Typeflag == tar.TypeDir, header.Mode&0o111 != 0:
+		header.Mode = 0o755
+	default:
+		header.Mode = 0o644
+	}
+}
+
+// addXattrs records the portable extended attributes of a source entry as
+// PAX records. Filesystems without extended attributes add none.
+func addXattrs(header *tar.Header, src fs.FS, path string) error {
+	xfs, ok := src.(xattrFS)
+	if !ok {
+		return nil
+	}
+	xattrs, err := xfs.Xattrs(path)
+	if err != nil {
+		return fmt.Errorf("xattrs %s: %w", path, err)
+	}
+	for name, value := range xattrs {
+		if !portableXattr(name) {
+			continue
+		}
+		if header.PAXRecords == nil {
+			header.PAXRecords = make(map[string]string, len(xattrs))
+		}
+		header.PAXRecords[xattrPAXPrefix+name] = value
+	}
+	return nil
+}
+
+// portableXattr reports whether an extended attribute is recorded when
+// building. Other namespaces, such as security.selinux labels and
+// system.posix_acl_* ACLs, describe the host rather than the file.
+func portableXattr(name string) bool {
+	return strings.HasPrefix(name, "user.") ||
+		strings.HasPrefix(name, "trusted.") ||
+		name == "security.capability"
+}
+
 // lstat returns FileInfo for a path without following symlinks.
 // Returns an error if the filesystem doesn't support Lstat.
 func lstat(src fs.FS, path string) (fs.FileInfo, error) {
@@ -1,9 +1,11 @@
 package archive
 
 import (
+	"archive/tar"
 	"bytes"
 	"compress/gzip"
 	"context"
+	"errors"
 	"io"
 	"io/fs"
 	"os"
@@ -11,6 +13,7 @@ import (
 	"runtime"
 	"testing"
 	"testing/fstest"
+	"time"
 
 	"github.com/klauspost/compress/zstd"
 	"github.com/opencontainers/go-digest"
@@ -18,6 +21,7 @@ import (
 	"github.com/stretchr/testify/require"
 
 	"github.com/meigma/blobber/core"
+	"github.com/meigma/blobber/internal/safepath"
 )
 
 func TestDigestingWriter(t *testing.T) {
@@ -136,7 +140,7 @@ func TestBuild(t *testing.T) {
 			t.Parallel()
 
 			builder := NewBuilder(nil)
-			result, err := builder.Build(context.Background(), tt.fs, tt.compression)
+			result, err := builder.Build(context.Background(), tt.fs, tt.compression, nil)
 
 			if tt.wantErr {
 				assert.Error(t, err)
@@ -179,7 +183,7 @@ func TestBuild_ContextCancellation(t *testing.T) {
 	cancel() // Cancel immediately
 
 	builder := NewBuilder(nil)
-	_, err := builder.Build(ctx, testFS, core.GzipCompression())
+	_, err := builder.Build(ctx, testFS, core.GzipCompression(), nil)
 
 	assert.Error(t, err, "Build() should return error when context is canceled")
 }
@@ -241,7 +245,7 @@ func TestBuild_DiffIDMatchesDecompressedBlob(t *testing.T) {
 			}
 
 			builder := NewBuilder(nil)
-			result, err := builder.Build(context.Background(), testFS, tt.compression)
+			result, err := builder.Build(context.Background(), testFS, tt.compression, nil)
 			require.NoError(t, err)
 			defer result.Blob.Close()
 
@@ -273,7 +277,7 @@ func TestBuild_RoundTrip(t *testing.T) {
 	}
 
 	builder := NewBuilder(nil)
-	result, err := builder.Build(context.Background(), testFS, core.GzipCompression())
+	result, err := builder.Build(context.Background(), testFS, core.GzipCompression(), nil)
 	require.NoError(t, err)
 	defer result.Blob.Close()
 
@@ -312,7 +316,7 @@ func TestBuild_TempFileCleanup(t *testing.T) {
 	}
 
 	builder := NewBuilder(nil)
-	result, err := builder.Build(context.Background(), testFS, core.GzipCompression())
+	result, err := builder.Build(context.Background(), testFS, core.GzipCompression(), nil)
 	require.NoError(t, err)
 
 	// Drain blob before closing - estargz uses io.Pipe internally
@@ -349,7 +353,7 @@ func TestBuild_WithSymlinks(t *testing.T) {
 
 	// Build using OSFS (which supports symlinks)
 	builder := NewBuilder(nil)
-	result, err := builder.Build(context.Background(), OSFS(tmpDir), core.GzipCompression())
+	result, err := builder.Build(context.Background(), OSFS(tmpDir), core.GzipCompression(), nil)
 	require.NoError(t, err)
 	defer result.Blob.Close()
 
@@ -373,6 +377,137 @@ func TestBuild_WithSymlinks(t *testing.T) {
 	assert.True(t, foundSymlink, "symlink entry not found in TOC")
 }
 
+func TestBuild_Hardlinks(t *testing.T) {
+	t.Parallel()
+
+	srcDir := t.TempDir()
+	require.NoError(t, os.Mkdir(filepath.Join(srcDir, "bin"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(srcDir, "bin", "tool"), []byte("#!/bin/sh\n"), 0o755))
+	if err := os.Link(filepath.Join(srcDir, "bin", "tool"), filepath.Join(srcDir, "bin", "tool-alias")); err != nil {
+		t.Skipf("hard links not supported: %v", err)
+	}
+	require.NoError(t, os.WriteFile(filepath.Join(srcDir, "other"), []byte("#!/bin/sh\n"), 0o755))
+
+	result, err := NewBuilder(nil).Build(context.Background(), OSFS(srcDir), core.GzipCompression(), nil)
+	require.NoError(t, err)
+	defer result.Blob.Close()
+	data, err := io.ReadAll(result.Blob)
+	require.NoError(t, err)
+
+	// The second name is stored as a hard link; files with equal content are not.
+	r, err := detectAndDecompress(bytes.NewReader(data))
+	require.NoError(t, err)
+	defer r.Close()
+	types := make(map[string]byte)
+	links := make(map[string]string)
+	tr := tar.NewReader(r)
+	for {
+		h, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		require.NoError(t, err)
+		types[h.Name] = h.Typeflag
+		links[h.Name] = h.Linkname
+	}
+	if runtime.GOOS == "linux" || runtime.GOOS == "darwin" {
+		assert.Equal(t, byte(tar.TypeReg), types["bin/tool"])
+		assert.Equal(t, byte(tar.TypeLink), types["bin/tool-alias"])
+		assert.Equal(t, "bin/tool", links["bin/tool-alias"])
+	}
+	assert.Equal(t, byte(tar.TypeReg), types["other"])
+
+	// Extraction restores the link.
+	destDir := t.TempDir()
+	require.NoError(t, Extract(context.Background(), bytes.NewReader(data), destDir, safepath.NewValidator(), core.ExtractLimits{}))
+	content, err := os.ReadFile(filepath.Join(destDir, "bin", "tool-alias"))
+	require.NoError(t, err)
+	assert.Equal(t, "#!/bin/sh\n", string(content))
+	if types["bin/tool-alias"] == tar.TypeLink {
+		tool, err := os.Stat(filepath.Join(destDir, "bin", "tool"))
+		require.NoError(t, err)
+		alias, err := os.Stat(filepath.Join(destDir, "bin", "tool-alias"))
+		require.NoError(t, err)
+		assert.True(t, os.SameFile(tool, alias))
+	}
+}
+
+func TestBuild_Xattrs(t *testing.T) {
+	t.Parallel()
+
+	srcDir := t.TempDir()
+	requireXattrs(t, srcDir)
+	require.NoError(t, os.WriteFile(filepath.Join(srcDir, "model.bin"), []byte("weights"), 0o644))
+	require.NoError(t, lsetxattr(filepath.Join(srcDir, "model.bin"), "user.checksum", "abc123"))
+
+	result, err := NewBuilder(nil).Build(context.Background(), OSFS(srcDir), core.GzipCompression(), nil)
+	require.NoError(t, err)
+	defer result.Blob.Close()
+	data, err := io.ReadAll(result.Blob)
+	require.NoError(t, err)
+
+	// The attribute is recorded in the TOC.
+	toc, err := NewReader().ReadTOC(bytes.NewReader(data), int64(len(data)))
+	require.NoError(t, err)
+	var xattrs map[string][]byte
+	for _, e := range toc.Entries {
+		if e.Name == "model.bin" {
+			xattrs = e.Xattrs
+		}
+	}
+	assert.Equal(t, map[string][]byte{"user.checksum": []byte("abc123")}, xattrs)
+
+	// And restored on extraction.
+	destDir := t.TempDir()
+	extractor := NewLayerExtractor(destDir, safepath.NewValidator(), core.ExtractLimits{}, WithPreserve(Preserve{Xattrs: true}))
+	require.NoError(t, extractor.Extract(context.Background(), bytes.NewReader(data)))
+	got, err := lgetxattrs(filepath.Join(destDir, "model.bin"))
+	require.NoError(t, err)
+	assert.Equal(t, "abc123", got["user.checksum"])
+}
+
+// xattrMapFS is a MapFS that reports the same extended attributes for every file.
+type xattrMapFS struct {
+	fstest.MapFS
+	xattrs map[string]string
+}
+
+func (f xattrMapFS) Xattrs(string) (map[string]string, error) { return f.xattrs, nil }
+
+func TestBuild_PortableXattrsOnly(t *testing.T) {
+	t.Parallel()
+
+	src := xattrMapFS{
+		MapFS: fstest.MapFS{"tool": &fstest.MapFile{Data: []byte("#!/bin/sh"), Mode: 0o755}},
+		xattrs: map[string]string{
+			"user.origin":             "ci",
+			"trusted.overlay":         "y",
+			"security.capability":     "caps",
+			"security.selinux":        "system_u:object_r:bin_t:s0",
+			"system.posix_acl_access": "acl",
+		},
+	}
+	result, err := NewBuilder(nil).Build(context.Background(), src, core.GzipCompression(), nil)
+	require.NoError(t, err)
+	defer result.Blob.Close()
+	data, err := io.ReadAll(result.Blob)
+	require.NoError(t, err)
+
+	toc, err := NewReader().ReadTOC(bytes.NewReader(data), int64(len(data)))
+	require.NoError(t, err)
+	var xattrs map[string][]byte
+	for _, e := range toc.Entries {
+		if e.Name == "tool" {
+			xattrs = e.Xattrs
+		}
+	}
+	assert.Equal(t, map[string][]byte{
+		"user.origin":         []byte("ci"),
+		"trusted.overlay":     []byte("y"),
+		"security.capability": []byte("caps"),
+	}, xattrs)
+}
+
 func TestBuild_SymlinkWithoutLstatFS(t *testing.T) {
 	t.Parallel()
 
@@ -386,7 +521,7 @@ func TestBuild_SymlinkWithoutLstatFS(t *testing.T) {
 	}
 
 	builder := NewBuilder(nil)
-	result, err := builder.Build(context.Background(), testFS, core.GzipCompression())
+	result, err := builder.Build(context.Background(), testFS, core.GzipCompression(), nil)
 
 	if err == nil {
 		// Drain blob to avoid goroutine leak
@@ -398,6 +533,24 @@ func TestBuild_SymlinkWithoutLstatFS(t *testing.T) {
 	assert.Error(t, err, "Build() should return error for symlink without Lstat support")
 }
 
+func TestBuild_RejectsWhiteouts(t *testing.T) {
+	t.Parallel()
+
+	// Readers would hide these entries, even in a single-layer image.
+	for _, name := range []string{".wh.file", "dir/.wh.file", "dir/.wh..wh..opq", ".wh.dir/file"} {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			testFS := fstest.MapFS{
+				"keep.txt": &fstest.MapFile{Data: []byte("keep"), Mode: 0o644},
+				name:       &fstest.MapFile{Data: []byte("data"), Mode: 0o644},
+			}
+			_, err := NewBuilder(nil).Build(context.Background(), testFS, core.GzipCompression(), nil)
+			require.ErrorIs(t, err, core.ErrInvalidArchive)
+		})
+	}
+}
+
 // noSymlinkSupportFS wraps an fs.FS but doesn't expose Lstat/ReadLink.
 type noSymlinkSupportFS struct {
 	inner fs.FS
@@ -419,7 +572,7 @@ func TestBuild_EmptyFile(t *testing.T) {
 	}
 
 	builder := NewBuilder(nil)
-	result, err := builder.Build(context.Background(), testFS, core.GzipCompression())
+	result, err := builder.Build(context.Background(), testFS, core.GzipCompression(), nil)
 	require.NoError(t, err)
 	defer result.Blob.Close()
 
@@ -452,7 +605,7 @@ func TestBuild_SpecialCharacters(t *testing.T) {
 	}
 
 	builder := NewBuilder(nil)
-	result, err := builder.Build(context.Background(), testFS, core.GzipCompression())
+	result, err := builder.Build(context.Background(), testFS, core.GzipCompression(), nil)
 	require.NoError(t, err)
 	defer result.Blob.Close()
 
@@ -498,7 +651,7 @@ func TestBuild_DeeplyNested(t *testing.T) {
 	}
 
 	builder := NewBuilder(nil)
-	result, err := builder.Build(context.Background(), testFS, core.GzipCompression())
+	result, err := builder.Build(context.Background(), testFS, core.GzipCompression(), nil)
 	require.NoError(t, err)
 	defer result.Blob.Close()
 
@@ -518,3 +671,58 @@ func TestBuild_DeeplyNested(t *testing.T) {
 	}
 	assert.True(t, found, "a/b/c/d/e/f/g/h/deep.txt not found in TOC")
 }
+
+func TestBuild_Reproducible(t *testing.T) {
+	t.Parallel()
+
+	// buildDir writes the same files with the given mtime and builds them.
+	buildDir := func(t *testing.T, mtime time.Time, opts *core.BuildOptions) *core.BuildResult {
+		t.Helper()
+		dir := t.TempDir()
+		require.NoError(t, os.MkdirAll(filepath.Join(dir, "bin"), 0o700))
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "config.yaml"), []byte("key: value\n"), 0o600))
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "bin", "run"), []byte("#!/bin/sh\n"), 0o700))
+		if runtime.GOOS != osWindows {
+			require.NoError(t, os.Symlink("config.yaml", filepath.Join(dir, "current")))
+		}
+		for _, p := range []string{"config.yaml", "bin/run", "bin", "."} {
+			require.NoError(t, os.Chtimes(filepath.Join(dir, p), mtime, mtime))
+		}
+
+		result, err := NewBuilder(nil).Build(context.Background(), OSFS(dir), core.GzipCompression(), opts)
+		require.NoError(t, err)
+		t.Cleanup(func() { result.Blob.Close() })
+		return result
+	}
+
+	epoch := time.Unix(1700000000, 0)
+	opts := &core.BuildOptions{SourceDateEpoch: &epoch}
+
+	first := buildDir(t, time.Unix(1000, 0), opts)
+	second := buildDir(t, time.Unix(2000, 0), opts)
+	assert.Equal(t, first.BlobDigest, second.BlobDigest)
+	assert.Equal(t, first.TOCDigest, second.TOCDigest)
+	assert.Equal(t, first.DiffID, second.DiffID)
+
+	// Without normalization, differing mtimes change the blob.
+	plain1 := buildDir(t, time.Unix(1000, 0), nil)
+	plain2 := buildDir(t, time.Unix(2000, 0), nil)
+	assert.NotEqual(t, plain1.BlobDigest, plain2.BlobDigest)
+
+	// Permissions are normalized and mtimes pinned.
+	data, err := io.ReadAll(first.Blob)
+	require.NoError(t, err)
+	toc, err := NewReader().ReadTOC(bytes.NewReader(data), int64(len(data)))
+	require.NoError(t, err)
+	modes := make(map[string]int64)
+	for _, e := range toc.Entries {
+		modes[e.Name] = e.Mode
+	}
+	assert.Equal(t, int64(0o644), modes["config.yaml"])
+	assert.Equal(t, int64(0o755), modes["bin"])
+	if runtime.GOOS != osWindows {
+		// Windows has no executable bit, and creating symlinks needs privileges.
+		assert.Equal(t, int64(0o755), modes["bin/run"])
+		assert.Equal(t, int64(0o777), modes["current"])
+	}
+}
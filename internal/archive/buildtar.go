@@ -0,0 +1,149 @@
+package archive
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+
+	"github.com/meigma/blobber/core"
+	"github.com/meigma/blobber/internal/contracts"
+)
+
+// tarRoot is the virtual extraction root used to validate symlink targets
+// of tar streams, which have no destination directory when pushed.
+var tarRoot = filepath.Join(string(filepath.Separator), "blobber-tar")
+
+// gzipMagic is the header of a gzip stream.
+var gzipMagic = []byte{0x1f, 0x8b}
+
+// BuildTar creates an eStargz blob from an existing tar stream.
+// Gzip-compressed streams are detected and decompressed automatically.
+//
+// Every entry is checked with validator as it would be on extraction:
+// paths must not escape the archive root, symlink targets must stay within
+// it, and hard links must refer to a regular file earlier in the stream.
+// Device and FIFO nodes are accepted; extraction only creates them when
+// allowed. Other entry types are rejected.
+// Invalid streams fail with ErrInvalidArchive, unsafe paths with ErrPathTraversal.
+// opts may be nil for the defaults.
+func (b *Builder) BuildTar(ctx context.Context, r io.Reader, validator contracts.PathValidator, compression core.Compression, opts *core.BuildOptions) (*core.BuildResult, error) {
+	src, err := decompressTar(r)
+	if err != nil {
+		return nil, err
+	}
+	if closer, ok := src.(io.Closer); ok {
+		defer closer.Close()
+	}
+
+	return b.build(ctx, compression, func(pw *io.PipeWriter) error {
+		return copyTarToPipe(ctx, pw, src, validator, opts)
+	})
+}
+
+// decompressTar returns a reader of the uncompressed tar stream in r.
+func decompressTar(r io.Reader) (io.Reader, error) {
+	br := bufio.NewReader(r)
+	magic, err := br.Peek(len(gzipMagic))
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("read tar stream: %w", err)
+	}
+	if !bytes.Equal(magic, gzipMagic) {
+		return br, nil
+	}
+
+	zr, err := gzip.NewReader(br)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", core.ErrInvalidArchive, err)
+	}
+	return zr, nil
+}
+
+// copyTarToPipe validates the entries of a tar stream and rewrites them to the pipe writer.
+// It closes the pipe when done, propagating any error.
+func copyTarToPipe(ctx context.Context, pw *io.PipeWriter, r io.Reader, validator contracts.PathValidator, opts *core.BuildOptions) error {
+	var tarErr error
+	defer func() {
+		if tarErr != nil {
+			pw.CloseWithError(tarErr)
+		} else {
+			pw.Close()
+		}
+	}()
+
+	tr := tar.NewReader(r)
+	tw := tar.NewWriter(pw)
+	buf := make([]byte, copyBufferSize)
+	files := make(map[string]bool) // regular files so far, for hard link targets
+
+	for {
+		if tarErr = ctx.Err(); tarErr != nil {
+			return tarErr
+		}
+
+		header, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			tarErr = fmt.Errorf("%w: %v", core.ErrInvalidArchive, err)
+			return tarErr
+		}
+
+		if tarErr = validateTarEntry(header, validator, files); tarErr != nil {
+			return tarErr
+		}
+		if header.Typeflag == tar.TypeReg || header.Typeflag == tar.TypeLink {
+			files[cleanEntryName(header.Name)] = true
+		}
+		normalizeHeader(header, opts)
+
+		if tarErr = tw.WriteHeader(header); tarErr != nil {
+			return tarErr
+		}
+		if header.Typeflag == tar.TypeReg {
+			if tarErr = copyWithContext(ctx, tw, tr, buf); tarErr != nil {
+				return tarErr
+			}
+		}
+	}
+
+	tarErr = tw.Close()
+	return tarErr
+}
+
+// validateTarEntry checks that an entry of a pushed tar stream is safe to extract.
+// files holds the regular files seen so far.
+func validateTarEntry(header *tar.Header, validator contracts.PathValidator, files map[string]bool) error {
+	if err := validator.ValidatePath(header.Name); err != nil {
+		return fmt.Errorf("%s: %w", header.Name, err)
+	}
+	if err := checkNotWhiteout(header.Name); err != nil {
+		return err
+	}
+
+	switch header.Typeflag {
+	case tar.TypeReg, tar.TypeDir, tar.TypeChar, tar.TypeBlock, tar.TypeFifo:
+		return nil
+	case tar.TypeLink:
+		if err := validator.ValidatePath(header.Linkname); err != nil {
+			return fmt.Errorf("%s => %s: %w", header.Name, header.Linkname, err)
+		}
+		if !files[cleanEntryName(header.Linkname)] {
+			return fmt.Errorf("%w: hard link %s: target %s is not an earlier regular file", core.ErrInvalidArchive, header.Name, header.Linkname)
+		}
+		return nil
+	case tar.TypeSymlink:
+		if err := validator.ValidateSymlink(tarRoot, header.Name, header.Linkname); err != nil {
+			return fmt.Errorf("%s -> %s: %w", header.Name, header.Linkname, err)
+		}
+		return nil
+	default:
+		return fmt.Errorf("%w: unsupported entry type %q for %s", core.ErrInvalidArchive, header.Typeflag, header.Name)
+	}
+}
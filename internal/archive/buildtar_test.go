@@ -0,0 +1,124 @@
+package archive
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/meigma/blobber/core"
+	"github.com/meigma/blobber/internal/safepath"
+)
+
+// makeTar writes the given headers (with content for regular files) as a tar stream.
+func makeTar(t *testing.T, headers []*tar.Header, contents map[string]string) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, h := range headers {
+		data := contents[h.Name]
+		if h.Typeflag == tar.TypeReg {
+			h.Size = int64(len(data))
+		}
+		require.NoError(t, tw.WriteHeader(h))
+		if data != "" {
+			_, err := tw.Write([]byte(data))
+			require.NoError(t, err)
+		}
+	}
+	require.NoError(t, tw.Close())
+	return buf.Bytes()
+}
+
+func TestBuildTar(t *testing.T) {
+	t.Parallel()
+
+	// Layout as produced by "tar c -C dir ."
+	stream := makeTar(t, []*tar.Header{
+		{Typeflag: tar.TypeDir, Name: "./", Mode: 0o755},
+		{Typeflag: tar.TypeReg, Name: "./config.yaml", Mode: 0o644},
+		{Typeflag: tar.TypeDir, Name: "./bin/", Mode: 0o755},
+		{Typeflag: tar.TypeReg, Name: "./bin/run", Mode: 0o755},
+		{Typeflag: tar.TypeSymlink, Name: "./current", Linkname: "bin/run", Mode: 0o777},
+		{Typeflag: tar.TypeLink, Name: "./bin/start", Linkname: "./bin/run", Mode: 0o755},
+		{Typeflag: tar.TypeFifo, Name: "./pipe", Mode: 0o600},
+	}, map[string]string{
+		"./config.yaml": "key: value\n",
+		"./bin/run":     "#!/bin/sh\n",
+	})
+
+	var gzipped bytes.Buffer
+	zw := gzip.NewWriter(&gzipped)
+	_, err := zw.Write(stream)
+	require.NoError(t, err)
+	require.NoError(t, zw.Close())
+
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"plain", stream},
+		{"gzip", gzipped.Bytes()},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			entries := buildTOC(t, func() (*core.BuildResult, error) {
+				return NewBuilder(nil).BuildTar(context.Background(), bytes.NewReader(tt.data), safepath.NewValidator(), core.GzipCompression(), nil)
+			})
+
+			require.Contains(t, entries, "config.yaml")
+			assert.Equal(t, int64(len("key: value\n")), entries["config.yaml"].Size)
+			require.Contains(t, entries, "bin/run")
+			assert.Equal(t, "reg", entries["bin/run"].Type)
+			require.Contains(t, entries, "current")
+			assert.Equal(t, "symlink", entries["current"].Type)
+			assert.Equal(t, "bin/run", entries["current"].LinkName)
+			require.Contains(t, entries, "pipe")
+			assert.Equal(t, "fifo", entries["pipe"].Type)
+		})
+	}
+}
+
+func TestBuildTar_Rejects(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		header  *tar.Header
+		wantErr error
+	}{
+		{"absolute path", &tar.Header{Typeflag: tar.TypeReg, Name: "/etc/passwd", Mode: 0o644}, core.ErrPathTraversal},
+		{"traversal", &tar.Header{Typeflag: tar.TypeReg, Name: "../escape", Mode: 0o644}, core.ErrPathTraversal},
+		{"absolute symlink", &tar.Header{Typeflag: tar.TypeSymlink, Name: "link", Linkname: "/etc/passwd"}, core.ErrPathTraversal},
+		{"escaping symlink", &tar.Header{Typeflag: tar.TypeSymlink, Name: "dir/link", Linkname: "../../outside"}, core.ErrPathTraversal},
+		{"hardlink to missing file", &tar.Header{Typeflag: tar.TypeLink, Name: "hard", Linkname: "file"}, core.ErrInvalidArchive},
+		{"escaping hardlink", &tar.Header{Typeflag: tar.TypeLink, Name: "hard", Linkname: "../file"}, core.ErrPathTraversal},
+		{"whiteout", &tar.Header{Typeflag: tar.TypeReg, Name: "dir/.wh.file", Mode: 0o644}, core.ErrInvalidArchive},
+		{"opaque whiteout", &tar.Header{Typeflag: tar.TypeReg, Name: ".wh..wh..opq", Mode: 0o644}, core.ErrInvalidArchive},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			stream := makeTar(t, []*tar.Header{tt.header}, nil)
+			_, err := NewBuilder(nil).BuildTar(context.Background(), bytes.NewReader(stream), safepath.NewValidator(), core.GzipCompression(), nil)
+			require.ErrorIs(t, err, tt.wantErr)
+		})
+	}
+}
+
+func TestBuildTar_InvalidStream(t *testing.T) {
+	t.Parallel()
+
+	_, err := NewBuilder(nil).BuildTar(context.Background(), bytes.NewReader([]byte("not a tar stream, just some text that is long enough")), safepath.NewValidator(), core.GzipCompression(), nil)
+	require.ErrorIs(t, err, core.ErrInvalidArchive)
+}
@@ -0,0 +1,294 @@
+package archive
+
+import (
+	"archive/tar"
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"slices"
+
+	"github.com/opencontainers/go-digest"
+
+	"github.com/meigma/blobber/core"
+)
+
+// BuildDiff creates an eStargz blob to be layered on top of base.
+// The blob holds the entries of src that are new or differ from base (with
+// their parent directories), plus OCI whiteouts for entries of base that no
+// longer exist in src. base is keyed by path without a leading slash.
+//
+// Entries are compared by type, mode, and link target; regular files of the
+// same size are also compared by content digest. Unchanged files are only
+// read when their size matches, so src is scanned once before building.
+// opts must match the options the base was built with for modes to compare equal.
+func (b *Builder) BuildDiff(ctx context.Context, src fs.FS, base map[string]core.TOCEntry, compression core.Compression, opts *core.BuildOptions) (*core.BuildResult, error) {
+	plan, err := planDiff(ctx, src, base, opts)
+	if err != nil {
+		return nil, fmt.Errorf("compare with base: %w", err)
+	}
+	b.logger.Debug("computed layer diff", "changed", plan.changed, "removed", plan.removed)
+
+	return b.build(ctx, compression, func(pw *io.PipeWriter) error {
+		return writeDiffTarToPipe(ctx, pw, src, plan, opts)
+	})
+}
+
+// Unchanged reports whether src holds the same entries as base: no entry of
+// src is new or differs from base, and no entry of base is missing from src.
+// Entries are compared as in BuildDiff.
+func Unchanged(ctx context.Context, src fs.FS, base map[string]core.TOCEntry, opts *core.BuildOptions) (bool, error) {
+	plan, err := planDiff(ctx, src, base, opts)
+	if err != nil {
+		return false, err
+	}
+	return plan.changed == 0 && plan.removed == 0, nil
+}
+
+// diffPlan lists the entries written to a diff layer.
+type diffPlan struct {
+	include   map[string]bool     // src paths to write: changed entries and their parent directories
+	whiteouts map[string][]string // base entry names removed from each directory ("" is the root)
+	changed   int
+	removed   int
+}
+
+// addChanged marks name and its parent directories for writing.
+func (p *diffPlan) addChanged(name string) {
+	p.include[name] = true
+	p.includeParents(name)
+	p.changed++
+}
+
+// addWhiteout records the removal of a base entry.
+func (p *diffPlan) addWhiteout(name string) {
+	dir := tocParent(name)
+	p.whiteouts[dir] = append(p.whiteouts[dir], path.Base(name))
+	p.includeParents(name)
+	p.removed++
+}
+
+// includeParents marks the parent directories of name for writing.
+// A marked directory always has its own parents marked, so the walk stops there.
+func (p *diffPlan) includeParents(name string) {
+	for dir := tocParent(name); dir != "" && !p.include[dir]; dir = tocParent(dir) {
+		p.include[dir] = true
+	}
+}
+
+// tocParent returns the parent directory of a slash-separated TOC path ("" for the root).
+func tocParent(name string) string {
+	dir := path.Dir(name)
+	if dir == "." {
+		return ""
+	}
+	return dir
+}
+
+// planDiff compares src against base and returns the entries of the diff layer.
+func planDiff(ctx context.Context, src fs.FS, base map[string]core.TOCEntry, opts *core.BuildOptions) (*diffPlan, error) {
+	plan := &diffPlan{
+		include:   make(map[string]bool),
+		whiteouts: make(map[string][]string),
+	}
+	seen := make(map[string]bool)
+	dirs := map[string]bool{"": true}
+	buf := make([]byte, copyBufferSize)
+
+	err := fs.WalkDir(src, ".", func(name string, d fs.DirEntry, walkErr error) error {
+		if walkErr != nil {
+			return walkErr
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if name == "." {
+			return nil
+		}
+		seen[name] = true
+		if d.IsDir() {
+			dirs[name] = true
+		}
+
+		changed, err := entryChanged(ctx, src, name, d, base, buf, opts)
+		if err != nil {
+			return err
+		}
+		if changed {
+			plan.addChanged(name)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Only the top-most removed entry needs a whiteout. Entries below a
+	// directory that became a file are already hidden by the replacement.
+	for name := range base {
+		if name == "" || seen[name] || !dirs[tocParent(name)] {
+			continue
+		}
+		plan.addWhiteout(name)
+	}
+	for _, names := range plan.whiteouts {
+		slices.Sort(names)
+	}
+
+	return plan, nil
+}
+
+// entryChanged reports whether the src entry differs from its base entry.
+func entryChanged(ctx context.Context, src fs.FS, name string, d fs.DirEntry, base map[string]core.TOCEntry, buf []byte, opts *core.BuildOptions) (bool, error) {
+	prev, ok := base[name]
+	if !ok {
+		return true, nil
+	}
+
+	header, err := entryHeader(src, name, d)
+	if err != nil {
+		return false, err
+	}
+	normalizeHeader(header, opts)
+	if tocType(header.Typeflag) != prev.Type || header.Mode != prev.Mode || header.Linkname != prev.LinkName {
+		return true, nil
+	}
+	if header.Typeflag != tar.TypeReg {
+		return false, nil
+	}
+	if header.Size != prev.Size || prev.Digest == "" {
+		return true, nil
+	}
+
+	dgst, err := fileDigest(ctx, src, name, buf)
+	if err != nil {
+		return false, err
+	}
+	return dgst.String() != prev.Digest, nil
+}
+
+// entryHeader returns the tar header that would be written for a src entry.
+// It mirrors addEntryToTar: symlinks are never followed.
+func entryHeader(src fs.FS, name string, d fs.DirEntry) (*tar.Header, error) {
+	var info fs.FileInfo
+	var err error
+	if _, ok := src.(lstatFS); ok || d.Type()&fs.ModeSymlink != 0 {
+		info, err = lstat(src, name)
+	} else {
+		info, err = d.Info()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("lstat %s: %w", name, err)
+	}
+
+	var target string
+	if info.Mode()&fs.ModeSymlink != 0 {
+		if target, err = readLink(src, name); err != nil {
+			return nil, err
+		}
+	}
+
+	header, err := tar.FileInfoHeader(info, target)
+	if err != nil {
+		return nil, err
+	}
+	header.Name = name
+	return header, nil
+}
+
+// tocType returns the eStargz TOC type of a tar type flag.
+func tocType(typeflag byte) string {
+	switch typeflag {
+	case tar.TypeReg:
+		return "reg"
+	case tar.TypeDir:
+		return "dir"
+	case tar.TypeSymlink:
+		return "symlink"
+	case tar.TypeLink:
+		return "hardlink"
+	case tar.TypeChar:
+		return "char"
+	case tar.TypeBlock:
+		return "block"
+	case tar.TypeFifo:
+		return "fifo"
+	default:
+		return ""
+	}
+}
+
+// fileDigest computes the SHA256 digest of a file's content.
+func fileDigest(ctx context.Context, src fs.FS, name string, buf []byte) (digest.Digest, error) {
+	f, err := src.Open(name)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	digester := digest.SHA256.Digester()
+	if err := copyWithContext(ctx, digester.Hash(), f, buf); err != nil {
+		return "", fmt.Errorf("read %s: %w", name, err)
+	}
+	return digester.Digest(), nil
+}
+
+// writeDiffTarToPipe writes the entries of a diff plan to the pipe writer.
+// It closes the pipe when done, propagating any error.
+func writeDiffTarToPipe(ctx context.Context, pw *io.PipeWriter, src fs.FS, plan *diffPlan, opts *core.BuildOptions) error {
+	var tarErr error
+	defer func() {
+		if tarErr != nil {
+			pw.CloseWithError(tarErr)
+		} else {
+			pw.Close()
+		}
+	}()
+
+	prioritized, tarErr := prioritizedFiles(opts)
+	if tarErr != nil {
+		return tarErr
+	}
+
+	tw := tar.NewWriter(pw)
+	buf := make([]byte, copyBufferSize)
+	links := make(hardlinks)
+
+	tarErr = writeEntries(ctx, tw, src, prioritized, func(name string, d fs.DirEntry) error {
+		if name == "." {
+			return addWhiteoutsToTar(tw, "", plan.whiteouts[""])
+		}
+		if !plan.include[name] {
+			// Nothing below an unmarked directory is part of the diff.
+			if d.IsDir() {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		if err := addEntryToTar(ctx, tw, src, name, d, buf, links, opts); err != nil {
+			return err
+		}
+		return addWhiteoutsToTar(tw, name, plan.whiteouts[name])
+	})
+	if tarErr != nil {
+		return tarErr
+	}
+
+	tarErr = tw.Close()
+	return tarErr
+}
+
+// addWhiteoutsToTar writes OCI whiteout markers hiding names in dir.
+func addWhiteoutsToTar(tw *tar.Writer, dir string, names []string) error {
+	for _, name := range names {
+		if err := tw.WriteHeader(&tar.Header{
+			Typeflag: tar.TypeReg,
+			Name:     path.Join(dir, whiteoutPrefix+name),
+			Mode:     0o644,
+		}); err != nil {
+			return fmt.Errorf("write whiteout %s: %w", path.Join(dir, name), err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,111 @@
+package archive
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/meigma/blobber/core"
+)
+
+// buildTOC builds src with build and returns its TOC entries keyed by name.
+func buildTOC(t *testing.T, build func() (*core.BuildResult, error)) map[string]core.TOCEntry {
+	t.Helper()
+
+	result, err := build()
+	require.NoError(t, err)
+	defer result.Blob.Close()
+
+	data, err := io.ReadAll(result.Blob)
+	require.NoError(t, err)
+
+	toc, err := NewReader().ReadTOC(bytes.NewReader(data), int64(len(data)))
+	require.NoError(t, err)
+
+	entries := make(map[string]core.TOCEntry, len(toc.Entries))
+	for _, e := range toc.Entries {
+		entries[e.Name] = e
+	}
+	return entries
+}
+
+func TestBuildDiff(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	builder := NewBuilder(nil)
+
+	baseFS := fstest.MapFS{
+		"unchanged.txt":      &fstest.MapFile{Data: []byte("same"), Mode: 0o644},
+		"modified.txt":       &fstest.MapFile{Data: []byte("old!"), Mode: 0o644},
+		"resized.txt":        &fstest.MapFile{Data: []byte("short"), Mode: 0o644},
+		"chmod.sh":           &fstest.MapFile{Data: []byte("#!/bin/sh"), Mode: 0o644},
+		"removed.txt":        &fstest.MapFile{Data: []byte("gone"), Mode: 0o644},
+		"olddir/a.txt":       &fstest.MapFile{Data: []byte("a"), Mode: 0o644},
+		"olddir/sub/b.txt":   &fstest.MapFile{Data: []byte("b"), Mode: 0o644},
+		"keep/same.txt":      &fstest.MapFile{Data: []byte("keep"), Mode: 0o644},
+		"keep/stale.txt":     &fstest.MapFile{Data: []byte("stale"), Mode: 0o644},
+		"replaced/child.txt": &fstest.MapFile{Data: []byte("child"), Mode: 0o644},
+	}
+	base := buildTOC(t, func() (*core.BuildResult, error) {
+		return builder.Build(ctx, baseFS, core.GzipCompression(), nil)
+	})
+
+	newFS := fstest.MapFS{
+		"unchanged.txt":  &fstest.MapFile{Data: []byte("same"), Mode: 0o644},
+		"modified.txt":   &fstest.MapFile{Data: []byte("new!"), Mode: 0o644},
+		"resized.txt":    &fstest.MapFile{Data: []byte("much longer"), Mode: 0o644},
+		"chmod.sh":       &fstest.MapFile{Data: []byte("#!/bin/sh"), Mode: 0o755},
+		"keep/same.txt":  &fstest.MapFile{Data: []byte("keep"), Mode: 0o644},
+		"keep/added.txt": &fstest.MapFile{Data: []byte("added"), Mode: 0o644},
+		"replaced":       &fstest.MapFile{Data: []byte("now a file"), Mode: 0o644},
+	}
+	diff := buildTOC(t, func() (*core.BuildResult, error) {
+		return builder.BuildDiff(ctx, newFS, base, core.GzipCompression(), nil)
+	})
+
+	names := make([]string, 0, len(diff))
+	for name := range diff {
+		names = append(names, name)
+	}
+	assert.ElementsMatch(t, []string{
+		"modified.txt",
+		"resized.txt",
+		"chmod.sh",
+		"keep",
+		"keep/added.txt",
+		"keep/.wh.stale.txt",
+		"replaced",
+		".wh.removed.txt",
+		".wh.olddir",
+	}, names)
+
+	assert.Equal(t, "dir", diff["keep"].Type)
+	assert.Equal(t, "reg", diff["replaced"].Type)
+	assert.Equal(t, int64(0o755), diff["chmod.sh"].Mode&0o777)
+}
+
+func TestBuildDiff_NoChanges(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	builder := NewBuilder(nil)
+
+	src := fstest.MapFS{
+		"a.txt":     &fstest.MapFile{Data: []byte("a"), Mode: 0o644},
+		"dir/b.txt": &fstest.MapFile{Data: []byte("b"), Mode: 0o644},
+	}
+	base := buildTOC(t, func() (*core.BuildResult, error) {
+		return builder.Build(ctx, src, core.GzipCompression(), nil)
+	})
+
+	diff := buildTOC(t, func() (*core.BuildResult, error) {
+		return builder.BuildDiff(ctx, src, base, core.GzipCompression(), nil)
+	})
+	assert.Empty(t, diff)
+}
@@ -0,0 +1,11 @@
+//go:build !linux && !darwin
+
+package archive
+
+import "errors"
+
+// exchange reports that directories cannot be swapped atomically on this
+// platform.
+func exchange(_, _ string) error {
+	return errors.ErrUnsupported
+}
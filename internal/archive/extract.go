@@ -9,12 +9,17 @@ import (
 	"fmt"
 	"io"
 	"io/fs"
+	"log/slog"
 	"math"
 	"os"
+	"path"
 	"path/filepath"
 	"runtime"
+	"sort"
 	"strings"
+	"time"
 
+	"github.com/containerd/stargz-snapshotter/estargz"
 	"github.com/klauspost/compress/zstd"
 
 	"github.com/meigma/blobber/core"
@@ -30,24 +35,125 @@ import (
 // Note: This implementation uses best-effort TOCTOU prevention via Lstat
 // checks and O_EXCL flags. Full openat(2) safety is not yet implemented.
 func Extract(ctx context.Context, r io.Reader, destDir string, validator contracts.PathValidator, limits core.ExtractLimits) error {
-	// Auto-detect compression
-	decompReader, err := detectAndDecompress(r)
-	if err != nil {
-		return fmt.Errorf("%w: %v", core.ErrInvalidArchive, err)
+	return NewLayerExtractor(destDir, validator, limits).Extract(ctx, r)
+}
+
+// Whiteout markers used by OCI layers to delete entries from lower layers.
+const (
+	whiteoutPrefix = ".wh."
+	whiteoutOpaque = ".wh..wh..opq"
+)
+
+// LayerExtractor extracts the layers of an image into a destination directory.
+//
+// Layers must be extracted in manifest order (bottom layer first). Entries of a
+// later layer replace entries extracted from earlier layers, and OCI whiteouts
+// (".wh.<name>" and ".wh..wh..opq") remove them. Whiteouts only ever remove
+// entries extracted by this LayerExtractor; pre-existing files in the
+// destination are left untouched and still cause extraction to fail.
+//
+// Extraction limits apply to the total across all layers.
+type LayerExtractor struct {
+	destDir   string
+	validator contracts.PathValidator
+	state     *extractState
+}
+
+// ExtractorOption configures a LayerExtractor.
+type ExtractorOption func(*LayerExtractor)
+
+// WithFilter extracts only the entries selected by filter.
+// Whiteouts are still applied, and every entry is still validated.
+func WithFilter(filter *Filter) ExtractorOption {
+	return func(e *LayerExtractor) {
+		e.state.filter = filter
 	}
-	defer decompReader.Close()
+}
+
+// WithLogger sets the logger used to report entries that are skipped.
+// If logger is nil, a no-op logger is used.
+func WithLogger(logger *slog.Logger) ExtractorOption {
+	return func(e *LayerExtractor) {
+		if logger != nil {
+			e.state.logger = logger
+		}
+	}
+}
+
+// WithExtractTypes allows the special file types selected by types.
+// Device and FIFO entries of other types fail with ErrExtractLimits.
+func WithExtractTypes(types core.ExtractTypes) ExtractorOption {
+	return func(e *LayerExtractor) {
+		e.state.types = types
+	}
+}
 
-	tr := tar.NewReader(decompReader)
+// Preserve selects the metadata restored on extraction in addition to
+// permissions, which are always applied.
+type Preserve struct {
+	// Times restores modification times.
+	Times bool
+	// Ownership restores owners and groups. It only takes effect when running
+	// as root, unless IDMap is set.
+	Ownership bool
+	// IDMap translates archive owners to host owners. Setting it implies Ownership.
+	IDMap *core.IDMap
+	// Xattrs restores extended attributes.
+	Xattrs bool
+}
+
+// WithPreserve restores the metadata selected by p.
+func WithPreserve(p Preserve) ExtractorOption {
+	return func(e *LayerExtractor) {
+		e.state.preserve = p
+	}
+}
+
+// NewLayerExtractor creates a LayerExtractor for the destination directory.
+func NewLayerExtractor(destDir string, validator contracts.PathValidator, limits core.ExtractLimits, opts ...ExtractorOption) *LayerExtractor {
 	state := &extractState{
 		limits:        limits,
 		buf:           make([]byte, copyBufferSize),
 		validatedDirs: make(map[string]struct{}),
 		createdDirs:   make(map[string]struct{}),
+		extracted:     make(map[string]extractedEntry),
+		dirTimes:      make(map[string]time.Time),
+		excluded:      make(map[string]struct{}),
+		//nolint:sloglint // DiscardHandler is intentional for no-op logging
+		logger: slog.New(slog.NewTextHandler(io.Discard, nil)),
 	}
 	if info, err := os.Stat(destDir); err == nil && info.IsDir() {
 		state.validatedDirs[destDir] = struct{}{}
 		state.createdDirs[destDir] = struct{}{}
 	}
+	e := &LayerExtractor{
+		destDir:   destDir,
+		validator: validator,
+		state:     state,
+	}
+	for _, opt := range opts {
+		opt(e)
+	}
+	return e
+}
+
+// Extract extracts the next layer from an eStargz blob.
+// The compression format (gzip or zstd) is auto-detected.
+func (e *LayerExtractor) Extract(ctx context.Context, r io.Reader) error {
+	// Auto-detect compression
+	decompReader, err := detectAndDecompress(r)
+	if err != nil {
+		return fmt.Errorf("%w: %v", core.ErrInvalidArchive, err)
+	}
+	defer decompReader.Close()
+
+	return e.ExtractTar(ctx, decompReader)
+}
+
+// ExtractTar extracts the next layer from an uncompressed tar stream.
+func (e *LayerExtractor) ExtractTar(ctx context.Context, r io.Reader) error {
+	tr := tar.NewReader(r)
+	defer func() { e.state.layer++ }()
 
 	for {
 		select {
@@ -64,12 +170,12 @@ func Extract(ctx context.Context, r io.Reader, destDir string, validator contrac
 			return fmt.Errorf("%w: %v", core.ErrInvalidArchive, err)
 		}
 
-		if err := processEntry(ctx, destDir, header, tr, validator, state); err != nil {
+		if err := processEntry(ctx, e.destDir, header, tr, e.validator, e.state); err != nil {
 			return err
 		}
 	}
 
-	return nil
+	return restoreDirTimes(e.state)
 }
 
 // extractState tracks extraction progress for limit enforcement.
@@ -80,6 +186,33 @@ type extractState struct {
 	buf           []byte
 	validatedDirs map[string]struct{}
 	createdDirs   map[string]struct{}
+
+	// filter selects the entries to extract; nil extracts all entries.
+	filter *Filter
+	// types selects the special file types that may be created.
+	types core.ExtractTypes
+	// preserve selects the metadata restored on extracted entries.
+	preserve Preserve
+	// dirTimes holds the modification times of extracted directories, which
+	// are restored once their contents have been written.
+	dirTimes map[string]time.Time
+
+	// layer is the index of the layer currently being extracted.
+	layer int
+	// extracted records entries written so far, keyed by cleaned tar name.
+	extracted map[string]extractedEntry
+	// excluded records the regular files skipped by filter, keyed by cleaned
+	// tar name, so that hard links to them can be skipped as well.
+	excluded map[string]struct{}
+
+	logger *slog.Logger
+}
+
+// extractedEntry records an entry written during extraction.
+type extractedEntry struct {
+	layer int
+	dir   bool
+	reg   bool // regular file, which hard links may refer to
 }
 
 // processEntry handles a single tar entry.
@@ -88,32 +221,303 @@ func processEntry(ctx context.Context, destDir string, header *tar.Header, tr *t
 	if header.Name == "stargz.index.json" {
 		return nil
 	}
+	// Skip prefetch landmarks, which only mark the prioritized region
+	if header.Name == estargz.PrefetchLandmark || header.Name == estargz.NoPrefetchLandmark {
+		return nil
+	}
 
 	// Validate path
 	if err := validator.ValidatePath(header.Name); err != nil {
 		return err
 	}
 
-	// Check limits for regular files
-	if header.Typeflag == tar.TypeReg {
+	name := cleanEntryName(header.Name)
+	if isWhiteout(name) {
+		return applyWhiteout(destDir, name, state)
+	}
+	if !state.filter.Match(name) {
+		if header.Typeflag == tar.TypeReg || header.Typeflag == tar.TypeLink {
+			state.excluded[name] = struct{}{}
+		}
+		return nil
+	}
+	if header.Typeflag == tar.TypeLink {
+		if err := validator.ValidatePath(header.Linkname); err != nil {
+			return err
+		}
+		// The content of an excluded target has already been skipped, so the
+		// link cannot be created.
+		if _, ok := state.excluded[cleanEntryName(header.Linkname)]; ok {
+			state.logger.Warn("skipping hard link to excluded file", "path", header.Name, "target", header.Linkname)
+			return nil
+		}
+	}
+
+	// Check limits for regular files and hard links
+	if header.Typeflag == tar.TypeReg || header.Typeflag == tar.TypeLink {
 		if err := checkLimits(header, state); err != nil {
 			return err
 		}
 	}
 
+	switch header.Typeflag {
+	case tar.TypeSymlink:
+		if err := validator.ValidateSymlink(destDir, header.Name, header.Linkname); err != nil {
+			return err
+		}
+	case tar.TypeLink:
+		if err := validateHardlink(header, validator, state); err != nil {
+			return err
+		}
+	case tar.TypeChar, tar.TypeBlock, tar.TypeFifo:
+		if !typeAllowed(header.Typeflag, state.types) {
+			return fmt.Errorf("%w: %s entries are not allowed: %s", core.ErrExtractLimits, tocType(header.Typeflag), header.Name)
+		}
+	}
+
+	isDir := header.Typeflag == tar.TypeDir
+	if err := replaceLowerEntry(destDir, name, isDir, state); err != nil {
+		return err
+	}
+
 	// Extract based on type
+	var err error
 	switch header.Typeflag {
 	case tar.TypeDir:
-		return extractDir(destDir, header, state)
+		err = extractDir(destDir, header, state)
 	case tar.TypeReg:
-		return extractFile(ctx, destDir, header, tr, state)
+		err = extractFile(ctx, destDir, header, tr, state)
 	case tar.TypeSymlink:
-		if err := validator.ValidateSymlink(destDir, header.Name, header.Linkname); err != nil {
-			return err
+		err = extractSymlink(destDir, header, state)
+	case tar.TypeLink:
+		err = extractHardlink(destDir, header, state)
+	case tar.TypeChar, tar.TypeBlock, tar.TypeFifo:
+		err = extractSpecial(destDir, header, state)
+	default:
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	state.extracted[name] = extractedEntry{
+		layer: state.layer,
+		dir:   isDir,
+		reg:   header.Typeflag == tar.TypeReg || header.Typeflag == tar.TypeLink,
+	}
+	return restoreMetadata(destDir, header, state)
+}
+
+// restoreMetadata applies the ownership, extended attributes, and times of
+// header to the extracted entry, as selected by state.preserve. Directory
+// times are recorded and applied by restoreDirTimes.
+//
+//nolint:gosec // G305: Path validated by caller via PathValidator
+func restoreMetadata(destDir string, header *tar.Header, state *extractState) error {
+	p := state.preserve
+	if header.Typeflag == tar.TypeLink {
+		// Hard links share the metadata of their target.
+		return nil
+	}
+	fullPath := filepath.Join(destDir, header.Name)
+
+	// The owner is set first: changing it clears setuid and setgid bits, and
+	// the kernel drops security.capability, so both are restored after it.
+	if p.Ownership || p.IDMap != nil {
+		if uid, gid, ok := hostOwner(header, p.IDMap); ok {
+			if err := os.Lchown(fullPath, uid, gid); err != nil {
+				return err
+			}
+			if header.Typeflag != tar.TypeSymlink {
+				if err := os.Chmod(fullPath, header.FileInfo().Mode()&modeBits); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	if p.Xattrs {
+		for name, value := range tarXattrs(header) {
+			err := lsetxattr(fullPath, name, value)
+			if err != nil && !skipXattr(name, err, os.Geteuid() == 0) {
+				return fmt.Errorf("set xattr %s on %s: %w", name, header.Name, err)
+			}
+		}
+	}
+	if p.Times && !header.ModTime.IsZero() {
+		if header.Typeflag == tar.TypeDir {
+			state.dirTimes[fullPath] = header.ModTime
+			return nil
+		}
+		if err := lutimes(fullPath, header.ModTime); err != nil {
+			return fmt.Errorf("set times on %s: %w", header.Name, err)
+		}
+	}
+	return nil
+}
+
+// skipXattr reports whether the failure to set the extended attribute name
+// leaves the others to apply. Attributes the destination filesystem, or the
+// platform, does not support are skipped. Like ownership, the trusted. and
+// security. namespaces need privileges, so they are skipped when denied
+// without root.
+func skipXattr(name string, err error, root bool) bool {
+	if errors.Is(err, errors.ErrUnsupported) {
+		return true
+	}
+	privileged := strings.HasPrefix(name, "trusted.") || strings.HasPrefix(name, "security.")
+	return privileged && !root && errors.Is(err, fs.ErrPermission)
+}
+
+// modeBits are the mode bits restored along with ownership.
+const modeBits = fs.ModePerm | fs.ModeSetuid | fs.ModeSetgid | fs.ModeSticky
+
+// restoreDirTimes applies the recorded directory times. It runs after each
+// layer, since later entries change the times of their parent directories.
+func restoreDirTimes(state *extractState) error {
+	for dir, mtime := range state.dirTimes {
+		if err := lutimes(dir, mtime); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("set times on %s: %w", dir, err)
+		}
+	}
+	return nil
+}
+
+// hostOwner returns the owner to give an extracted entry. Without an ID map,
+// owners are only restored when running as root.
+func hostOwner(header *tar.Header, idmap *core.IDMap) (uid, gid int, ok bool) {
+	if idmap == nil {
+		return header.Uid, header.Gid, os.Geteuid() == 0
+	}
+	uid, uidOK := mapID(header.Uid, idmap.UIDs)
+	gid, gidOK := mapID(header.Gid, idmap.GIDs)
+	if !uidOK {
+		uid = -1 // left unchanged
+	}
+	if !gidOK {
+		gid = -1
+	}
+	return uid, gid, uidOK || gidOK
+}
+
+// mapID translates an archive ID through mappings.
+func mapID(id int, mappings []core.IDMapping) (int, bool) {
+	for _, m := range mappings {
+		if id >= m.ArchiveID && id-m.ArchiveID < m.Size {
+			return m.HostID + id - m.ArchiveID, true
+		}
+	}
+	return 0, false
+}
+
+// xattrPAXPrefix is the PAX record prefix of extended attributes.
+const xattrPAXPrefix = "SCHILY.xattr."
+
+// tarXattrs returns the extended attributes recorded in a tar header.
+func tarXattrs(header *tar.Header) map[string]string {
+	var xattrs map[string]string
+	for k, v := range header.PAXRecords {
+		if name, ok := strings.CutPrefix(k, xattrPAXPrefix); ok {
+			if xattrs == nil {
+				xattrs = make(map[string]string)
+			}
+			xattrs[name] = v
+		}
+	}
+	return xattrs
+}
+
+// validateHardlink checks that a hard link refers to a regular file
+// extracted earlier, so it cannot reach files outside the archive.
+func validateHardlink(header *tar.Header, validator contracts.PathValidator, state *extractState) error {
+	if err := validator.ValidatePath(header.Linkname); err != nil {
+		return err
+	}
+	if target, ok := state.extracted[cleanEntryName(header.Linkname)]; !ok || !target.reg {
+		return fmt.Errorf("%w: hard link %s: target %s is not a regular file extracted from the archive",
+			core.ErrInvalidArchive, header.Name, header.Linkname)
+	}
+	return nil
+}
+
+// typeAllowed reports whether types allows entries of a special file type.
+func typeAllowed(typeflag byte, types core.ExtractTypes) bool {
+	switch typeflag {
+	case tar.TypeChar:
+		return types.CharDevices
+	case tar.TypeBlock:
+		return types.BlockDevices
+	case tar.TypeFifo:
+		return types.FIFOs
+	default:
+		return false
+	}
+}
+
+// cleanEntryName normalizes a tar entry name to a slash-separated relative path.
+func cleanEntryName(name string) string {
+	return strings.TrimPrefix(path.Clean("/"+name), "/")
+}
+
+// isWhiteout reports whether the entry name is an OCI whiteout marker.
+func isWhiteout(name string) bool {
+	return strings.HasPrefix(path.Base(name), whiteoutPrefix)
+}
+
+// applyWhiteout removes the entries hidden by a whiteout marker.
+// Only entries extracted from lower layers are removed.
+func applyWhiteout(destDir, name string, state *extractState) error {
+	dir, base := path.Split(name)
+	dir = strings.TrimSuffix(dir, "/")
+
+	if base == whiteoutOpaque {
+		return removeLowerEntries(destDir, dir, false, state)
+	}
+	return removeLowerEntries(destDir, path.Join(dir, strings.TrimPrefix(base, whiteoutPrefix)), true, state)
+}
+
+// replaceLowerEntry prepares for an entry that replaces one extracted from a lower layer.
+// Directories merge with lower directories; any other combination removes the lower entry.
+func replaceLowerEntry(destDir, name string, isDir bool, state *extractState) error {
+	prev, ok := state.extracted[name]
+	if !ok || prev.layer >= state.layer {
+		return nil
+	}
+	if prev.dir && isDir {
+		return nil
+	}
+	return removeLowerEntries(destDir, name, true, state)
+}
+
+// removeLowerEntries removes entries extracted from lower layers below root,
+// and root itself if includeRoot is set. The root "" refers to the destination.
+// Directories that still contain files not written by the extractor are kept.
+func removeLowerEntries(destDir, root string, includeRoot bool, state *extractState) error {
+	var victims []string
+	for name, e := range state.extracted {
+		if e.layer >= state.layer {
+			continue
+		}
+		if (includeRoot && name == root) || root == "" || strings.HasPrefix(name, root+"/") {
+			victims = append(victims, name)
+		}
+	}
+
+	// Remove children before their parents.
+	sort.Sort(sort.Reverse(sort.StringSlice(victims)))
+	for _, name := range victims {
+		entry := state.extracted[name]
+		delete(state.extracted, name)
+
+		fullPath := filepath.Join(destDir, filepath.FromSlash(name))
+		err := os.Remove(fullPath)
+		if entry.dir {
+			delete(state.createdDirs, fullPath)
+			delete(state.validatedDirs, fullPath)
+			// Keep directories holding pre-existing files.
+			continue
+		}
+		if err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("remove %s: %w", name, err)
 		}
-		return extractSymlink(destDir, header, state)
-	case tar.TypeLink, tar.TypeChar, tar.TypeBlock, tar.TypeFifo:
-		return fmt.Errorf("%w: unsupported entry type %q for %s", core.ErrInvalidArchive, header.Typeflag, header.Name)
 	}
 	return nil
 }
@@ -243,6 +647,43 @@ func extractSymlink(destDir string, header *tar.Header, state *extractState) err
 	return nil
 }
 
+// extractHardlink creates a hard link from a tar header.
+// The target has been checked by validateHardlink.
+//
+//nolint:gosec // G305: Paths validated by caller via PathValidator
+func extractHardlink(destDir string, header *tar.Header, state *extractState) error {
+	fullPath := filepath.Join(destDir, header.Name)
+	targetPath := filepath.Join(destDir, filepath.FromSlash(cleanEntryName(header.Linkname)))
+
+	if err := ensureParentDir(parentDir(fullPath), destDir, state); err != nil {
+		return err
+	}
+
+	// The target must still be the regular file that was extracted.
+	info, err := os.Lstat(targetPath)
+	if err != nil {
+		return err
+	}
+	if !info.Mode().IsRegular() {
+		return core.ErrPathTraversal
+	}
+
+	// Link fails if the path exists, like O_EXCL for regular files.
+	return os.Link(targetPath, fullPath)
+}
+
+// extractSpecial creates a device or FIFO node from a tar header.
+//
+//nolint:gosec // G305: Path validated by caller via PathValidator
+func extractSpecial(destDir string, header *tar.Header, state *extractState) error {
+	fullPath := filepath.Join(destDir, header.Name)
+
+	if err := ensureParentDir(parentDir(fullPath), destDir, state); err != nil {
+		return err
+	}
+	return mknod(fullPath, header)
+}
+
 // validateNotSymlink checks that a path is not a symlink.
 // This is a best-effort TOCTOU check - not fully race-safe.
 func validateNotSymlink(path string) error {
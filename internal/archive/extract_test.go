@@ -3,14 +3,17 @@ package archive
 import (
 	"archive/tar"
 	"bytes"
-	"compress/gzip"
 	"context"
+	"errors"
 	"io"
+	"io/fs"
 	"os"
 	"path/filepath"
 	"runtime"
+	"syscall"
 	"testing"
 	"testing/fstest"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -62,7 +65,7 @@ func TestExtract(t *testing.T) {
 
 			// Build archive
 			builder := NewBuilder(nil)
-			result, err := builder.Build(context.Background(), tt.fs, tt.compression)
+			result, err := builder.Build(context.Background(), tt.fs, tt.compression, nil)
 			require.NoError(t, err)
 			defer result.Blob.Close()
 
@@ -97,7 +100,7 @@ func TestExtract_FileContent(t *testing.T) {
 	}
 
 	builder := NewBuilder(nil)
-	result, err := builder.Build(context.Background(), testFS, core.GzipCompression())
+	result, err := builder.Build(context.Background(), testFS, core.GzipCompression(), nil)
 	require.NoError(t, err)
 	defer result.Blob.Close()
 
@@ -136,7 +139,7 @@ func TestExtract_Symlink(t *testing.T) {
 	}
 
 	builder := NewBuilder(nil)
-	result, err := builder.Build(context.Background(), OSFS(tmpDir), core.GzipCompression())
+	result, err := builder.Build(context.Background(), OSFS(tmpDir), core.GzipCompression(), nil)
 	require.NoError(t, err)
 	defer result.Blob.Close()
 
@@ -215,7 +218,7 @@ func TestExtract_Limits(t *testing.T) {
 			t.Parallel()
 
 			builder := NewBuilder(nil)
-			result, err := builder.Build(context.Background(), tt.fs, core.GzipCompression())
+			result, err := builder.Build(context.Background(), tt.fs, core.GzipCompression(), nil)
 			require.NoError(t, err)
 			defer result.Blob.Close()
 
@@ -244,7 +247,7 @@ func TestExtract_ContextCancellation(t *testing.T) {
 	}
 
 	builder := NewBuilder(nil)
-	result, err := builder.Build(context.Background(), testFS, core.GzipCompression())
+	result, err := builder.Build(context.Background(), testFS, core.GzipCompression(), nil)
 	require.NoError(t, err)
 	defer result.Blob.Close()
 
@@ -302,7 +305,7 @@ func Test_detectAndDecompress(t *testing.T) {
 			}
 
 			builder := NewBuilder(nil)
-			result, err := builder.Build(context.Background(), testFS, tt.compression)
+			result, err := builder.Build(context.Background(), testFS, tt.compression, nil)
 			require.NoError(t, err)
 			defer result.Blob.Close()
 
@@ -322,50 +325,463 @@ func Test_detectAndDecompress(t *testing.T) {
 	}
 }
 
-func TestExtract_HardlinkRejected(t *testing.T) {
+func TestExtract_Hardlinks(t *testing.T) {
 	t.Parallel()
 
-	// Create a tar archive with a hardlink entry directly
-	// since fstest.MapFS doesn't support hardlinks
-	var buf bytes.Buffer
-	tw := tar.NewWriter(&buf)
+	original := &tar.Header{Typeflag: tar.TypeReg, Name: "original.txt", Mode: 0o644}
+	contents := map[string]string{"original.txt": "content"}
 
-	// Write a regular file first
-	err := tw.WriteHeader(&tar.Header{
-		Name: "original.txt",
-		Mode: 0o644,
-		Size: 7,
+	t.Run("links to extracted files", func(t *testing.T) {
+		t.Parallel()
+
+		stream := makeTar(t, []*tar.Header{
+			original,
+			{Typeflag: tar.TypeLink, Name: "sub/hardlink.txt", Linkname: "original.txt", Mode: 0o644},
+		}, contents)
+
+		destDir := t.TempDir()
+		limits := core.ExtractLimits{MaxFiles: 2}
+		err := NewLayerExtractor(destDir, safepath.NewValidator(), limits).ExtractTar(context.Background(), bytes.NewReader(stream))
+		require.NoError(t, err)
+
+		orig, err := os.Stat(filepath.Join(destDir, "original.txt"))
+		require.NoError(t, err)
+		link, err := os.Stat(filepath.Join(destDir, "sub", "hardlink.txt"))
+		require.NoError(t, err)
+		assert.True(t, os.SameFile(orig, link), "hardlink.txt should share the inode of original.txt")
+	})
+
+	t.Run("links to excluded files are skipped", func(t *testing.T) {
+		t.Parallel()
+
+		stream := makeTar(t, []*tar.Header{
+			original,
+			{Typeflag: tar.TypeLink, Name: "sub/hardlink.txt", Linkname: "original.txt", Mode: 0o644},
+		}, contents)
+
+		filter, err := NewFilter([]string{"sub"}, nil)
+		require.NoError(t, err)
+
+		destDir := t.TempDir()
+		err = NewLayerExtractor(destDir, safepath.NewValidator(), core.ExtractLimits{}, WithFilter(filter)).
+			ExtractTar(context.Background(), bytes.NewReader(stream))
+		require.NoError(t, err)
+
+		_, err = os.Lstat(filepath.Join(destDir, "sub", "hardlink.txt"))
+		assert.ErrorIs(t, err, fs.ErrNotExist)
+	})
+
+	tests := []struct {
+		name    string
+		link    *tar.Header
+		wantErr error
+	}{
+		{"traversal", &tar.Header{Typeflag: tar.TypeLink, Name: "link", Linkname: "../outside"}, core.ErrPathTraversal},
+		{"absolute target", &tar.Header{Typeflag: tar.TypeLink, Name: "link", Linkname: "/etc/passwd"}, core.ErrPathTraversal},
+		{"missing target", &tar.Header{Typeflag: tar.TypeLink, Name: "link", Linkname: "missing.txt"}, core.ErrInvalidArchive},
+		{"directory target", &tar.Header{Typeflag: tar.TypeLink, Name: "link", Linkname: "dir"}, core.ErrInvalidArchive},
+		{"symlink target", &tar.Header{Typeflag: tar.TypeLink, Name: "link", Linkname: "symlink"}, core.ErrInvalidArchive},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			stream := makeTar(t, []*tar.Header{
+				original,
+				{Typeflag: tar.TypeDir, Name: "dir/", Mode: 0o755},
+				{Typeflag: tar.TypeSymlink, Name: "symlink", Linkname: "original.txt"},
+				tt.link,
+			}, contents)
+
+			destDir := t.TempDir()
+			err := NewLayerExtractor(destDir, safepath.NewValidator(), core.ExtractLimits{}).ExtractTar(context.Background(), bytes.NewReader(stream))
+			require.ErrorIs(t, err, tt.wantErr)
+			assert.NoFileExists(t, filepath.Join(destDir, "link"))
+		})
+	}
+
+	t.Run("pre-existing files are not link targets", func(t *testing.T) {
+		t.Parallel()
+
+		destDir := t.TempDir()
+		require.NoError(t, os.WriteFile(filepath.Join(destDir, "secret"), []byte("secret"), 0o600))
+		stream := makeTar(t, []*tar.Header{
+			{Typeflag: tar.TypeLink, Name: "link", Linkname: "secret"},
+		}, nil)
+
+		err := NewLayerExtractor(destDir, safepath.NewValidator(), core.ExtractLimits{}).ExtractTar(context.Background(), bytes.NewReader(stream))
+		require.ErrorIs(t, err, core.ErrInvalidArchive)
+	})
+
+	t.Run("count toward the file limit", func(t *testing.T) {
+		t.Parallel()
+
+		stream := makeTar(t, []*tar.Header{
+			original,
+			{Typeflag: tar.TypeLink, Name: "link", Linkname: "original.txt"},
+		}, contents)
+
+		err := NewLayerExtractor(t.TempDir(), safepath.NewValidator(), core.ExtractLimits{MaxFiles: 1}).ExtractTar(context.Background(), bytes.NewReader(stream))
+		require.ErrorIs(t, err, core.ErrExtractLimits)
+	})
+}
+
+func TestExtract_SpecialFiles(t *testing.T) {
+	t.Parallel()
+
+	if runtime.GOOS != "linux" && runtime.GOOS != "darwin" {
+		t.Skip("device and FIFO nodes are not supported on " + runtime.GOOS)
+	}
+
+	stream := makeTar(t, []*tar.Header{
+		{Typeflag: tar.TypeFifo, Name: "pipe", Mode: 0o600},
+	}, nil)
+
+	t.Run("rejected by default", func(t *testing.T) {
+		t.Parallel()
+
+		destDir := t.TempDir()
+		err := NewLayerExtractor(destDir, safepath.NewValidator(), core.ExtractLimits{}).ExtractTar(context.Background(), bytes.NewReader(stream))
+		require.ErrorIs(t, err, core.ErrExtractLimits)
+		assert.NoFileExists(t, filepath.Join(destDir, "pipe"))
 	})
-	require.NoError(t, err, "failed to write header")
 
-	_, err = tw.Write([]byte("content"))
-	require.NoError(t, err, "failed to write content")
+	t.Run("rejected when another type is allowed", func(t *testing.T) {
+		t.Parallel()
 
-	// Write a hardlink to the file
-	err = tw.WriteHeader(&tar.Header{
-		Typeflag: tar.TypeLink,
-		Name:     "hardlink.txt",
-		Linkname: "original.txt",
-		Mode:     0o644,
+		types := core.ExtractTypes{CharDevices: true, BlockDevices: true}
+		err := NewLayerExtractor(t.TempDir(), safepath.NewValidator(), core.ExtractLimits{}, WithExtractTypes(types)).ExtractTar(context.Background(), bytes.NewReader(stream))
+		require.ErrorIs(t, err, core.ErrExtractLimits)
 	})
-	require.NoError(t, err, "failed to write hardlink header")
 
-	err = tw.Close()
-	require.NoError(t, err, "failed to close tar writer")
+	t.Run("created when allowed", func(t *testing.T) {
+		t.Parallel()
 
-	// Compress with gzip
-	var gzBuf bytes.Buffer
-	gw := gzip.NewWriter(&gzBuf)
-	_, err = gw.Write(buf.Bytes())
-	require.NoError(t, err, "failed to gzip")
+		destDir := t.TempDir()
+		types := core.ExtractTypes{FIFOs: true}
+		err := NewLayerExtractor(destDir, safepath.NewValidator(), core.ExtractLimits{}, WithExtractTypes(types)).ExtractTar(context.Background(), bytes.NewReader(stream))
+		require.NoError(t, err)
 
-	err = gw.Close()
-	require.NoError(t, err, "failed to close gzip")
+		info, err := os.Lstat(filepath.Join(destDir, "pipe"))
+		require.NoError(t, err)
+		assert.NotZero(t, info.Mode()&os.ModeNamedPipe, "pipe should be a FIFO")
+	})
+}
+
+// requireXattrs skips the test unless dir supports user extended attributes.
+func requireXattrs(t *testing.T, dir string) {
+	t.Helper()
+	probe := filepath.Join(dir, ".xattr-probe")
+	require.NoError(t, os.WriteFile(probe, nil, 0o600))
+	defer os.Remove(probe)
+	if err := lsetxattr(probe, "user.probe", "1"); err != nil {
+		t.Skipf("extended attributes not supported: %v", err)
+	}
+}
+
+func TestExtract_PreserveMetadata(t *testing.T) {
+	t.Parallel()
+
+	mtime := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	stream := makeTar(t, []*tar.Header{
+		{Typeflag: tar.TypeDir, Name: "etc/", Mode: 0o755, ModTime: mtime, Uid: 1000, Gid: 1000},
+		{
+			Typeflag: tar.TypeReg, Name: "etc/app.conf", Mode: 0o644, ModTime: mtime, Uid: 1000, Gid: 1000,
+			PAXRecords: map[string]string{"SCHILY.xattr.user.origin": "build"},
+		},
+		{Typeflag: tar.TypeSymlink, Name: "etc/current", Linkname: "app.conf", Mode: 0o777, ModTime: mtime, Uid: 1000, Gid: 1000},
+	}, map[string]string{"etc/app.conf": "key=value"})
+
+	t.Run("ignored by default", func(t *testing.T) {
+		t.Parallel()
+
+		destDir := t.TempDir()
+		require.NoError(t, NewLayerExtractor(destDir, safepath.NewValidator(), core.ExtractLimits{}).ExtractTar(context.Background(), bytes.NewReader(stream)))
+
+		info, err := os.Stat(filepath.Join(destDir, "etc", "app.conf"))
+		require.NoError(t, err)
+		assert.NotEqual(t, mtime, info.ModTime().UTC())
+		xattrs, err := lgetxattrs(filepath.Join(destDir, "etc", "app.conf"))
+		require.NoError(t, err)
+		assert.NotContains(t, xattrs, "user.origin")
+	})
+
+	t.Run("times", func(t *testing.T) {
+		t.Parallel()
+
+		destDir := t.TempDir()
+		extractor := NewLayerExtractor(destDir, safepath.NewValidator(), core.ExtractLimits{}, WithPreserve(Preserve{Times: true}))
+		require.NoError(t, extractor.ExtractTar(context.Background(), bytes.NewReader(stream)))
+
+		// Directory times survive the entries written into them.
+		for _, name := range []string{"etc", "etc/app.conf"} {
+			info, err := os.Stat(filepath.Join(destDir, name))
+			require.NoError(t, err)
+			assert.Equal(t, mtime, info.ModTime().UTC(), name)
+		}
+		if runtime.GOOS == "linux" || runtime.GOOS == "darwin" {
+			info, err := os.Lstat(filepath.Join(destDir, "etc", "current"))
+			require.NoError(t, err)
+			assert.Equal(t, mtime, info.ModTime().UTC(), "symlink time")
+		}
+	})
+
+	t.Run("ownership through an ID map", func(t *testing.T) {
+		t.Parallel()
+
+		if runtime.GOOS == "windows" {
+			t.Skip("ownership is not supported on windows")
+		}
+		uid, gid := os.Getuid(), os.Getgid()
+		idmap := core.IDMap{
+			UIDs: []core.IDMapping{{ArchiveID: 1000, HostID: uid, Size: 1}},
+			GIDs: []core.IDMapping{{ArchiveID: 1000, HostID: gid, Size: 1}},
+		}
+		destDir := t.TempDir()
+		extractor := NewLayerExtractor(destDir, safepath.NewValidator(), core.ExtractLimits{}, WithPreserve(Preserve{IDMap: &idmap}))
+		require.NoError(t, extractor.ExtractTar(context.Background(), bytes.NewReader(stream)))
+		assert.FileExists(t, filepath.Join(destDir, "etc", "app.conf"))
+	})
+
+	t.Run("xattrs", func(t *testing.T) {
+		t.Parallel()
+
+		destDir := t.TempDir()
+		requireXattrs(t, destDir)
+		extractor := NewLayerExtractor(destDir, safepath.NewValidator(), core.ExtractLimits{}, WithPreserve(Preserve{Xattrs: true}))
+		require.NoError(t, extractor.ExtractTar(context.Background(), bytes.NewReader(stream)))
+
+		xattrs, err := lgetxattrs(filepath.Join(destDir, "etc", "app.conf"))
+		require.NoError(t, err)
+		assert.Equal(t, "build", xattrs["user.origin"])
+	})
+
+	t.Run("unsupported xattrs are skipped", func(t *testing.T) {
+		t.Parallel()
+
+		if runtime.GOOS != "linux" {
+			t.Skip("attribute namespaces are only enforced on linux")
+		}
+		destDir := t.TempDir()
+		requireXattrs(t, destDir)
+		// Linux rejects attributes outside its namespaces with EOPNOTSUPP.
+		stream := makeTar(t, []*tar.Header{{
+			Typeflag: tar.TypeReg, Name: "app.conf", Mode: 0o644,
+			PAXRecords: map[string]string{
+				"SCHILY.xattr.user.origin":   "build",
+				"SCHILY.xattr.com.apple.tag": "red",
+			},
+		}}, map[string]string{"app.conf": "key=value"})
+		extractor := NewLayerExtractor(destDir, safepath.NewValidator(), core.ExtractLimits{}, WithPreserve(Preserve{Xattrs: true}))
+		require.NoError(t, extractor.ExtractTar(context.Background(), bytes.NewReader(stream)))
+
+		xattrs, err := lgetxattrs(filepath.Join(destDir, "app.conf"))
+		require.NoError(t, err)
+		assert.Equal(t, map[string]string{"user.origin": "build"}, xattrs)
+	})
+
+	t.Run("privileged xattrs are skipped without root", func(t *testing.T) {
+		t.Parallel()
+
+		if runtime.GOOS != "linux" || os.Geteuid() == 0 {
+			t.Skip("trusted attributes are only denied to unprivileged users on linux")
+		}
+		destDir := t.TempDir()
+		requireXattrs(t, destDir)
+		stream := makeTar(t, []*tar.Header{{
+			Typeflag: tar.TypeReg, Name: "app.conf", Mode: 0o644,
+			PAXRecords: map[string]string{
+				"SCHILY.xattr.user.origin":    "build",
+				"SCHILY.xattr.trusted.origin": "build",
+			},
+		}}, map[string]string{"app.conf": "key=value"})
+		extractor := NewLayerExtractor(destDir, safepath.NewValidator(), core.ExtractLimits{}, WithPreserve(Preserve{Xattrs: true}))
+		require.NoError(t, extractor.ExtractTar(context.Background(), bytes.NewReader(stream)))
+
+		xattrs, err := lgetxattrs(filepath.Join(destDir, "app.conf"))
+		require.NoError(t, err)
+		assert.Equal(t, map[string]string{"user.origin": "build"}, xattrs)
+	})
+
+	t.Run("xattrs and mode survive ownership", func(t *testing.T) {
+		t.Parallel()
+
+		if runtime.GOOS == "windows" {
+			t.Skip("ownership is not supported on windows")
+		}
+		destDir := t.TempDir()
+		requireXattrs(t, destDir)
+
+		records := map[string]string{"SCHILY.xattr.user.origin": "build"}
+		// Changing the owner of a file drops its file capabilities. Setting
+		// them needs CAP_SETFCAP, so they are only checked when that works.
+		// The value grants CAP_NET_BIND_SERVICE (VFS_CAP_REVISION_2).
+		capability := string([]byte{1, 0, 0, 2, 0, 4, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0})
+		probe := filepath.Join(destDir, ".cap-probe")
+		require.NoError(t, os.WriteFile(probe, nil, 0o600))
+		withCapability := lsetxattr(probe, "security.capability", capability) == nil
+		require.NoError(t, os.Remove(probe))
+		if withCapability {
+			records["SCHILY.xattr.security.capability"] = capability
+		}
+
+		stream := makeTar(t, []*tar.Header{
+			{Typeflag: tar.TypeReg, Name: "bin/tool", Mode: 0o4755, Uid: 1000, Gid: 1000, PAXRecords: records},
+		}, map[string]string{"bin/tool": "#!/bin/sh"})
+		idmap := core.IDMap{
+			UIDs: []core.IDMapping{{ArchiveID: 1000, HostID: os.Getuid(), Size: 1}},
+			GIDs: []core.IDMapping{{ArchiveID: 1000, HostID: os.Getgid(), Size: 1}},
+		}
+		extractor := NewLayerExtractor(destDir, safepath.NewValidator(), core.ExtractLimits{}, WithPreserve(Preserve{IDMap: &idmap, Xattrs: true}))
+		require.NoError(t, extractor.ExtractTar(context.Background(), bytes.NewReader(stream)))
+
+		path := filepath.Join(destDir, "bin", "tool")
+		info, err := os.Lstat(path)
+		require.NoError(t, err)
+		assert.Equal(t, fs.FileMode(0o755)|fs.ModeSetuid, info.Mode()&modeBits)
+		xattrs, err := lgetxattrs(path)
+		require.NoError(t, err)
+		assert.Equal(t, "build", xattrs["user.origin"])
+		if withCapability {
+			assert.Equal(t, capability, xattrs["security.capability"])
+		}
+	})
+}
+
+func Test_hostOwner(t *testing.T) {
+	t.Parallel()
+
+	idmap := &core.IDMap{
+		UIDs: []core.IDMapping{{ArchiveID: 0, HostID: 100000, Size: 65536}},
+		GIDs: []core.IDMapping{{ArchiveID: 1000, HostID: 2000, Size: 1}},
+	}
+
+	uid, gid, ok := hostOwner(&tar.Header{Uid: 1000, Gid: 1000}, idmap)
+	assert.True(t, ok)
+	assert.Equal(t, 101000, uid)
+	assert.Equal(t, 2000, gid)
+
+	// Unmapped IDs are left unchanged.
+	uid, gid, ok = hostOwner(&tar.Header{Uid: 70000, Gid: 0}, idmap)
+	assert.False(t, ok)
+	assert.Equal(t, -1, uid)
+	assert.Equal(t, -1, gid)
+
+	// Without a map, owners are restored as recorded, only as root.
+	uid, gid, ok = hostOwner(&tar.Header{Uid: 1000, Gid: 1001}, nil)
+	assert.Equal(t, os.Geteuid() == 0, ok)
+	assert.Equal(t, 1000, uid)
+	assert.Equal(t, 1001, gid)
+}
+
+func Test_skipXattr(t *testing.T) {
+	t.Parallel()
+
+	denied := &fs.PathError{Op: "lsetxattr", Path: "app.conf", Err: syscall.EPERM}
+	tests := []struct {
+		name  string
+		xattr string
+		err   error
+		root  bool
+		want  bool
+	}{
+		{"unsupported", "user.origin", errors.ErrUnsupported, false, true},
+		{"trusted denied without root", "trusted.origin", denied, false, true},
+		{"security denied without root", "security.capability", denied, false, true},
+		{"trusted denied as root", "trusted.origin", denied, true, false},
+		{"user denied", "user.origin", denied, false, false},
+		{"other error", "trusted.origin", errors.New("disk full"), false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			assert.Equal(t, tt.want, skipXattr(tt.xattr, tt.err, tt.root))
+		})
+	}
+}
+
+func TestLayerExtractor_Whiteouts(t *testing.T) {
+	t.Parallel()
+
+	// Build rejects whiteout names, so the layers are written from raw tar streams.
+	buildLayer := func(t *testing.T, fsys fstest.MapFS) []byte {
+		t.Helper()
+		result, err := NewBuilder(nil).build(context.Background(), core.GzipCompression(), func(pw *io.PipeWriter) error {
+			tw := tar.NewWriter(pw)
+			err := tw.AddFS(fsys)
+			if err == nil {
+				err = tw.Close()
+			}
+			pw.CloseWithError(err)
+			return err
+		})
+		require.NoError(t, err)
+		defer result.Blob.Close()
+		data, err := io.ReadAll(result.Blob)
+		require.NoError(t, err, "failed to read blob")
+		return data
+	}
+
+	lower := buildLayer(t, fstest.MapFS{
+		"keep.txt":        &fstest.MapFile{Data: []byte("keep"), Mode: 0o644},
+		"replace.txt":     &fstest.MapFile{Data: []byte("old"), Mode: 0o644},
+		"removed.txt":     &fstest.MapFile{Data: []byte("removed"), Mode: 0o644},
+		"gone/file.txt":   &fstest.MapFile{Data: []byte("gone"), Mode: 0o644},
+		"opaque/old.txt":  &fstest.MapFile{Data: []byte("old"), Mode: 0o644},
+		"opaque/also.txt": &fstest.MapFile{Data: []byte("also"), Mode: 0o644},
+	})
+	upper := buildLayer(t, fstest.MapFS{
+		"replace.txt":         &fstest.MapFile{Data: []byte("new"), Mode: 0o644},
+		".wh.removed.txt":     &fstest.MapFile{Mode: 0o644},
+		".wh.gone":            &fstest.MapFile{Mode: 0o644},
+		"opaque/.wh..wh..opq": &fstest.MapFile{Mode: 0o644},
+		"opaque/new.txt":      &fstest.MapFile{Data: []byte("new"), Mode: 0o644},
+	})
 
 	destDir := t.TempDir()
-	validator := safepath.NewValidator()
-	limits := core.ExtractLimits{}
+	// Pre-existing files are never removed by whiteouts.
+	require.NoError(t, os.MkdirAll(filepath.Join(destDir, "gone"), 0o750))
+	require.NoError(t, os.WriteFile(filepath.Join(destDir, "gone", "user.txt"), []byte("user"), 0o600))
+
+	extractor := NewLayerExtractor(destDir, safepath.NewValidator(), core.ExtractLimits{})
+	require.NoError(t, extractor.Extract(context.Background(), bytes.NewReader(lower)))
+	require.NoError(t, extractor.Extract(context.Background(), bytes.NewReader(upper)))
+
+	readFile := func(name string) string {
+		//nolint:gosec // G304: Test file path is constructed from t.TempDir()
+		data, err := os.ReadFile(filepath.Join(destDir, name))
+		require.NoError(t, err, "read %s", name)
+		return string(data)
+	}
 
-	err = Extract(context.Background(), &gzBuf, destDir, validator, limits)
-	assert.ErrorIs(t, err, core.ErrInvalidArchive)
+	assert.Equal(t, "keep", readFile("keep.txt"))
+	assert.Equal(t, "new", readFile("replace.txt"))
+	assert.Equal(t, "new", readFile("opaque/new.txt"))
+	assert.Equal(t, "user", readFile("gone/user.txt"))
+
+	for _, name := range []string{"removed.txt", ".wh.removed.txt", "gone/file.txt", "opaque/old.txt", "opaque/also.txt", "opaque/.wh..wh..opq"} {
+		_, err := os.Lstat(filepath.Join(destDir, name))
+		assert.True(t, os.IsNotExist(err), "expected %s to be removed", name)
+	}
+}
+
+func TestLayerExtractor_LimitsAcrossLayers(t *testing.T) {
+	t.Parallel()
+
+	var layers [][]byte
+	for _, name := range []string{"a.txt", "b.txt"} {
+		result, err := NewBuilder(nil).Build(context.Background(), fstest.MapFS{
+			name: &fstest.MapFile{Data: []byte("data"), Mode: 0o644},
+		}, core.GzipCompression(), nil)
+		require.NoError(t, err)
+		data, err := io.ReadAll(result.Blob)
+		result.Blob.Close()
+		require.NoError(t, err)
+		layers = append(layers, data)
+	}
+
+	extractor := NewLayerExtractor(t.TempDir(), safepath.NewValidator(), core.ExtractLimits{MaxFiles: 1})
+	require.NoError(t, extractor.Extract(context.Background(), bytes.NewReader(layers[0])))
+	err := extractor.Extract(context.Background(), bytes.NewReader(layers[1]))
+	assert.ErrorIs(t, err, core.ErrExtractLimits)
 }
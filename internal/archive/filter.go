@@ -0,0 +1,86 @@
+package archive
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// Filter selects archive entries by include and exclude glob patterns.
+//
+// Patterns use path.Match syntax and are matched against slash-separated
+// entry paths relative to the archive root. A pattern matches an entry when it
+// matches the entry's path or one of its parent directories, so "docs" selects
+// everything below docs/. Patterns without a slash match a name at any depth,
+// like .gitignore patterns: "*.md" selects every Markdown file.
+//
+// An entry is selected when it matches at least one include pattern (or no
+// include patterns are set) and no exclude pattern. A nil Filter selects all entries.
+type Filter struct {
+	include []string
+	exclude []string
+}
+
+// NewFilter creates a Filter from include and exclude patterns.
+// It returns nil if no patterns are given, and an error for malformed patterns.
+func NewFilter(include, exclude []string) (*Filter, error) {
+	if len(include) == 0 && len(exclude) == 0 {
+		return nil, nil //nolint:nilnil // nil Filter selects all entries
+	}
+
+	f := &Filter{}
+	var err error
+	if f.include, err = cleanPatterns(include); err != nil {
+		return nil, err
+	}
+	if f.exclude, err = cleanPatterns(exclude); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// cleanPatterns normalizes patterns and checks their syntax.
+func cleanPatterns(patterns []string) ([]string, error) {
+	cleaned := make([]string, 0, len(patterns))
+	for _, p := range patterns {
+		c := strings.Trim(path.Clean("/"+p), "/")
+		if c == "" {
+			return nil, fmt.Errorf("invalid pattern %q: matches the archive root", p)
+		}
+		if _, err := path.Match(c, ""); err != nil {
+			return nil, fmt.Errorf("invalid pattern %q: %w", p, err)
+		}
+		cleaned = append(cleaned, c)
+	}
+	return cleaned, nil
+}
+
+// Match reports whether the entry at name is selected.
+// name is a slash-separated path relative to the archive root.
+func (f *Filter) Match(name string) bool {
+	if f == nil {
+		return true
+	}
+	name = cleanEntryName(name)
+	if len(f.include) > 0 && !matchAny(f.include, name) {
+		return false
+	}
+	return !matchAny(f.exclude, name)
+}
+
+// matchAny reports whether any pattern matches name or one of its parents.
+func matchAny(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		anchored := strings.Contains(pattern, "/")
+		for p := name; p != "." && p != ""; p = path.Dir(p) {
+			target := p
+			if !anchored {
+				target = path.Base(p)
+			}
+			if ok, _ := path.Match(pattern, target); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,57 @@
+package archive
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFilter_Match(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		include []string
+		exclude []string
+		path    string
+		want    bool
+	}{
+		{"no include selects all", nil, []string{"*.tmp"}, "a/b.txt", true},
+		{"directory selects descendants", []string{"config"}, nil, "config/sub/app.yaml", true},
+		{"directory itself", []string{"config"}, nil, "config", true},
+		{"unanchored matches at any depth", []string{"*.yaml"}, nil, "deep/dir/app.yaml", true},
+		{"anchored matches from root", []string{"config/*.yaml"}, nil, "config/app.yaml", true},
+		{"anchored does not float", []string{"config/*.yaml"}, nil, "other/config/app.yaml", false},
+		{"anchored glob selects matched directories", []string{"config/*"}, nil, "config/sub/app.yaml", true},
+		{"not included", []string{"config"}, nil, "data/file.txt", false},
+		{"exclude wins", []string{"config"}, []string{"*.key"}, "config/secret.key", false},
+		{"excluded directory", nil, []string{"cache"}, "cache/x/y.bin", false},
+		{"leading ./ is ignored", []string{"./config/"}, nil, "./config/app.yaml", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			f, err := NewFilter(tt.include, tt.exclude)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, f.Match(tt.path))
+		})
+	}
+}
+
+func TestNewFilter(t *testing.T) {
+	t.Parallel()
+
+	f, err := NewFilter(nil, nil)
+	require.NoError(t, err)
+	assert.Nil(t, f)
+	assert.True(t, f.Match("anything"), "nil filter selects all entries")
+
+	_, err = NewFilter([]string{"[abc"}, nil)
+	require.Error(t, err)
+
+	_, err = NewFilter(nil, []string{"/"})
+	require.Error(t, err)
+}
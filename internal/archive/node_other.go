@@ -0,0 +1,45 @@
+//go:build !linux && !darwin
+
+package archive
+
+import (
+	"archive/tar"
+	"errors"
+	"io/fs"
+	"os"
+	"time"
+)
+
+// mknod reports that device and FIFO nodes are not supported on this platform.
+func mknod(path string, _ *tar.Header) error {
+	return &fs.PathError{Op: "mknod", Path: path, Err: errors.ErrUnsupported}
+}
+
+// fileIdentity reports no identity: hard links are not detected on this
+// platform, so every name is written as a regular file.
+func fileIdentity(fs.FileInfo) (inode, bool) {
+	return inode{}, false
+}
+
+// lutimes sets the access and modification times of path to mtime. Symbolic
+// links are left unchanged, since their times cannot be set on this platform.
+func lutimes(path string, mtime time.Time) error {
+	info, err := os.Lstat(path)
+	if err != nil {
+		return err
+	}
+	if info.Mode()&fs.ModeSymlink != 0 {
+		return nil
+	}
+	return os.Chtimes(path, mtime, mtime)
+}
+
+// lsetxattr reports that extended attributes are not supported on this platform.
+func lsetxattr(path, _, _ string) error {
+	return &fs.PathError{Op: "lsetxattr", Path: path, Err: errors.ErrUnsupported}
+}
+
+// lgetxattrs returns no attributes: they are not captured on this platform.
+func lgetxattrs(string) (map[string]string, error) {
+	return nil, nil
+}
@@ -0,0 +1,120 @@
+//go:build linux || darwin
+
+package archive
+
+import (
+	"archive/tar"
+	"errors"
+	"io/fs"
+	"strings"
+	"syscall"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// mknod creates a device or FIFO node for a tar header.
+func mknod(path string, header *tar.Header) error {
+	//nolint:gosec // G115: Mode from tar header, masked to permission bits
+	mode := uint32(header.Mode & 0o7777)
+	switch header.Typeflag {
+	case tar.TypeFifo:
+		return unix.Mkfifo(path, mode)
+	case tar.TypeChar:
+		mode |= unix.S_IFCHR
+	case tar.TypeBlock:
+		mode |= unix.S_IFBLK
+	}
+	//nolint:gosec // G115: Device numbers from tar header
+	dev := unix.Mkdev(uint32(header.Devmajor), uint32(header.Devminor))
+	//nolint:gosec // G115: Device number encoding fits in int on supported platforms
+	return unix.Mknod(path, mode, int(dev))
+}
+
+// fileIdentity returns the device and inode of a regular file that has more
+// than one link, so that its other names can be written as hard links.
+func fileIdentity(info fs.FileInfo) (inode, bool) {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok || !info.Mode().IsRegular() || st.Nlink < 2 {
+		return inode{}, false
+	}
+	//nolint:gosec // G115: Device numbers are never negative
+	return inode{dev: uint64(st.Dev), ino: st.Ino}, true
+}
+
+// lutimes sets the access and modification times of path to mtime without
+// following symbolic links.
+func lutimes(path string, mtime time.Time) error {
+	ts := unix.NsecToTimespec(mtime.UnixNano())
+	return unix.UtimesNanoAt(unix.AT_FDCWD, path, []unix.Timespec{ts, ts}, unix.AT_SYMLINK_NOFOLLOW)
+}
+
+// lsetxattr sets an extended attribute without following symbolic links.
+func lsetxattr(path, name, value string) error {
+	if err := unix.Lsetxattr(path, name, []byte(value), 0); err != nil {
+		return &fs.PathError{Op: "lsetxattr", Path: path, Err: err}
+	}
+	return nil
+}
+
+// lgetxattrs returns the extended attributes of path without following
+// symbolic links. It returns nil if the filesystem does not support them.
+func lgetxattrs(path string) (map[string]string, error) {
+	names, err := listxattr(path)
+	if err != nil {
+		if errors.Is(err, unix.ENOTSUP) {
+			return nil, nil
+		}
+		return nil, &fs.PathError{Op: "llistxattr", Path: path, Err: err}
+	}
+
+	var xattrs map[string]string
+	for _, name := range names {
+		value, err := getxattr(path, name)
+		if err != nil {
+			if errors.Is(err, unix.ENODATA) {
+				continue // removed since listing
+			}
+			return nil, &fs.PathError{Op: "lgetxattr", Path: path, Err: err}
+		}
+		if xattrs == nil {
+			xattrs = make(map[string]string)
+		}
+		xattrs[name] = string(value)
+	}
+	return xattrs, nil
+}
+
+// listxattr returns the names of the extended attributes of path.
+func listxattr(path string) ([]string, error) {
+	size, err := unix.Llistxattr(path, nil)
+	if err != nil || size == 0 {
+		return nil, err
+	}
+	buf := make([]byte, size)
+	size, err = unix.Llistxattr(path, buf)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, name := range strings.Split(string(buf[:size]), "\x00") {
+		if name != "" {
+			names = append(names, name)
+		}
+	}
+	return names, nil
+}
+
+// getxattr returns the value of an extended attribute of path.
+func getxattr(path, name string) ([]byte, error) {
+	size, err := unix.Lgetxattr(path, name, nil)
+	if err != nil || size == 0 {
+		return nil, err
+	}
+	buf := make([]byte, size)
+	size, err = unix.Lgetxattr(path, name, buf)
+	if err != nil {
+		return nil, err
+	}
+	return buf[:size], nil
+}
@@ -13,6 +13,7 @@ var (
 	_ fs.StatFS    = (*osFS)(nil)
 	_ lstatFS      = (*osFS)(nil)
 	_ readLinkFS   = (*osFS)(nil)
+	_ xattrFS      = (*osFS)(nil)
 )
 
 // OSFS returns a filesystem rooted at the given directory path.
@@ -68,3 +69,12 @@ func (o *osFS) Stat(name string) (fs.FileInfo, error) {
 	}
 	return os.Stat(filepath.Join(o.root, name))
 }
+
+// Xattrs returns the extended attributes of the named file without following
+// symlinks. It returns nil where extended attributes are unsupported.
+func (o *osFS) Xattrs(name string) (map[string]string, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "xattrs", Path: name, Err: fs.ErrInvalid}
+	}
+	return lgetxattrs(filepath.Join(o.root, name))
+}
@@ -0,0 +1,160 @@
+package archive
+
+import (
+	"archive/tar"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/containerd/stargz-snapshotter/estargz"
+
+	"github.com/meigma/blobber/core"
+)
+
+// landmarkContents is the payload of eStargz landmark entries.
+const landmarkContents = 0xf
+
+// entryWriter writes a single entry of src to the archive. It may return
+// fs.SkipDir for a directory to skip the directory and its contents.
+type entryWriter func(name string, d fs.DirEntry) error
+
+// writeEntries calls write for every entry of src in walk order.
+//
+// If prioritized is non-empty, those entries (with their parent directories)
+// are written first, in the given order, followed by the eStargz prefetch
+// landmark. Prioritized directories include their whole subtree. Lazy readers
+// fetch everything before the landmark up front, so prioritized files are
+// local as soon as they are needed.
+func writeEntries(ctx context.Context, tw *tar.Writer, src fs.FS, prioritized []string, write entryWriter) error {
+	written := make(map[string]bool)
+	visit := func(name string, d fs.DirEntry) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if written[name] {
+			return nil
+		}
+		if err := write(name, d); err != nil {
+			return err
+		}
+		written[name] = true
+		return nil
+	}
+
+	if len(prioritized) > 0 {
+		for _, name := range prioritized {
+			if err := writePrioritized(src, name, visit); err != nil {
+				return err
+			}
+		}
+		if err := tw.WriteHeader(&tar.Header{
+			Typeflag: tar.TypeReg,
+			Name:     estargz.PrefetchLandmark,
+			Mode:     0o644,
+			Size:     1,
+		}); err != nil {
+			return fmt.Errorf("write prefetch landmark: %w", err)
+		}
+		if _, err := tw.Write([]byte{landmarkContents}); err != nil {
+			return fmt.Errorf("write prefetch landmark: %w", err)
+		}
+	}
+
+	return fs.WalkDir(src, ".", func(name string, d fs.DirEntry, walkErr error) error {
+		if walkErr != nil {
+			return walkErr
+		}
+		return visit(name, d)
+	})
+}
+
+// writePrioritized visits the parent directories of name, then name itself
+// and, for a directory, everything below it.
+func writePrioritized(src fs.FS, name string, visit entryWriter) error {
+	dirs := []string{"."}
+	for dir := path.Dir(name); dir != "."; dir = path.Dir(dir) {
+		dirs = append(dirs, dir)
+	}
+	slices.Reverse(dirs[1:])
+	for _, dir := range dirs {
+		d, err := statDirEntry(src, dir)
+		if err != nil {
+			return fmt.Errorf("prioritized file %s: %w", name, err)
+		}
+		if err := visit(dir, d); err != nil {
+			if errors.Is(err, fs.SkipDir) {
+				// Nothing below dir is written, so neither is name.
+				return nil
+			}
+			return err
+		}
+	}
+
+	d, err := statDirEntry(src, name)
+	if err != nil {
+		return fmt.Errorf("prioritized file %s: %w", name, err)
+	}
+	if !d.IsDir() {
+		return visit(name, d)
+	}
+	return fs.WalkDir(src, name, func(p string, d fs.DirEntry, walkErr error) error {
+		if walkErr != nil {
+			return walkErr
+		}
+		return visit(p, d)
+	})
+}
+
+// statDirEntry returns the directory entry of name without following symlinks.
+func statDirEntry(src fs.FS, name string) (fs.DirEntry, error) {
+	if name == "." {
+		info, err := fs.Stat(src, name)
+		if err != nil {
+			return nil, err
+		}
+		return fs.FileInfoToDirEntry(info), nil
+	}
+
+	entries, err := fs.ReadDir(src, path.Dir(name))
+	if err != nil {
+		return nil, err
+	}
+	base := path.Base(name)
+	for _, d := range entries {
+		if d.Name() == base {
+			return d, nil
+		}
+	}
+	return nil, fs.ErrNotExist
+}
+
+// prioritizedFiles returns the cleaned prioritized files of opts.
+func prioritizedFiles(opts *core.BuildOptions) ([]string, error) {
+	if opts == nil || len(opts.PrioritizedFiles) == 0 {
+		return nil, nil
+	}
+	return cleanPrioritizedFiles(opts.PrioritizedFiles)
+}
+
+// cleanPrioritizedFiles normalizes prioritized file paths to slash-separated
+// paths relative to the source root, dropping duplicates.
+// It returns an error for paths that escape the root.
+func cleanPrioritizedFiles(files []string) ([]string, error) {
+	seen := make(map[string]bool, len(files))
+	cleaned := make([]string, 0, len(files))
+	for _, f := range files {
+		name := path.Clean(strings.TrimPrefix(strings.TrimSpace(f), "/"))
+		if name == "." || !fs.ValidPath(name) {
+			return nil, fmt.Errorf("invalid prioritized file %q", f)
+		}
+		if !seen[name] {
+			seen[name] = true
+			cleaned = append(cleaned, name)
+		}
+	}
+	return cleaned, nil
+}
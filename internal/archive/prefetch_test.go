@@ -0,0 +1,171 @@
+package archive
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+
+	"github.com/containerd/stargz-snapshotter/estargz"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/meigma/blobber/core"
+	"github.com/meigma/blobber/internal/safepath"
+)
+
+// openBuilt opens the blob of a build result as an eStargz reader.
+func openBuilt(t *testing.T, result *core.BuildResult) *estargz.Reader {
+	t.Helper()
+	defer result.Blob.Close()
+
+	data, err := io.ReadAll(result.Blob)
+	require.NoError(t, err)
+
+	r, err := estargz.Open(io.NewSectionReader(bytes.NewReader(data), 0, int64(len(data))))
+	require.NoError(t, err)
+	return r
+}
+
+// chunkOffset returns the blob offset of the first chunk of a regular file.
+func chunkOffset(t *testing.T, r *estargz.Reader, name string) int64 {
+	t.Helper()
+	e, ok := r.Lookup(name)
+	require.True(t, ok, "missing %s", name)
+	return e.Offset
+}
+
+func TestBuild_PrioritizedFiles(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	builder := NewBuilder(nil)
+	src := fstest.MapFS{
+		"a.txt":           &fstest.MapFile{Data: []byte("a"), Mode: 0o644},
+		"bin/app":         &fstest.MapFile{Data: []byte("app"), Mode: 0o755},
+		"etc/conf/x.yaml": &fstest.MapFile{Data: []byte("x"), Mode: 0o644},
+		"etc/conf/y.yaml": &fstest.MapFile{Data: []byte("y"), Mode: 0o644},
+		"z.txt":           &fstest.MapFile{Data: []byte("z"), Mode: 0o644},
+	}
+
+	t.Run("places prioritized files before the landmark", func(t *testing.T) {
+		t.Parallel()
+
+		result, err := builder.Build(ctx, src, core.GzipCompression(), &core.BuildOptions{
+			PrioritizedFiles: []string{"./bin/app", "etc/conf", "bin/app"},
+		})
+		require.NoError(t, err)
+		r := openBuilt(t, result)
+
+		landmark := chunkOffset(t, r, estargz.PrefetchLandmark)
+		for _, name := range []string{"bin/app", "etc/conf/x.yaml", "etc/conf/y.yaml"} {
+			assert.Less(t, chunkOffset(t, r, name), landmark, name)
+		}
+		for _, name := range []string{"a.txt", "z.txt"} {
+			assert.Greater(t, chunkOffset(t, r, name), landmark, name)
+		}
+		assert.Less(t, chunkOffset(t, r, "bin/app"), chunkOffset(t, r, "etc/conf/x.yaml"), "given order is kept")
+
+		// Every entry is written exactly once.
+		root, ok := r.Lookup("")
+		require.True(t, ok)
+		var names []string
+		var walk func(dir string, e *estargz.TOCEntry)
+		walk = func(dir string, e *estargz.TOCEntry) {
+			e.ForeachChild(func(base string, child *estargz.TOCEntry) bool {
+				names = append(names, dir+base)
+				if child.Type == "dir" {
+					walk(dir+base+"/", child)
+				}
+				return true
+			})
+		}
+		walk("", root)
+		assert.ElementsMatch(t, []string{
+			"a.txt", "bin", "bin/app", "etc", "etc/conf", "etc/conf/x.yaml", "etc/conf/y.yaml", "z.txt",
+			estargz.PrefetchLandmark,
+		}, names)
+	})
+
+	t.Run("extraction skips the landmark", func(t *testing.T) {
+		t.Parallel()
+
+		result, err := builder.Build(ctx, src, core.GzipCompression(), &core.BuildOptions{
+			PrioritizedFiles: []string{"bin/app"},
+		})
+		require.NoError(t, err)
+		defer result.Blob.Close()
+
+		destDir := t.TempDir()
+		require.NoError(t, Extract(ctx, result.Blob, destDir, safepath.NewValidator(), core.ExtractLimits{}))
+
+		_, err = os.Lstat(filepath.Join(destDir, estargz.PrefetchLandmark))
+		require.ErrorIs(t, err, fs.ErrNotExist)
+		_, err = os.Stat(filepath.Join(destDir, "bin", "app"))
+		require.NoError(t, err)
+	})
+
+	t.Run("no landmark without prioritized files", func(t *testing.T) {
+		t.Parallel()
+
+		result, err := builder.Build(ctx, src, core.GzipCompression(), nil)
+		require.NoError(t, err)
+		r := openBuilt(t, result)
+
+		_, ok := r.Lookup(estargz.PrefetchLandmark)
+		assert.False(t, ok)
+	})
+
+	t.Run("missing file fails", func(t *testing.T) {
+		t.Parallel()
+
+		_, err := builder.Build(ctx, src, core.GzipCompression(), &core.BuildOptions{
+			PrioritizedFiles: []string{"missing.txt"},
+		})
+		require.ErrorIs(t, err, fs.ErrNotExist)
+	})
+
+	t.Run("path outside the root fails", func(t *testing.T) {
+		t.Parallel()
+
+		_, err := builder.Build(ctx, src, core.GzipCompression(), &core.BuildOptions{
+			PrioritizedFiles: []string{"../etc/passwd"},
+		})
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "invalid prioritized file")
+	})
+}
+
+func TestBuildDiff_PrioritizedFiles(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	builder := NewBuilder(nil)
+
+	base := buildTOC(t, func() (*core.BuildResult, error) {
+		return builder.Build(ctx, fstest.MapFS{
+			"same.txt":    &fstest.MapFile{Data: []byte("same"), Mode: 0o644},
+			"changed.txt": &fstest.MapFile{Data: []byte("old"), Mode: 0o644},
+		}, core.GzipCompression(), nil)
+	})
+
+	result, err := builder.BuildDiff(ctx, fstest.MapFS{
+		"same.txt":    &fstest.MapFile{Data: []byte("same"), Mode: 0o644},
+		"changed.txt": &fstest.MapFile{Data: []byte("new"), Mode: 0o644},
+		"added.txt":   &fstest.MapFile{Data: []byte("added"), Mode: 0o644},
+	}, base, core.GzipCompression(), &core.BuildOptions{
+		PrioritizedFiles: []string{"same.txt", "changed.txt"},
+	})
+	require.NoError(t, err)
+	r := openBuilt(t, result)
+
+	// Unchanged prioritized files stay in the base layer.
+	_, ok := r.Lookup("same.txt")
+	assert.False(t, ok)
+	assert.Less(t, chunkOffset(t, r, "changed.txt"), chunkOffset(t, r, estargz.PrefetchLandmark))
+	assert.Greater(t, chunkOffset(t, r, "added.txt"), chunkOffset(t, r, estargz.PrefetchLandmark))
+}
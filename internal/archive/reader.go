@@ -3,6 +3,7 @@ package archive
 import (
 	"fmt"
 	"io"
+	"maps"
 
 	"github.com/containerd/stargz-snapshotter/estargz"
 	"github.com/containerd/stargz-snapshotter/estargz/zstdchunked"
@@ -90,13 +91,21 @@ func (r *Reader) OpenFile(ra io.ReaderAt, size int64, entry core.TOCEntry) (io.R
 // convertTOCEntry converts an estargz.TOCEntry to core.TOCEntry.
 func convertTOCEntry(e *estargz.TOCEntry) core.TOCEntry {
 	return core.TOCEntry{
-		Name:       e.Name,
-		Type:       e.Type,
-		Size:       e.Size,
-		Mode:       e.Mode,
-		Offset:     e.Offset,
-		LinkName:   e.LinkName,
-		ChunkSize:  e.ChunkSize,
-		ChunkCount: 0, // Derived from chunk entries if needed, not NumLink
+		Name:        e.Name,
+		Type:        e.Type,
+		Size:        e.Size,
+		Mode:        e.Mode,
+		Offset:      e.Offset,
+		LinkName:    e.LinkName,
+		ChunkSize:   e.ChunkSize,
+		ChunkCount:  0, // Derived from chunk entries if needed, not NumLink
+		Digest:      e.Digest,
+		ChunkDigest: e.ChunkDigest,
+		ModTime:     e.ModTime(),
+		UID:         e.UID,
+		GID:         e.GID,
+		Uname:       e.Uname,
+		Gname:       e.Gname,
+		Xattrs:      maps.Clone(e.Xattrs),
 	}
 }
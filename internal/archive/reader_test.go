@@ -26,7 +26,7 @@ func TestReader_ReadTOC(t *testing.T) {
 	}
 
 	builder := NewBuilder(nil)
-	result, err := builder.Build(context.Background(), testFS, core.GzipCompression())
+	result, err := builder.Build(context.Background(), testFS, core.GzipCompression(), nil)
 	require.NoError(t, err)
 	defer result.Blob.Close()
 
@@ -66,7 +66,7 @@ func TestReader_ReadTOC_Zstd(t *testing.T) {
 	}
 
 	builder := NewBuilder(nil)
-	result, err := builder.Build(context.Background(), testFS, core.ZstdCompression())
+	result, err := builder.Build(context.Background(), testFS, core.ZstdCompression(), nil)
 	require.NoError(t, err)
 	defer result.Blob.Close()
 
@@ -101,7 +101,7 @@ func TestReader_OpenFile(t *testing.T) {
 	}
 
 	builder := NewBuilder(nil)
-	result, err := builder.Build(context.Background(), testFS, core.GzipCompression())
+	result, err := builder.Build(context.Background(), testFS, core.GzipCompression(), nil)
 	require.NoError(t, err)
 	defer result.Blob.Close()
 
@@ -146,7 +146,7 @@ func TestReader_OpenFile_Zstd(t *testing.T) {
 	}
 
 	builder := NewBuilder(nil)
-	result, err := builder.Build(context.Background(), testFS, core.ZstdCompression())
+	result, err := builder.Build(context.Background(), testFS, core.ZstdCompression(), nil)
 	require.NoError(t, err)
 	defer result.Blob.Close()
 
@@ -185,7 +185,7 @@ func TestReader_OpenFile_Missing(t *testing.T) {
 	}
 
 	builder := NewBuilder(nil)
-	result, err := builder.Build(context.Background(), testFS, core.GzipCompression())
+	result, err := builder.Build(context.Background(), testFS, core.GzipCompression(), nil)
 	require.NoError(t, err)
 	defer result.Blob.Close()
 
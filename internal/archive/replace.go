@@ -0,0 +1,111 @@
+package archive
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// stagingInfix marks the sibling directories created by StagingDir.
+const stagingInfix = ".blobber-"
+
+// StagingDir creates an empty directory next to dest, on the same filesystem,
+// to extract into before ReplaceDir swaps it in. The directory takes the
+// permissions of dest, or 0750 if dest does not exist.
+func StagingDir(dest string) (string, error) {
+	dest = filepath.Clean(dest)
+	parent := filepath.Dir(dest)
+	if err := os.MkdirAll(parent, 0o750); err != nil {
+		return "", fmt.Errorf("create parent directory: %w", err)
+	}
+
+	perm := fs.FileMode(0o750)
+	if info, err := os.Stat(dest); err == nil && info.IsDir() {
+		perm = info.Mode().Perm()
+	}
+	staging, err := os.MkdirTemp(parent, "."+filepath.Base(dest)+stagingInfix+"*")
+	if err != nil {
+		return "", fmt.Errorf("create staging directory: %w", err)
+	}
+	if err := os.Chmod(staging, perm); err != nil {
+		os.Remove(staging)
+		return "", fmt.Errorf("create staging directory: %w", err)
+	}
+	return staging, nil
+}
+
+// ReplaceDir replaces dest with the staging directory created by StagingDir.
+// Readers of dest see either the previous or the new contents, never a mix.
+//
+// If dest is a symbolic link, a link to staging is renamed over it, and
+// staging stays in place as the new target. If dest is a directory, the two
+// are exchanged atomically where the platform supports it; elsewhere dest is
+// renamed aside first, so it is briefly missing. A missing dest is created.
+//
+// On success, ReplaceDir returns the path now holding the previous contents,
+// which the caller should remove, or "" if there is nothing to remove. On
+// failure, dest is unchanged.
+func ReplaceDir(staging, dest string) (string, error) {
+	dest = filepath.Clean(dest)
+	info, err := os.Lstat(dest)
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		return "", os.Rename(staging, dest)
+	case err != nil:
+		return "", err
+	case info.Mode()&fs.ModeSymlink != 0:
+		return flipSymlink(staging, dest)
+	case !info.IsDir():
+		return "", &fs.PathError{Op: "replace", Path: dest, Err: errors.New("not a directory")}
+	}
+
+	err = exchange(staging, dest)
+	if err == nil {
+		return staging, nil
+	}
+	if !errors.Is(err, errors.ErrUnsupported) {
+		return "", err
+	}
+
+	old := staging + ".old"
+	if err := os.Rename(dest, old); err != nil {
+		return "", err
+	}
+	if err := os.Rename(staging, dest); err != nil {
+		if restoreErr := os.Rename(old, dest); restoreErr != nil {
+			return "", errors.Join(err, fmt.Errorf("restore %s: %w", dest, restoreErr))
+		}
+		return "", err
+	}
+	return old, nil
+}
+
+// flipSymlink points the symbolic link dest at staging by renaming a new link
+// over it. The previous target is returned for removal only if it is a
+// staging directory of dest, as created by an earlier replacement.
+func flipSymlink(staging, dest string) (string, error) {
+	target, err := os.Readlink(dest)
+	if err != nil {
+		return "", err
+	}
+
+	tmpLink := staging + ".link"
+	if err := os.Symlink(filepath.Base(staging), tmpLink); err != nil {
+		return "", err
+	}
+	if err := os.Rename(tmpLink, dest); err != nil {
+		os.Remove(tmpLink)
+		return "", err
+	}
+
+	if !filepath.IsAbs(target) {
+		target = filepath.Join(filepath.Dir(dest), target)
+	}
+	if filepath.Dir(target) == filepath.Dir(dest) && strings.HasPrefix(filepath.Base(target), "."+filepath.Base(dest)+stagingInfix) {
+		return target, nil
+	}
+	return "", nil
+}
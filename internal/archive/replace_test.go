@@ -0,0 +1,62 @@
+package archive
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReplaceDir(t *testing.T) {
+	t.Parallel()
+
+	t.Run("creates a missing destination", func(t *testing.T) {
+		t.Parallel()
+
+		dest := filepath.Join(t.TempDir(), "out")
+		staging, err := StagingDir(dest)
+		require.NoError(t, err)
+		require.NoError(t, os.WriteFile(filepath.Join(staging, "a.txt"), []byte("a"), 0o644))
+
+		old, err := ReplaceDir(staging, dest)
+		require.NoError(t, err)
+		assert.Empty(t, old)
+		assert.FileExists(t, filepath.Join(dest, "a.txt"))
+		assert.NoDirExists(t, staging)
+	})
+
+	t.Run("swaps an existing directory", func(t *testing.T) {
+		t.Parallel()
+
+		dest := filepath.Join(t.TempDir(), "out")
+		require.NoError(t, os.Mkdir(dest, 0o700))
+		require.NoError(t, os.WriteFile(filepath.Join(dest, "old.txt"), []byte("old"), 0o644))
+		staging, err := StagingDir(dest)
+		require.NoError(t, err)
+		info, err := os.Stat(staging)
+		require.NoError(t, err)
+		assert.Equal(t, os.FileMode(0o700), info.Mode().Perm(), "staging takes the permissions of dest")
+		require.NoError(t, os.WriteFile(filepath.Join(staging, "new.txt"), []byte("new"), 0o644))
+
+		old, err := ReplaceDir(staging, dest)
+		require.NoError(t, err)
+		assert.FileExists(t, filepath.Join(dest, "new.txt"))
+		assert.NoFileExists(t, filepath.Join(dest, "old.txt"))
+		assert.FileExists(t, filepath.Join(old, "old.txt"), "previous contents are returned for removal")
+	})
+
+	t.Run("rejects a file", func(t *testing.T) {
+		t.Parallel()
+
+		dest := filepath.Join(t.TempDir(), "out")
+		require.NoError(t, os.WriteFile(dest, []byte("file"), 0o644))
+		staging, err := StagingDir(dest)
+		require.NoError(t, err)
+
+		_, err = ReplaceDir(staging, dest)
+		require.Error(t, err)
+		assert.FileExists(t, dest)
+	})
+}
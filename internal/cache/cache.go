@@ -30,6 +30,10 @@ type Cache struct {
 	logger       *slog.Logger
 	verifyOnRead bool
 
+	// parallel download configuration (see SetParallelDownload)
+	parallelDownloads int
+	chunkSize         int64
+
 	mu sync.RWMutex
 }
 
@@ -534,8 +538,19 @@ func (c *Cache) downloadBlob(ctx context.Context, ref string, desc core.LayerDes
 		return nil // Another goroutine completed the download
 	}
 
-	// Check for existing partial download
 	partialPath := blobPath + ".partial"
+
+	// Parallel download fetches missing chunks concurrently, resuming any partial download.
+	if c.useParallelDownload(desc.Size) {
+		parallelErr := c.parallelDownload(ctx, ref, desc, partialPath, entryPath, entry)
+		if !errors.Is(parallelErr, core.ErrRangeNotSupported) {
+			return parallelErr
+		}
+		c.logger.Debug("range requests not supported, falling back to full download")
+		return c.fullDownload(ctx, ref, desc, blobPath, entryPath)
+	}
+
+	// Check for existing partial download
 	if entry != nil && !entry.Complete && len(entry.Ranges) > 0 {
 		// Try to resume partial download
 		if resumeErr := c.resumeDownload(ctx, ref, desc, partialPath, entryPath, entry); resumeErr != nil {
@@ -688,6 +703,14 @@ func (c *Cache) resumeDownload(ctx context.Context, ref string, desc core.LayerD
 		updatedRanges = addRange(updatedRanges, Range{Offset: gap.Offset, Length: written})
 	}
 
+	entry.Ranges = updatedRanges
+	return c.completePartial(f, ref, desc, partialPath, entryPath, entry)
+}
+
+// completePartial verifies a fully downloaded partial file against the blob
+// digest and moves it into place as a complete cache entry. On digest mismatch,
+// the partial file and entry are removed so the next download starts fresh.
+func (c *Cache) completePartial(f *os.File, ref string, desc core.LayerDescriptor, partialPath, entryPath string, entry *Entry) error {
 	// Sync the file
 	if err := f.Sync(); err != nil {
 		return fmt.Errorf("sync partial file: %w", err)
@@ -708,7 +731,7 @@ func (c *Cache) resumeDownload(ctx context.Context, ref string, desc core.LayerD
 		// Digest mismatch - remove partial and force full download
 		os.Remove(partialPath)
 		os.Remove(entryPath)
-		return fmt.Errorf("digest mismatch after resume: expected %s, got %s", desc.Digest, computedHash)
+		return fmt.Errorf("digest mismatch after range download: expected %s, got %s", desc.Digest, computedHash)
 	}
 
 	// Rename partial to final
@@ -726,7 +749,7 @@ func (c *Cache) resumeDownload(ctx context.Context, ref string, desc core.LayerD
 		c.logger.Warn("failed to save completed entry", "error", err)
 	}
 
-	c.logger.Debug("resumed download complete", "digest", desc.Digest)
+	c.logger.Debug("range download complete", "digest", desc.Digest)
 	return nil
 }
 
@@ -755,6 +778,20 @@ func writeRangeToFile(f *os.File, reader io.Reader, offset, expectedLength int64
 	return written, nil
 }
 
+// writeRangeAt writes exactly length bytes from reader to f at offset.
+// Unlike writeRangeToFile, it does not move the file offset, so concurrent
+// writers can fill different ranges of the same file.
+func writeRangeAt(f *os.File, reader io.Reader, offset, length int64) error {
+	written, err := io.Copy(io.NewOffsetWriter(f, offset), io.LimitReader(reader, length))
+	if err != nil {
+		return fmt.Errorf("copy data: %w", err)
+	}
+	if written != length {
+		return fmt.Errorf("length mismatch: expected %d, got %d", length, written)
+	}
+	return nil
+}
+
 // savePartialProgress saves the current download progress to the entry file.
 func (c *Cache) savePartialProgress(entryPath string, entry *Entry, ranges []Range, ref string, desc core.LayerDescriptor) {
 	entry.Ranges = ranges
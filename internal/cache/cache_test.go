@@ -5,9 +5,11 @@ import (
 	"context"
 	"crypto/sha256"
 	"encoding/hex"
+	"errors"
 	"io"
 	"os"
 	"path/filepath"
+	"sync"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -18,8 +20,11 @@ import (
 
 // mockRegistry is a test double for contracts.Registry.
 type mockRegistry struct {
-	blobs         map[string][]byte
-	rangeSupport  bool
+	blobs        map[string][]byte
+	rangeSupport bool
+	failOffset   int64 // range requests starting here fail when > 0
+
+	mu            sync.Mutex
 	rangeRequests []rangeRequest
 }
 
@@ -44,6 +49,14 @@ func (m *mockRegistry) Push(_ context.Context, _ string, _ io.Reader, _ *core.Re
 	return "", nil
 }
 
+func (m *mockRegistry) PushIndex(_ context.Context, _ string, _ []core.IndexManifest, _ core.TagCondition) (string, error) {
+	return "", nil
+}
+
+func (m *mockRegistry) Copy(_ context.Context, _, _ string, _ core.TagCondition) (string, error) {
+	return "", nil
+}
+
 func (m *mockRegistry) Pull(_ context.Context, _ string) (io.ReadCloser, int64, error) {
 	return nil, 0, nil
 }
@@ -56,6 +69,10 @@ func (m *mockRegistry) ResolveLayer(_ context.Context, _ string) (core.LayerDesc
 	return core.LayerDescriptor{}, nil
 }
 
+func (m *mockRegistry) ResolveLayers(_ context.Context, _ string) ([]core.LayerDescriptor, error) {
+	return []core.LayerDescriptor{{}}, nil
+}
+
 func (m *mockRegistry) FetchBlob(_ context.Context, _ string, desc core.LayerDescriptor) (io.ReadCloser, error) {
 	data, ok := m.blobs[desc.Digest]
 	if !ok {
@@ -74,12 +91,18 @@ func (m *mockRegistry) FetchBlobRange(_ context.Context, _ string, desc core.Lay
 		return nil, core.ErrNotFound
 	}
 
+	if m.failOffset > 0 && offset == m.failOffset {
+		return nil, errors.New("injected range failure")
+	}
+
 	// Track the range request
+	m.mu.Lock()
 	m.rangeRequests = append(m.rangeRequests, rangeRequest{
 		digest: desc.Digest,
 		offset: offset,
 		length: length,
 	})
+	m.mu.Unlock()
 
 	// Return the requested range
 	end := offset + length
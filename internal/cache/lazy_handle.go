@@ -13,13 +13,21 @@ import (
 	"github.com/meigma/blobber/internal/contracts"
 )
 
-// Compile-time interface check.
-var _ contracts.BlobHandle = (*lazyHandle)(nil)
+// Compile-time interface checks.
+var (
+	_ contracts.BlobHandle      = (*lazyHandle)(nil)
+	_ contracts.RangePrefetcher = (*lazyHandle)(nil)
+)
 
 // lazyHandle implements contracts.BlobHandle with on-demand range fetching.
 // It fetches only the byte ranges that are actually read, caching them
 // to disk for future access. This enables efficient selective file access
 // from eStargz archives without downloading the entire blob.
+//
+// The lock is never held during network I/O. Missing ranges are fetched
+// concurrently, and a range already being fetched for one reader is awaited
+// by other readers that need it rather than fetched again. Readers of cached
+// ranges are never blocked by fetches of other ranges.
 type lazyHandle struct {
 	cache    *Cache
 	ref      string
@@ -28,12 +36,21 @@ type lazyHandle struct {
 	cancelFn context.CancelFunc
 
 	mu        sync.RWMutex
-	file      *os.File // The cached file (may be sparse/partial)
-	entry     *Entry   // Tracked ranges and metadata
-	entryPath string   // Path to entry metadata file
+	file      *os.File      // The cached file (may be sparse/partial)
+	entry     *Entry        // Tracked ranges and metadata
+	entryPath string        // Path to entry metadata file
+	inflight  []*rangeFetch // Ranges currently being fetched
 	closed    bool
 }
 
+// rangeFetch is a range fetch in progress. done is closed once the data is
+// written to the file (or the fetch failed), after which err is set.
+type rangeFetch struct {
+	Range
+	done chan struct{}
+	err  error
+}
+
 // newLazyHandle creates a lazy handle for on-demand blob fetching.
 // The file should be opened or created with read/write access.
 func newLazyHandle(
@@ -60,73 +77,108 @@ func newLazyHandle(
 
 // ReadAt implements io.ReaderAt with on-demand fetching.
 // If the requested range is not cached, it fetches from the registry.
+// Concurrent calls for different ranges fetch in parallel.
 func (h *lazyHandle) ReadAt(p []byte, off int64) (n int, err error) {
 	if len(p) == 0 {
 		return 0, nil
 	}
 
-	h.mu.Lock()
-	defer h.mu.Unlock()
+	if err := h.ensureRange(off, int64(len(p))); err != nil {
+		return 0, err
+	}
 
+	h.mu.RLock()
+	defer h.mu.RUnlock()
 	if h.closed {
 		return 0, core.ErrClosed
 	}
+	return h.file.ReadAt(p, off)
+}
 
-	length := int64(len(p))
+// PrefetchRange implements contracts.RangePrefetcher.
+func (h *lazyHandle) PrefetchRange(off, length int64) error {
+	return h.ensureRange(off, length)
+}
 
-	// Check if we have this range cached
-	if h.entry.Complete || containsRange(h.entry.Ranges, off, length) {
-		return h.file.ReadAt(p, off)
-	}
+// ensureRange makes the given range available in the file, fetching missing
+// parts and waiting for parts that other readers are already fetching.
+func (h *lazyHandle) ensureRange(off, length int64) error {
+	requestEnd := min(off+length, h.desc.Size)
 
-	// Need to fetch missing data
-	if err := h.fetchMissingRanges(off, length); err != nil {
-		return 0, fmt.Errorf("fetch range: %w", err)
+	h.mu.Lock()
+	if h.closed {
+		h.mu.Unlock()
+		return core.ErrClosed
 	}
-
-	return h.file.ReadAt(p, off)
-}
-
-// fetchMissingRanges fetches any byte ranges not already cached.
-// Caller must hold h.mu lock.
-func (h *lazyHandle) fetchMissingRanges(off, length int64) error {
-	// Calculate what we need to fetch
-	requestEnd := off + length
-	if requestEnd > h.desc.Size {
-		requestEnd = h.desc.Size
+	if h.entry.Complete || requestEnd <= off {
+		h.mu.Unlock()
+		return nil
 	}
 
-	// Find gaps in the cached ranges that overlap with our request
-	gaps := findGapsInRange(h.entry.Ranges, off, requestEnd-off)
-	if len(gaps) == 0 {
-		return nil // Everything is cached
+	// Wait for overlapping fetches in flight and start fetches for the rest.
+	var wait, own []*rangeFetch
+	busy := make([]Range, 0, len(h.inflight))
+	for _, f := range h.inflight {
+		if f.Offset < requestEnd && f.End() > off {
+			wait = append(wait, f)
+		}
+		busy = append(busy, f.Range)
 	}
-
-	// Fetch each gap
-	for _, gap := range gaps {
-		if err := h.ctx.Err(); err != nil {
-			h.saveProgress()
-			return err
+	for _, gap := range findGapsInRange(h.entry.Ranges, off, requestEnd-off) {
+		for _, missing := range findGapsInRange(busy, gap.Offset, gap.Length) {
+			f := &rangeFetch{Range: missing, done: make(chan struct{})}
+			h.inflight = append(h.inflight, f)
+			own = append(own, f)
+		}
+	}
+	h.mu.Unlock()
+
+	// Fetch all but the last range in the background, the last one inline.
+	for i, f := range own {
+		if i == len(own)-1 {
+			h.fetch(f)
+		} else {
+			go h.fetch(f)
 		}
+	}
 
-		// Fetch the range from registry
-		reader, err := h.cache.fallback.FetchBlobRange(h.ctx, h.ref, h.desc, gap.Offset, gap.Length)
-		if err != nil {
-			h.saveProgress()
-			return fmt.Errorf("fetch blob range at %d: %w", gap.Offset, err)
+	var firstErr error
+	for _, f := range append(own, wait...) {
+		<-f.done
+		if f.err != nil && firstErr == nil {
+			firstErr = f.err
 		}
+	}
+	if firstErr != nil {
+		return fmt.Errorf("fetch range: %w", firstErr)
+	}
+	return nil
+}
+
+// fetch downloads a single range into the file and records the result.
+func (h *lazyHandle) fetch(f *rangeFetch) {
+	err := h.ctx.Err()
+	if err == nil {
+		err = h.fetchRange(f.Range)
+	}
 
-		// Write to file at the correct offset
-		written, writeErr := writeRangeToFile(h.file, reader, gap.Offset, gap.Length)
-		reader.Close()
-		if writeErr != nil {
-			h.saveProgress()
-			return fmt.Errorf("write range at %d: %w", gap.Offset, writeErr)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for i, other := range h.inflight {
+		if other == f {
+			h.inflight = append(h.inflight[:i], h.inflight[i+1:]...)
+			break
 		}
+	}
+	f.err = err
+	close(f.done)
 
-		// Update tracked ranges
-		h.entry.Ranges = addRange(h.entry.Ranges, Range{Offset: gap.Offset, Length: written})
+	if err != nil || h.closed {
+		h.saveProgress()
+		return
 	}
+	h.entry.Ranges = addRange(h.entry.Ranges, f.Range)
 
 	// Check if we now have the complete blob
 	if isComplete(h.entry.Ranges, h.desc.Size) {
@@ -138,6 +190,25 @@ func (h *lazyHandle) fetchMissingRanges(off, length int64) error {
 
 	// Save progress
 	h.saveProgress()
+}
+
+// fetchRange fetches a range from the registry and writes it to the file.
+// It does not hold h.mu. The file is not replaced while fetches are in
+// flight, since the blob cannot be complete until they finish.
+func (h *lazyHandle) fetchRange(r Range) error {
+	reader, err := h.cache.fallback.FetchBlobRange(h.ctx, h.ref, h.desc, r.Offset, r.Length)
+	if err != nil {
+		return fmt.Errorf("fetch blob range at %d: %w", r.Offset, err)
+	}
+	defer reader.Close()
+
+	h.mu.RLock()
+	file := h.file
+	h.mu.RUnlock()
+
+	if err := writeRangeAt(file, reader, r.Offset, r.Length); err != nil {
+		return fmt.Errorf("write range at %d: %w", r.Offset, err)
+	}
 	return nil
 }
 
@@ -5,8 +5,10 @@ import (
 	"context"
 	"crypto/sha256"
 	"encoding/hex"
+	"io"
 	"os"
 	"path/filepath"
+	"sync"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -227,6 +229,115 @@ func TestLazyHandle_ConcurrentReads(t *testing.T) {
 	}
 }
 
+// blockingRegistry holds range requests until release is closed.
+type blockingRegistry struct {
+	*mockRegistry
+	started chan int64
+	release chan struct{}
+}
+
+func (b *blockingRegistry) FetchBlobRange(ctx context.Context, ref string, desc core.LayerDescriptor, offset, length int64) (io.ReadCloser, error) {
+	b.started <- offset
+	<-b.release
+	return b.mockRegistry.FetchBlobRange(ctx, ref, desc, offset, length)
+}
+
+func TestLazyHandle_InflightFetches(t *testing.T) {
+	t.Parallel()
+
+	content := bytes.Repeat([]byte("inflight test data "), 20)
+	hash := sha256.Sum256(content)
+	digest := "sha256:" + hex.EncodeToString(hash[:])
+	desc := core.LayerDescriptor{
+		Digest:    digest,
+		Size:      int64(len(content)),
+		MediaType: "application/vnd.oci.image.layer.v1.tar+gzip",
+	}
+
+	t.Run("deduplicates overlapping reads", func(t *testing.T) {
+		t.Parallel()
+
+		reg := &blockingRegistry{mockRegistry: newMockRegistry(), started: make(chan int64, 10), release: make(chan struct{})}
+		reg.addBlob(digest, content)
+		cache, err := New(t.TempDir(), reg, nil)
+		require.NoError(t, err)
+		handle, err := cache.OpenLazy(context.Background(), "test.io/repo:tag", desc)
+		require.NoError(t, err)
+		defer handle.Close()
+
+		var wg sync.WaitGroup
+		read := func(off int64) {
+			defer wg.Done()
+			buf := make([]byte, 10)
+			_, readErr := handle.ReadAt(buf, off)
+			assert.NoError(t, readErr)
+			assert.Equal(t, content[off:off+10], buf)
+		}
+
+		wg.Add(1)
+		go read(0)
+		assert.Equal(t, int64(0), <-reg.started)
+
+		// A second reader of the same bytes waits for the first fetch.
+		wg.Add(1)
+		go read(0)
+		// A reader of a partially overlapping range only fetches the rest.
+		wg.Add(1)
+		go read(5)
+		assert.Equal(t, int64(10), <-reg.started)
+
+		close(reg.release)
+		wg.Wait()
+
+		assert.ElementsMatch(t, []rangeRequest{
+			{digest: digest, offset: 0, length: 10},
+			{digest: digest, offset: 10, length: 5},
+		}, reg.rangeRequests)
+	})
+
+	t.Run("cached reads do not wait for fetches", func(t *testing.T) {
+		t.Parallel()
+
+		reg := &blockingRegistry{mockRegistry: newMockRegistry(), started: make(chan int64, 10), release: make(chan struct{})}
+		reg.addBlob(digest, content)
+		cache, err := New(t.TempDir(), reg, nil)
+		require.NoError(t, err)
+		handle, err := cache.OpenLazy(context.Background(), "test.io/repo:tag", desc)
+		require.NoError(t, err)
+		defer handle.Close()
+
+		// Cache the first bytes.
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			buf := make([]byte, 10)
+			_, readErr := handle.ReadAt(buf, 0)
+			assert.NoError(t, readErr)
+		}()
+		<-reg.started
+		reg.release <- struct{}{}
+		<-done
+
+		// Start a fetch that stays blocked.
+		blocked := make(chan struct{})
+		go func() {
+			defer close(blocked)
+			buf := make([]byte, 10)
+			_, readErr := handle.ReadAt(buf, 100)
+			assert.NoError(t, readErr)
+		}()
+		<-reg.started
+
+		buf := make([]byte, 10)
+		_, err = handle.ReadAt(buf, 0)
+		require.NoError(t, err)
+		assert.Equal(t, content[:10], buf)
+
+		close(reg.release)
+		<-blocked
+	})
+}
+
 func TestLazyHandle_PersistsProgress(t *testing.T) {
 	t.Parallel()
 
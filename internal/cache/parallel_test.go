@@ -0,0 +1,136 @@
+package cache
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/meigma/blobber/core"
+)
+
+func TestCache_ParallelDownload(t *testing.T) {
+	t.Parallel()
+
+	content := strings.Repeat("parallel chunk content ", 100)
+
+	t.Run("downloads chunks concurrently", func(t *testing.T) {
+		t.Parallel()
+		dir := t.TempDir()
+
+		data, digest := createTestBlob(content)
+		reg := newMockRegistry()
+		reg.addBlob(digest, data)
+
+		cache, err := New(dir, reg, nil)
+		require.NoError(t, err)
+		cache.SetParallelDownload(4, 256)
+
+		desc := core.LayerDescriptor{Digest: digest, Size: int64(len(data))}
+		handle, err := cache.Open(context.Background(), "test.io/repo:tag", desc)
+		require.NoError(t, err)
+		defer handle.Close()
+
+		buf := make([]byte, len(data))
+		_, err = handle.ReadAt(buf, 0)
+		require.NoError(t, err)
+		assert.Equal(t, data, buf)
+		assert.True(t, handle.Complete())
+
+		wantChunks := (len(data) + 255) / 256
+		require.Len(t, reg.rangeRequests, wantChunks)
+		for _, req := range reg.rangeRequests {
+			assert.LessOrEqual(t, req.length, int64(256))
+		}
+	})
+
+	t.Run("resumes missing chunks after failure", func(t *testing.T) {
+		t.Parallel()
+		dir := t.TempDir()
+
+		data, digest := createTestBlob(content)
+		reg := newMockRegistry()
+		reg.addBlob(digest, data)
+		reg.failOffset = 512
+
+		cache, err := New(dir, reg, nil)
+		require.NoError(t, err)
+		cache.SetParallelDownload(2, 256)
+
+		desc := core.LayerDescriptor{Digest: digest, Size: int64(len(data))}
+		_, err = cache.Open(context.Background(), "test.io/repo:tag", desc)
+		require.Error(t, err)
+
+		// Progress made before the failure is recorded.
+		entry, err := loadEntry(filepath.Join(dir, "entries", "sha256", extractHash(digest)+".json"))
+		require.NoError(t, err)
+		assert.False(t, entry.Complete)
+		assert.NotContains(t, entry.Ranges, Range{Offset: 512, Length: 256})
+
+		reg.failOffset = 0
+		reg.rangeRequests = nil
+		handle, err := cache.Open(context.Background(), "test.io/repo:tag", desc)
+		require.NoError(t, err)
+		defer handle.Close()
+
+		buf := make([]byte, len(data))
+		_, err = handle.ReadAt(buf, 0)
+		require.NoError(t, err)
+		assert.Equal(t, data, buf)
+
+		// Only the gaps are fetched again.
+		var fetched int64
+		for _, req := range reg.rangeRequests {
+			fetched += req.length
+		}
+		assert.Equal(t, int64(len(data))-rangesLength(entry.Ranges), fetched)
+	})
+
+	t.Run("falls back to full download when range not supported", func(t *testing.T) {
+		t.Parallel()
+		dir := t.TempDir()
+
+		data, digest := createTestBlob(content)
+		reg := newMockRegistry()
+		reg.addBlob(digest, data)
+		reg.rangeSupport = false
+
+		cache, err := New(dir, reg, nil)
+		require.NoError(t, err)
+		cache.SetParallelDownload(4, 256)
+
+		desc := core.LayerDescriptor{Digest: digest, Size: int64(len(data))}
+		handle, err := cache.Open(context.Background(), "test.io/repo:tag", desc)
+		require.NoError(t, err)
+		defer handle.Close()
+
+		buf := make([]byte, len(data))
+		_, err = handle.ReadAt(buf, 0)
+		require.NoError(t, err)
+		assert.Equal(t, data, buf)
+	})
+}
+
+func TestSplitRanges(t *testing.T) {
+	t.Parallel()
+
+	got := splitRanges([]Range{{Offset: 0, Length: 10}, {Offset: 20, Length: 3}}, 4)
+	assert.Equal(t, []Range{
+		{Offset: 0, Length: 4},
+		{Offset: 4, Length: 4},
+		{Offset: 8, Length: 2},
+		{Offset: 20, Length: 3},
+	}, got)
+}
+
+// rangesLength returns the total length of ranges.
+func rangesLength(ranges []Range) int64 {
+	var n int64
+	for _, r := range ranges {
+		n += r.Length
+	}
+	return n
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"os"
 	"path/filepath"
+	"slices"
 	"sort"
 	"time"
 )
@@ -236,7 +237,8 @@ func (c *Cache) evictLocked(digest string) error {
 	return nil
 }
 
-// removeRefsByDigest removes all reference entries that point to the given digest.
+// removeRefsByDigest removes all reference entries that point to the given digest,
+// including multi-layer entries where any layer matches.
 // This is called when a blob is evicted to prevent stale ref→digest mappings.
 func (c *Cache) removeRefsByDigest(digest string) {
 	refsDir := filepath.Join(c.path, "refs")
@@ -256,7 +258,7 @@ func (c *Cache) removeRefsByDigest(digest string) {
 			continue
 		}
 
-		if entry.Digest == digest {
+		if slices.Contains(entry.digests(), digest) {
 			if err := os.Remove(refPath); err != nil && !os.IsNotExist(err) {
 				c.logger.Debug("failed to remove ref entry", "path", refPath, "error", err)
 			}
@@ -264,7 +266,7 @@ func (c *Cache) removeRefsByDigest(digest string) {
 	}
 }
 
-// cleanupOrphanedRefs removes ref entries that point to digests not in the valid set.
+// cleanupOrphanedRefs removes ref entries that point to any digest not in the valid set.
 // This is called after pruning to ensure ref index stays consistent with blob cache.
 func (c *Cache) cleanupOrphanedRefs(validDigests map[string]bool) {
 	refsDir := filepath.Join(c.path, "refs")
@@ -286,7 +288,10 @@ func (c *Cache) cleanupOrphanedRefs(validDigests map[string]bool) {
 			continue
 		}
 
-		if !validDigests[entry.Digest] {
+		orphaned := slices.ContainsFunc(entry.digests(), func(d string) bool {
+			return !validDigests[d]
+		})
+		if orphaned {
 			if err := os.Remove(refPath); err != nil && !os.IsNotExist(err) {
 				c.logger.Debug("failed to remove orphaned ref", "ref", entry.Ref, "error", err)
 			} else {
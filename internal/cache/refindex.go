@@ -22,8 +22,38 @@ type RefEntry struct {
 	Size int64 `json:"size"`
 	// MediaType is the layer media type.
 	MediaType string `json:"media_type"`
+	// TOCDigest is the annotated eStargz TOC digest of the layer, if any.
+	TOCDigest string `json:"toc_digest,omitempty"`
 	// ValidatedAt is when this ref→digest mapping was last confirmed.
 	ValidatedAt time.Time `json:"validated_at"`
+	// Layers lists every layer of a multi-layer image, bottom layer first.
+	// Empty for single-layer images, which are described by Digest alone.
+	// For multi-layer images, Digest, Size, and MediaType describe the top layer.
+	Layers []RefLayer `json:"layers,omitempty"`
+}
+
+// RefLayer describes one layer of a multi-layer reference.
+type RefLayer struct {
+	// Digest is the layer digest (sha256:...).
+	Digest string `json:"digest"`
+	// Size is the layer size in bytes.
+	Size int64 `json:"size"`
+	// MediaType is the layer media type.
+	MediaType string `json:"media_type"`
+	// TOCDigest is the annotated eStargz TOC digest of the layer, if any.
+	TOCDigest string `json:"toc_digest,omitempty"`
+}
+
+// digests returns every layer digest referenced by the entry.
+func (e *RefEntry) digests() []string {
+	if len(e.Layers) == 0 {
+		return []string{e.Digest}
+	}
+	digests := make([]string, len(e.Layers))
+	for i, l := range e.Layers {
+		digests[i] = l.Digest
+	}
+	return digests
 }
 
 // refPath returns the path for a reference index entry.
@@ -103,46 +133,98 @@ func saveRefEntry(path string, entry *RefEntry) error {
 // LookupByRef checks if a reference has a valid cached digest within the TTL.
 // Returns the LayerDescriptor and true if the cached mapping is valid,
 // or zero value and false if not found or expired.
+// For multi-layer references, the top layer is returned.
 //
 // This method does NOT validate that the blob itself is cached - only that
 // we have a recent ref→digest mapping. The caller should still check the
 // blob cache using the returned descriptor.
 func (c *Cache) LookupByRef(ref string, ttl time.Duration) (core.LayerDescriptor, bool) {
-	if ttl <= 0 {
+	layers, ok := c.LookupLayersByRef(ref, ttl)
+	if !ok {
 		return core.LayerDescriptor{}, false
 	}
+	return layers[len(layers)-1], true
+}
+
+// LookupLayersByRef checks if a reference has valid cached layer digests within the TTL.
+// Returns the layer descriptors (bottom layer first) and true if the cached mapping
+// is valid, or nil and false if not found or expired.
+//
+// Like LookupByRef, this does NOT validate that the blobs themselves are cached.
+func (c *Cache) LookupLayersByRef(ref string, ttl time.Duration) ([]core.LayerDescriptor, bool) {
+	if ttl <= 0 {
+		return nil, false
+	}
 
 	refPath := c.refPath(ref)
 	refEntry, err := loadRefEntry(refPath)
 	if err != nil {
-		return core.LayerDescriptor{}, false
+		return nil, false
 	}
 
 	// Check if mapping is still valid
 	if time.Since(refEntry.ValidatedAt) > ttl {
 		c.logger.Debug("ref cache expired", "ref", ref, "validated_at", refEntry.ValidatedAt)
-		return core.LayerDescriptor{}, false
+		return nil, false
 	}
 
 	c.logger.Debug("ref cache hit", "ref", ref, "digest", refEntry.Digest)
-	return core.LayerDescriptor{
-		Digest:    refEntry.Digest,
-		Size:      refEntry.Size,
-		MediaType: refEntry.MediaType,
-	}, true
+	if len(refEntry.Layers) == 0 {
+		return []core.LayerDescriptor{{
+			Digest:    refEntry.Digest,
+			Size:      refEntry.Size,
+			MediaType: refEntry.MediaType,
+			TOCDigest: refEntry.TOCDigest,
+		}}, true
+	}
+
+	layers := make([]core.LayerDescriptor, len(refEntry.Layers))
+	for i, l := range refEntry.Layers {
+		layers[i] = core.LayerDescriptor{
+			Digest:    l.Digest,
+			Size:      l.Size,
+			MediaType: l.MediaType,
+			TOCDigest: l.TOCDigest,
+		}
+	}
+	return layers, true
 }
 
 // UpdateRefIndex updates the reference index with a validated ref→digest mapping.
 // This should be called after successfully resolving a reference from the registry.
 func (c *Cache) UpdateRefIndex(ref string, desc core.LayerDescriptor) {
-	refPath := c.refPath(ref)
+	c.UpdateRefIndexLayers(ref, []core.LayerDescriptor{desc})
+}
+
+// UpdateRefIndexLayers updates the reference index with the validated layer digests
+// of a reference. Layers must be ordered bottom layer first.
+func (c *Cache) UpdateRefIndexLayers(ref string, layers []core.LayerDescriptor) {
+	if len(layers) == 0 {
+		return
+	}
+
+	top := layers[len(layers)-1]
 	entry := &RefEntry{
 		Ref:         ref,
-		Digest:      desc.Digest,
-		Size:        desc.Size,
-		MediaType:   desc.MediaType,
+		Digest:      top.Digest,
+		Size:        top.Size,
+		MediaType:   top.MediaType,
+		TOCDigest:   top.TOCDigest,
 		ValidatedAt: time.Now(),
 	}
+	if len(layers) > 1 {
+		entry.Layers = make([]RefLayer, len(layers))
+		for i, l := range layers {
+			entry.Layers[i] = RefLayer{
+				Digest:    l.Digest,
+				Size:      l.Size,
+				MediaType: l.MediaType,
+				TOCDigest: l.TOCDigest,
+			}
+		}
+	}
+
+	refPath := c.refPath(ref)
 	if err := saveRefEntry(refPath, entry); err != nil {
 		c.logger.Debug("failed to update ref index", "ref", ref, "error", err)
 	}
@@ -272,6 +272,53 @@ func TestCache_UpdateRefIndex(t *testing.T) {
 	})
 }
 
+func TestCache_RefIndexLayers(t *testing.T) {
+	t.Parallel()
+
+	t.Run("round trips multiple layers", func(t *testing.T) {
+		t.Parallel()
+		dir := t.TempDir()
+
+		cache, err := New(dir, newMockRegistry(), nil)
+		require.NoError(t, err)
+
+		ref := "ghcr.io/org/repo:v1.0"
+		layers := []core.LayerDescriptor{
+			{Digest: "sha256:bottom", Size: 512, MediaType: "application/vnd.oci.image.layer.v1.tar+gzip", TOCDigest: "sha256:bottomtoc"},
+			{Digest: "sha256:top", Size: 1024, MediaType: "application/vnd.oci.image.layer.v1.tar+gzip", TOCDigest: "sha256:toptoc"},
+		}
+		cache.UpdateRefIndexLayers(ref, layers)
+
+		result, ok := cache.LookupLayersByRef(ref, 5*time.Minute)
+		require.True(t, ok)
+		assert.Equal(t, layers, result)
+
+		// LookupByRef returns the top layer.
+		top, ok := cache.LookupByRef(ref, 5*time.Minute)
+		require.True(t, ok)
+		assert.Equal(t, layers[1], top)
+	})
+
+	t.Run("evicting any layer removes the ref", func(t *testing.T) {
+		t.Parallel()
+		dir := t.TempDir()
+
+		cache, err := New(dir, newMockRegistry(), nil)
+		require.NoError(t, err)
+
+		ref := "ghcr.io/org/repo:v1.0"
+		cache.UpdateRefIndexLayers(ref, []core.LayerDescriptor{
+			{Digest: "sha256:bottom", Size: 512},
+			{Digest: "sha256:top", Size: 1024},
+		})
+
+		cache.removeRefsByDigest("sha256:bottom")
+
+		_, ok := cache.LookupLayersByRef(ref, 5*time.Minute)
+		assert.False(t, ok, "ref should be removed when a lower layer is evicted")
+	})
+}
+
 func TestCache_RefPath(t *testing.T) {
 	t.Parallel()
 
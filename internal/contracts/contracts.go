@@ -15,7 +15,18 @@ import (
 type ArchiveBuilder interface {
 	// Build creates an eStargz blob from the given filesystem.
 	// Returns a BuildResult containing the blob, TOC digest, blob digest, and size.
-	Build(ctx context.Context, src fs.FS, compression core.Compression) (*core.BuildResult, error)
+	// opts may be nil for the defaults.
+	Build(ctx context.Context, src fs.FS, compression core.Compression, opts *core.BuildOptions) (*core.BuildResult, error)
+
+	// BuildDiff creates an eStargz blob to be layered on top of base.
+	// The blob holds only the entries of src that are new or differ from base,
+	// plus whiteouts for entries of base that no longer exist in src.
+	// base is keyed by path, relative to the root without a leading slash.
+	BuildDiff(ctx context.Context, src fs.FS, base map[string]core.TOCEntry, compression core.Compression, opts *core.BuildOptions) (*core.BuildResult, error)
+
+	// BuildTar creates an eStargz blob from an existing (optionally gzip-compressed) tar stream.
+	// Entries are checked with validator as they would be on extraction.
+	BuildTar(ctx context.Context, r io.Reader, validator PathValidator, compression core.Compression, opts *core.BuildOptions) (*core.BuildResult, error)
 }
 
 // ArchiveReader reads eStargz blobs.
@@ -48,6 +59,13 @@ type BlobHandle interface {
 	Complete() bool
 }
 
+// RangePrefetcher is implemented by blob handles that fetch ranges on demand.
+type RangePrefetcher interface {
+	// PrefetchRange fetches the given byte range into local storage without
+	// reading it, returning once the range is available.
+	PrefetchRange(off, length int64) error
+}
+
 // BlobSource provides access to blobs, either from cache or network.
 // The cache implementation wraps a fallback source (typically the registry).
 type BlobSource interface {
@@ -88,6 +106,16 @@ type Registry interface {
 	// Returns the manifest digest.
 	Push(ctx context.Context, ref string, layer io.Reader, opts *core.RegistryPushOptions) (string, error)
 
+	// PushIndex creates an OCI image index referencing existing manifests and tags it as ref,
+	// if the tag satisfies cond. Returns the index digest.
+	PushIndex(ctx context.Context, ref string, manifests []core.IndexManifest, cond core.TagCondition) (string, error)
+
+	// Copy copies the manifest at src, with the manifests and blobs it references,
+	// to the repository of dst and tags it if dst has a tag that satisfies cond.
+	// Blobs are mounted within a registry and streamed between registries.
+	// Returns the manifest digest.
+	Copy(ctx context.Context, src, dst string, cond core.TagCondition) (string, error)
+
 	// Pull returns a reader for the image's layer blob and its size.
 	Pull(ctx context.Context, ref string) (io.ReadCloser, int64, error)
 
@@ -100,6 +128,11 @@ type Registry interface {
 	// Used by the cache to check for hits before downloading.
 	ResolveLayer(ctx context.Context, ref string) (core.LayerDescriptor, error)
 
+	// ResolveLayers resolves a reference to the descriptors of all its layers.
+	// Layers are returned in manifest order, from the bottom layer to the top layer.
+	// Unlike ResolveLayer, this accepts manifests with more than one layer.
+	ResolveLayers(ctx context.Context, ref string) ([]core.LayerDescriptor, error)
+
 	// FetchBlob fetches a blob by its descriptor.
 	// Unlike Pull, this uses a known digest rather than resolving a ref.
 	FetchBlob(ctx context.Context, ref string, desc core.LayerDescriptor) (io.ReadCloser, error)
@@ -0,0 +1,110 @@
+package registry
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"oras.land/oras-go/v2/content"
+	"oras.land/oras-go/v2/registry"
+	"oras.land/oras-go/v2/registry/remote"
+
+	"github.com/meigma/blobber/core"
+)
+
+// baseImage holds the layers of an image that a pushed layer is stacked on.
+type baseImage struct {
+	layers   []ocispec.Descriptor
+	diffIDs  []digest.Digest
+	platform ocispec.Platform
+}
+
+// loadBase resolves the base image of a push and makes its layer blobs
+// available in the target repository.
+func (r *orasRegistry) loadBase(ctx context.Context, repo *remote.Repository, target registry.Reference, baseRef string) (*baseImage, error) {
+	parsedBase, err := registry.ParseReference(baseRef)
+	if err != nil {
+		return nil, core.ErrInvalidRef
+	}
+
+	baseRepo, err := r.newRepository(parsedBase)
+	if err != nil {
+		return nil, fmt.Errorf("create repository: %w", err)
+	}
+
+	_, manifestDigest, _, err := r.resolveLayerDescriptorFull(ctx, baseRepo, parsedBase.Reference)
+	if err != nil {
+		return nil, err
+	}
+
+	// Fetch the platform manifest and its config for the layer diff IDs.
+	_, manifestReader, err := baseRepo.Manifests().FetchReference(ctx, manifestDigest)
+	if err != nil {
+		return nil, fmt.Errorf("fetch manifest: %w", mapError(err))
+	}
+	defer manifestReader.Close()
+
+	var manifest ocispec.Manifest
+	if err := json.NewDecoder(manifestReader).Decode(&manifest); err != nil {
+		return nil, fmt.Errorf("decode manifest: %w", err)
+	}
+
+	configData, err := content.FetchAll(ctx, baseRepo.Blobs(), manifest.Config)
+	if err != nil {
+		return nil, fmt.Errorf("fetch config: %w", mapError(err))
+	}
+	var config ocispec.Image
+	if err := json.Unmarshal(configData, &config); err != nil {
+		return nil, fmt.Errorf("decode config: %w", err)
+	}
+	if len(config.RootFS.DiffIDs) != len(manifest.Layers) {
+		return nil, fmt.Errorf("config has %d diff ids for %d layers", len(config.RootFS.DiffIDs), len(manifest.Layers))
+	}
+
+	for _, layer := range manifest.Layers {
+		if err := ensureBlob(ctx, repo, target, baseRepo, parsedBase, layer); err != nil {
+			return nil, fmt.Errorf("copy layer %s: %w", layer.Digest, mapError(err))
+		}
+	}
+
+	return &baseImage{
+		layers:   manifest.Layers,
+		diffIDs:  config.RootFS.DiffIDs,
+		platform: config.Platform,
+	}, nil
+}
+
+// ensureBlob makes a blob of the source repository available in the target
+// repository. Blobs are mounted within the same registry and copied otherwise.
+func ensureBlob(ctx context.Context, repo *remote.Repository, target registry.Reference, srcRepo *remote.Repository, src registry.Reference, desc ocispec.Descriptor) error {
+	if src.Registry == target.Registry && src.Repository == target.Repository {
+		return nil
+	}
+
+	getContent := func() (io.ReadCloser, error) {
+		return srcRepo.Blobs().Fetch(ctx, desc)
+	}
+
+	// Cross-repository mount falls back to getContent if the registry declines it.
+	if src.Registry == target.Registry {
+		return repo.Mount(ctx, desc, src.Repository, getContent)
+	}
+
+	exists, err := repo.Blobs().Exists(ctx, desc)
+	if err != nil {
+		return err
+	}
+	if exists {
+		return nil
+	}
+
+	rc, err := getContent()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	return repo.Blobs().Push(ctx, desc, rc)
+}
@@ -0,0 +1,137 @@
+package registry
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/opencontainers/go-digest"
+	"github.com/opencontainers/image-spec/specs-go"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"oras.land/oras-go/v2/registry"
+)
+
+// baseRegistryServer serves a base image at test/base:v1 and records blob mounts into test/repo.
+func baseRegistryServer(t *testing.T, config ocispec.Image, layers []ocispec.Descriptor) (host string, mounts func() []string) {
+	t.Helper()
+
+	configJSON, err := json.Marshal(config)
+	require.NoError(t, err)
+	configDesc := ocispec.Descriptor{
+		MediaType: ocispec.MediaTypeImageConfig,
+		Digest:    digest.FromBytes(configJSON),
+		Size:      int64(len(configJSON)),
+	}
+	manifestJSON, err := json.Marshal(ocispec.Manifest{
+		Versioned: specs.Versioned{SchemaVersion: 2},
+		MediaType: ocispec.MediaTypeImageManifest,
+		Config:    configDesc,
+		Layers:    layers,
+	})
+	require.NoError(t, err)
+	manifestDigest := digest.FromBytes(manifestJSON)
+
+	var mu sync.Mutex
+	var mounted []string
+	server := mockRegistryServer(t, map[string]http.HandlerFunc{
+		"/v2/": func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		},
+		"/v2/test/base/manifests/": func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", ocispec.MediaTypeImageManifest)
+			w.Header().Set("Docker-Content-Digest", manifestDigest.String())
+			w.Write(manifestJSON)
+		},
+		"/v2/test/base/blobs/" + configDesc.Digest.String(): func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Docker-Content-Digest", configDesc.Digest.String())
+			w.Write(configJSON)
+		},
+		"/v2/test/repo/blobs/uploads/": func(w http.ResponseWriter, r *http.Request) {
+			assert.Equal(t, "test/base", r.URL.Query().Get("from"))
+			mu.Lock()
+			mounted = append(mounted, r.URL.Query().Get("mount"))
+			mu.Unlock()
+			w.WriteHeader(http.StatusCreated)
+		},
+	})
+	t.Cleanup(server.Close)
+
+	return strings.TrimPrefix(server.URL, "http://"), func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return mounted
+	}
+}
+
+func TestLoadBase(t *testing.T) {
+	t.Parallel()
+
+	layers := []ocispec.Descriptor{
+		{MediaType: "application/vnd.oci.image.layer.v1.tar+gzip", Digest: digest.FromString("layer0"), Size: 6},
+		{MediaType: "application/vnd.oci.image.layer.v1.tar+gzip", Digest: digest.FromString("layer1"), Size: 6},
+	}
+	config := ocispec.Image{
+		Platform: ocispec.Platform{OS: "linux", Architecture: "arm64", Variant: "v8"},
+		RootFS: ocispec.RootFS{
+			Type:    "layers",
+			DiffIDs: []digest.Digest{digest.FromString("diff0"), digest.FromString("diff1")},
+		},
+	}
+
+	t.Run("mounts layers from another repository", func(t *testing.T) {
+		t.Parallel()
+
+		host, mounts := baseRegistryServer(t, config, layers)
+		r := New(WithPlainHTTP(true))
+		target, err := registry.ParseReference(host + "/test/repo:latest")
+		require.NoError(t, err)
+		repo, err := r.newRepository(target)
+		require.NoError(t, err)
+
+		base, err := r.loadBase(context.Background(), repo, target, host+"/test/base:v1")
+		require.NoError(t, err)
+
+		assert.Equal(t, layers, base.layers)
+		assert.Equal(t, config.RootFS.DiffIDs, base.diffIDs)
+		assert.Equal(t, "linux/arm64/v8", FormatPlatform(base.platform))
+		assert.ElementsMatch(t, []string{layers[0].Digest.String(), layers[1].Digest.String()}, mounts())
+	})
+
+	t.Run("same repository needs no copy", func(t *testing.T) {
+		t.Parallel()
+
+		host, mounts := baseRegistryServer(t, config, layers)
+		r := New(WithPlainHTTP(true))
+		target, err := registry.ParseReference(host + "/test/base:v2")
+		require.NoError(t, err)
+		repo, err := r.newRepository(target)
+		require.NoError(t, err)
+
+		base, err := r.loadBase(context.Background(), repo, target, host+"/test/base:v1")
+		require.NoError(t, err)
+		assert.Len(t, base.layers, 2)
+		assert.Empty(t, mounts())
+	})
+
+	t.Run("diff id count mismatch", func(t *testing.T) {
+		t.Parallel()
+
+		bad := config
+		bad.RootFS.DiffIDs = bad.RootFS.DiffIDs[:1]
+		host, _ := baseRegistryServer(t, bad, layers)
+		r := New(WithPlainHTTP(true))
+		target, err := registry.ParseReference(host + "/test/base:v2")
+		require.NoError(t, err)
+		repo, err := r.newRepository(target)
+		require.NoError(t, err)
+
+		_, err = r.loadBase(context.Background(), repo, target, host+"/test/base:v1")
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "1 diff ids for 2 layers")
+	})
+}
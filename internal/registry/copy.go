@@ -0,0 +1,118 @@
+package registry
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"oras.land/oras-go/v2/content"
+	"oras.land/oras-go/v2/registry"
+	"oras.land/oras-go/v2/registry/remote"
+
+	"github.com/meigma/blobber/core"
+)
+
+// Copy copies the manifest at src to the repository of dst, together with
+// its config and layer blobs and, for an image index, its platform manifests.
+// If dst has a tag, it is moved to the manifest if it satisfies cond.
+// Returns the manifest digest.
+//
+// Blobs already present in the target repository are skipped, blobs in
+// another repository of the same registry are mounted, and other blobs are
+// streamed from src without being stored locally.
+func (r *orasRegistry) Copy(ctx context.Context, src, dst string, cond core.TagCondition) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+
+	parsedSrc, err := registry.ParseReference(src)
+	if err != nil {
+		return "", core.ErrInvalidRef
+	}
+	parsedDst, err := registry.ParseReference(dst)
+	if err != nil {
+		return "", core.ErrInvalidRef
+	}
+
+	srcRepo, err := r.newRepository(parsedSrc)
+	if err != nil {
+		return "", fmt.Errorf("create repository: %w", err)
+	}
+	repo, err := r.newRepository(parsedDst)
+	if err != nil {
+		return "", fmt.Errorf("create repository: %w", err)
+	}
+
+	desc, err := srcRepo.Manifests().Resolve(ctx, parsedSrc.Reference)
+	if err != nil {
+		return "", fmt.Errorf("resolve %s: %w", src, mapError(err))
+	}
+
+	// A digest destination must name the copied manifest.
+	tag := parsedDst.Reference
+	if parsedDst.ValidateReferenceAsDigest() == nil {
+		if tag != desc.Digest.String() {
+			return "", fmt.Errorf("destination digest %s does not match %s", tag, desc.Digest)
+		}
+		tag = ""
+	}
+
+	if err := copyManifest(ctx, srcRepo, parsedSrc, repo, parsedDst, desc); err != nil {
+		return "", err
+	}
+
+	if tag != "" {
+		if err := checkTag(ctx, repo, tag, cond); err != nil {
+			return "", err
+		}
+		if err := repo.Tag(ctx, desc, tag); err != nil {
+			return "", fmt.Errorf("tag manifest: %w", mapError(err))
+		}
+	}
+
+	return desc.Digest.String(), nil
+}
+
+// copyManifest copies a manifest and everything it references from the
+// source repository to the target repository. Nothing is copied within a
+// repository.
+func copyManifest(ctx context.Context, srcRepo *remote.Repository, src registry.Reference, repo *remote.Repository, target registry.Reference, desc ocispec.Descriptor) error {
+	if src.Registry == target.Registry && src.Repository == target.Repository {
+		return nil
+	}
+
+	data, err := content.FetchAll(ctx, srcRepo.Manifests(), desc)
+	if err != nil {
+		return fmt.Errorf("fetch manifest %s: %w", desc.Digest, mapError(err))
+	}
+
+	if isIndex(desc.MediaType) {
+		var index ocispec.Index
+		if err := json.Unmarshal(data, &index); err != nil {
+			return fmt.Errorf("decode index %s: %w", desc.Digest, err)
+		}
+		for _, m := range index.Manifests {
+			if err := copyManifest(ctx, srcRepo, src, repo, target, m); err != nil {
+				return err
+			}
+		}
+	} else {
+		var manifest ocispec.Manifest
+		if err := json.Unmarshal(data, &manifest); err != nil {
+			return fmt.Errorf("decode manifest %s: %w", desc.Digest, err)
+		}
+		blobs := append([]ocispec.Descriptor{manifest.Config}, manifest.Layers...)
+		for _, blob := range blobs {
+			if err := ensureBlob(ctx, repo, target, srcRepo, src, blob); err != nil {
+				return fmt.Errorf("copy blob %s: %w", blob.Digest, mapError(err))
+			}
+		}
+	}
+
+	if err := repo.Manifests().Push(ctx, desc, bytes.NewReader(data)); err != nil {
+		return fmt.Errorf("push manifest %s: %w", desc.Digest, mapError(err))
+	}
+	return nil
+}
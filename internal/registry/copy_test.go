@@ -0,0 +1,123 @@
+package registry
+
+import (
+	"context"
+	"testing"
+
+	"github.com/opencontainers/go-digest"
+	"github.com/opencontainers/image-spec/specs-go"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/meigma/blobber/core"
+)
+
+// putTestImage stores a single-layer image in repo of f, tagged tag.
+func putTestImage(t *testing.T, f *fakeRegistry, repo, tag, content string) ocispec.Descriptor {
+	t.Helper()
+	config := []byte(`{"architecture":"amd64","os":"linux"}`)
+	layer := []byte(content)
+	manifest := ocispec.Manifest{
+		Versioned: specs.Versioned{SchemaVersion: 2},
+		MediaType: ocispec.MediaTypeImageManifest,
+		Config:    ocispec.Descriptor{MediaType: ocispec.MediaTypeImageConfig, Digest: f.putBlob(repo, config), Size: int64(len(config))},
+		Layers: []ocispec.Descriptor{
+			{MediaType: ocispec.MediaTypeImageLayerGzip, Digest: f.putBlob(repo, layer), Size: int64(len(layer))},
+		},
+	}
+	d := f.putJSON(t, repo, tag, ocispec.MediaTypeImageManifest, manifest)
+	m, _ := f.manifest(repo, d.String())
+	return ocispec.Descriptor{MediaType: ocispec.MediaTypeImageManifest, Digest: d, Size: int64(len(m.data))}
+}
+
+func TestCopy(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	src, srcHost := newFakeRegistry(t)
+	dst, dstHost := newFakeRegistry(t)
+	image := putTestImage(t, src, "staging/app", "v1", "layer")
+	r := New(WithPlainHTTP(true))
+
+	t.Run("same registry mounts blobs", func(t *testing.T) {
+		got, err := r.Copy(ctx, srcHost+"/staging/app:v1", srcHost+"/prod/app:v1", core.TagCondition{})
+		require.NoError(t, err)
+		assert.Equal(t, image.Digest.String(), got)
+
+		uploads, mounts := src.counts()
+		assert.Equal(t, 0, uploads)
+		assert.Equal(t, 2, mounts)
+		tagged, ok := src.manifest("prod/app", "v1")
+		require.True(t, ok)
+		assert.Equal(t, image.Digest, digest.FromBytes(tagged.data))
+	})
+
+	t.Run("other registry streams missing blobs", func(t *testing.T) {
+		_, err := r.Copy(ctx, srcHost+"/staging/app:v1", dstHost+"/prod/app:v1", core.TagCondition{})
+		require.NoError(t, err)
+		uploads, _ := dst.counts()
+		assert.Equal(t, 2, uploads)
+
+		// Blobs already present are not sent again.
+		_, err = r.Copy(ctx, srcHost+"/staging/app:v1", dstHost+"/prod/app:latest", core.TagCondition{})
+		require.NoError(t, err)
+		uploads, _ = dst.counts()
+		assert.Equal(t, 2, uploads)
+		_, ok := dst.manifest("prod/app", "latest")
+		assert.True(t, ok)
+	})
+
+	t.Run("tag condition", func(t *testing.T) {
+		other := digest.FromString("other").String()
+		_, err := r.Copy(ctx, srcHost+"/staging/app:v1", srcHost+"/prod/app:v1", core.TagCondition{ExpectedDigest: other})
+		require.ErrorIs(t, err, core.ErrTagConflict)
+		_, err = r.Copy(ctx, srcHost+"/staging/app:v1", srcHost+"/prod/app:v1", core.TagCondition{MustNotExist: true})
+		require.ErrorIs(t, err, core.ErrTagConflict)
+		_, err = r.Copy(ctx, srcHost+"/staging/app:v1", srcHost+"/prod/app:v1", core.TagCondition{ExpectedDigest: image.Digest.String()})
+		require.NoError(t, err)
+	})
+
+	t.Run("digest destination", func(t *testing.T) {
+		_, err := r.Copy(ctx, srcHost+"/staging/app:v1", dstHost+"/pinned/app@"+image.Digest.String(), core.TagCondition{})
+		require.NoError(t, err)
+		_, ok := dst.manifest("pinned/app", image.Digest.String())
+		assert.True(t, ok)
+
+		_, err = r.Copy(ctx, srcHost+"/staging/app:v1", dstHost+"/pinned/app@"+digest.FromString("other").String(), core.TagCondition{})
+		require.Error(t, err)
+	})
+}
+
+func TestCopy_Index(t *testing.T) {
+	t.Parallel()
+
+	src, srcHost := newFakeRegistry(t)
+	dst, dstHost := newFakeRegistry(t)
+	amd64 := putTestImage(t, src, "staging/app", "", "amd64 layer")
+	arm64 := putTestImage(t, src, "staging/app", "", "arm64 layer")
+	amd64.Platform = &ocispec.Platform{OS: "linux", Architecture: "amd64"}
+	arm64.Platform = &ocispec.Platform{OS: "linux", Architecture: "arm64"}
+	index := src.putJSON(t, "staging/app", "v1", ocispec.MediaTypeImageIndex, ocispec.Index{
+		Versioned: specs.Versioned{SchemaVersion: 2},
+		MediaType: ocispec.MediaTypeImageIndex,
+		Manifests: []ocispec.Descriptor{amd64, arm64},
+	})
+
+	r := New(WithPlainHTTP(true))
+	got, err := r.Copy(context.Background(), srcHost+"/staging/app:v1", dstHost+"/prod/app:v1", core.TagCondition{})
+	require.NoError(t, err)
+	assert.Equal(t, index.String(), got)
+
+	for _, d := range []digest.Digest{index, amd64.Digest, arm64.Digest} {
+		_, ok := dst.manifest("prod/app", d.String())
+		assert.True(t, ok, "manifest %s copied", d)
+	}
+	uploads, _ := dst.counts()
+	assert.Equal(t, 3, uploads, "the shared config and both layers")
+
+	// The platform manifests resolve from the copied index.
+	layers, err := r.ResolveLayers(context.Background(), dstHost+"/prod/app:v1")
+	require.NoError(t, err)
+	require.Len(t, layers, 1)
+}
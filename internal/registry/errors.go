@@ -15,8 +15,9 @@ var (
 	// ErrRangeNotSupported is an alias to core.ErrRangeNotSupported for use within this package.
 	ErrRangeNotSupported = core.ErrRangeNotSupported
 
-	// ErrMultipleLayers indicates the manifest has multiple layers, which is unexpected for blobber images.
-	ErrMultipleLayers = errors.New("manifest has multiple layers; blobber expects exactly one layer")
+	// ErrMultipleLayers indicates the manifest has multiple layers where a single layer was required.
+	// Use ResolveLayers to access every layer of a multi-layer manifest.
+	ErrMultipleLayers = errors.New("manifest has multiple layers; operation requires exactly one layer")
 )
 
 // mapError converts ORAS registry errors to blobber sentinel errors.
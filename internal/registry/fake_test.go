@@ -0,0 +1,205 @@
+package registry
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/opencontainers/go-digest"
+)
+
+// fakeRegistry is an in-memory OCI distribution registry supporting blob
+// uploads and mounts, and manifests by tag or digest.
+type fakeRegistry struct {
+	mu        sync.Mutex
+	blobs     map[string]map[string][]byte // repository -> digest -> content
+	manifests map[string]map[string]fakeManifest
+	uploads   int // monolithic blob uploads
+	mounts    int // successful cross-repository mounts
+}
+
+// fakeManifest is a stored manifest and its media type.
+type fakeManifest struct {
+	mediaType string
+	data      []byte
+}
+
+// newFakeRegistry starts a fake registry and returns it with its host.
+func newFakeRegistry(t *testing.T) (*fakeRegistry, string) {
+	t.Helper()
+	f := &fakeRegistry{
+		blobs:     make(map[string]map[string][]byte),
+		manifests: make(map[string]map[string]fakeManifest),
+	}
+	server := httptest.NewServer(f)
+	t.Cleanup(server.Close)
+	return f, strings.TrimPrefix(server.URL, "http://")
+}
+
+// counts returns the number of blob uploads and mounts so far.
+func (f *fakeRegistry) counts() (uploads, mounts int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.uploads, f.mounts
+}
+
+// manifest returns the manifest of repo stored under reference.
+func (f *fakeRegistry) manifest(repo, reference string) (fakeManifest, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	m, ok := f.manifests[repo][reference]
+	return m, ok
+}
+
+// putBlob stores a blob in repo.
+func (f *fakeRegistry) putBlob(repo string, data []byte) digest.Digest {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	d := digest.FromBytes(data)
+	if f.blobs[repo] == nil {
+		f.blobs[repo] = make(map[string][]byte)
+	}
+	f.blobs[repo][d.String()] = data
+	return d
+}
+
+// putManifest stores a manifest in repo under its digest and tag, if any.
+func (f *fakeRegistry) putManifest(repo, tag, mediaType string, data []byte) digest.Digest {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	d := digest.FromBytes(data)
+	if f.manifests[repo] == nil {
+		f.manifests[repo] = make(map[string]fakeManifest)
+	}
+	m := fakeManifest{mediaType: mediaType, data: data}
+	f.manifests[repo][d.String()] = m
+	if tag != "" {
+		f.manifests[repo][tag] = m
+	}
+	return d
+}
+
+// putJSON marshals v and stores it as a manifest, as putManifest does.
+func (f *fakeRegistry) putJSON(t *testing.T, repo, tag, mediaType string, v any) digest.Digest {
+	t.Helper()
+	data, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return f.putManifest(repo, tag, mediaType, data)
+}
+
+func (f *fakeRegistry) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	path := strings.TrimPrefix(r.URL.Path, "/v2/")
+	if path == "" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	switch {
+	case strings.Contains(path, "/blobs/uploads/"):
+		i := strings.Index(path, "/blobs/uploads/")
+		f.serveUpload(w, r, path[:i])
+	case strings.Contains(path, "/blobs/"):
+		i := strings.LastIndex(path, "/blobs/")
+		f.serveBlob(w, r, path[:i], path[i+len("/blobs/"):])
+	case strings.Contains(path, "/manifests/"):
+		i := strings.LastIndex(path, "/manifests/")
+		f.serveManifest(w, r, path[:i], path[i+len("/manifests/"):])
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (f *fakeRegistry) serveUpload(w http.ResponseWriter, r *http.Request, repo string) {
+	switch r.Method {
+	case http.MethodPost:
+		if mount, from := r.URL.Query().Get("mount"), r.URL.Query().Get("from"); mount != "" {
+			f.mu.Lock()
+			data, ok := f.blobs[from][mount]
+			if ok {
+				f.mounts++
+			}
+			f.mu.Unlock()
+			if ok {
+				f.putBlob(repo, data)
+				w.Header().Set("Location", fmt.Sprintf("/v2/%s/blobs/%s", repo, mount))
+				w.WriteHeader(http.StatusCreated)
+				return
+			}
+		}
+		w.Header().Set("Location", fmt.Sprintf("/v2/%s/blobs/uploads/session", repo))
+		w.WriteHeader(http.StatusAccepted)
+	case http.MethodPut:
+		data, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if d := f.putBlob(repo, data); d.String() != r.URL.Query().Get("digest") {
+			http.Error(w, "digest mismatch", http.StatusBadRequest)
+			return
+		}
+		f.mu.Lock()
+		f.uploads++
+		f.mu.Unlock()
+		w.Header().Set("Location", fmt.Sprintf("/v2/%s/blobs/%s", repo, r.URL.Query().Get("digest")))
+		w.WriteHeader(http.StatusCreated)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func (f *fakeRegistry) serveBlob(w http.ResponseWriter, r *http.Request, repo, reference string) {
+	f.mu.Lock()
+	data, ok := f.blobs[repo][reference]
+	f.mu.Unlock()
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Length", fmt.Sprint(len(data)))
+	w.Header().Set("Docker-Content-Digest", reference)
+	if r.Method == http.MethodGet {
+		w.Write(data)
+	}
+}
+
+func (f *fakeRegistry) serveManifest(w http.ResponseWriter, r *http.Request, repo, reference string) {
+	if r.Method == http.MethodPut {
+		data, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		tag := reference
+		if strings.Contains(reference, ":") {
+			tag = ""
+		}
+		d := f.putManifest(repo, tag, r.Header.Get("Content-Type"), data)
+		w.Header().Set("Docker-Content-Digest", d.String())
+		w.Header().Set("Location", fmt.Sprintf("/v2/%s/manifests/%s", repo, d))
+		w.WriteHeader(http.StatusCreated)
+		return
+	}
+
+	m, ok := f.manifest(repo, reference)
+	if !ok {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(`{"errors":[{"code":"MANIFEST_UNKNOWN","message":"manifest unknown"}]}`))
+		return
+	}
+	w.Header().Set("Content-Type", m.mediaType)
+	w.Header().Set("Content-Length", fmt.Sprint(len(m.data)))
+	w.Header().Set("Docker-Content-Digest", digest.FromBytes(m.data).String())
+	if r.Method == http.MethodGet {
+		w.Write(m.data)
+	}
+}
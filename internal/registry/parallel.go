@@ -0,0 +1,146 @@
+package registry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/meigma/blobber/core"
+)
+
+// WithParallelDownload makes FetchBlob fetch blobs larger than chunkSize as
+// chunkSize ranges over n concurrent range requests, reassembled in order.
+// At most n chunks are buffered in memory. Registries without range support
+// fall back to a single stream. n <= 1 or chunkSize <= 0 disables it.
+func WithParallelDownload(n int, chunkSize int64) Option {
+	return func(r *orasRegistry) {
+		r.parallelDownloads = n
+		r.chunkSize = chunkSize
+	}
+}
+
+// useParallelDownload reports whether a blob of size is fetched in parallel.
+func (r *orasRegistry) useParallelDownload(size int64) bool {
+	return r.parallelDownloads > 1 && r.chunkSize > 0 && size > r.chunkSize
+}
+
+// fetchBlobParallel returns a reader of the blob whose chunks are fetched
+// concurrently. The first chunk is fetched before returning, so registries
+// without range support are detected up front with ErrRangeNotSupported.
+func (r *orasRegistry) fetchBlobParallel(ctx context.Context, ref string, desc core.LayerDescriptor) (io.ReadCloser, error) {
+	first, err := r.fetchChunk(ctx, ref, desc, 0, min(r.chunkSize, desc.Size))
+	if err != nil {
+		return nil, err
+	}
+
+	numChunks := int((desc.Size + r.chunkSize - 1) / r.chunkSize)
+	ctx, cancel := context.WithCancel(ctx)
+	pr := &parallelReader{
+		ctx:     ctx,
+		cancel:  cancel,
+		results: make([]chan chunkResult, numChunks),
+		slots:   make(chan struct{}, r.parallelDownloads),
+		cur:     first,
+		next:    1,
+	}
+	for i := range pr.results {
+		pr.results[i] = make(chan chunkResult, 1)
+	}
+
+	go pr.dispatch(ctx, func(ctx context.Context, i int) ([]byte, error) {
+		offset := int64(i) * r.chunkSize
+		return r.fetchChunk(ctx, ref, desc, offset, min(r.chunkSize, desc.Size-offset))
+	})
+	return pr, nil
+}
+
+// fetchChunk reads a whole range of the blob into memory.
+func (r *orasRegistry) fetchChunk(ctx context.Context, ref string, desc core.LayerDescriptor, offset, length int64) ([]byte, error) {
+	rc, err := r.FetchBlobRange(ctx, ref, desc, offset, length)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	buf := make([]byte, length)
+	if _, err := io.ReadFull(rc, buf); err != nil {
+		return nil, fmt.Errorf("read range %d-%d: %w", offset, offset+length, err)
+	}
+	return buf, nil
+}
+
+// chunkResult is the outcome of fetching one chunk.
+type chunkResult struct {
+	data []byte
+	err  error
+}
+
+// parallelReader reassembles concurrently fetched chunks in order.
+// The first chunk is already in cur when reading starts.
+type parallelReader struct {
+	ctx     context.Context
+	cancel  context.CancelFunc
+	results []chan chunkResult // one buffered channel per chunk
+	slots   chan struct{}      // limits chunks in flight or awaiting Read
+	cur     []byte
+	next    int
+	err     error
+}
+
+// dispatch starts the fetches of chunks 1..n, keeping at most cap(slots) in
+// flight or buffered. It stops when the reader is closed.
+func (p *parallelReader) dispatch(ctx context.Context, fetch func(context.Context, int) ([]byte, error)) {
+	for i := 1; i < len(p.results); i++ {
+		select {
+		case p.slots <- struct{}{}:
+		case <-ctx.Done():
+			return
+		}
+		go func() {
+			data, err := fetch(ctx, i)
+			p.results[i] <- chunkResult{data: data, err: err}
+		}()
+	}
+}
+
+// Read implements io.Reader.
+func (p *parallelReader) Read(b []byte) (int, error) {
+	for len(p.cur) == 0 {
+		if p.err != nil {
+			return 0, p.err
+		}
+		if p.next >= len(p.results) {
+			return 0, io.EOF
+		}
+		var res chunkResult
+		select {
+		case res = <-p.results[p.next]:
+			<-p.slots
+		case <-p.ctx.Done():
+			// The chunk may never be dispatched once the context is done.
+			res.err = p.ctx.Err()
+		}
+		p.next++
+		if res.err != nil {
+			p.err = res.err
+			p.cancel()
+			return 0, p.err
+		}
+		p.cur = res.data
+	}
+
+	n := copy(b, p.cur)
+	p.cur = p.cur[n:]
+	return n, nil
+}
+
+// Close stops outstanding fetches.
+func (p *parallelReader) Close() error {
+	p.cancel()
+	if p.err == nil {
+		p.err = errors.New("read after close")
+	}
+	p.cur = nil
+	return nil
+}
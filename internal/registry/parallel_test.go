@@ -0,0 +1,86 @@
+package registry
+
+import (
+	"context"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestParallelReader returns a parallelReader over data split into chunks of size.
+func newTestParallelReader(data []byte, size, workers int, fetch func(context.Context, int) ([]byte, error)) *parallelReader {
+	numChunks := (len(data) + size - 1) / size
+	ctx, cancel := context.WithCancel(context.Background())
+	pr := &parallelReader{
+		ctx:     ctx,
+		cancel:  cancel,
+		results: make([]chan chunkResult, numChunks),
+		slots:   make(chan struct{}, workers),
+		cur:     data[:min(size, len(data))],
+		next:    1,
+	}
+	for i := range pr.results {
+		pr.results[i] = make(chan chunkResult, 1)
+	}
+	go pr.dispatch(ctx, fetch)
+	return pr
+}
+
+func TestParallelReader(t *testing.T) {
+	t.Parallel()
+
+	data := []byte("0123456789abcdefghijklmnopqrstuvwxyz")
+	const size = 5
+
+	t.Run("reassembles chunks in order", func(t *testing.T) {
+		t.Parallel()
+
+		pr := newTestParallelReader(data, size, 3, func(_ context.Context, i int) ([]byte, error) {
+			off := i * size
+			return data[off:min(off+size, len(data))], nil
+		})
+		defer pr.Close()
+
+		got, err := io.ReadAll(pr)
+		require.NoError(t, err)
+		assert.Equal(t, data, got)
+	})
+
+	t.Run("returns chunk error", func(t *testing.T) {
+		t.Parallel()
+
+		errChunk := errors.New("chunk failed")
+		pr := newTestParallelReader(data, size, 2, func(_ context.Context, i int) ([]byte, error) {
+			if i == 3 {
+				return nil, errChunk
+			}
+			off := i * size
+			return data[off:min(off+size, len(data))], nil
+		})
+		defer pr.Close()
+
+		got, err := io.ReadAll(pr)
+		require.ErrorIs(t, err, errChunk)
+		assert.Equal(t, data[:3*size], got)
+	})
+
+	t.Run("close stops reading", func(t *testing.T) {
+		t.Parallel()
+
+		pr := newTestParallelReader(data, size, 2, func(ctx context.Context, _ int) ([]byte, error) {
+			<-ctx.Done()
+			return nil, ctx.Err()
+		})
+
+		buf := make([]byte, size)
+		_, err := io.ReadFull(pr, buf)
+		require.NoError(t, err)
+		require.NoError(t, pr.Close())
+
+		_, err = pr.Read(buf)
+		require.Error(t, err)
+	})
+}
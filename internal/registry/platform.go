@@ -0,0 +1,91 @@
+package registry
+
+import (
+	"fmt"
+	"runtime"
+	"strings"
+
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// ParsePlatform parses a platform string in os/arch[/variant] form
+// (e.g., "linux/arm64/v8"). Common architecture aliases such as "x86_64"
+// and "aarch64" are normalized to their OCI names.
+func ParsePlatform(s string) (ocispec.Platform, error) {
+	parts := strings.Split(strings.ToLower(strings.TrimSpace(s)), "/")
+	if len(parts) < 2 || len(parts) > 3 {
+		return ocispec.Platform{}, fmt.Errorf("invalid platform %q: expected os/arch[/variant]", s)
+	}
+	for _, p := range parts {
+		if p == "" {
+			return ocispec.Platform{}, fmt.Errorf("invalid platform %q: expected os/arch[/variant]", s)
+		}
+	}
+
+	platform := ocispec.Platform{
+		OS:           parts[0],
+		Architecture: normalizeArch(parts[1]),
+	}
+	if len(parts) == 3 {
+		platform.Variant = parts[2]
+	}
+	return platform, nil
+}
+
+// FormatPlatform formats a platform as os/arch[/variant].
+func FormatPlatform(p ocispec.Platform) string {
+	s := p.OS + "/" + p.Architecture
+	if p.Variant != "" {
+		s += "/" + p.Variant
+	}
+	return s
+}
+
+// runtimePlatform returns the platform of the running process.
+func runtimePlatform() ocispec.Platform {
+	return ocispec.Platform{OS: runtime.GOOS, Architecture: runtime.GOARCH}
+}
+
+// normalizeArch maps common architecture aliases to OCI architecture names.
+func normalizeArch(arch string) string {
+	switch arch {
+	case "x86_64", "x86-64":
+		return "amd64"
+	case "aarch64":
+		return "arm64"
+	case "i386", "i686":
+		return "386"
+	default:
+		return arch
+	}
+}
+
+// normalizeVariant returns the variant with the architecture default applied,
+// so that "linux/arm64" and "linux/arm64/v8" compare equal.
+func normalizeVariant(arch, variant string) string {
+	if variant != "" {
+		return variant
+	}
+	switch arch {
+	case "arm64":
+		return "v8"
+	case "arm":
+		return "v7"
+	case "amd64":
+		return "v1"
+	default:
+		return ""
+	}
+}
+
+// matchPlatform reports whether have satisfies the wanted platform.
+// An empty wanted variant matches any variant of the architecture.
+func matchPlatform(want, have ocispec.Platform) bool {
+	if want.OS != have.OS || want.Architecture != normalizeArch(have.Architecture) {
+		return false
+	}
+	if want.Variant == "" {
+		return true
+	}
+	return normalizeVariant(want.Architecture, want.Variant) == normalizeVariant(want.Architecture, have.Variant)
+}
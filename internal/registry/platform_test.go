@@ -0,0 +1,302 @@
+package registry
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/opencontainers/go-digest"
+	specs "github.com/opencontainers/image-spec/specs-go"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/meigma/blobber/core"
+)
+
+func TestParsePlatform(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		input   string
+		want    ocispec.Platform
+		wantErr bool
+	}{
+		{input: "linux/amd64", want: ocispec.Platform{OS: "linux", Architecture: "amd64"}},
+		{input: "linux/arm64/v8", want: ocispec.Platform{OS: "linux", Architecture: "arm64", Variant: "v8"}},
+		{input: "Linux/x86_64", want: ocispec.Platform{OS: "linux", Architecture: "amd64"}},
+		{input: "linux/aarch64", want: ocispec.Platform{OS: "linux", Architecture: "arm64"}},
+		{input: "linux", wantErr: true},
+		{input: "linux//v8", wantErr: true},
+		{input: "linux/arm/v7/extra", wantErr: true},
+		{input: "", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			t.Parallel()
+			got, err := ParsePlatform(tt.input)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestMatchPlatform(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		want string
+		have ocispec.Platform
+		ok   bool
+	}{
+		{name: "exact", want: "linux/amd64", have: ocispec.Platform{OS: "linux", Architecture: "amd64"}, ok: true},
+		{name: "different arch", want: "linux/amd64", have: ocispec.Platform{OS: "linux", Architecture: "arm64"}, ok: false},
+		{name: "different os", want: "linux/amd64", have: ocispec.Platform{OS: "windows", Architecture: "amd64"}, ok: false},
+		{name: "default arm64 variant", want: "linux/arm64/v8", have: ocispec.Platform{OS: "linux", Architecture: "arm64"}, ok: true},
+		{name: "explicit variant", want: "linux/arm/v7", have: ocispec.Platform{OS: "linux", Architecture: "arm", Variant: "v7"}, ok: true},
+		{name: "variant mismatch", want: "linux/arm/v7", have: ocispec.Platform{OS: "linux", Architecture: "arm", Variant: "v6"}, ok: false},
+		{name: "any variant", want: "linux/arm", have: ocispec.Platform{OS: "linux", Architecture: "arm", Variant: "v6"}, ok: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			want, err := ParsePlatform(tt.want)
+			require.NoError(t, err)
+			assert.Equal(t, tt.ok, matchPlatform(want, tt.have))
+		})
+	}
+}
+
+func TestResolveLayer_WithPlatform(t *testing.T) {
+	t.Parallel()
+
+	// Build one manifest per platform, each with a distinct layer.
+	platforms := []ocispec.Platform{
+		{OS: "linux", Architecture: "amd64"},
+		{OS: "linux", Architecture: "arm64", Variant: "v8"},
+	}
+	handlers := map[string]http.HandlerFunc{
+		"/v2/": func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		},
+	}
+	index := ocispec.Index{
+		Versioned: specs.Versioned{SchemaVersion: 2},
+		MediaType: ocispec.MediaTypeImageIndex,
+	}
+	layerDigests := make(map[string]string)
+	for _, p := range platforms {
+		layerDigest := digest.FromString("layer-" + FormatPlatform(p))
+		manifestJSON, err := json.Marshal(ocispec.Manifest{
+			Versioned: specs.Versioned{SchemaVersion: 2},
+			MediaType: ocispec.MediaTypeImageManifest,
+			Config: ocispec.Descriptor{
+				MediaType: ocispec.MediaTypeImageConfig,
+				Digest:    digest.FromString("config"),
+				Size:      2,
+			},
+			Layers: []ocispec.Descriptor{{
+				MediaType: "application/vnd.oci.image.layer.v1.tar+gzip",
+				Digest:    layerDigest,
+				Size:      10,
+			}},
+		})
+		require.NoError(t, err)
+		manifestDigest := digest.FromBytes(manifestJSON)
+		layerDigests[FormatPlatform(p)] = layerDigest.String()
+
+		handlers["/v2/test/repo/manifests/"+manifestDigest.String()] = func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", ocispec.MediaTypeImageManifest)
+			w.Header().Set("Docker-Content-Digest", manifestDigest.String())
+			w.Write(manifestJSON)
+		}
+		index.Manifests = append(index.Manifests, ocispec.Descriptor{
+			MediaType: ocispec.MediaTypeImageManifest,
+			Digest:    manifestDigest,
+			Size:      int64(len(manifestJSON)),
+			Platform:  &p,
+		})
+	}
+	indexJSON, err := json.Marshal(index)
+	require.NoError(t, err)
+	indexDigest := digest.FromBytes(indexJSON)
+	handlers["/v2/test/repo/manifests/latest"] = func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", ocispec.MediaTypeImageIndex)
+		w.Header().Set("Docker-Content-Digest", indexDigest.String())
+		w.Write(indexJSON)
+	}
+
+	server := mockRegistryServer(t, handlers)
+	t.Cleanup(server.Close)
+	ref := strings.TrimPrefix(server.URL, "http://") + "/test/repo:latest"
+
+	t.Run("selects matching variant", func(t *testing.T) {
+		t.Parallel()
+		platform, err := ParsePlatform("linux/arm64")
+		require.NoError(t, err)
+		r := New(WithPlainHTTP(true), WithPlatform(platform))
+
+		desc, err := r.ResolveLayer(context.Background(), ref)
+		require.NoError(t, err)
+		assert.Equal(t, layerDigests["linux/arm64/v8"], desc.Digest)
+		assert.Equal(t, "linux/arm64/v8", desc.Platform)
+	})
+
+	t.Run("no matching platform", func(t *testing.T) {
+		t.Parallel()
+		platform, err := ParsePlatform("linux/s390x")
+		require.NoError(t, err)
+		r := New(WithPlainHTTP(true), WithPlatform(platform))
+
+		_, err = r.ResolveLayer(context.Background(), ref)
+		require.ErrorIs(t, err, core.ErrPlatformNotFound)
+		assert.Contains(t, err.Error(), "linux/arm64/v8", "error should list available platforms")
+
+		_, err = r.PullRange(context.Background(), ref, 0, 5)
+		assert.ErrorIs(t, err, core.ErrPlatformNotFound)
+	})
+}
+
+func TestResolveLayer_WithPlatformSingleManifest(t *testing.T) {
+	t.Parallel()
+
+	// serve registers a single manifest tagged tag, with the given config.
+	handlers := map[string]http.HandlerFunc{
+		"/v2/": func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		},
+	}
+	serve := func(tag, configMediaType string, config []byte) {
+		configDigest := digest.FromBytes(config)
+		manifestJSON, err := json.Marshal(ocispec.Manifest{
+			Versioned: specs.Versioned{SchemaVersion: 2},
+			MediaType: ocispec.MediaTypeImageManifest,
+			Config: ocispec.Descriptor{
+				MediaType: configMediaType,
+				Digest:    configDigest,
+				Size:      int64(len(config)),
+			},
+			Layers: []ocispec.Descriptor{{
+				MediaType: "application/vnd.oci.image.layer.v1.tar+gzip",
+				Digest:    digest.FromString("layer-" + tag),
+				Size:      10,
+			}},
+		})
+		require.NoError(t, err)
+		handlers["/v2/test/repo/manifests/"+tag] = func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", ocispec.MediaTypeImageManifest)
+			w.Header().Set("Docker-Content-Digest", digest.FromBytes(manifestJSON).String())
+			w.Write(manifestJSON)
+		}
+		handlers["/v2/test/repo/blobs/"+configDigest.String()] = func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Docker-Content-Digest", configDigest.String())
+			w.Write(config)
+		}
+	}
+	amd64Config, err := json.Marshal(ocispec.Image{Platform: ocispec.Platform{OS: "linux", Architecture: "amd64"}})
+	require.NoError(t, err)
+	serve("amd64", ocispec.MediaTypeImageConfig, amd64Config)
+	serve("artifact", "application/vnd.oci.empty.v1+json", []byte("{}"))
+
+	server := mockRegistryServer(t, handlers)
+	t.Cleanup(server.Close)
+	repo := strings.TrimPrefix(server.URL, "http://") + "/test/repo"
+
+	tests := []struct {
+		name         string
+		tag          string
+		platform     string
+		wantPlatform string
+		wantErr      error
+	}{
+		{name: "matching config", tag: "amd64", platform: "linux/amd64", wantPlatform: "linux/amd64"},
+		{name: "other platform", tag: "amd64", platform: "linux/arm64", wantErr: core.ErrPlatformNotFound},
+		{name: "config without platform", tag: "artifact", platform: "linux/arm64", wantPlatform: "linux/arm64"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			platform, err := ParsePlatform(tt.platform)
+			require.NoError(t, err)
+			r := New(WithPlainHTTP(true), WithPlatform(platform))
+
+			desc, err := r.ResolveLayer(context.Background(), repo+":"+tt.tag)
+			if tt.wantErr != nil {
+				require.ErrorIs(t, err, tt.wantErr)
+				assert.Contains(t, err.Error(), "linux/amd64", "error should name the manifest's platform")
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantPlatform, desc.Platform)
+		})
+	}
+}
+
+func TestPushIndex_WithMockRegistry(t *testing.T) {
+	t.Parallel()
+
+	manifests := map[string]digest.Digest{
+		"linux/amd64":    digest.FromString("amd64 manifest"),
+		"linux/arm64/v8": digest.FromString("arm64 manifest"),
+	}
+
+	var pushedIndex []byte
+	handlers := map[string]http.HandlerFunc{
+		"/v2/": func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		},
+		"/v2/test/repo/manifests/latest": func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodPut {
+				w.WriteHeader(http.StatusMethodNotAllowed)
+				return
+			}
+			assert.Equal(t, ocispec.MediaTypeImageIndex, r.Header.Get("Content-Type"))
+			pushedIndex, _ = io.ReadAll(r.Body)
+			w.Header().Set("Docker-Content-Digest", digest.FromBytes(pushedIndex).String())
+			w.WriteHeader(http.StatusCreated)
+		},
+	}
+	for _, d := range manifests {
+		handlers["/v2/test/repo/manifests/"+d.String()] = func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", ocispec.MediaTypeImageManifest)
+			w.Header().Set("Docker-Content-Digest", d.String())
+			w.Header().Set("Content-Length", "14")
+			w.WriteHeader(http.StatusOK)
+		}
+	}
+
+	server := mockRegistryServer(t, handlers)
+	defer server.Close()
+
+	r := New(WithPlainHTTP(true))
+	ref := strings.TrimPrefix(server.URL, "http://") + "/test/repo:latest"
+
+	indexDigest, err := r.PushIndex(context.Background(), ref, []core.IndexManifest{
+		{Digest: manifests["linux/amd64"].String(), Platform: "linux/amd64"},
+		{Digest: manifests["linux/arm64/v8"].String(), Platform: "linux/arm64/v8"},
+	}, core.TagCondition{})
+	require.NoError(t, err)
+	require.NotEmpty(t, pushedIndex)
+	assert.Equal(t, digest.FromBytes(pushedIndex).String(), indexDigest)
+
+	var index ocispec.Index
+	require.NoError(t, json.Unmarshal(pushedIndex, &index))
+	require.Len(t, index.Manifests, 2)
+	for _, m := range index.Manifests {
+		require.NotNil(t, m.Platform)
+		platform := FormatPlatform(*m.Platform)
+		assert.Equal(t, manifests[platform], m.Digest, "digest for %s", platform)
+		assert.Equal(t, int64(14), m.Size)
+		assert.Equal(t, ocispec.MediaTypeImageManifest, m.MediaType)
+	}
+}
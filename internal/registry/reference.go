@@ -0,0 +1,42 @@
+package registry
+
+import (
+	"fmt"
+	"strings"
+
+	"oras.land/oras-go/v2/registry"
+
+	"github.com/meigma/blobber/core"
+)
+
+// ResolveTag returns the reference named by tag relative to ref. A bare tag
+// (e.g., "latest") names a tag in the repository of ref; anything else must
+// be a full reference (e.g., "ghcr.io/org/repo:latest").
+func ResolveTag(ref, tag string) (string, error) {
+	parsedRef, err := registry.ParseReference(ref)
+	if err != nil {
+		return "", core.ErrInvalidRef
+	}
+
+	if !strings.ContainsAny(tag, "/:@") {
+		parsedRef.Reference = tag
+		if err := parsedRef.ValidateReferenceAsTag(); err != nil {
+			return "", fmt.Errorf("%w: tag %q", core.ErrInvalidRef, tag)
+		}
+		return parsedRef.String(), nil
+	}
+
+	if _, err := registry.ParseReference(tag); err != nil {
+		return "", fmt.Errorf("%w: %s", core.ErrInvalidRef, tag)
+	}
+	return tag, nil
+}
+
+// Host returns the registry host of ref, or "" if ref is invalid.
+func Host(ref string) string {
+	parsedRef, err := registry.ParseReference(ref)
+	if err != nil {
+		return ""
+	}
+	return parsedRef.Registry
+}
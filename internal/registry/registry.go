@@ -11,13 +11,14 @@ import (
 	"math"
 	"net/http"
 	"net/url"
-	"runtime"
 	"strings"
 	"sync"
 
+	"github.com/containerd/stargz-snapshotter/estargz"
 	"github.com/opencontainers/go-digest"
 	"github.com/opencontainers/image-spec/specs-go"
 	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"oras.land/oras-go/v2/content"
 	"oras.land/oras-go/v2/registry"
 	"oras.land/oras-go/v2/registry/remote"
 	"oras.land/oras-go/v2/registry/remote/auth"
@@ -40,6 +41,11 @@ type orasRegistry struct {
 	userAgent       string
 	credStore       credentials.Store
 	descriptorCache *descriptorCache
+	platform        *ocispec.Platform // nil selects the runtime platform with fallback
+
+	// parallel download configuration (see WithParallelDownload)
+	parallelDownloads int
+	chunkSize         int64
 }
 
 // New creates a new Registry backed by ORAS.
@@ -53,31 +59,31 @@ func New(opts ...Option) *orasRegistry {
 	return r
 }
 
-type resolvedLayer struct {
-	desc           ocispec.Descriptor
+type resolvedLayers struct {
+	layers         []ocispec.Descriptor
 	manifestDigest string
 	platform       string
 }
 
 type descriptorCache struct {
 	mu      sync.RWMutex
-	entries map[string]resolvedLayer
+	entries map[string]resolvedLayers
 }
 
 func newDescriptorCache() *descriptorCache {
 	return &descriptorCache{
-		entries: make(map[string]resolvedLayer),
+		entries: make(map[string]resolvedLayers),
 	}
 }
 
-func (c *descriptorCache) Get(key string) (resolvedLayer, bool) {
+func (c *descriptorCache) Get(key string) (resolvedLayers, bool) {
 	c.mu.RLock()
 	entry, ok := c.entries[key]
 	c.mu.RUnlock()
 	return entry, ok
 }
 
-func (c *descriptorCache) Set(key string, entry *resolvedLayer) {
+func (c *descriptorCache) Set(key string, entry *resolvedLayers) {
 	if entry == nil {
 		return
 	}
@@ -139,7 +145,7 @@ func (r *orasRegistry) Push(ctx context.Context, ref string, layer io.Reader, op
 		annotations[k] = v
 	}
 	if opts.TOCDigest != "" {
-		annotations["containerd.io/snapshot/stargz/toc.digest"] = opts.TOCDigest
+		annotations[estargz.TOCJSONDigestAnnotation] = opts.TOCDigest
 	}
 
 	// Create layer descriptor.
@@ -155,6 +161,25 @@ func (r *orasRegistry) Push(ctx context.Context, ref string, layer io.Reader, op
 		Annotations: annotations,
 	}
 
+	// Resolve the base image before uploading so a bad base fails fast.
+	var base baseImage
+	platform := runtimePlatform()
+	if opts.BaseRef != "" {
+		loaded, baseErr := r.loadBase(ctx, repo, parsedRef, opts.BaseRef)
+		if baseErr != nil {
+			return "", fmt.Errorf("base image %s: %w", opts.BaseRef, baseErr)
+		}
+		base = *loaded
+		if base.platform.OS != "" {
+			platform = base.platform
+		}
+	}
+	if opts.Platform != "" {
+		if platform, err = ParsePlatform(opts.Platform); err != nil {
+			return "", err
+		}
+	}
+
 	// Push blob directly (streams from reader).
 	if err = repo.Blobs().Push(ctx, layerDesc, layer); err != nil {
 		return "", fmt.Errorf("push layer: %w", mapError(err))
@@ -164,13 +189,11 @@ func (r *orasRegistry) Push(ctx context.Context, ref string, layer io.Reader, op
 	// Per OCI spec, config must have architecture, os, and rootfs.
 	// DiffIDs must be the uncompressed layer digest, not the compressed blob digest.
 	config := ocispec.Image{
-		Platform: ocispec.Platform{
-			Architecture: runtime.GOARCH,
-			OS:           runtime.GOOS,
-		},
+		Created:  opts.Created,
+		Platform: platform,
 		RootFS: ocispec.RootFS{
 			Type:    "layers",
-			DiffIDs: []digest.Digest{diffID},
+			DiffIDs: append(base.diffIDs, diffID),
 		},
 	}
 	configData, err := json.Marshal(config)
@@ -193,7 +216,7 @@ func (r *orasRegistry) Push(ctx context.Context, ref string, layer io.Reader, op
 		Versioned: specs.Versioned{SchemaVersion: 2},
 		MediaType: ocispec.MediaTypeImageManifest,
 		Config:    configDesc,
-		Layers:    []ocispec.Descriptor{layerDesc},
+		Layers:    append(base.layers, layerDesc),
 	}
 
 	manifestJSON, err := json.Marshal(manifest)
@@ -213,13 +236,115 @@ func (r *orasRegistry) Push(ctx context.Context, ref string, layer io.Reader, op
 	}
 
 	// Tag the manifest.
-	if err = repo.Tag(ctx, manifestDesc, parsedRef.Reference); err != nil {
-		return "", fmt.Errorf("tag manifest: %w", mapError(err))
+	if !opts.SkipTag {
+		if err = checkTag(ctx, repo, parsedRef.Reference, opts.TagCondition); err != nil {
+			return "", err
+		}
+		if err = repo.Tag(ctx, manifestDesc, parsedRef.Reference); err != nil {
+			return "", fmt.Errorf("tag manifest: %w", mapError(err))
+		}
 	}
 
 	return manifestDesc.Digest.String(), nil
 }
 
+// PushIndex creates an OCI image index referencing existing manifests and tags it,
+// if the tag satisfies cond. Returns the index digest.
+func (r *orasRegistry) PushIndex(ctx context.Context, ref string, manifests []core.IndexManifest, cond core.TagCondition) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	if len(manifests) == 0 {
+		return "", errors.New("image index requires at least one manifest")
+	}
+
+	parsedRef, err := registry.ParseReference(ref)
+	if err != nil {
+		return "", core.ErrInvalidRef
+	}
+
+	repo, err := r.newRepository(parsedRef)
+	if err != nil {
+		return "", fmt.Errorf("create repository: %w", err)
+	}
+
+	// Resolve each manifest to obtain its media type and size.
+	descs := make([]ocispec.Descriptor, 0, len(manifests))
+	for _, m := range manifests {
+		platform, err := ParsePlatform(m.Platform)
+		if err != nil {
+			return "", err
+		}
+		desc, err := repo.Manifests().Resolve(ctx, m.Digest)
+		if err != nil {
+			return "", fmt.Errorf("resolve manifest %s: %w", m.Digest, mapError(err))
+		}
+		descs = append(descs, ocispec.Descriptor{
+			MediaType: desc.MediaType,
+			Digest:    desc.Digest,
+			Size:      desc.Size,
+			Platform:  &platform,
+		})
+	}
+
+	index := ocispec.Index{
+		Versioned: specs.Versioned{SchemaVersion: 2},
+		MediaType: ocispec.MediaTypeImageIndex,
+		Manifests: descs,
+	}
+	indexJSON, err := json.Marshal(index)
+	if err != nil {
+		return "", fmt.Errorf("marshal index: %w", err)
+	}
+
+	indexDesc := ocispec.Descriptor{
+		MediaType: ocispec.MediaTypeImageIndex,
+		Digest:    digest.FromBytes(indexJSON),
+		Size:      int64(len(indexJSON)),
+	}
+
+	// Push and tag the index in one request.
+	if err = checkTag(ctx, repo, parsedRef.Reference, cond); err != nil {
+		return "", err
+	}
+	if err = repo.Manifests().PushReference(ctx, indexDesc, bytes.NewReader(indexJSON), parsedRef.Reference); err != nil {
+		return "", fmt.Errorf("push index: %w", mapError(err))
+	}
+
+	return indexDesc.Digest.String(), nil
+}
+
+// checkTag resolves tag and returns ErrTagConflict if it does not satisfy cond.
+func checkTag(ctx context.Context, repo *remote.Repository, tag string, cond core.TagCondition) error {
+	if cond == (core.TagCondition{}) {
+		return nil
+	}
+
+	current := ""
+	desc, err := repo.Manifests().Resolve(ctx, tag)
+	switch err = mapError(err); {
+	case err == nil:
+		current = desc.Digest.String()
+	case !errors.Is(err, core.ErrNotFound):
+		return fmt.Errorf("resolve tag %s: %w", tag, err)
+	}
+	return CheckTag(tag, current, cond)
+}
+
+// CheckTag returns ErrTagConflict if a tag pointing to the manifest digest
+// current does not satisfy cond. An empty current means the tag does not exist.
+func CheckTag(tag, current string, cond core.TagCondition) error {
+	switch {
+	case cond.MustNotExist && current != "":
+		return fmt.Errorf("%w: tag %s already exists (%s)", core.ErrTagConflict, tag, current)
+	case cond.ExpectedDigest != "" && current == "":
+		return fmt.Errorf("%w: tag %s does not exist, expected %s", core.ErrTagConflict, tag, cond.ExpectedDigest)
+	case cond.ExpectedDigest != "" && current != cond.ExpectedDigest:
+		return fmt.Errorf("%w: tag %s points to %s, expected %s", core.ErrTagConflict, tag, current, cond.ExpectedDigest)
+	}
+	return nil
+}
+
 // Pull returns a reader for the image's layer blob and its size.
 func (r *orasRegistry) Pull(ctx context.Context, ref string) (io.ReadCloser, int64, error) {
 	if err := ctx.Err(); err != nil {
@@ -238,15 +363,14 @@ func (r *orasRegistry) Pull(ctx context.Context, ref string) (io.ReadCloser, int
 
 	// Resolve layer descriptor.
 	cacheKey := parsedRef.String()
-	layerDesc, manifestDigest, platform, err := r.resolveLayerDescriptor(ctx, repo, cacheKey, parsedRef.Reference)
+	layers, _, _, err := r.resolveLayerDescriptor(ctx, repo, cacheKey, parsedRef.Reference)
 	if err != nil {
-		if errors.Is(err, ErrMultipleLayers) {
-			return nil, 0, fmt.Errorf("%s: %w: %w", ref, core.ErrInvalidArchive, err)
-		}
 		return nil, 0, err
 	}
-	_ = manifestDigest // unused in Pull, but available
-	_ = platform
+	layerDesc, err := singleLayer(layers)
+	if err != nil {
+		return nil, 0, fmt.Errorf("%s: %w: %w", ref, core.ErrInvalidArchive, err)
+	}
 
 	// Fetch the layer blob.
 	blobReader, err := repo.Blobs().Fetch(ctx, layerDesc)
@@ -274,29 +398,83 @@ func (r *orasRegistry) ResolveLayer(ctx context.Context, ref string) (core.Layer
 	}
 
 	cacheKey := parsedRef.String()
-	layerDesc, manifestDigest, platform, err := r.resolveLayerDescriptor(ctx, repo, cacheKey, parsedRef.Reference)
+	layers, manifestDigest, platform, err := r.resolveLayerDescriptor(ctx, repo, cacheKey, parsedRef.Reference)
 	if err != nil {
-		if errors.Is(err, ErrMultipleLayers) {
-			return core.LayerDescriptor{}, fmt.Errorf("%s: %w: %w", ref, core.ErrInvalidArchive, err)
-		}
 		return core.LayerDescriptor{}, err
 	}
+	layerDesc, err := singleLayer(layers)
+	if err != nil {
+		return core.LayerDescriptor{}, fmt.Errorf("%s: %w: %w", ref, core.ErrInvalidArchive, err)
+	}
+
+	return toLayerDescriptor(layerDesc, manifestDigest, platform), nil
+}
 
+// ResolveLayers resolves a reference to the descriptors of all its layers.
+// Layers are returned in manifest order, from the bottom layer to the top layer.
+func (r *orasRegistry) ResolveLayers(ctx context.Context, ref string) ([]core.LayerDescriptor, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	parsedRef, err := registry.ParseReference(ref)
+	if err != nil {
+		return nil, core.ErrInvalidRef
+	}
+
+	repo, err := r.newRepository(parsedRef)
+	if err != nil {
+		return nil, fmt.Errorf("create repository: %w", err)
+	}
+
+	cacheKey := parsedRef.String()
+	layers, manifestDigest, platform, err := r.resolveLayerDescriptor(ctx, repo, cacheKey, parsedRef.Reference)
+	if err != nil {
+		return nil, err
+	}
+
+	descs := make([]core.LayerDescriptor, len(layers))
+	for i, layer := range layers {
+		descs[i] = toLayerDescriptor(layer, manifestDigest, platform)
+	}
+	return descs, nil
+}
+
+// toLayerDescriptor converts an OCI layer descriptor to a core.LayerDescriptor.
+func toLayerDescriptor(desc ocispec.Descriptor, manifestDigest, platform string) core.LayerDescriptor {
 	return core.LayerDescriptor{
-		Digest:         layerDesc.Digest.String(),
-		Size:           layerDesc.Size,
-		MediaType:      layerDesc.MediaType,
+		Digest:         desc.Digest.String(),
+		Size:           desc.Size,
+		MediaType:      desc.MediaType,
 		ManifestDigest: manifestDigest,
 		Platform:       platform,
-	}, nil
+		TOCDigest:      desc.Annotations[estargz.TOCJSONDigestAnnotation],
+	}
+}
+
+// singleLayer returns the only layer of a manifest.
+// Returns ErrMultipleLayers if the manifest has more than one layer.
+func singleLayer(layers []ocispec.Descriptor) (ocispec.Descriptor, error) {
+	if len(layers) > 1 {
+		return ocispec.Descriptor{}, ErrMultipleLayers
+	}
+	return layers[0], nil
 }
 
 // FetchBlob fetches a blob by its descriptor.
+// With WithParallelDownload, large blobs are fetched as concurrent ranges.
 func (r *orasRegistry) FetchBlob(ctx context.Context, ref string, desc core.LayerDescriptor) (io.ReadCloser, error) {
 	if err := ctx.Err(); err != nil {
 		return nil, err
 	}
 
+	if r.useParallelDownload(desc.Size) {
+		rc, err := r.fetchBlobParallel(ctx, ref, desc)
+		if !errors.Is(err, ErrRangeNotSupported) {
+			return rc, err
+		}
+	}
+
 	parsedRef, err := registry.ParseReference(ref)
 	if err != nil {
 		return nil, core.ErrInvalidRef
@@ -359,13 +537,14 @@ func (r *orasRegistry) PullRange(ctx context.Context, ref string, offset, length
 
 	// Resolve layer descriptor.
 	cacheKey := parsedRef.String()
-	layerDesc, _, _, err := r.resolveLayerDescriptor(ctx, repo, cacheKey, parsedRef.Reference)
+	layers, _, _, err := r.resolveLayerDescriptor(ctx, repo, cacheKey, parsedRef.Reference)
 	if err != nil {
-		if errors.Is(err, ErrMultipleLayers) {
-			return nil, fmt.Errorf("%s: %w: %w", ref, core.ErrInvalidArchive, err)
-		}
 		return nil, err
 	}
+	layerDesc, err := singleLayer(layers)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w: %w", ref, core.ErrInvalidArchive, err)
+	}
 
 	return r.fetchRange(ctx, parsedRef, repo, layerDesc.Digest.String(), offset, length)
 }
@@ -520,6 +699,16 @@ func WithDescriptorCache(enabled bool) Option {
 	}
 }
 
+// WithPlatform selects the platform used when resolving OCI indexes.
+// When set, resolution fails with core.ErrPlatformNotFound if no manifest
+// in the index matches, instead of falling back to the first manifest, or
+// if a single manifest's config declares another platform.
+func WithPlatform(platform ocispec.Platform) Option {
+	return func(r *orasRegistry) {
+		r.platform = &platform
+	}
+}
+
 // newRepository creates an authenticated remote repository.
 func (r *orasRegistry) newRepository(ref registry.Reference) (*remote.Repository, error) {
 	repoRef := fmt.Sprintf("%s/%s", ref.Registry, ref.Repository)
@@ -546,43 +735,43 @@ func (r *orasRegistry) newRepository(ref registry.Reference) (*remote.Repository
 	return repo, nil
 }
 
-func (r *orasRegistry) resolveLayerDescriptor(ctx context.Context, repo *remote.Repository, cacheKey, reference string) (desc ocispec.Descriptor, manifestDigest, platform string, err error) {
+func (r *orasRegistry) resolveLayerDescriptor(ctx context.Context, repo *remote.Repository, cacheKey, reference string) (layers []ocispec.Descriptor, manifestDigest, platform string, err error) {
 	if cacheKey != "" && r.descriptorCache != nil {
 		if cached, ok := r.descriptorCache.Get(cacheKey); ok {
-			return cached.desc, cached.manifestDigest, cached.platform, nil
+			return cached.layers, cached.manifestDigest, cached.platform, nil
 		}
 	}
 
-	desc, manifestDigest, platform, err = r.resolveLayerDescriptorFull(ctx, repo, reference)
+	layers, manifestDigest, platform, err = r.resolveLayerDescriptorFull(ctx, repo, reference)
 	if err != nil {
-		return ocispec.Descriptor{}, "", "", err
+		return nil, "", "", err
 	}
 	if cacheKey != "" && r.descriptorCache != nil {
-		r.descriptorCache.Set(cacheKey, &resolvedLayer{
-			desc:           desc,
+		r.descriptorCache.Set(cacheKey, &resolvedLayers{
+			layers:         layers,
 			manifestDigest: manifestDigest,
 			platform:       platform,
 		})
 	}
-	return desc, manifestDigest, platform, nil
+	return layers, manifestDigest, platform, nil
 }
 
-// resolveLayerDescriptorFull fetches the manifest and returns the layer descriptor,
+// resolveLayerDescriptorFull fetches the manifest and returns the layer descriptors,
 // manifest digest, and platform string.
 // Handles both single-arch manifests and multi-arch manifest lists (OCI index).
-// Returns an error if the manifest has multiple layers, as blobber images have exactly one.
+// Layers are returned in manifest order (bottom layer first).
 //
 //nolint:gocritic // unnamedResult: using descriptive variable names in function body instead
-func (r *orasRegistry) resolveLayerDescriptorFull(ctx context.Context, repo *remote.Repository, reference string) (ocispec.Descriptor, string, string, error) {
+func (r *orasRegistry) resolveLayerDescriptorFull(ctx context.Context, repo *remote.Repository, reference string) ([]ocispec.Descriptor, string, string, error) {
 	desc, manifestReader, err := repo.Manifests().FetchReference(ctx, reference)
 	if err != nil {
-		return ocispec.Descriptor{}, "", "", mapError(err)
+		return nil, "", "", mapError(err)
 	}
 	defer manifestReader.Close()
 
 	manifestData, err := io.ReadAll(manifestReader)
 	if err != nil {
-		return ocispec.Descriptor{}, "", "", fmt.Errorf("read manifest: %w", err)
+		return nil, "", "", fmt.Errorf("read manifest: %w", err)
 	}
 
 	// Check if this is an OCI index (multi-arch manifest list).
@@ -593,87 +782,131 @@ func (r *orasRegistry) resolveLayerDescriptorFull(ctx context.Context, repo *rem
 	// Single-arch manifest - decode directly.
 	var manifest ocispec.Manifest
 	if err := json.Unmarshal(manifestData, &manifest); err != nil {
-		return ocispec.Descriptor{}, "", "", fmt.Errorf("decode manifest: %w", err)
+		return nil, "", "", fmt.Errorf("decode manifest: %w", err)
 	}
 
 	if len(manifest.Layers) == 0 {
-		return ocispec.Descriptor{}, "", "", core.ErrNotFound
+		return nil, "", "", core.ErrNotFound
 	}
 
-	if len(manifest.Layers) > 1 {
-		return ocispec.Descriptor{}, "", "", ErrMultipleLayers
+	platform := FormatPlatform(runtimePlatform())
+	if r.platform != nil {
+		// A single manifest declares its platform in its config. Manifests
+		// whose config declares none apply to any platform.
+		have, err := configPlatform(ctx, repo, manifest.Config)
+		if err != nil {
+			return nil, "", "", err
+		}
+		if have.OS != "" && !matchPlatform(*r.platform, have) {
+			return nil, "", "", fmt.Errorf("%w: %s (available: %s)", core.ErrPlatformNotFound, FormatPlatform(*r.platform), FormatPlatform(have))
+		}
+		platform = FormatPlatform(*r.platform)
+		if have.OS != "" {
+			platform = FormatPlatform(have)
+		}
 	}
 
-	// For single-arch manifests, use runtime platform
-	platform := runtime.GOOS + "/" + runtime.GOARCH
+	return manifest.Layers, desc.Digest.String(), platform, nil
+}
 
-	return manifest.Layers[0], desc.Digest.String(), platform, nil
+// configPlatform returns the platform declared by an image config. Configs
+// of other media types, such as empty artifact configs, declare none.
+func configPlatform(ctx context.Context, repo *remote.Repository, desc ocispec.Descriptor) (ocispec.Platform, error) {
+	if desc.MediaType != ocispec.MediaTypeImageConfig && desc.MediaType != dockerConfigMediaType {
+		return ocispec.Platform{}, nil
+	}
+	data, err := content.FetchAll(ctx, repo.Blobs(), desc)
+	if err != nil {
+		return ocispec.Platform{}, fmt.Errorf("fetch config: %w", mapError(err))
+	}
+	var config ocispec.Image
+	if err := json.Unmarshal(data, &config); err != nil {
+		return ocispec.Platform{}, fmt.Errorf("decode config: %w", err)
+	}
+	return config.Platform, nil
 }
 
-// resolveFromIndexFull selects a manifest from an OCI index and returns its layer descriptor,
+// resolveFromIndexFull selects a manifest from an OCI index and returns its layer descriptors,
 // manifest digest, and platform string.
-// Prefers the current runtime platform, falls back to the first manifest if not found.
-// Returns an error if the selected manifest has multiple layers.
+// See selectManifest for how the manifest is chosen.
 //
 //nolint:gocritic // unnamedResult: using descriptive variable names in function body instead
-func (r *orasRegistry) resolveFromIndexFull(ctx context.Context, repo *remote.Repository, indexData []byte) (ocispec.Descriptor, string, string, error) {
+func (r *orasRegistry) resolveFromIndexFull(ctx context.Context, repo *remote.Repository, indexData []byte) ([]ocispec.Descriptor, string, string, error) {
 	var index ocispec.Index
 	if err := json.Unmarshal(indexData, &index); err != nil {
-		return ocispec.Descriptor{}, "", "", fmt.Errorf("decode index: %w", err)
+		return nil, "", "", fmt.Errorf("decode index: %w", err)
 	}
 
 	if len(index.Manifests) == 0 {
-		return ocispec.Descriptor{}, "", "", core.ErrNotFound
+		return nil, "", "", core.ErrNotFound
 	}
 
-	// Find a suitable manifest - prefer current runtime platform.
-	var selected *ocispec.Descriptor
-	for i := range index.Manifests {
-		m := &index.Manifests[i]
-		if m.Platform != nil && m.Platform.OS == runtime.GOOS && m.Platform.Architecture == runtime.GOARCH {
-			selected = m
-			break
-		}
-	}
-	if selected == nil {
-		// Fall back to first manifest.
-		selected = &index.Manifests[0]
+	selected, err := r.selectManifest(index.Manifests)
+	if err != nil {
+		return nil, "", "", err
 	}
 
 	// Build platform string
 	var platform string
 	if selected.Platform != nil {
-		platform = selected.Platform.OS + "/" + selected.Platform.Architecture
-		if selected.Platform.Variant != "" {
-			platform += "/" + selected.Platform.Variant
-		}
+		platform = FormatPlatform(*selected.Platform)
 	} else {
-		platform = runtime.GOOS + "/" + runtime.GOARCH
+		platform = FormatPlatform(runtimePlatform())
 	}
 
 	// Fetch the selected manifest.
 	manifestReader, err := repo.Manifests().Fetch(ctx, *selected)
 	if err != nil {
-		return ocispec.Descriptor{}, "", "", mapError(err)
+		return nil, "", "", mapError(err)
 	}
 	defer manifestReader.Close()
 
 	var manifest ocispec.Manifest
 	if err := json.NewDecoder(manifestReader).Decode(&manifest); err != nil {
-		return ocispec.Descriptor{}, "", "", fmt.Errorf("decode manifest: %w", err)
+		return nil, "", "", fmt.Errorf("decode manifest: %w", err)
 	}
 
 	if len(manifest.Layers) == 0 {
-		return ocispec.Descriptor{}, "", "", core.ErrNotFound
+		return nil, "", "", core.ErrNotFound
 	}
 
-	if len(manifest.Layers) > 1 {
-		return ocispec.Descriptor{}, "", "", ErrMultipleLayers
+	return manifest.Layers, selected.Digest.String(), platform, nil
+}
+
+// selectManifest picks the manifest to use from an index.
+// With an explicit platform (WithPlatform), the first matching manifest is
+// returned, or core.ErrPlatformNotFound if none match. Otherwise the runtime
+// platform is preferred, falling back to the first manifest.
+func (r *orasRegistry) selectManifest(manifests []ocispec.Descriptor) (*ocispec.Descriptor, error) {
+	want := runtimePlatform()
+	if r.platform != nil {
+		want = *r.platform
 	}
 
-	return manifest.Layers[0], selected.Digest.String(), platform, nil
+	for i := range manifests {
+		m := &manifests[i]
+		if m.Platform != nil && matchPlatform(want, *m.Platform) {
+			return m, nil
+		}
+	}
+
+	if r.platform == nil {
+		// Fall back to first manifest.
+		return &manifests[0], nil
+	}
+
+	available := make([]string, 0, len(manifests))
+	for _, m := range manifests {
+		if m.Platform != nil {
+			available = append(available, FormatPlatform(*m.Platform))
+		}
+	}
+	return nil, fmt.Errorf("%w: %s (available: %s)", core.ErrPlatformNotFound, FormatPlatform(want), strings.Join(available, ", "))
 }
 
+// dockerConfigMediaType is the media type of Docker image configs.
+const dockerConfigMediaType = "application/vnd.docker.container.image.v1+json"
+
 // isIndex returns true if the media type indicates an OCI index or Docker manifest list.
 func isIndex(mediaType string) bool {
 	return mediaType == ocispec.MediaTypeImageIndex ||
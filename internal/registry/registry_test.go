@@ -16,6 +16,7 @@ import (
 	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"oras.land/oras-go/v2/registry"
 
 	"github.com/meigma/blobber/core"
 )
@@ -522,6 +523,65 @@ func TestPull_MultipleLayers(t *testing.T) {
 	assert.ErrorIs(t, err, core.ErrInvalidArchive, "expected ErrInvalidArchive")
 }
 
+func TestResolveLayers_MultipleLayers(t *testing.T) {
+	t.Parallel()
+
+	layers := []ocispec.Descriptor{
+		{
+			MediaType: "application/vnd.oci.image.layer.v1.tar+gzip",
+			Digest:    digest.FromString("layer1"),
+			Size:      100,
+		},
+		{
+			MediaType: "application/vnd.oci.image.layer.v1.tar+gzip",
+			Digest:    digest.FromString("layer2"),
+			Size:      200,
+		},
+	}
+	manifest := ocispec.Manifest{
+		Versioned: specs.Versioned{SchemaVersion: 2},
+		MediaType: ocispec.MediaTypeImageManifest,
+		Config: ocispec.Descriptor{
+			MediaType: ocispec.MediaTypeImageConfig,
+			Digest:    digest.FromString("config"),
+			Size:      2,
+		},
+		Layers: layers,
+	}
+	manifestJSON, err := json.Marshal(manifest)
+	require.NoError(t, err)
+	manifestDigest := digest.FromBytes(manifestJSON)
+
+	server := mockRegistryServer(t, map[string]http.HandlerFunc{
+		"/v2/": func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		},
+		"/v2/test/repo/manifests/latest": func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", ocispec.MediaTypeImageManifest)
+			w.Header().Set("Docker-Content-Digest", manifestDigest.String())
+			w.Write(manifestJSON)
+		},
+	})
+	defer server.Close()
+
+	host := strings.TrimPrefix(server.URL, "http://")
+	r := New(WithPlainHTTP(true))
+	ref := host + "/test/repo:latest"
+
+	descs, err := r.ResolveLayers(context.Background(), ref)
+	require.NoError(t, err)
+	require.Len(t, descs, 2)
+	for i, desc := range descs {
+		assert.Equal(t, layers[i].Digest.String(), desc.Digest, "layer %d digest", i)
+		assert.Equal(t, layers[i].Size, desc.Size, "layer %d size", i)
+		assert.Equal(t, manifestDigest.String(), desc.ManifestDigest, "layer %d manifest digest", i)
+	}
+
+	// Single-layer APIs still reject the manifest.
+	_, err = r.ResolveLayer(context.Background(), ref)
+	assert.ErrorIs(t, err, ErrMultipleLayers)
+}
+
 func TestPull_EmptyManifest(t *testing.T) {
 	t.Parallel()
 
@@ -929,3 +989,59 @@ func TestPull_EmptyIndex(t *testing.T) {
 	require.Error(t, err)
 	assert.ErrorIs(t, err, core.ErrNotFound, "expected ErrNotFound")
 }
+
+func TestCheckTag(t *testing.T) {
+	t.Parallel()
+
+	current := digest.FromString("current manifest")
+	server := mockRegistryServer(t, map[string]http.HandlerFunc{
+		"/v2/": func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		},
+		"/v2/test/repo/manifests/": func(w http.ResponseWriter, r *http.Request) {
+			if !strings.HasSuffix(r.URL.Path, "/prod") {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			w.Header().Set("Content-Type", ocispec.MediaTypeImageManifest)
+			w.Header().Set("Docker-Content-Digest", current.String())
+			w.Header().Set("Content-Length", "16")
+			w.WriteHeader(http.StatusOK)
+		},
+	})
+	t.Cleanup(server.Close)
+
+	r := New(WithPlainHTTP(true))
+	ref, err := registry.ParseReference(strings.TrimPrefix(server.URL, "http://") + "/test/repo:prod")
+	require.NoError(t, err)
+	repo, err := r.newRepository(ref)
+	require.NoError(t, err)
+
+	other := digest.FromString("other manifest").String()
+	tests := []struct {
+		name     string
+		tag      string
+		cond     core.TagCondition
+		conflict bool
+	}{
+		{name: "unconditional", tag: "prod"},
+		{name: "expected digest matches", tag: "prod", cond: core.TagCondition{ExpectedDigest: current.String()}},
+		{name: "tag moved", tag: "prod", cond: core.TagCondition{ExpectedDigest: other}, conflict: true},
+		{name: "expected tag missing", tag: "staging", cond: core.TagCondition{ExpectedDigest: other}, conflict: true},
+		{name: "must not exist", tag: "staging", cond: core.TagCondition{MustNotExist: true}},
+		{name: "already exists", tag: "prod", cond: core.TagCondition{MustNotExist: true}, conflict: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			err := checkTag(context.Background(), repo, tt.tag, tt.cond)
+			if tt.conflict {
+				require.ErrorIs(t, err, core.ErrTagConflict)
+				return
+			}
+			require.NoError(t, err)
+		})
+	}
+}
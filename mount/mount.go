@@ -0,0 +1,75 @@
+// Package mount exposes blobber images as read-only FUSE filesystems.
+//
+// Any fs.FS can be mounted; images are mounted through their io/fs view
+// (blobber.Image.FS). Files are read through the image when the kernel asks
+// for them, so with a lazily loaded image (blobber.WithLazyLoading) only the
+// byte ranges that are actually read are fetched from the registry. This
+// makes it practical to browse large images without pulling them.
+//
+// Mounting requires FUSE and is only supported on Linux. Unprivileged users
+// need the fusermount3 (or fusermount) helper in PATH.
+package mount
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"log/slog"
+)
+
+// ErrNotSupported is returned by Mount on platforms without FUSE support.
+var ErrNotSupported = errors.New("mount: FUSE is not supported on this platform")
+
+// Option configures a mount.
+type Option func(*config)
+
+type config struct {
+	fsName     string
+	allowOther bool
+	logger     *slog.Logger
+}
+
+// WithFSName sets the mount source shown in /proc/mounts and by mount(8),
+// typically the image reference. Defaults to "blobber".
+func WithFSName(name string) Option {
+	return func(c *config) {
+		c.fsName = name
+	}
+}
+
+// WithAllowOther lets users other than the one mounting access the filesystem.
+// Unprivileged users need user_allow_other in /etc/fuse.conf.
+func WithAllowOther(enabled bool) Option {
+	return func(c *config) {
+		c.allowOther = enabled
+	}
+}
+
+// WithLogger sets the logger for failed filesystem requests.
+// Defaults to discarding logs.
+func WithLogger(logger *slog.Logger) Option {
+	return func(c *config) {
+		c.logger = logger
+	}
+}
+
+// Mount mounts fsys read-only at mountpoint, which must be an existing
+// directory, and serves it until ctx is done or the filesystem is unmounted
+// externally (for example with fusermount -u).
+//
+// When ctx is done, Mount unmounts the filesystem and returns nil. If the
+// unmount fails because files are still in use, the error is returned and
+// the mount is left in place; it stops working once the process exits and
+// must then be unmounted by hand.
+//
+// Symbolic links are served when fsys implements fs.ReadLinkFS, and files
+// that implement io.ReaderAt or io.Seeker are read at random offsets;
+// blobber.Image.FS provides both. An image must stay open while its FS is
+// mounted.
+func Mount(ctx context.Context, fsys fs.FS, mountpoint string, opts ...Option) error {
+	var cfg config
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	return mountFS(ctx, fsys, mountpoint, &cfg)
+}
@@ -0,0 +1,73 @@
+package mount
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"time"
+
+	fusefs "github.com/hanwen/go-fuse/v2/fs"
+	"github.com/hanwen/go-fuse/v2/fuse"
+)
+
+// cacheTimeout is how long the kernel may cache entries and attributes.
+// Served filesystems are immutable, so this can be long.
+const cacheTimeout = time.Hour
+
+// mountFS serves fsys at mountpoint until ctx is done or it is unmounted.
+func mountFS(ctx context.Context, fsys fs.FS, mountpoint string, cfg *config) error {
+	logger := cfg.logger
+	if logger == nil {
+		logger = slog.New(slog.DiscardHandler)
+	}
+	fsName := cfg.fsName
+	if fsName == "" {
+		fsName = "blobber"
+	}
+
+	// go-fuse logs through a standard library logger.
+	fuseLogger := slog.NewLogLogger(logger.Handler(), slog.LevelDebug)
+	timeout := cacheTimeout
+	srv, err := fusefs.Mount(mountpoint, newRoot(fsys, logger), &fusefs.Options{
+		MountOptions: fuse.MountOptions{
+			FsName:     fsName,
+			Name:       "blobber",
+			AllowOther: cfg.allowOther,
+			Options:    []string{"ro", "nosuid", "nodev", "default_permissions"},
+			// Mount directly when privileged, and through fusermount otherwise.
+			DirectMount: true,
+			Logger:      fuseLogger,
+		},
+		EntryTimeout:    &timeout,
+		AttrTimeout:     &timeout,
+		NegativeTimeout: &timeout,
+		//nolint:gosec // G115: uid and gid are non-negative
+		UID: uint32(os.Getuid()),
+		//nolint:gosec // G115: uid and gid are non-negative
+		GID:    uint32(os.Getgid()),
+		Logger: fuseLogger,
+	})
+	if err != nil {
+		return fmt.Errorf("mount %s: %w", mountpoint, err)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		srv.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+	}
+
+	if err := srv.Unmount(); err != nil {
+		return err
+	}
+	<-done
+	return nil
+}
@@ -0,0 +1,64 @@
+package mount
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMount(t *testing.T) {
+	t.Parallel()
+
+	if _, err := os.Stat("/dev/fuse"); err != nil {
+		t.Skip("FUSE not available: /dev/fuse missing")
+	}
+
+	fsys := fstest.MapFS{
+		"config.yaml": &fstest.MapFile{Data: []byte("key: value"), Mode: 0o644},
+		"current":     &fstest.MapFile{Data: []byte("config.yaml"), Mode: fs.ModeSymlink | 0o777},
+	}
+	mnt := t.TempDir()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- Mount(ctx, fsys, mnt, WithFSName("test")) }()
+
+	// Wait for the mount to appear, or for Mount to fail.
+	var got []byte
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		select {
+		case err := <-done:
+			if errors.Is(err, syscall.EPERM) || errors.Is(err, syscall.EACCES) {
+				t.Skipf("FUSE mount not permitted: %v", err)
+			}
+			require.NoError(t, err)
+			t.Fatal("Mount returned before ctx was cancelled")
+		default:
+		}
+		var err error
+		if got, err = os.ReadFile(filepath.Join(mnt, "current")); err == nil {
+			break
+		}
+		require.True(t, time.Now().Before(deadline), "mount did not appear: %v", err)
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.Equal(t, "key: value", string(got))
+
+	cancel()
+	require.NoError(t, <-done)
+
+	// The mountpoint is empty again after unmounting.
+	entries, err := os.ReadDir(mnt)
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+}
@@ -0,0 +1,13 @@
+//go:build !linux
+
+package mount
+
+import (
+	"context"
+	"io/fs"
+)
+
+// mountFS reports that mounting is not supported on this platform.
+func mountFS(_ context.Context, _ fs.FS, _ string, _ *config) error {
+	return ErrNotSupported
+}
@@ -0,0 +1,262 @@
+package mount
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"log/slog"
+	"path"
+	"sync"
+	"syscall"
+
+	fusefs "github.com/hanwen/go-fuse/v2/fs"
+	"github.com/hanwen/go-fuse/v2/fuse"
+)
+
+// Compile-time interface checks.
+var (
+	_ fusefs.NodeGetattrer  = (*node)(nil)
+	_ fusefs.NodeLookuper   = (*node)(nil)
+	_ fusefs.NodeReaddirer  = (*node)(nil)
+	_ fusefs.NodeOpener     = (*node)(nil)
+	_ fusefs.NodeReadlinker = (*node)(nil)
+	_ fusefs.NodeStatfser   = (*node)(nil)
+	_ fusefs.FileReader     = (*handle)(nil)
+	_ fusefs.FileReleaser   = (*handle)(nil)
+)
+
+// node is an entry of a served fs.FS. Nodes are created when the kernel
+// looks them up, so only the parts of the tree that are visited are read.
+type node struct {
+	fusefs.Inode
+
+	fsys   fs.FS
+	path   string // "." for the root
+	logger *slog.Logger
+}
+
+// newRoot returns the root node serving fsys.
+func newRoot(fsys fs.FS, logger *slog.Logger) *node {
+	return &node{fsys: fsys, path: ".", logger: logger}
+}
+
+// Getattr reports the attributes of the entry. Symbolic links are not followed.
+func (n *node) Getattr(_ context.Context, _ fusefs.FileHandle, out *fuse.AttrOut) syscall.Errno {
+	info, err := fs.Lstat(n.fsys, n.path)
+	if err != nil {
+		return n.errno(n.path, err)
+	}
+	setAttr(&out.Attr, info)
+	return fusefs.OK
+}
+
+// Lookup returns the child named name.
+func (n *node) Lookup(ctx context.Context, name string, out *fuse.EntryOut) (*fusefs.Inode, syscall.Errno) {
+	p := path.Join(n.path, name)
+	info, err := fs.Lstat(n.fsys, p)
+	if err != nil {
+		return nil, n.errno(p, err)
+	}
+	setAttr(&out.Attr, info)
+	child := &node{fsys: n.fsys, path: p, logger: n.logger}
+	return n.NewInode(ctx, child, fusefs.StableAttr{Mode: out.Mode & syscall.S_IFMT}), fusefs.OK
+}
+
+// Readdir lists the directory.
+func (n *node) Readdir(context.Context) (fusefs.DirStream, syscall.Errno) {
+	entries, err := fs.ReadDir(n.fsys, n.path)
+	if err != nil {
+		return nil, n.errno(n.path, err)
+	}
+	list := make([]fuse.DirEntry, 0, len(entries))
+	for _, e := range entries {
+		list = append(list, fuse.DirEntry{Name: e.Name(), Mode: unixMode(e.Type())})
+	}
+	return fusefs.NewListDirStream(list), fusefs.OK
+}
+
+// Open opens a regular file for reading.
+func (n *node) Open(_ context.Context, flags uint32) (fusefs.FileHandle, uint32, syscall.Errno) {
+	if flags&syscall.O_ACCMODE != syscall.O_RDONLY {
+		return nil, 0, syscall.EROFS
+	}
+	f, err := n.fsys.Open(n.path)
+	if err != nil {
+		return nil, 0, n.errno(n.path, err)
+	}
+	// Served filesystems are immutable, so cached pages stay valid.
+	return &handle{node: n, file: f}, fuse.FOPEN_KEEP_CACHE, fusefs.OK
+}
+
+// Readlink returns the target of a symbolic link.
+func (n *node) Readlink(context.Context) ([]byte, syscall.Errno) {
+	target, err := fs.ReadLink(n.fsys, n.path)
+	if err != nil {
+		return nil, n.errno(n.path, err)
+	}
+	return []byte(target), fusefs.OK
+}
+
+// Statfs reports an empty filesystem; served filesystems have no free space.
+func (n *node) Statfs(_ context.Context, out *fuse.StatfsOut) syscall.Errno {
+	out.Bsize = 4096
+	out.Frsize = 4096
+	out.NameLen = 255
+	return fusefs.OK
+}
+
+// errno maps err to the errno reported to the kernel, logging failures that
+// are not explained by the request itself.
+func (n *node) errno(p string, err error) syscall.Errno {
+	errno := toErrno(err)
+	if errno == syscall.EIO {
+		n.logger.Debug("fuse request failed", "path", p, "error", err)
+	}
+	return errno
+}
+
+// toErrno maps an error to the errno reported to the kernel.
+func toErrno(err error) syscall.Errno {
+	var errno syscall.Errno
+	switch {
+	case errors.As(err, &errno):
+		return errno
+	case errors.Is(err, fs.ErrNotExist):
+		return syscall.ENOENT
+	case errors.Is(err, fs.ErrPermission):
+		return syscall.EACCES
+	case errors.Is(err, fs.ErrInvalid):
+		return syscall.EINVAL
+	}
+	return syscall.EIO
+}
+
+// handle is an open regular file.
+type handle struct {
+	node *node
+
+	mu   sync.Mutex
+	file fs.File
+	pos  int64 // read position of file when it has no ReaderAt
+}
+
+// Read reads len(dest) bytes at off, or fewer at the end of the file.
+func (h *handle) Read(_ context.Context, dest []byte, off int64) (fuse.ReadResult, syscall.Errno) {
+	n, err := h.readAt(dest, off)
+	if err != nil {
+		return nil, h.node.errno(h.node.path, err)
+	}
+	return fuse.ReadResultData(dest[:n]), fusefs.OK
+}
+
+// Release closes the file.
+func (h *handle) Release(context.Context) syscall.Errno {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if err := h.file.Close(); err != nil {
+		return h.node.errno(h.node.path, err)
+	}
+	return fusefs.OK
+}
+
+// readAt reads len(p) bytes at off, or fewer at the end of the file.
+// Files without io.ReaderAt are read sequentially, seeking or reopening
+// them when the kernel reads out of order.
+func (h *handle) readAt(p []byte, off int64) (int, error) {
+	if ra, ok := h.file.(io.ReaderAt); ok {
+		n, err := ra.ReadAt(p, off)
+		if errors.Is(err, io.EOF) {
+			err = nil
+		}
+		return n, err
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if off != h.pos {
+		if err := h.reposition(off); err != nil {
+			return 0, err
+		}
+	}
+	n, err := io.ReadFull(h.file, p)
+	h.pos += int64(n)
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		err = nil
+	}
+	return n, err
+}
+
+// reposition moves the read position of a sequential file to off.
+func (h *handle) reposition(off int64) error {
+	if seeker, ok := h.file.(io.Seeker); ok {
+		if _, err := seeker.Seek(off, io.SeekStart); err != nil {
+			return err
+		}
+		h.pos = off
+		return nil
+	}
+
+	if off < h.pos {
+		f, err := h.node.fsys.Open(h.node.path)
+		if err != nil {
+			return err
+		}
+		h.file.Close()
+		h.file, h.pos = f, 0
+	}
+	n, err := io.CopyN(io.Discard, h.file, off-h.pos)
+	h.pos += n
+	if errors.Is(err, io.EOF) {
+		err = nil
+	}
+	return err
+}
+
+// setAttr fills out from info.
+func setAttr(out *fuse.Attr, info fs.FileInfo) {
+	out.Mode = unixMode(info.Mode())
+	out.Nlink = 1
+	if info.IsDir() {
+		out.Nlink = 2
+	} else if size := info.Size(); size > 0 {
+		out.Size = uint64(size)
+		out.Blocks = (out.Size + 511) / 512
+	}
+	out.Blksize = 4096
+	if mtime := info.ModTime(); mtime.Unix() > 0 {
+		out.SetTimes(&mtime, &mtime, &mtime)
+	}
+}
+
+// unixMode converts an fs.FileMode to a Unix mode with file type bits.
+func unixMode(m fs.FileMode) uint32 {
+	mode := uint32(m.Perm())
+	switch {
+	case m.IsDir():
+		mode |= syscall.S_IFDIR
+	case m&fs.ModeSymlink != 0:
+		mode |= syscall.S_IFLNK
+	case m&fs.ModeNamedPipe != 0:
+		mode |= syscall.S_IFIFO
+	case m&fs.ModeSocket != 0:
+		mode |= syscall.S_IFSOCK
+	case m&fs.ModeCharDevice != 0:
+		mode |= syscall.S_IFCHR
+	case m&fs.ModeDevice != 0:
+		mode |= syscall.S_IFBLK
+	default:
+		mode |= syscall.S_IFREG
+	}
+	if m&fs.ModeSetuid != 0 {
+		mode |= syscall.S_ISUID
+	}
+	if m&fs.ModeSetgid != 0 {
+		mode |= syscall.S_ISGID
+	}
+	if m&fs.ModeSticky != 0 {
+		mode |= syscall.S_ISVTX
+	}
+	return mode
+}
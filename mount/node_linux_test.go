@@ -0,0 +1,132 @@
+package mount
+
+import (
+	"context"
+	"io/fs"
+	"log/slog"
+	"syscall"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	fusefs "github.com/hanwen/go-fuse/v2/fs"
+	"github.com/hanwen/go-fuse/v2/fuse"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testRoot returns the root node of fsys attached to a node filesystem, so
+// its methods can be called without mounting it.
+func testRoot(t *testing.T, fsys fs.FS) *node {
+	t.Helper()
+	root := newRoot(fsys, slog.New(slog.DiscardHandler))
+	fusefs.NewNodeFS(root, &fusefs.Options{})
+	return root
+}
+
+// lookup looks up a slash-separated path below n.
+func lookup(t *testing.T, n *node, names ...string) (*node, fuse.EntryOut) {
+	t.Helper()
+	var out fuse.EntryOut
+	for _, name := range names {
+		child, errno := n.Lookup(context.Background(), name, &out)
+		require.Equal(t, fusefs.OK, errno, "lookup %s", name)
+		n = child.Operations().(*node)
+	}
+	return n, out
+}
+
+func TestNode(t *testing.T) {
+	t.Parallel()
+
+	mtime := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	fsys := fstest.MapFS{
+		"etc/config.yaml": &fstest.MapFile{Data: []byte("key: value"), Mode: 0o644, ModTime: mtime},
+		"bin/tool":        &fstest.MapFile{Data: []byte("#!/bin/sh\n"), Mode: 0o755 | fs.ModeSetuid},
+		"current":         &fstest.MapFile{Data: []byte("etc/config.yaml"), Mode: fs.ModeSymlink | 0o777},
+	}
+	ctx := context.Background()
+	root := testRoot(t, fsys)
+
+	t.Run("readdir", func(t *testing.T) {
+		t.Parallel()
+		stream, errno := root.Readdir(ctx)
+		require.Equal(t, fusefs.OK, errno)
+		got := map[string]uint32{}
+		for stream.HasNext() {
+			e, errno := stream.Next()
+			require.Equal(t, fusefs.OK, errno)
+			got[e.Name] = e.Mode & syscall.S_IFMT
+		}
+		assert.Equal(t, map[string]uint32{
+			"bin":     syscall.S_IFDIR,
+			"current": syscall.S_IFLNK,
+			"etc":     syscall.S_IFDIR,
+		}, got)
+	})
+
+	t.Run("getattr", func(t *testing.T) {
+		t.Parallel()
+		n, entry := lookup(t, root, "etc", "config.yaml")
+		assert.Equal(t, uint32(syscall.S_IFREG|0o644), entry.Mode)
+
+		var out fuse.AttrOut
+		require.Equal(t, fusefs.OK, n.Getattr(ctx, nil, &out))
+		assert.Equal(t, uint32(syscall.S_IFREG|0o644), out.Mode)
+		assert.Equal(t, uint64(len("key: value")), out.Size)
+		assert.Equal(t, uint32(1), out.Nlink)
+		assert.Equal(t, uint64(mtime.Unix()), out.Mtime)
+
+		_, entry = lookup(t, root, "bin", "tool")
+		assert.Equal(t, uint32(syscall.S_IFREG|syscall.S_ISUID|0o755), entry.Mode)
+	})
+
+	t.Run("read", func(t *testing.T) {
+		t.Parallel()
+		n, _ := lookup(t, root, "etc", "config.yaml")
+		fh, flags, errno := n.Open(ctx, syscall.O_RDONLY)
+		require.Equal(t, fusefs.OK, errno)
+		assert.Equal(t, uint32(fuse.FOPEN_KEEP_CACHE), flags)
+		h := fh.(*handle)
+		defer h.Release(ctx)
+
+		for _, tc := range []struct {
+			off  int64
+			size int
+			want string
+		}{
+			{off: 5, size: 5, want: "value"},
+			{off: 0, size: 3, want: "key"},
+			{off: 8, size: 100, want: "ue"},
+		} {
+			res, errno := h.Read(ctx, make([]byte, tc.size), tc.off)
+			require.Equal(t, fusefs.OK, errno)
+			data, status := res.Bytes(nil)
+			require.True(t, status.Ok())
+			assert.Equal(t, tc.want, string(data), "read %d at %d", tc.size, tc.off)
+		}
+	})
+
+	t.Run("readlink", func(t *testing.T) {
+		t.Parallel()
+		n, entry := lookup(t, root, "current")
+		assert.Equal(t, uint32(syscall.S_IFLNK), entry.Mode&syscall.S_IFMT)
+		target, errno := n.Readlink(ctx)
+		require.Equal(t, fusefs.OK, errno)
+		assert.Equal(t, "etc/config.yaml", string(target))
+	})
+
+	t.Run("missing", func(t *testing.T) {
+		t.Parallel()
+		var out fuse.EntryOut
+		_, errno := root.Lookup(ctx, "missing", &out)
+		assert.Equal(t, syscall.ENOENT, errno)
+	})
+
+	t.Run("write", func(t *testing.T) {
+		t.Parallel()
+		n, _ := lookup(t, root, "etc", "config.yaml")
+		_, _, errno := n.Open(ctx, syscall.O_RDWR)
+		assert.Equal(t, syscall.EROFS, errno)
+	})
+}
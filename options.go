@@ -1,12 +1,14 @@
 package blobber
 
 import (
+	"fmt"
 	"log/slog"
 	"time"
 
 	"oras.land/oras-go/v2/registry/remote/credentials"
 
 	"github.com/meigma/blobber/core"
+	"github.com/meigma/blobber/internal/archive"
 	"github.com/meigma/blobber/internal/registry"
 )
 
@@ -19,22 +21,108 @@ type PushOption func(*pushConfig)
 // PullOption configures a Pull operation.
 type PullOption func(*pullConfig)
 
+// ExportOption configures an Image.WriteTar operation.
+type ExportOption func(*exportConfig)
+
+// CopyOption configures a Copy operation.
+type CopyOption func(*copyConfig)
+
 // ExtractLimits defines safety limits for extraction.
 // Re-exported from core package.
 type ExtractLimits = core.ExtractLimits
 
+// ExtractTypes selects the special file types created on extraction.
+// Re-exported from core package.
+type ExtractTypes = core.ExtractTypes
+
+// IDMap translates archive owners to host owners on extraction.
+// Re-exported from core package.
+type IDMap = core.IDMap
+
+// IDMapping maps a range of archive IDs to host IDs.
+// Re-exported from core package.
+type IDMapping = core.IDMapping
+
 // pushConfig holds configuration for Push operations.
 type pushConfig struct {
 	annotations map[string]string
 	mediaType   string
 	compression Compression
 	progress    ProgressCallback
+	baseRef     string
+
+	// sourceDateEpoch enables reproducible builds when set
+	sourceDateEpoch *time.Time
+	// prioritized lists files written first, before the prefetch landmark
+	prioritized []string
+	// skipIfUnchanged returns the existing image when the tag holds the same content
+	skipIfUnchanged bool
+	// tagCondition is checked right before the tag is moved
+	tagCondition TagCondition
+	// tags lists the other tags or references the pushed image is copied to
+	tags []string
 }
 
 // pullConfig holds configuration for Pull operations.
 type pullConfig struct {
 	limits   ExtractLimits
+	types    ExtractTypes
 	progress ProgressCallback
+	include  []string
+	exclude  []string
+	preserve archive.Preserve
+	atomic   bool
+
+	// filter is compiled from include and exclude when the pull starts.
+	filter *archive.Filter
+}
+
+// exportConfig holds configuration for Image.WriteTar.
+type exportConfig struct {
+	format ExportFormat
+
+	// filter selects the entries to write; nil writes all entries.
+	filter *archive.Filter
+	// paths, if set, further restricts the entries written to these paths.
+	paths map[string]bool
+	// progress is called with the cumulative file bytes written.
+	progress func(written int64)
+}
+
+// copyConfig holds configuration for Copy operations.
+type copyConfig struct {
+	// referrers copies the referrers of the copied manifests
+	referrers bool
+	// resign signs the copied manifests at the destination
+	resign bool
+}
+
+// buildOptions returns the archive build options for the push.
+func (c *pushConfig) buildOptions() *core.BuildOptions {
+	return &core.BuildOptions{
+		SourceDateEpoch:  c.sourceDateEpoch,
+		PrioritizedFiles: c.prioritized,
+	}
+}
+
+// createdAt returns the timestamp recorded for the push: the source date epoch
+// for reproducible pushes, or the current time otherwise.
+func (c *pushConfig) createdAt() time.Time {
+	if c.sourceDateEpoch != nil {
+		return c.sourceDateEpoch.UTC()
+	}
+	return time.Now().UTC()
+}
+
+// newPushConfig applies opts on top of the default push configuration.
+func newPushConfig(opts []PushOption) *pushConfig {
+	cfg := &pushConfig{
+		compression: GzipCompression(), // default
+	}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	return cfg
 }
 
 // WithAnnotations sets OCI annotations on the pushed image.
@@ -44,6 +132,21 @@ func WithAnnotations(annotations map[string]string) PushOption {
 	}
 }
 
+// WithBaseImage pushes src as a new layer on top of the layers of an existing image.
+// Only files that are new or changed relative to the base image are uploaded,
+// and files missing from src are hidden with OCI whiteouts. The base image's
+// TOCs are read with range requests, so its layers are not downloaded.
+//
+// The base may be in another repository; its layer blobs are mounted or copied
+// into the target repository. Each incremental push adds a layer, so rebuild
+// without a base periodically to keep the layer count down.
+// Not supported by PushIndex.
+func WithBaseImage(ref string) PushOption {
+	return func(c *pushConfig) {
+		c.baseRef = ref
+	}
+}
+
 // WithCompression sets the compression algorithm (gzip or zstd).
 func WithCompression(c Compression) PushOption {
 	return func(cfg *pushConfig) {
@@ -67,6 +170,22 @@ func WithCredentialStore(store credentials.Store) ClientOption {
 	}
 }
 
+// WithExportFormat sets the archive format written by Image.WriteTar.
+// The default is an uncompressed tar archive.
+func WithExportFormat(format ExportFormat) ExportOption {
+	return func(c *exportConfig) {
+		c.format = format
+	}
+}
+
+// WithExclude skips files matching any of the glob patterns during pull.
+// Patterns follow the same rules as WithInclude; excludes take precedence over includes.
+func WithExclude(patterns ...string) PullOption {
+	return func(c *pullConfig) {
+		c.exclude = append(c.exclude, patterns...)
+	}
+}
+
 // WithExtractLimits sets safety limits for extraction.
 func WithExtractLimits(limits ExtractLimits) PullOption {
 	return func(c *pullConfig) {
@@ -74,6 +193,90 @@ func WithExtractLimits(limits ExtractLimits) PullOption {
 	}
 }
 
+// WithExtractTypes allows the special file types selected by types to be
+// extracted. Without it, images containing device or FIFO nodes fail to pull
+// with ErrExtractLimits. Creating devices usually requires root privileges.
+func WithExtractTypes(types ExtractTypes) PullOption {
+	return func(c *pullConfig) {
+		c.types = types
+	}
+}
+
+// WithPreserveTimes restores the modification times recorded in the image.
+// Without it, extracted files get the time of extraction.
+func WithPreserveTimes() PullOption {
+	return func(c *pullConfig) {
+		c.preserve.Times = true
+	}
+}
+
+// WithPreserveOwnership restores the owners and groups recorded in the image.
+// It only takes effect when running as root; use WithIDMap to restore
+// ownership through a mapping instead. The mode recorded in the image,
+// including setuid and setgid bits, is restored after the owner.
+func WithPreserveOwnership() PullOption {
+	return func(c *pullConfig) {
+		c.preserve.Ownership = true
+	}
+}
+
+// WithIDMap restores ownership, translating the owners recorded in the image
+// through m. It applies whether or not the process runs as root, so the
+// mapped IDs must be ones the process may assign. IDs not covered by m are
+// left unchanged.
+func WithIDMap(m IDMap) PullOption {
+	return func(c *pullConfig) {
+		c.preserve.Ownership = true
+		c.preserve.IDMap = &m
+	}
+}
+
+// WithPreserveXattrs restores the extended attributes recorded in the image.
+// Attributes the destination filesystem does not support are skipped. Like
+// ownership, attributes in the trusted. and security. namespaces need
+// privileges, so they are skipped when denied without root.
+func WithPreserveXattrs() PullOption {
+	return func(c *pullConfig) {
+		c.preserve.Xattrs = true
+	}
+}
+
+// WithAtomic makes the pull all-or-nothing. The image is extracted into a
+// staging directory next to the destination, which then replaces the
+// destination as a whole: files not in the image are removed rather than
+// merged. If the pull fails, the destination is left untouched.
+//
+// A destination that is a symbolic link is flipped to the staging directory.
+// A destination directory is swapped atomically on Linux and macOS; on other
+// platforms it is briefly missing during the swap.
+func WithAtomic() PullOption {
+	return func(c *pullConfig) {
+		c.atomic = true
+	}
+}
+
+// WithInclude pulls only files matching at least one of the glob patterns.
+//
+// Patterns use path.Match syntax against paths relative to the image root.
+// A pattern matching a directory selects everything below it ("config"
+// selects config/ and its contents), and patterns without a slash match a
+// name at any depth ("*.yaml" selects every YAML file).
+//
+// For eStargz images, the selection is made from the TOC and only the
+// matching files are fetched with range requests. When range requests are not
+// available, or the client uses an eager cache, the layers are streamed and
+// non-matching entries are skipped.
+//
+// A selected hard link whose target is not selected is written as a copy of
+// the target when files are fetched from the TOC. When streaming, the
+// target's content has already been skipped, so the link is skipped with a
+// warning.
+func WithInclude(patterns ...string) PullOption {
+	return func(c *pullConfig) {
+		c.include = append(c.include, patterns...)
+	}
+}
+
 // WithInsecure allows connections to registries without TLS.
 func WithInsecure(insecure bool) ClientOption {
 	return func(c *Client) error {
@@ -97,6 +300,117 @@ func WithMediaType(mt string) PushOption {
 	}
 }
 
+// WithReproducible makes pushes deterministic: pushing identical inputs yields
+// identical blob and manifest digests. File mtimes are set to sourceDateEpoch,
+// ownership is cleared, and permissions are normalized to 0644 (0755 for
+// directories and executables, 0777 for symbolic links). The image config
+// creation time and the signature timestamp annotation are pinned to
+// sourceDateEpoch.
+//
+// sourceDateEpoch is typically the commit time of the source, following the
+// SOURCE_DATE_EPOCH convention (https://reproducible-builds.org/specs/source-date-epoch/).
+func WithReproducible(sourceDateEpoch time.Time) PushOption {
+	return func(c *pushConfig) {
+		c.sourceDateEpoch = &sourceDateEpoch
+	}
+}
+
+// WithPrioritizedFiles places the given files at the start of the layer,
+// followed by the eStargz prefetch landmark. Clients that open the image
+// lazily with background prefetch fetch this region first, so files needed
+// at startup are local before they are read. Paths are slash-separated and
+// relative to the source root; a directory prioritizes its whole subtree.
+// Files are written in the given order, and missing files fail the push.
+//
+// Not supported by PushTar.
+func WithPrioritizedFiles(paths ...string) PushOption {
+	return func(c *pushConfig) {
+		c.prioritized = append(c.prioritized, paths...)
+	}
+}
+
+// WithSkipIfUnchanged skips the push when the tag already holds the same
+// content, returning the digest of the existing image without uploading,
+// tagging, or signing anything.
+//
+// Push compares the files of src with the TOC of the tagged image by type,
+// permissions, link target, and content digest, so only the TOC is read and
+// nothing is built when they match. With WithReproducible, the built blob is
+// compared with the tagged layer instead, which also covers timestamps,
+// ownership, and file order. PushTar always compares the built blob.
+//
+// The tag only matches a single-layer image with the same layer media type
+// and annotations. Not supported with WithBaseImage or by PushIndex. Tag
+// conditions set with WithExpectedDigest or WithIfNotExists still apply, so
+// a skipped push fails with ErrTagConflict if the tag could not have moved.
+func WithSkipIfUnchanged() PushOption {
+	return func(c *pushConfig) {
+		c.skipIfUnchanged = true
+	}
+}
+
+// WithTags also publishes the pushed image under additional tags. A bare tag
+// (e.g., "latest") names a tag in the pushed repository; a full reference
+// (e.g., "registry.example.com/org/repo:v1") may name another repository or
+// registry.
+//
+// The image is built and uploaded once. It is then copied to each additional
+// destination: within a repository only the tag is set, within a registry
+// blobs are mounted, and across registries blobs missing from the destination
+// are streamed from the pushed repository. Signatures created by WithSigner
+// are copied along. Destinations on different registries are pushed
+// concurrently.
+//
+// If a destination fails, the push returns the digest of the pushed image
+// along with an error naming each failed destination. Tag conditions and
+// WithSkipIfUnchanged apply to the primary reference only, and a skipped
+// push does not update the additional tags.
+func WithTags(tags ...string) PushOption {
+	return func(c *pushConfig) {
+		c.tags = append(c.tags, tags...)
+	}
+}
+
+// WithExpectedDigest makes the push fail with ErrTagConflict unless the tag
+// points to manifestDigest (sha256:...) right before it is moved. Use it to
+// advance a shared tag only from the image a job started from.
+//
+// The tag is resolved again just before tagging, after the content is
+// uploaded. Registries cannot update tags atomically, so this narrows the
+// race between concurrent writers to a single request rather than closing it.
+func WithExpectedDigest(manifestDigest string) PushOption {
+	return func(c *pushConfig) {
+		c.tagCondition.ExpectedDigest = manifestDigest
+	}
+}
+
+// WithIfNotExists makes the push fail with ErrTagConflict if the tag already
+// exists right before it would be created, for tags that must never move.
+// As with WithExpectedDigest, the check and the update are separate requests.
+func WithIfNotExists() PushOption {
+	return func(c *pushConfig) {
+		c.tagCondition.MustNotExist = true
+	}
+}
+
+// WithReferrers makes Copy carry the referrers of the copied image, such as
+// signatures, SBOMs, and attestations, to the destination. Referrers of the
+// platform manifests of an image index, and referrers of referrers, are
+// copied as well.
+func WithReferrers() CopyOption {
+	return func(c *copyConfig) {
+		c.referrers = true
+	}
+}
+
+// WithResign makes Copy sign the copied image at the destination with the
+// client's Signer, as Push does. Requires WithSigner.
+func WithResign() CopyOption {
+	return func(c *copyConfig) {
+		c.resign = true
+	}
+}
+
 // WithPushProgress sets a callback to receive progress updates during push.
 // The callback receives cumulative bytes uploaded to the registry.
 func WithPushProgress(callback ProgressCallback) PushOption {
@@ -121,6 +435,52 @@ func WithUserAgent(ua string) ClientOption {
 	}
 }
 
+// WithParallelDownload downloads blobs larger than chunkSize as chunkSize byte
+// ranges fetched over n concurrent range requests. This speeds up downloads on
+// high-latency links, where a single stream cannot use the available bandwidth.
+//
+// With a cache (WithCacheDir), chunks are written directly into the cache file
+// and completed ranges are recorded, so an interrupted download resumes where
+// it stopped. Without a cache, chunks are reassembled in order in memory,
+// buffering at most n chunks. The blob digest is verified in both cases.
+// Registries without range support fall back to a single stream.
+//
+// n must be at least 1 (1 disables parallel downloads) and chunkSize must be positive.
+func WithParallelDownload(n int, chunkSize int64) ClientOption {
+	return func(c *Client) error {
+		if n < 1 {
+			return fmt.Errorf("parallel downloads must be at least 1, got %d", n)
+		}
+		if chunkSize <= 0 {
+			return fmt.Errorf("chunk size must be positive, got %d", chunkSize)
+		}
+		c.parallelDownloads = n
+		c.chunkSize = chunkSize
+		return nil
+	}
+}
+
+// WithPlatform selects the platform used when resolving multi-platform images
+// (OCI indexes). The platform has the form os/arch[/variant], for example
+// "linux/arm64/v8". An omitted variant matches any variant of the architecture,
+// and architecture defaults are honored ("linux/arm64" matches "linux/arm64/v8").
+//
+// The platform applies to OpenImage, Pull, and signature verification.
+// If no manifest in the index matches, those operations return ErrPlatformNotFound.
+// Without this option, the runtime platform is preferred and the first manifest
+// is used if none match. Single-platform manifests are used as-is, unless this
+// option is set and their config declares another platform.
+func WithPlatform(platform string) ClientOption {
+	return func(c *Client) error {
+		p, err := registry.ParsePlatform(platform)
+		if err != nil {
+			return err
+		}
+		c.platform = &p
+		return nil
+	}
+}
+
 // WithDescriptorCache enables in-memory caching for layer descriptor resolution.
 // This can return stale results for mutable tags; prefer digest references.
 func WithDescriptorCache(enabled bool) ClientOption {
@@ -156,6 +516,9 @@ func WithCacheDir(path string) ClientOption {
 // when a partial cache hit occurs. This allows reading from the partial cache
 // immediately while the remaining data is downloaded in the background.
 //
+// With lazy loading, layers pushed with WithPrioritizedFiles have the region
+// before their prefetch landmark fetched first, then the rest of the blob.
+//
 // This option only has effect when caching is enabled (via WithCacheDir).
 // The prefetch runs in a background goroutine and will stop if the context
 // is canceled.
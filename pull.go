@@ -2,11 +2,14 @@ package blobber
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
+	"os"
 
 	"github.com/opencontainers/go-digest"
 
+	"github.com/meigma/blobber/core"
 	"github.com/meigma/blobber/internal/archive"
 	"github.com/meigma/blobber/internal/progress"
 )
@@ -14,13 +17,24 @@ import (
 // Pull downloads all files from the image to the destination directory.
 // The ref must be fully qualified (e.g., "ghcr.io/org/repo:tag").
 //
+// Multi-layer images are extracted layer by layer in manifest order. Files in
+// later layers replace files from earlier layers, and OCI whiteouts remove them.
+//
 // If a cache is configured (via WithCacheDir), the blob will be fetched from cache
 // if available, or downloaded and cached for future use.
 //
 // If a verifier is configured (via WithVerifier), the signature is verified before
 // downloading the blob. Verification failure prevents the pull.
 //
-// The layer digest is verified while downloading for integrity.
+// The layer digests are verified while downloading for integrity.
+//
+// With WithInclude or WithExclude, only the selected files are extracted. For
+// eStargz images they are fetched individually with range requests, so the
+// rest of the layers is never downloaded; whole-layer digests are not checked
+// in that case.
+//
+// With WithAtomic, the image is extracted into a staging directory and
+// replaces destDir only once extraction has succeeded.
 func (c *Client) Pull(ctx context.Context, ref, destDir string, opts ...PullOption) error {
 	// Verify signature if verifier configured
 	if c.verifier != nil {
@@ -36,70 +50,211 @@ func (c *Client) Pull(ctx context.Context, ref, destDir string, opts ...PullOpti
 	for _, opt := range opts {
 		opt(cfg)
 	}
+	filter, err := archive.NewFilter(cfg.include, cfg.exclude)
+	if err != nil {
+		return err
+	}
+	cfg.filter = filter
+
+	if cfg.atomic {
+		return c.pullAtomic(ctx, ref, destDir, cfg)
+	}
+	return c.pull(ctx, ref, destDir, cfg)
+}
+
+// pullAtomic pulls into a staging directory next to destDir and swaps it in
+// once the pull has succeeded. On failure, destDir is left untouched.
+func (c *Client) pullAtomic(ctx context.Context, ref, destDir string, cfg *pullConfig) error {
+	staging, err := archive.StagingDir(destDir)
+	if err != nil {
+		return err
+	}
+	if err := c.pull(ctx, ref, staging, cfg); err != nil {
+		if rmErr := os.RemoveAll(staging); rmErr != nil {
+			c.logger.Warn("failed to remove staging directory", "path", staging, "error", rmErr)
+		}
+		return err
+	}
+
+	old, err := archive.ReplaceDir(staging, destDir)
+	if err != nil {
+		if rmErr := os.RemoveAll(staging); rmErr != nil {
+			c.logger.Warn("failed to remove staging directory", "path", staging, "error", rmErr)
+		}
+		return fmt.Errorf("replace %s: %w", destDir, err)
+	}
+	if old != "" {
+		if err := os.RemoveAll(old); err != nil {
+			c.logger.Warn("failed to remove previous contents", "path", old, "error", err)
+		}
+	}
+	return nil
+}
+
+// pull extracts the image into destDir using the configured source.
+func (c *Client) pull(ctx context.Context, ref, destDir string, cfg *pullConfig) error {
+	// Selective pulls read only the matching files when range reads are available.
+	// An eager cache downloads whole blobs anyway, so it filters the streams instead.
+	if cfg.filter != nil && (c.cache == nil || c.lazyLoading) {
+		err := c.pullSelective(ctx, ref, destDir, cfg)
+		if !errors.Is(err, errSelectiveUnavailable) {
+			return err
+		}
+		c.logger.Debug("range reads unavailable, filtering layer streams", "ref", ref, "error", err)
+	}
 
 	// Use cache if available
 	if c.cache != nil {
 		return c.pullCached(ctx, ref, destDir, cfg)
 	}
 
-	// Resolve descriptor so we can verify the downloaded blob digest.
-	desc, err := c.registry.ResolveLayer(ctx, ref)
+	// Resolve descriptors so we can verify the downloaded blob digests.
+	layers, err := c.registry.ResolveLayers(ctx, ref)
 	if err != nil {
 		return fmt.Errorf("resolve %s: %w", ref, err)
 	}
 
-	// Pull blob from registry directly
-	blob, err := c.registry.FetchBlob(ctx, ref, desc)
+	// Pull blobs from registry directly
+	return c.extractLayers(ctx, ref, destDir, layers, cfg, func(desc LayerDescriptor) (io.ReadCloser, error) {
+		blob, err := c.registry.FetchBlob(ctx, ref, desc)
+		if err != nil {
+			return nil, fmt.Errorf("pull %s: %w", ref, err)
+		}
+		return blob, nil
+	})
+}
+
+// pullCached pulls an image using the cache.
+func (c *Client) pullCached(ctx context.Context, ref, destDir string, cfg *pullConfig) error {
+	layers, err := c.resolveLayersCached(ctx, ref)
 	if err != nil {
-		return fmt.Errorf("pull %s: %w", ref, err)
+		return err
 	}
 
-	// Wrap blob for progress tracking if callback provided
-	blobReader := wrapReaderForProgress(blob, desc.Size, cfg.progress)
+	// Get blob streams from cache with streaming pass-through.
+	// OpenStreamThrough streams from registry while concurrently caching,
+	// preserving streaming extraction performance on cache miss.
+	return c.extractLayers(ctx, ref, destDir, layers, cfg, func(desc LayerDescriptor) (io.ReadCloser, error) {
+		blob, err := c.cache.OpenStreamThrough(ctx, ref, desc)
+		if err != nil {
+			return nil, fmt.Errorf("open cached blob %s: %w", ref, err)
+		}
+		return blob, nil
+	})
+}
+
+// extractLayers extracts each layer in order, reporting cumulative progress
+// across all layers.
+func (c *Client) extractLayers(ctx context.Context, ref, destDir string, layers []LayerDescriptor, cfg *pullConfig, open func(LayerDescriptor) (io.ReadCloser, error)) error {
+	var total int64
+	for _, desc := range layers {
+		total += desc.Size
+	}
 
-	return c.extractWithDigest(ctx, ref, destDir, blobReader, desc, cfg.limits)
+	extractor := archive.NewLayerExtractor(destDir, c.validator, cfg.limits, cfg.extractorOptions(archive.WithFilter(cfg.filter), archive.WithLogger(c.logger))...)
+	var offset int64
+	for _, desc := range layers {
+		blob, err := open(desc)
+		if err != nil {
+			return err
+		}
+
+		// Wrap blob for progress tracking if callback provided
+		blobReader := wrapReaderForProgress(blob, offset, total, cfg.progress)
+
+		if err := c.extractWithDigest(ctx, ref, extractor, blobReader, desc); err != nil {
+			return err
+		}
+		offset += desc.Size
+	}
+	return nil
 }
 
-// pullCached pulls an image using the cache.
-func (c *Client) pullCached(ctx context.Context, ref, destDir string, cfg *pullConfig) error {
-	var desc LayerDescriptor
-	var err error
+// errSelectiveUnavailable indicates that the files of an image cannot be read
+// individually, so a selective pull falls back to filtering the layer streams.
+var errSelectiveUnavailable = errors.New("selective pull unavailable")
 
-	// Try TTL-based resolution first
-	if c.cacheTTL > 0 {
-		if cachedDesc, ok := c.cache.LookupByRef(ref, c.cacheTTL); ok {
-			if c.hasCachedBlob(cachedDesc) {
-				c.logger.Debug("using TTL-cached descriptor for pull", "ref", ref, "digest", cachedDesc.Digest)
-				desc = cachedDesc
-			}
+// pullSelective extracts the files selected by cfg.filter from the merged view
+// of the image. Only the TOCs and the selected files are fetched.
+func (c *Client) pullSelective(ctx context.Context, ref, destDir string, cfg *pullConfig) error {
+	var img *Image
+	var err error
+	if c.cache != nil {
+		img, err = c.openImageCached(ctx, ref)
+	} else {
+		img, err = c.openRangeImage(ctx, ref)
+	}
+	if err != nil {
+		if errors.Is(err, core.ErrRangeNotSupported) || errors.Is(err, ErrInvalidArchive) {
+			return fmt.Errorf("%w: %w", errSelectiveUnavailable, err)
 		}
+		return err
 	}
+	defer img.Close()
 
-	// If no valid TTL cache hit, resolve from registry
-	if desc.Digest == "" {
-		desc, err = c.registry.ResolveLayer(ctx, ref)
+	return c.extractSelected(ctx, ref, img, destDir, cfg, &exportConfig{format: ExportTar, filter: cfg.filter})
+}
+
+// extractSelected extracts the entries of img selected by exportCfg into destDir.
+func (c *Client) extractSelected(ctx context.Context, ref string, img *Image, destDir string, cfg *pullConfig, exportCfg *exportConfig) error {
+	if cfg.progress != nil {
+		total, err := selectedSize(img, exportCfg)
 		if err != nil {
-			return fmt.Errorf("resolve %s: %w", ref, err)
+			return err
+		}
+		exportCfg.progress = func(written int64) {
+			cfg.progress(ProgressEvent{
+				Operation:        "pull",
+				BytesTransferred: written,
+				TotalBytes:       total,
+			})
 		}
-		// Update the reference index
-		c.cache.UpdateRefIndex(ref, desc)
 	}
 
-	// Get blob stream from cache with streaming pass-through.
-	// OpenStreamThrough streams from registry while concurrently caching,
-	// preserving streaming extraction performance on cache miss.
-	blob, err := c.cache.OpenStreamThrough(ctx, ref, desc)
-	if err != nil {
-		return fmt.Errorf("open cached blob %s: %w", ref, err)
+	// Stream the selected entries through the extractor so they get the same
+	// validation and limits as a full pull.
+	pr, pw := io.Pipe()
+	writeErr := make(chan error, 1)
+	go func() {
+		err := img.writeTar(pw, exportCfg)
+		pw.CloseWithError(err)
+		writeErr <- err
+	}()
+
+	extractor := archive.NewLayerExtractor(destDir, c.validator, cfg.limits, cfg.extractorOptions()...)
+	extractErr := extractor.ExtractTar(ctx, pr)
+	if extractErr == nil {
+		// Let the writer finish the tar trailer.
+		_, extractErr = io.Copy(io.Discard, pr)
 	}
+	pr.CloseWithError(extractErr)
 
-	// Wrap blob for progress tracking if callback provided
-	blobReader := wrapReaderForProgress(blob, desc.Size, cfg.progress)
+	// Prefer the read error over the broken stream it caused.
+	if err := <-writeErr; err != nil && !errors.Is(err, io.ErrClosedPipe) {
+		return fmt.Errorf("read %s: %w", ref, err)
+	}
+	if extractErr != nil {
+		return fmt.Errorf("extract %s: %w", ref, extractErr)
+	}
+	return nil
+}
 
-	return c.extractWithDigest(ctx, ref, destDir, blobReader, desc, cfg.limits)
+// selectedSize returns the total size of the regular files selected by cfg.
+func selectedSize(img *Image, cfg *exportConfig) (int64, error) {
+	entries, err := img.List()
+	if err != nil {
+		return 0, err
+	}
+	var total int64
+	for _, e := range entries {
+		if e.Mode().IsRegular() && cfg.selects(e.Path()) {
+			total += e.Size()
+		}
+	}
+	return total, nil
 }
 
-func (c *Client) extractWithDigest(ctx context.Context, ref, destDir string, blob io.ReadCloser, desc LayerDescriptor, limits ExtractLimits) error {
+func (c *Client) extractWithDigest(ctx context.Context, ref string, extractor *archive.LayerExtractor, blob io.ReadCloser, desc LayerDescriptor) error {
 	defer blob.Close()
 
 	if desc.Digest == "" {
@@ -108,7 +263,7 @@ func (c *Client) extractWithDigest(ctx context.Context, ref, destDir string, blo
 
 	digester := digest.SHA256.Digester()
 	reader := io.TeeReader(blob, digester.Hash())
-	if err := archive.Extract(ctx, reader, destDir, c.validator, limits); err != nil {
+	if err := extractor.Extract(ctx, reader); err != nil {
 		return fmt.Errorf("extract %s: %w", ref, err)
 	}
 
@@ -121,8 +276,10 @@ func (c *Client) extractWithDigest(ctx context.Context, ref, destDir string, blo
 }
 
 // wrapReaderForProgress wraps an io.ReadCloser with progress tracking.
+// Reported bytes start at offset, so progress stays cumulative when several
+// blobs contribute to the same total.
 // If callback is nil, returns the original reader unchanged.
-func wrapReaderForProgress(r io.ReadCloser, total int64, callback ProgressCallback) io.ReadCloser {
+func wrapReaderForProgress(r io.ReadCloser, offset, total int64, callback ProgressCallback) io.ReadCloser {
 	if callback == nil {
 		return r
 	}
@@ -130,7 +287,7 @@ func wrapReaderForProgress(r io.ReadCloser, total int64, callback ProgressCallba
 		Reader: progress.NewReader(r, total, func(transferred, totalBytes int64) {
 			callback(ProgressEvent{
 				Operation:        "pull",
-				BytesTransferred: transferred,
+				BytesTransferred: offset + transferred,
 				TotalBytes:       totalBytes,
 			})
 		}),
@@ -147,3 +304,11 @@ type progressReadCloser struct {
 func (p *progressReadCloser) Close() error {
 	return p.closer.Close()
 }
+
+// extractorOptions returns the extractor options for the pull, followed by extra.
+func (cfg *pullConfig) extractorOptions(extra ...archive.ExtractorOption) []archive.ExtractorOption {
+	return append([]archive.ExtractorOption{
+		archive.WithExtractTypes(cfg.types),
+		archive.WithPreserve(cfg.preserve),
+	}, extra...)
+}
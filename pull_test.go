@@ -0,0 +1,332 @@
+package blobber
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync"
+	"testing"
+	"testing/fstest"
+
+	"github.com/opencontainers/go-digest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/meigma/blobber/core"
+	"github.com/meigma/blobber/internal/archive"
+	"github.com/meigma/blobber/internal/safepath"
+)
+
+// mockPullRegistry serves a single-layer image and records how it was read.
+type mockPullRegistry struct {
+	mockVerifyRegistry
+
+	blob          []byte
+	rangeDisabled bool
+
+	mu          sync.Mutex
+	rangeBytes  int64
+	ranges      [][2]int64 // offset and length of each range request
+	fullFetches int
+}
+
+func newMockPullRegistry(t *testing.T, fsys fstest.MapFS) *mockPullRegistry {
+	t.Helper()
+
+	data, size := buildTestBlob(t, fsys)
+	return &mockPullRegistry{
+		mockVerifyRegistry: mockVerifyRegistry{
+			layerDesc: core.LayerDescriptor{
+				Digest:         digest.FromBytes(data).String(),
+				Size:           size,
+				ManifestDigest: digest.FromString("manifest").String(),
+			},
+		},
+		blob: data,
+	}
+}
+
+func (m *mockPullRegistry) FetchBlob(_ context.Context, _ string, _ core.LayerDescriptor) (io.ReadCloser, error) {
+	m.mu.Lock()
+	m.fullFetches++
+	m.mu.Unlock()
+	return io.NopCloser(bytes.NewReader(m.blob)), nil
+}
+
+func (m *mockPullRegistry) FetchBlobRange(_ context.Context, _ string, _ core.LayerDescriptor, offset, length int64) (io.ReadCloser, error) {
+	if m.rangeDisabled {
+		return nil, core.ErrRangeNotSupported
+	}
+	m.mu.Lock()
+	m.rangeBytes += length
+	m.ranges = append(m.ranges, [2]int64{offset, length})
+	m.mu.Unlock()
+	return io.NopCloser(bytes.NewReader(m.blob[offset : offset+length])), nil
+}
+
+func TestPull_IncludeExclude(t *testing.T) {
+	t.Parallel()
+
+	// Random data does not compress, so skipping it is visible in the bytes read.
+	large := make([]byte, 512*1024)
+	_, err := rand.Read(large)
+	require.NoError(t, err)
+
+	fsys := fstest.MapFS{
+		"config/app.yaml":      &fstest.MapFile{Data: []byte("app: true"), Mode: 0o644},
+		"config/db.yaml":       &fstest.MapFile{Data: []byte("db: true"), Mode: 0o644},
+		"config/secret.key":    &fstest.MapFile{Data: []byte("secret"), Mode: 0o600},
+		"assets/large.bin":     &fstest.MapFile{Data: large, Mode: 0o644},
+		"assets/nested/a.yaml": &fstest.MapFile{Data: []byte("nested"), Mode: 0o644},
+	}
+
+	tests := []struct {
+		name          string
+		rangeDisabled bool
+	}{
+		{"range reads", false},
+		{"stream fallback", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			reg := newMockPullRegistry(t, fsys)
+			reg.rangeDisabled = tt.rangeDisabled
+			c := &Client{registry: reg, validator: safepath.NewValidator(), logger: slog.New(slog.DiscardHandler)}
+
+			destDir := t.TempDir()
+			err := c.Pull(context.Background(), "test/repo:v1", destDir,
+				WithInclude("config", "*.yaml"),
+				WithExclude("*.key"),
+			)
+			require.NoError(t, err)
+
+			var got []string
+			require.NoError(t, filepath.WalkDir(destDir, func(p string, d os.DirEntry, err error) error {
+				if err != nil || d.IsDir() {
+					return err
+				}
+				rel, err := filepath.Rel(destDir, p)
+				got = append(got, filepath.ToSlash(rel))
+				return err
+			}))
+			assert.ElementsMatch(t, []string{"config/app.yaml", "config/db.yaml", "assets/nested/a.yaml"}, got)
+
+			//nolint:gosec // G304: Test file path is constructed from t.TempDir()
+			content, err := os.ReadFile(filepath.Join(destDir, "config", "app.yaml"))
+			require.NoError(t, err)
+			assert.Equal(t, "app: true", string(content))
+
+			if tt.rangeDisabled {
+				assert.Equal(t, 1, reg.fullFetches, "fallback streams the whole layer")
+			} else {
+				assert.Zero(t, reg.fullFetches, "selective pull must not download the layer")
+				assert.Less(t, reg.rangeBytes, int64(len(large)), "excluded files must not be fetched")
+			}
+		})
+	}
+}
+
+func TestPull_HardlinkToExcludedFile(t *testing.T) {
+	t.Parallel()
+
+	if runtime.GOOS == "windows" {
+		t.Skip("hard links are not detected on Windows")
+	}
+
+	src := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(src, "original.txt"), []byte("shared"), 0o644))
+	require.NoError(t, os.Link(filepath.Join(src, "original.txt"), filepath.Join(src, "selected.txt")))
+
+	result, err := archive.NewBuilder(nil).Build(context.Background(), os.DirFS(src), GzipCompression(), nil)
+	require.NoError(t, err)
+	defer result.Blob.Close()
+	data, err := io.ReadAll(result.Blob)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name          string
+		rangeDisabled bool
+		want          []string
+	}{
+		// Range reads export the link with the content of its target.
+		{"range reads", false, []string{"selected.txt"}},
+		// The stream has skipped the target's content by the time the link is read.
+		{"stream fallback", true, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			reg := &mockPullRegistry{
+				mockVerifyRegistry: mockVerifyRegistry{
+					layerDesc: core.LayerDescriptor{
+						Digest:         digest.FromBytes(data).String(),
+						Size:           int64(len(data)),
+						ManifestDigest: digest.FromString("manifest").String(),
+					},
+				},
+				blob:          data,
+				rangeDisabled: tt.rangeDisabled,
+			}
+			c := &Client{registry: reg, validator: safepath.NewValidator(), logger: slog.New(slog.DiscardHandler)}
+
+			destDir := t.TempDir()
+			err := c.Pull(context.Background(), "test/repo:v1", destDir, WithInclude("selected.txt"))
+			require.NoError(t, err)
+
+			entries, err := os.ReadDir(destDir)
+			require.NoError(t, err)
+			var got []string
+			for _, e := range entries {
+				got = append(got, e.Name())
+			}
+			assert.Equal(t, tt.want, got)
+
+			if len(tt.want) > 0 {
+				//nolint:gosec // G304: Test file path is constructed from t.TempDir()
+				content, err := os.ReadFile(filepath.Join(destDir, "selected.txt"))
+				require.NoError(t, err)
+				assert.Equal(t, "shared", string(content))
+			}
+		})
+	}
+}
+
+func TestPull_SelectiveReadsChunksOnce(t *testing.T) {
+	t.Parallel()
+
+	large := make([]byte, 512*1024)
+	_, err := rand.Read(large)
+	require.NoError(t, err)
+
+	reg := newMockPullRegistry(t, fstest.MapFS{
+		"large.bin": &fstest.MapFile{Data: large, Mode: 0o644},
+		"small.txt": &fstest.MapFile{Data: []byte("small"), Mode: 0o644},
+	})
+	c := &Client{registry: reg, validator: safepath.NewValidator(), logger: slog.New(slog.DiscardHandler)}
+
+	destDir := t.TempDir()
+	require.NoError(t, c.Pull(context.Background(), "test/repo:v1", destDir, WithInclude("*.bin")))
+
+	//nolint:gosec // G304: Test file path is constructed from t.TempDir()
+	content, err := os.ReadFile(filepath.Join(destDir, "large.bin"))
+	require.NoError(t, err)
+	assert.Equal(t, large, content)
+	assert.Less(t, reg.rangeBytes, 2*int64(len(reg.blob)), "each chunk must be fetched once")
+}
+
+func TestPull_InvalidPattern(t *testing.T) {
+	t.Parallel()
+
+	reg := newMockPullRegistry(t, fstest.MapFS{
+		"a.txt": &fstest.MapFile{Data: []byte("a"), Mode: 0o644},
+	})
+	c := &Client{registry: reg, validator: safepath.NewValidator(), logger: slog.New(slog.DiscardHandler)}
+
+	err := c.Pull(context.Background(), "test/repo:v1", t.TempDir(), WithInclude("[invalid"))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "invalid pattern")
+	assert.Zero(t, reg.fullFetches)
+}
+
+func TestPull_Atomic(t *testing.T) {
+	t.Parallel()
+
+	fsys := fstest.MapFS{
+		"app.yaml": &fstest.MapFile{Data: []byte("version: 2"), Mode: 0o644},
+	}
+
+	// listDir returns the names in dir.
+	listDir := func(t *testing.T, dir string) []string {
+		t.Helper()
+		entries, err := os.ReadDir(dir)
+		require.NoError(t, err)
+		var names []string
+		for _, e := range entries {
+			names = append(names, e.Name())
+		}
+		return names
+	}
+
+	t.Run("replaces the destination", func(t *testing.T) {
+		t.Parallel()
+
+		reg := newMockPullRegistry(t, fsys)
+		c := &Client{registry: reg, validator: safepath.NewValidator(), logger: slog.New(slog.DiscardHandler)}
+
+		parent := t.TempDir()
+		destDir := filepath.Join(parent, "app")
+		require.NoError(t, os.Mkdir(destDir, 0o755))
+		require.NoError(t, os.WriteFile(filepath.Join(destDir, "app.yaml"), []byte("version: 1"), 0o644))
+		require.NoError(t, os.WriteFile(filepath.Join(destDir, "stale.txt"), []byte("stale"), 0o644))
+
+		require.NoError(t, c.Pull(context.Background(), "test/repo:v2", destDir, WithAtomic()))
+
+		assert.Equal(t, []string{"app.yaml"}, listDir(t, destDir))
+		//nolint:gosec // G304: Test file path is constructed from t.TempDir()
+		content, err := os.ReadFile(filepath.Join(destDir, "app.yaml"))
+		require.NoError(t, err)
+		assert.Equal(t, "version: 2", string(content))
+		assert.Equal(t, []string{"app"}, listDir(t, parent), "staging directories must be removed")
+	})
+
+	t.Run("leaves the destination untouched on failure", func(t *testing.T) {
+		t.Parallel()
+
+		reg := newMockPullRegistry(t, fsys)
+		reg.blob = append([]byte(nil), reg.blob...)
+		reg.blob[len(reg.blob)/2] ^= 0xff
+		c := &Client{registry: reg, validator: safepath.NewValidator(), logger: slog.New(slog.DiscardHandler)}
+
+		parent := t.TempDir()
+		destDir := filepath.Join(parent, "app")
+		require.NoError(t, os.Mkdir(destDir, 0o755))
+		require.NoError(t, os.WriteFile(filepath.Join(destDir, "app.yaml"), []byte("version: 1"), 0o644))
+
+		require.Error(t, c.Pull(context.Background(), "test/repo:v2", destDir, WithAtomic()))
+
+		//nolint:gosec // G304: Test file path is constructed from t.TempDir()
+		content, err := os.ReadFile(filepath.Join(destDir, "app.yaml"))
+		require.NoError(t, err)
+		assert.Equal(t, "version: 1", string(content))
+		assert.Equal(t, []string{"app"}, listDir(t, parent), "staging directories must be removed")
+	})
+
+	t.Run("flips a symbolic link", func(t *testing.T) {
+		t.Parallel()
+
+		reg := newMockPullRegistry(t, fsys)
+		c := &Client{registry: reg, validator: safepath.NewValidator(), logger: slog.New(slog.DiscardHandler)}
+
+		parent := t.TempDir()
+		require.NoError(t, os.Mkdir(filepath.Join(parent, "v1"), 0o755))
+		destDir := filepath.Join(parent, "current")
+		if err := os.Symlink("v1", destDir); err != nil {
+			t.Skipf("symlinks not supported: %v", err)
+		}
+
+		require.NoError(t, c.Pull(context.Background(), "test/repo:v2", destDir, WithAtomic()))
+		first, err := os.Readlink(destDir)
+		require.NoError(t, err)
+		assert.NotEqual(t, "v1", first)
+		assert.DirExists(t, filepath.Join(parent, "v1"), "targets not created by a pull are kept")
+		assert.FileExists(t, filepath.Join(destDir, "app.yaml"))
+
+		// The next pull removes the target created by the previous one.
+		require.NoError(t, c.Pull(context.Background(), "test/repo:v2", destDir, WithAtomic()))
+		second, err := os.Readlink(destDir)
+		require.NoError(t, err)
+		assert.NotEqual(t, first, second)
+		assert.NoDirExists(t, filepath.Join(parent, first))
+		assert.ElementsMatch(t, []string{"current", "v1", second}, listDir(t, parent))
+	})
+}
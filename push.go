@@ -2,43 +2,370 @@ package blobber
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"io/fs"
+	"maps"
+	"slices"
+	"sync"
 	"time"
 
+	"github.com/containerd/stargz-snapshotter/estargz"
 	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
 
 	"github.com/meigma/blobber/core"
+	"github.com/meigma/blobber/internal/archive"
 	"github.com/meigma/blobber/internal/progress"
+	"github.com/meigma/blobber/internal/registry"
 )
 
 // Push uploads files from src to the given image reference.
 // The ref must be fully qualified (e.g., "ghcr.io/org/repo:tag").
 // Returns the digest of the pushed image.
+//
+// With WithSkipIfUnchanged, nothing is written if the tag already holds the
+// same content, and the digest of the existing image is returned. With
+// WithTags, the image is also copied to the other destinations.
+//
+// Extended attributes are only recorded when src exposes them, as DirFS does.
 func (c *Client) Push(ctx context.Context, ref string, src fs.FS, opts ...PushOption) (string, error) {
-	// Apply options
-	cfg := &pushConfig{
-		compression: GzipCompression(), // default
+	cfg := newPushConfig(opts)
+	tags, err := tagReferences(ref, cfg.tags)
+	if err != nil {
+		return "", err
 	}
-	for _, opt := range opts {
-		opt(cfg)
+
+	// Without a reproducible build, compare the tree with the tag's TOC
+	// before building.
+	if cfg.skipIfUnchanged {
+		if cfg.baseRef != "" {
+			return "", errors.New("push: skipping unchanged pushes is not supported with base images")
+		}
+		if cfg.sourceDateEpoch == nil {
+			existing, err := c.unchangedTree(ctx, ref, src, cfg)
+			if err != nil || existing != "" {
+				return existing, err
+			}
+		}
 	}
 
 	// Build eStargz blob
-	result, err := c.builder.Build(ctx, src, cfg.compression)
+	result, baseRef, err := c.buildLayer(ctx, src, cfg)
+	if err != nil {
+		return "", err
+	}
+	defer result.Blob.Close()
+
+	if cfg.skipIfUnchanged && cfg.sourceDateEpoch != nil {
+		existing, err := c.unchangedBlob(ctx, ref, result, cfg)
+		if err != nil || existing != "" {
+			return existing, err
+		}
+	}
+
+	return c.publish(ctx, ref, result, cfg, pushTarget{base: baseRef, total: result.BlobSize, tags: tags})
+}
+
+// DirFS returns a filesystem for the files in the directory dir.
+// Unlike os.DirFS, it exposes the extended attributes of its files, so that
+// Push records them.
+func DirFS(dir string) fs.FS {
+	return archive.OSFS(dir)
+}
+
+// PushTar uploads the contents of a tar stream to the given image reference.
+// The stream may be gzip-compressed; compression is detected automatically.
+// The ref must be fully qualified (e.g., "ghcr.io/org/repo:tag").
+// Returns the digest of the pushed image.
+//
+// Entries are validated as they would be on extraction: absolute paths, ".."
+// traversal, and symlinks pointing outside the archive fail with
+// ErrPathTraversal, and entry types other than regular files, directories,
+// and symlinks fail with ErrInvalidArchive. WithBaseImage and
+// WithPrioritizedFiles are not supported.
+//
+// With WithSkipIfUnchanged, the built blob is compared with the tag's layer,
+// which matches when the tar stream is identical.
+func (c *Client) PushTar(ctx context.Context, ref string, r io.Reader, opts ...PushOption) (string, error) {
+	cfg := newPushConfig(opts)
+	if cfg.baseRef != "" {
+		return "", errors.New("push tar: base images are not supported")
+	}
+	if len(cfg.prioritized) > 0 {
+		return "", errors.New("push tar: prioritized files are not supported")
+	}
+	tags, err := tagReferences(ref, cfg.tags)
+	if err != nil {
+		return "", err
+	}
+
+	result, err := c.builder.BuildTar(ctx, r, c.validator, cfg.compression, cfg.buildOptions())
 	if err != nil {
 		return "", fmt.Errorf("build archive: %w", err)
 	}
 	defer result.Blob.Close()
 
+	if cfg.skipIfUnchanged {
+		existing, err := c.unchangedBlob(ctx, ref, result, cfg)
+		if err != nil || existing != "" {
+			return existing, err
+		}
+	}
+
+	return c.publish(ctx, ref, result, cfg, pushTarget{total: result.BlobSize, tags: tags})
+}
+
+// publish uploads a built layer, signs the manifest if a signer is configured,
+// and copies the image to the other tags of target. Returns the manifest digest.
+func (c *Client) publish(ctx context.Context, ref string, result *BuildResult, cfg *pushConfig, target pushTarget) (string, error) {
+	manifestDigest, err := c.pushBuilt(ctx, ref, result, cfg, target)
+	if err != nil {
+		return "", err
+	}
+
+	// Sign and store as referrer if signer configured
+	var signatures []string
+	if c.signer != nil {
+		sigDigest, err := c.signAndStoreReferrer(ctx, ref, manifestDigest, cfg.createdAt())
+		if err != nil {
+			return "", fmt.Errorf("sign %s: %w", ref, err)
+		}
+		signatures = append(signatures, sigDigest)
+	}
+
+	return c.pushTags(ctx, ref, manifestDigest, target.tags, signatures)
+}
+
+// PushIndex uploads one image per platform and tags an OCI image index
+// referencing them, so that clients resolve the image for their own platform.
+// Platforms are keyed in os/arch[/variant] form (e.g., "linux/arm64/v8").
+// The ref must be fully qualified (e.g., "ghcr.io/org/repo:tag").
+// Returns the digest of the image index.
+//
+// Each platform is built as its own eStargz layer and pushed as an untagged
+// manifest whose config records the platform. Progress is reported across
+// all platforms combined.
+//
+// If a signer is configured (via WithSigner), every platform manifest and the
+// index itself are signed.
+func (c *Client) PushIndex(ctx context.Context, ref string, platforms map[string]fs.FS, opts ...PushOption) (string, error) {
+	if len(platforms) == 0 {
+		return "", errors.New("push index: at least one platform is required")
+	}
+	cfg := newPushConfig(opts)
+	if cfg.baseRef != "" {
+		return "", errors.New("push index: base images are not supported")
+	}
+	if cfg.skipIfUnchanged {
+		return "", errors.New("push index: skipping unchanged pushes is not supported")
+	}
+	tags, err := tagReferences(ref, cfg.tags)
+	if err != nil {
+		return "", err
+	}
+
+	// Normalize platforms and order them for a deterministic index.
+	sources := make(map[string]fs.FS, len(platforms))
+	for key, src := range platforms {
+		p, err := registry.ParsePlatform(key)
+		if err != nil {
+			return "", err
+		}
+		name := registry.FormatPlatform(p)
+		if _, dup := sources[name]; dup {
+			return "", fmt.Errorf("duplicate platform %s", name)
+		}
+		sources[name] = src
+	}
+	names := slices.Sorted(maps.Keys(sources))
+
+	// Build every layer before uploading so progress has a single total.
+	results := make([]*BuildResult, 0, len(names))
+	defer func() {
+		for _, result := range results {
+			result.Blob.Close()
+		}
+	}()
+	var total int64
+	for _, name := range names {
+		result, err := c.builder.Build(ctx, sources[name], cfg.compression, cfg.buildOptions())
+		if err != nil {
+			return "", fmt.Errorf("build archive for %s: %w", name, err)
+		}
+		results = append(results, result)
+		total += result.BlobSize
+	}
+
+	manifests := make([]IndexManifest, 0, len(names))
+	var offset int64
+	for i, name := range names {
+		manifestDigest, err := c.pushBuilt(ctx, ref, results[i], cfg, pushTarget{
+			platform: name,
+			skipTag:  true,
+			offset:   offset,
+			total:    total,
+		})
+		if err != nil {
+			return "", fmt.Errorf("%s: %w", name, err)
+		}
+		manifests = append(manifests, IndexManifest{Digest: manifestDigest, Platform: name})
+		offset += results[i].BlobSize
+	}
+
+	indexDigest, err := c.registry.PushIndex(ctx, ref, manifests, cfg.tagCondition)
+	if err != nil {
+		return "", fmt.Errorf("push index %s: %w", ref, err)
+	}
+
+	// Sign every platform manifest and the index if signer configured
+	var signatures []string
+	if c.signer != nil {
+		for _, m := range manifests {
+			sigDigest, err := c.signAndStoreReferrer(ctx, ref, m.Digest, cfg.createdAt())
+			if err != nil {
+				return "", fmt.Errorf("sign %s (%s): %w", ref, m.Platform, err)
+			}
+			signatures = append(signatures, sigDigest)
+		}
+		sigDigest, err := c.signAndStoreReferrer(ctx, ref, indexDigest, cfg.createdAt())
+		if err != nil {
+			return "", fmt.Errorf("sign %s: %w", ref, err)
+		}
+		signatures = append(signatures, sigDigest)
+	}
+
+	return c.pushTags(ctx, ref, indexDigest, tags, signatures)
+}
+
+// buildLayer builds the layer to push for src. With a base image configured,
+// the layer holds only the differences from the base, and the base reference
+// pinned by digest is returned.
+func (c *Client) buildLayer(ctx context.Context, src fs.FS, cfg *pushConfig) (result *BuildResult, baseRef string, err error) {
+	if cfg.baseRef == "" {
+		result, err = c.builder.Build(ctx, src, cfg.compression, cfg.buildOptions())
+		if err != nil {
+			return nil, "", fmt.Errorf("build archive: %w", err)
+		}
+		return result, "", nil
+	}
+
+	base, err := c.openRemoteImage(ctx, cfg.baseRef)
+	if err != nil {
+		return nil, "", fmt.Errorf("open base image %s: %w", cfg.baseRef, err)
+	}
+	defer base.Close()
+
+	result, err = c.builder.BuildDiff(ctx, src, base.tocEntries(), cfg.compression, cfg.buildOptions())
+	if err != nil {
+		return nil, "", fmt.Errorf("build archive: %w", err)
+	}
+	return result, base.ref, nil
+}
+
+// unchangedTree returns the digest of the image tagged ref if src holds the
+// same files, or "" if the tag does not exist or differs. Files are compared
+// with the tag's TOC by type, mode, link target, and content digest, so only
+// the TOC is read.
+func (c *Client) unchangedTree(ctx context.Context, ref string, src fs.FS, cfg *pushConfig) (string, error) {
+	manifestDigest, _, err := c.taggedLayer(ctx, ref, cfg)
+	if err != nil || manifestDigest == "" {
+		return "", err
+	}
+
+	img, err := c.openSelectiveImage(ctx, digestReference(ref, manifestDigest))
+	if errors.Is(err, ErrInvalidArchive) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	defer img.Close()
+
+	same, err := archive.Unchanged(ctx, src, img.tocEntries(), cfg.buildOptions())
+	if err != nil {
+		return "", fmt.Errorf("compare with %s: %w", ref, err)
+	}
+	if !same {
+		return "", nil
+	}
+	c.logger.Debug("files unchanged, skipping push", "ref", ref, "digest", manifestDigest)
+	return manifestDigest, nil
+}
+
+// unchangedBlob returns the digest of the image tagged ref if its layer is
+// the built blob, or "" if the tag does not exist or differs.
+func (c *Client) unchangedBlob(ctx context.Context, ref string, result *BuildResult, cfg *pushConfig) (string, error) {
+	manifestDigest, layer, err := c.taggedLayer(ctx, ref, cfg)
+	if err != nil || manifestDigest == "" {
+		return "", err
+	}
+	if layer.Digest.String() != result.BlobDigest {
+		return "", nil
+	}
+	c.logger.Debug("blob unchanged, skipping push", "ref", ref, "digest", manifestDigest)
+	return manifestDigest, nil
+}
+
+// taggedLayer returns the digest of the manifest tagged ref and its layer.
+// The digest is empty if the tag does not exist, or does not hold a
+// single-layer image manifest with the layer media type and annotations of cfg.
+// Fails with ErrTagConflict if the tag does not satisfy the tag condition of cfg.
+func (c *Client) taggedLayer(ctx context.Context, ref string, cfg *pushConfig) (string, ocispec.Descriptor, error) {
+	data, manifestDigest, err := c.registry.FetchManifest(ctx, ref)
+	if errors.Is(err, ErrNotFound) {
+		return "", ocispec.Descriptor{}, registry.CheckTag(ref, "", cfg.tagCondition)
+	}
+	if err != nil {
+		return "", ocispec.Descriptor{}, fmt.Errorf("fetch manifest %s: %w", ref, err)
+	}
+	// The push would not move the tag, but must still fail if it could not.
+	if err := registry.CheckTag(ref, manifestDigest, cfg.tagCondition); err != nil {
+		return "", ocispec.Descriptor{}, err
+	}
+
+	var manifest ocispec.Manifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return "", ocispec.Descriptor{}, fmt.Errorf("parse manifest %s: %w", ref, err)
+	}
+	if manifest.MediaType != ocispec.MediaTypeImageManifest || len(manifest.Layers) != 1 {
+		return "", ocispec.Descriptor{}, nil
+	}
+
+	layer := manifest.Layers[0]
+	mediaType := cfg.mediaType
+	if mediaType == "" {
+		mediaType = ocispec.MediaTypeImageLayerGzip
+	}
+	annotations := maps.Clone(layer.Annotations)
+	delete(annotations, estargz.TOCJSONDigestAnnotation)
+	if layer.MediaType != mediaType || !maps.Equal(annotations, cfg.annotations) {
+		return "", ocispec.Descriptor{}, nil
+	}
+	return manifestDigest, layer, nil
+}
+
+// pushTarget describes where a built layer is pushed and how its progress is reported.
+type pushTarget struct {
+	base     string   // image whose layers are placed below the built layer
+	platform string   // os/arch[/variant] recorded in the config; empty for the runtime platform
+	skipTag  bool     // push the manifest by digest only
+	tags     []string // other references the image is copied to
+	offset   int64    // bytes already reported by earlier uploads
+	total    int64    // total bytes reported across all uploads
+}
+
+// pushBuilt uploads a built layer and its manifest. Returns the manifest digest.
+func (c *Client) pushBuilt(ctx context.Context, ref string, result *BuildResult, cfg *pushConfig, target pushTarget) (string, error) {
 	// Wrap blob reader for progress tracking if callback provided
 	var blobReader io.Reader = result.Blob
 	if cfg.progress != nil {
-		blobReader = progress.NewReader(result.Blob, result.BlobSize, func(transferred, total int64) {
+		blobReader = progress.NewReader(result.Blob, target.total, func(transferred, total int64) {
 			cfg.progress(ProgressEvent{
 				Operation:        "push",
-				BytesTransferred: transferred,
+				BytesTransferred: target.offset + transferred,
 				TotalBytes:       total,
 			})
 		})
@@ -52,53 +379,124 @@ func (c *Client) Push(ctx context.Context, ref string, src fs.FS, opts ...PushOp
 		DiffID:      result.DiffID,
 		BlobDigest:  result.BlobDigest,
 		BlobSize:    result.BlobSize,
+		Platform:    target.platform,
+		SkipTag:     target.skipTag,
+		BaseRef:     target.base,
+		Created:     cfg.sourceDateEpoch,
+
+		TagCondition: cfg.tagCondition,
 	}
 
 	manifestDigest, err := c.registry.Push(ctx, ref, blobReader, &regOpts)
 	if err != nil {
 		return "", fmt.Errorf("push %s: %w", ref, err)
 	}
-
-	// Sign and store as referrer if signer configured
-	if c.signer != nil {
-		if err := c.signAndStoreReferrer(ctx, ref, manifestDigest); err != nil {
-			return "", fmt.Errorf("sign %s: %w", ref, err)
-		}
-	}
-
 	return manifestDigest, nil
 }
 
 // signAndStoreReferrer signs the manifest and stores the signature as an OCI referrer.
-func (c *Client) signAndStoreReferrer(ctx context.Context, ref, manifestDigest string) error {
+// The referrer is annotated with created as its creation time.
+// Returns the digest of the referrer manifest.
+func (c *Client) signAndStoreReferrer(ctx context.Context, ref, manifestDigest string, created time.Time) (string, error) {
 	d, err := digest.Parse(manifestDigest)
 	if err != nil {
-		return fmt.Errorf("parse digest: %w", err)
+		return "", fmt.Errorf("parse digest: %w", err)
 	}
 
 	// Fetch the manifest bytes for signing
 	manifestRef := digestReference(ref, manifestDigest)
 	manifestBytes, _, err := c.registry.FetchManifest(ctx, manifestRef)
 	if err != nil {
-		return fmt.Errorf("fetch manifest: %w", err)
+		return "", fmt.Errorf("fetch manifest: %w", err)
 	}
 
 	// Sign the manifest
 	sig, err := c.signer.Sign(ctx, d, manifestBytes)
 	if err != nil {
-		return fmt.Errorf("signing: %w", err)
+		return "", fmt.Errorf("signing: %w", err)
 	}
 
 	// Store signature as OCI referrer artifact
-	_, err = c.registry.PushReferrer(ctx, ref, manifestDigest, sig.Data, &core.ReferrerPushOptions{
+	referrerDigest, err := c.registry.PushReferrer(ctx, ref, manifestDigest, sig.Data, &core.ReferrerPushOptions{
 		ArtifactType: sig.MediaType,
 		Annotations: map[string]string{
-			"org.opencontainers.image.created": time.Now().UTC().Format(time.RFC3339),
+			"org.opencontainers.image.created": created.Format(time.RFC3339),
 		},
 	})
 	if err != nil {
-		return fmt.Errorf("storing signature: %w", err)
+		return "", fmt.Errorf("storing signature: %w", err)
+	}
+
+	return referrerDigest, nil
+}
+
+// tagReferences resolves the tags of a push to ref into references,
+// skipping duplicates and ref itself.
+func tagReferences(ref string, tags []string) ([]string, error) {
+	seen := map[string]bool{ref: true}
+	var refs []string
+	for _, tag := range tags {
+		tagRef, err := registry.ResolveTag(ref, tag)
+		if err != nil {
+			return nil, err
+		}
+		if !seen[tagRef] {
+			seen[tagRef] = true
+			refs = append(refs, tagRef)
+		}
+	}
+	return refs, nil
+}
+
+// pushTags copies the image pushed to ref as manifestDigest to each of tags,
+// together with the signature referrers in signatures. Destinations on
+// different registries are pushed concurrently, and those on the same
+// registry in order. Returns manifestDigest, with an error naming each
+// destination that failed.
+func (c *Client) pushTags(ctx context.Context, ref, manifestDigest string, tags, signatures []string) (string, error) {
+	if len(tags) == 0 {
+		return manifestDigest, nil
+	}
+
+	// Group destinations by registry, keeping their order.
+	var hosts []string
+	groups := make(map[string][]int)
+	for i, tag := range tags {
+		host := registry.Host(tag)
+		if _, ok := groups[host]; !ok {
+			hosts = append(hosts, host)
+		}
+		groups[host] = append(groups[host], i)
 	}
 
+	src := digestReference(ref, manifestDigest)
+	errs := make([]error, len(tags))
+	var wg sync.WaitGroup
+	for _, host := range hosts {
+		wg.Go(func() {
+			for _, i := range groups[host] {
+				if err := c.pushTag(ctx, src, tags[i], signatures); err != nil {
+					errs[i] = fmt.Errorf("push %s: %w", tags[i], err)
+				}
+			}
+		})
+	}
+	wg.Wait()
+
+	return manifestDigest, errors.Join(errs...)
+}
+
+// pushTag copies the image at src, pinned by digest, and its signature
+// referrers to dst.
+func (c *Client) pushTag(ctx context.Context, src, dst string, signatures []string) error {
+	if _, err := c.registry.Copy(ctx, src, dst, TagCondition{}); err != nil {
+		return err
+	}
+	for _, sigDigest := range signatures {
+		if _, err := c.registry.Copy(ctx, digestReference(src, sigDigest), digestReference(dst, sigDigest), TagCondition{}); err != nil {
+			return fmt.Errorf("copy signature %s: %w", sigDigest, err)
+		}
+	}
+	c.logger.Debug("pushed tag", "ref", dst, "source", src)
 	return nil
 }
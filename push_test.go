@@ -0,0 +1,561 @@
+package blobber
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"strings"
+	"sync"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/containerd/stargz-snapshotter/estargz"
+	"github.com/opencontainers/go-digest"
+	specs "github.com/opencontainers/image-spec/specs-go"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/meigma/blobber/core"
+	"github.com/meigma/blobber/internal/archive"
+	"github.com/meigma/blobber/internal/safepath"
+)
+
+// mockPushRegistry records push operations.
+type mockPushRegistry struct {
+	mockVerifyRegistry
+
+	pushes    []core.RegistryPushOptions
+	blobs     [][]byte
+	index     []core.IndexManifest
+	signed    []string
+	signedAt  []string
+	indexRef  string
+	indexCond core.TagCondition
+
+	// existing image returned by ResolveLayers, with blob content keyed by digest
+	layers     []core.LayerDescriptor
+	layerBlobs map[string][]byte
+
+	// manifest currently tagged, returned by FetchManifest for tag references
+	// (not found when nil)
+	tagged       []byte
+	taggedDigest string
+
+	// copies records Copy calls as "src -> dst", which return the digest of
+	// src; copying to failCopy fails
+	mu       sync.Mutex
+	copies   []string
+	failCopy string
+}
+
+func (m *mockPushRegistry) Copy(_ context.Context, src, dst string, _ core.TagCondition) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if dst == m.failCopy {
+		return "", errors.New("copy failed")
+	}
+	m.copies = append(m.copies, src+" -> "+dst)
+	_, d, _ := strings.Cut(src, "@")
+	return d, nil
+}
+
+func (m *mockPushRegistry) Push(_ context.Context, _ string, layer io.Reader, opts *core.RegistryPushOptions) (string, error) {
+	data, err := io.ReadAll(layer)
+	if err != nil {
+		return "", err
+	}
+	m.pushes = append(m.pushes, *opts)
+	m.blobs = append(m.blobs, data)
+	return digest.FromString(fmt.Sprintf("manifest-%d", len(m.pushes))).String(), nil
+}
+
+func (m *mockPushRegistry) ResolveLayers(_ context.Context, _ string) ([]core.LayerDescriptor, error) {
+	if len(m.layers) == 0 {
+		return nil, core.ErrNotFound
+	}
+	return m.layers, nil
+}
+
+func (m *mockPushRegistry) FetchBlobRange(_ context.Context, _ string, desc core.LayerDescriptor, offset, length int64) (io.ReadCloser, error) {
+	data := m.layerBlobs[desc.Digest]
+	return io.NopCloser(bytes.NewReader(data[offset : offset+length])), nil
+}
+
+func (m *mockPushRegistry) PushIndex(_ context.Context, ref string, manifests []core.IndexManifest, cond core.TagCondition) (string, error) {
+	m.indexRef = ref
+	m.index = manifests
+	m.indexCond = cond
+	return digest.FromString("index").String(), nil
+}
+
+//nolint:gocritic // unnamedResult: not needed for test mock
+func (m *mockPushRegistry) FetchManifest(_ context.Context, ref string) ([]byte, string, error) {
+	if strings.Contains(ref, "@") {
+		return []byte(ref), "", nil
+	}
+	if m.tagged == nil {
+		return nil, "", core.ErrNotFound
+	}
+	return m.tagged, m.taggedDigest, nil
+}
+
+func (m *mockPushRegistry) PushReferrer(_ context.Context, _, subjectDigest string, _ []byte, opts *core.ReferrerPushOptions) (string, error) {
+	m.signed = append(m.signed, subjectDigest)
+	m.signedAt = append(m.signedAt, opts.Annotations["org.opencontainers.image.created"])
+	return digest.FromString("signature of " + subjectDigest).String(), nil
+}
+
+// mockTestSigner produces a fixed signature for any manifest.
+type mockTestSigner struct{}
+
+func (mockTestSigner) Sign(_ context.Context, _ digest.Digest, _ []byte) (*Signature, error) {
+	return &Signature{Data: []byte("sig"), MediaType: SignatureArtifactType}, nil
+}
+
+func TestPushIndex(t *testing.T) {
+	t.Parallel()
+
+	reg := &mockPushRegistry{}
+	c := &Client{
+		registry: reg,
+		builder:  archive.NewBuilder(slog.New(slog.DiscardHandler)),
+		signer:   mockTestSigner{},
+	}
+
+	var events []ProgressEvent
+	indexDigest, err := c.PushIndex(context.Background(), "test/repo:tag", map[string]fs.FS{
+		"linux/arm64/v8": fstest.MapFS{"app": &fstest.MapFile{Data: []byte("arm64"), Mode: 0o755}},
+		"linux/amd64":    fstest.MapFS{"app": &fstest.MapFile{Data: []byte("amd64"), Mode: 0o755}},
+	}, WithPushProgress(func(e ProgressEvent) {
+		events = append(events, e)
+	}))
+	require.NoError(t, err)
+	assert.Equal(t, digest.FromString("index").String(), indexDigest)
+
+	// Platform manifests are pushed untagged, in sorted platform order.
+	require.Len(t, reg.pushes, 2)
+	assert.Equal(t, "linux/amd64", reg.pushes[0].Platform)
+	assert.Equal(t, "linux/arm64/v8", reg.pushes[1].Platform)
+	for _, p := range reg.pushes {
+		assert.True(t, p.SkipTag, "platform manifests must not be tagged")
+	}
+
+	assert.Equal(t, "test/repo:tag", reg.indexRef)
+	require.Len(t, reg.index, 2)
+	assert.Equal(t, "linux/amd64", reg.index[0].Platform)
+	assert.Equal(t, "linux/arm64/v8", reg.index[1].Platform)
+
+	// Both platform manifests and the index are signed.
+	assert.ElementsMatch(t, []string{reg.index[0].Digest, reg.index[1].Digest, indexDigest}, reg.signed)
+
+	// Progress is cumulative across platforms.
+	require.NotEmpty(t, events)
+	last := events[len(events)-1]
+	assert.Equal(t, reg.pushes[0].BlobSize+reg.pushes[1].BlobSize, last.TotalBytes)
+	assert.Equal(t, last.TotalBytes, last.BytesTransferred)
+}
+
+func TestPushIndex_InvalidPlatforms(t *testing.T) {
+	t.Parallel()
+
+	c := &Client{registry: &mockPushRegistry{}, builder: archive.NewBuilder(nil)}
+	src := fstest.MapFS{"a": &fstest.MapFile{Data: []byte("a")}}
+
+	_, err := c.PushIndex(context.Background(), "test/repo:tag", nil)
+	require.Error(t, err, "empty platform map should be rejected")
+
+	_, err = c.PushIndex(context.Background(), "test/repo:tag", map[string]fs.FS{"amd64": src})
+	require.Error(t, err, "platform without os should be rejected")
+
+	_, err = c.PushIndex(context.Background(), "test/repo:tag", map[string]fs.FS{
+		"linux/amd64":  src,
+		"linux/x86_64": src,
+	})
+	require.ErrorContains(t, err, "duplicate platform")
+}
+
+func TestPush_WithBaseImage(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	builder := archive.NewBuilder(nil)
+
+	baseFS := fstest.MapFS{
+		"config.yaml":   &fstest.MapFile{Data: []byte("version: 1"), Mode: 0o644},
+		"data/big.bin":  &fstest.MapFile{Data: bytes.Repeat([]byte("x"), 4096), Mode: 0o644},
+		"data/old.json": &fstest.MapFile{Data: []byte("{}"), Mode: 0o644},
+	}
+	baseResult, err := builder.Build(ctx, baseFS, GzipCompression(), nil)
+	require.NoError(t, err)
+	baseBlob, err := io.ReadAll(baseResult.Blob)
+	require.NoError(t, err)
+	baseResult.Blob.Close()
+
+	baseManifest := digest.FromString("base manifest").String()
+	reg := &mockPushRegistry{
+		layers: []core.LayerDescriptor{{
+			Digest:         baseResult.BlobDigest,
+			Size:           baseResult.BlobSize,
+			ManifestDigest: baseManifest,
+		}},
+		layerBlobs: map[string][]byte{baseResult.BlobDigest: baseBlob},
+	}
+	c := &Client{registry: reg, builder: builder, logger: slog.New(slog.DiscardHandler)}
+
+	newFS := fstest.MapFS{
+		"config.yaml":  &fstest.MapFile{Data: []byte("version: 2"), Mode: 0o644},
+		"data/big.bin": &fstest.MapFile{Data: bytes.Repeat([]byte("x"), 4096), Mode: 0o644},
+		"data/new.txt": &fstest.MapFile{Data: []byte("new"), Mode: 0o644},
+	}
+	_, err = c.Push(ctx, "test/repo:v2", newFS, WithBaseImage("test/repo:v1"))
+	require.NoError(t, err)
+
+	require.Len(t, reg.pushes, 1)
+	assert.Equal(t, "test/repo@"+baseManifest, reg.pushes[0].BaseRef, "base must be pinned by digest")
+
+	// The pushed layer only carries the changes.
+	diffBlob := reg.blobs[0]
+	diffTOC, err := archive.NewReader().ReadTOC(bytes.NewReader(diffBlob), int64(len(diffBlob)))
+	require.NoError(t, err)
+	names := make([]string, 0, len(diffTOC.Entries))
+	for _, e := range diffTOC.Entries {
+		names = append(names, e.Name)
+	}
+	assert.ElementsMatch(t, []string{"config.yaml", "data", "data/new.txt", "data/.wh.old.json"}, names)
+
+	// Overlaying the pushed layer on the base yields the new content.
+	baseLayer, err := openBlobLayer(bytes.NewReader(baseBlob), int64(len(baseBlob)), "", "")
+	require.NoError(t, err)
+	diffLayer, err := openBlobLayer(bytes.NewReader(diffBlob), int64(len(diffBlob)), "", "")
+	require.NoError(t, err)
+	img := newImageFromLayers("test/repo:v2", []*imageLayer{baseLayer, diffLayer}, safepath.NewValidator(), c.logger)
+	defer img.Close()
+
+	entries, err := img.List()
+	require.NoError(t, err)
+	paths := make([]string, 0, len(entries))
+	for _, e := range entries {
+		paths = append(paths, e.Path())
+	}
+	assert.ElementsMatch(t, []string{"config.yaml", "data", "data/big.bin", "data/new.txt"}, paths)
+
+	rc, err := img.Open("config.yaml")
+	require.NoError(t, err)
+	defer rc.Close()
+	content, err := io.ReadAll(rc)
+	require.NoError(t, err)
+	assert.Equal(t, "version: 2", string(content))
+}
+
+func TestPushIndex_RejectsBaseImage(t *testing.T) {
+	t.Parallel()
+
+	c := &Client{registry: &mockPushRegistry{}, builder: archive.NewBuilder(nil)}
+	_, err := c.PushIndex(context.Background(), "test/repo:tag", map[string]fs.FS{
+		"linux/amd64": fstest.MapFS{"a": &fstest.MapFile{Data: []byte("a")}},
+	}, WithBaseImage("test/repo:base"))
+	require.Error(t, err)
+}
+
+func TestPush_Reproducible(t *testing.T) {
+	t.Parallel()
+
+	epoch := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	push := func(mtime time.Time) *mockPushRegistry {
+		reg := &mockPushRegistry{}
+		c := &Client{registry: reg, builder: archive.NewBuilder(nil), signer: mockTestSigner{}}
+		src := fstest.MapFS{
+			"a.txt":     &fstest.MapFile{Data: []byte("a"), Mode: 0o600, ModTime: mtime},
+			"dir/b.txt": &fstest.MapFile{Data: []byte("b"), Mode: 0o640, ModTime: mtime},
+		}
+		_, err := c.Push(context.Background(), "test/repo:v1", src, WithReproducible(epoch))
+		require.NoError(t, err)
+		return reg
+	}
+
+	first := push(time.Now())
+	second := push(time.Now().Add(-time.Hour))
+
+	require.Len(t, first.pushes, 1)
+	require.Len(t, second.pushes, 1)
+	assert.Equal(t, first.pushes[0].BlobDigest, second.pushes[0].BlobDigest)
+	assert.Equal(t, first.pushes[0].DiffID, second.pushes[0].DiffID)
+	require.NotNil(t, first.pushes[0].Created)
+	assert.True(t, epoch.Equal(*first.pushes[0].Created), "config creation time pinned to epoch")
+	assert.Equal(t, []string{epoch.Format(time.RFC3339)}, first.signedAt)
+}
+
+// taggedPushRegistry returns a registry whose tag holds a single-layer image
+// built from src with opts.
+func taggedPushRegistry(t *testing.T, src fs.FS, opts *core.BuildOptions) *mockPushRegistry {
+	t.Helper()
+	result, err := archive.NewBuilder(nil).Build(context.Background(), src, GzipCompression(), opts)
+	require.NoError(t, err)
+	blob, err := io.ReadAll(result.Blob)
+	require.NoError(t, err)
+	result.Blob.Close()
+
+	manifest, err := json.Marshal(ocispec.Manifest{
+		Versioned: specs.Versioned{SchemaVersion: 2},
+		MediaType: ocispec.MediaTypeImageManifest,
+		Layers: []ocispec.Descriptor{{
+			MediaType:   ocispec.MediaTypeImageLayerGzip,
+			Digest:      digest.Digest(result.BlobDigest),
+			Size:        result.BlobSize,
+			Annotations: map[string]string{estargz.TOCJSONDigestAnnotation: result.TOCDigest},
+		}},
+	})
+	require.NoError(t, err)
+	manifestDigest := digest.FromBytes(manifest).String()
+
+	return &mockPushRegistry{
+		layers: []core.LayerDescriptor{{
+			Digest:         result.BlobDigest,
+			Size:           result.BlobSize,
+			ManifestDigest: manifestDigest,
+			TOCDigest:      result.TOCDigest,
+		}},
+		layerBlobs:   map[string][]byte{result.BlobDigest: blob},
+		tagged:       manifest,
+		taggedDigest: manifestDigest,
+	}
+}
+
+func TestPush_SkipIfUnchanged(t *testing.T) {
+	t.Parallel()
+
+	tagged := fstest.MapFS{
+		"config.yaml":  &fstest.MapFile{Data: []byte("version: 1"), Mode: 0o644},
+		"bin/run.sh":   &fstest.MapFile{Data: []byte("#!/bin/sh"), Mode: 0o755},
+		"bin":          &fstest.MapFile{Mode: fs.ModeDir | 0o755},
+		"current":      &fstest.MapFile{Data: []byte("config.yaml"), Mode: fs.ModeSymlink | 0o777},
+		"data/big.bin": &fstest.MapFile{Data: bytes.Repeat([]byte("x"), 4096), Mode: 0o644},
+		"data":         &fstest.MapFile{Mode: fs.ModeDir | 0o755},
+	}
+	// with returns a copy of tagged with the given entries replaced or removed (nil).
+	with := func(changes map[string]*fstest.MapFile) fstest.MapFS {
+		src := fstest.MapFS{}
+		for name, f := range tagged {
+			g := *f
+			g.ModTime = time.Now()
+			src[name] = &g
+		}
+		for name, f := range changes {
+			if f == nil {
+				delete(src, name)
+			} else {
+				src[name] = f
+			}
+		}
+		return src
+	}
+
+	tests := []struct {
+		name string
+		src  fstest.MapFS
+		opts []PushOption
+		skip bool
+	}{
+		{name: "same files", src: with(nil), skip: true},
+		{name: "modified file", src: with(map[string]*fstest.MapFile{
+			"config.yaml": {Data: []byte("version: 2"), Mode: 0o644},
+		})},
+		{name: "mode change", src: with(map[string]*fstest.MapFile{
+			"bin/run.sh": {Data: []byte("#!/bin/sh"), Mode: 0o644},
+		})},
+		{name: "added file", src: with(map[string]*fstest.MapFile{
+			"data/new.txt": {Data: []byte("new"), Mode: 0o644},
+		})},
+		{name: "removed file", src: with(map[string]*fstest.MapFile{"data/big.bin": nil})},
+		{name: "different annotations", src: with(nil), opts: []PushOption{
+			WithAnnotations(map[string]string{"org.opencontainers.image.version": "1"}),
+		}},
+		{name: "different media type", src: with(nil), opts: []PushOption{WithMediaType(ocispec.MediaTypeImageLayer)}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			reg := taggedPushRegistry(t, tagged, nil)
+			c := &Client{registry: reg, builder: archive.NewBuilder(nil), signer: mockTestSigner{}, logger: slog.New(slog.DiscardHandler)}
+
+			got, err := c.Push(context.Background(), "test/repo:v1", tt.src, append(tt.opts, WithSkipIfUnchanged())...)
+			require.NoError(t, err)
+			if tt.skip {
+				assert.Equal(t, reg.taggedDigest, got)
+				assert.Empty(t, reg.pushes)
+				assert.Empty(t, reg.signed)
+			} else {
+				assert.NotEqual(t, reg.taggedDigest, got)
+				assert.Len(t, reg.pushes, 1)
+				assert.Len(t, reg.signed, 1)
+			}
+		})
+	}
+
+	t.Run("missing tag", func(t *testing.T) {
+		t.Parallel()
+
+		reg := &mockPushRegistry{}
+		c := &Client{registry: reg, builder: archive.NewBuilder(nil)}
+		_, err := c.Push(context.Background(), "test/repo:v1", tagged, WithSkipIfUnchanged())
+		require.NoError(t, err)
+		assert.Len(t, reg.pushes, 1)
+	})
+}
+
+func TestPush_SkipIfUnchangedReproducible(t *testing.T) {
+	t.Parallel()
+
+	epoch := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	src := fstest.MapFS{
+		"a.txt":     &fstest.MapFile{Data: []byte("a"), Mode: 0o644, ModTime: time.Now()},
+		"dir/b.txt": &fstest.MapFile{Data: []byte("b"), Mode: 0o644, ModTime: time.Now()},
+	}
+
+	reg := taggedPushRegistry(t, src, &core.BuildOptions{SourceDateEpoch: &epoch})
+	c := &Client{registry: reg, builder: archive.NewBuilder(nil), logger: slog.New(slog.DiscardHandler)}
+	got, err := c.Push(context.Background(), "test/repo:v1", src, WithReproducible(epoch), WithSkipIfUnchanged())
+	require.NoError(t, err)
+	assert.Equal(t, reg.taggedDigest, got)
+	assert.Empty(t, reg.pushes)
+
+	// A different epoch yields a different blob.
+	_, err = c.Push(context.Background(), "test/repo:v1", src, WithReproducible(epoch.Add(time.Hour)), WithSkipIfUnchanged())
+	require.NoError(t, err)
+	assert.Len(t, reg.pushes, 1)
+}
+
+func TestPush_SkipIfUnchangedRejectsBaseImage(t *testing.T) {
+	t.Parallel()
+
+	c := &Client{registry: &mockPushRegistry{}, builder: archive.NewBuilder(nil)}
+	src := fstest.MapFS{"a": &fstest.MapFile{Data: []byte("a")}}
+	_, err := c.Push(context.Background(), "test/repo:v2", src, WithBaseImage("test/repo:v1"), WithSkipIfUnchanged())
+	require.Error(t, err)
+
+	_, err = c.PushIndex(context.Background(), "test/repo:v2", map[string]fs.FS{"linux/amd64": src}, WithSkipIfUnchanged())
+	require.Error(t, err)
+}
+
+func TestPush_TagCondition(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	src := fstest.MapFS{"a.txt": &fstest.MapFile{Data: []byte("a"), Mode: 0o644}}
+	expected := digest.FromString("prod").String()
+
+	reg := &mockPushRegistry{}
+	c := &Client{registry: reg, builder: archive.NewBuilder(nil)}
+	_, err := c.Push(ctx, "test/repo:prod", src, WithExpectedDigest(expected))
+	require.NoError(t, err)
+	require.Len(t, reg.pushes, 1)
+	assert.Equal(t, TagCondition{ExpectedDigest: expected}, reg.pushes[0].TagCondition)
+
+	_, err = c.PushIndex(ctx, "test/repo:v1", map[string]fs.FS{"linux/amd64": src}, WithIfNotExists())
+	require.NoError(t, err)
+	assert.Equal(t, TagCondition{MustNotExist: true}, reg.indexCond)
+
+	// Skipped pushes check the tag they would have moved.
+	tagged := taggedPushRegistry(t, src, nil)
+	c = &Client{registry: tagged, builder: archive.NewBuilder(nil), logger: slog.New(slog.DiscardHandler)}
+	got, err := c.Push(ctx, "test/repo:prod", src, WithSkipIfUnchanged(), WithExpectedDigest(tagged.taggedDigest))
+	require.NoError(t, err)
+	assert.Equal(t, tagged.taggedDigest, got)
+
+	_, err = c.Push(ctx, "test/repo:prod", src, WithSkipIfUnchanged(), WithExpectedDigest(expected))
+	require.ErrorIs(t, err, ErrTagConflict)
+	_, err = c.Push(ctx, "test/repo:prod", src, WithSkipIfUnchanged(), WithIfNotExists())
+	require.ErrorIs(t, err, ErrTagConflict)
+	assert.Empty(t, tagged.pushes)
+}
+
+func TestPush_WithTags(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	src := fstest.MapFS{"a.txt": &fstest.MapFile{Data: []byte("a"), Mode: 0o644}}
+
+	reg := &mockPushRegistry{}
+	c := &Client{registry: reg, builder: archive.NewBuilder(nil), signer: mockTestSigner{}, logger: slog.New(slog.DiscardHandler)}
+	got, err := c.Push(ctx, "ghcr.io/org/app:v1.2.3", src,
+		WithTags("v1.2", "latest", "v1.2", "ghcr.io/org/app:v1.2.3", "registry.example.com/mirror/app:v1.2.3"))
+	require.NoError(t, err)
+
+	require.Len(t, reg.pushes, 1, "built and uploaded once")
+	require.Len(t, reg.signed, 1, "signed once")
+	sigDigest := digest.FromString("signature of " + got).String()
+	source := "ghcr.io/org/app@" + got
+	signature := "ghcr.io/org/app@" + sigDigest
+	assert.ElementsMatch(t, []string{
+		source + " -> ghcr.io/org/app:v1.2",
+		signature + " -> ghcr.io/org/app@" + sigDigest,
+		source + " -> ghcr.io/org/app:latest",
+		signature + " -> ghcr.io/org/app@" + sigDigest,
+		source + " -> registry.example.com/mirror/app:v1.2.3",
+		signature + " -> registry.example.com/mirror/app@" + sigDigest,
+	}, reg.copies)
+
+	// Failed destinations are reported, and the digest is still returned.
+	reg = &mockPushRegistry{failCopy: "ghcr.io/org/app:latest"}
+	c = &Client{registry: reg, builder: archive.NewBuilder(nil), logger: slog.New(slog.DiscardHandler)}
+	got, err = c.Push(ctx, "ghcr.io/org/app:v1.2.3", src, WithTags("latest", "v1.2"))
+	require.ErrorContains(t, err, "push ghcr.io/org/app:latest: copy failed")
+	assert.NotEmpty(t, got)
+	assert.Equal(t, []string{"ghcr.io/org/app@" + got + " -> ghcr.io/org/app:v1.2"}, reg.copies)
+
+	// Invalid tags fail before anything is built.
+	reg = &mockPushRegistry{}
+	c = &Client{registry: reg, builder: archive.NewBuilder(nil)}
+	_, err = c.Push(ctx, "ghcr.io/org/app:v1", src, WithTags("not a tag"))
+	require.ErrorIs(t, err, ErrInvalidRef)
+	assert.Empty(t, reg.pushes)
+}
+
+func TestPushTar(t *testing.T) {
+	t.Parallel()
+
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	require.NoError(t, tw.WriteHeader(&tar.Header{Typeflag: tar.TypeReg, Name: "app.bin", Mode: 0o755, Size: 3}))
+	_, err := tw.Write([]byte("bin"))
+	require.NoError(t, err)
+	require.NoError(t, tw.Close())
+
+	reg := &mockPushRegistry{}
+	c := &Client{registry: reg, builder: archive.NewBuilder(nil), validator: safepath.NewValidator()}
+
+	_, err = c.PushTar(context.Background(), "test/repo:v1", &buf)
+	require.NoError(t, err)
+	require.Len(t, reg.blobs, 1)
+
+	toc, err := archive.NewReader().ReadTOC(bytes.NewReader(reg.blobs[0]), int64(len(reg.blobs[0])))
+	require.NoError(t, err)
+	require.Len(t, toc.Entries, 1)
+	assert.Equal(t, "app.bin", toc.Entries[0].Name)
+}
+
+func TestPushTar_PathTraversal(t *testing.T) {
+	t.Parallel()
+
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	require.NoError(t, tw.WriteHeader(&tar.Header{Typeflag: tar.TypeReg, Name: "../../etc/cron.d/x", Mode: 0o644}))
+	require.NoError(t, tw.Close())
+
+	reg := &mockPushRegistry{}
+	c := &Client{registry: reg, builder: archive.NewBuilder(nil), validator: safepath.NewValidator()}
+
+	_, err := c.PushTar(context.Background(), "test/repo:v1", &buf)
+	require.ErrorIs(t, err, ErrPathTraversal)
+	assert.Empty(t, reg.pushes, "nothing may be pushed for an unsafe archive")
+}
@@ -0,0 +1,58 @@
+//go:build linux || darwin
+
+package blobber
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/opencontainers/go-digest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sys/unix"
+
+	"github.com/meigma/blobber/core"
+	"github.com/meigma/blobber/internal/archive"
+	"github.com/meigma/blobber/internal/safepath"
+)
+
+func TestPush_DirFSRecordsXattrs(t *testing.T) {
+	t.Parallel()
+
+	src := t.TempDir()
+	path := filepath.Join(src, "app.conf")
+	require.NoError(t, os.WriteFile(path, []byte("key=value"), 0o644))
+	if err := unix.Lsetxattr(path, "user.origin", []byte("build"), 0); err != nil {
+		t.Skipf("extended attributes not supported: %v", err)
+	}
+
+	pushReg := &mockPushRegistry{}
+	pusher := &Client{registry: pushReg, builder: archive.NewBuilder(nil)}
+	_, err := pusher.Push(context.Background(), "test/repo:v1", DirFS(src))
+	require.NoError(t, err)
+	require.Len(t, pushReg.blobs, 1)
+
+	blob := pushReg.blobs[0]
+	pullReg := &mockPullRegistry{
+		mockVerifyRegistry: mockVerifyRegistry{
+			layerDesc: core.LayerDescriptor{
+				Digest:         digest.FromBytes(blob).String(),
+				Size:           int64(len(blob)),
+				ManifestDigest: digest.FromString("manifest").String(),
+			},
+		},
+		blob: blob,
+	}
+	puller := &Client{registry: pullReg, validator: safepath.NewValidator(), logger: slog.New(slog.DiscardHandler)}
+
+	destDir := t.TempDir()
+	require.NoError(t, puller.Pull(context.Background(), "test/repo:v1", destDir, WithPreserveXattrs()))
+
+	value := make([]byte, 64)
+	n, err := unix.Lgetxattr(filepath.Join(destDir, "app.conf"), "user.origin", value)
+	require.NoError(t, err)
+	assert.Equal(t, "build", string(value[:n]))
+}
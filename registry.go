@@ -6,4 +6,10 @@ import "github.com/meigma/blobber/core"
 type (
 	// RegistryPushOptions contains metadata for push operations.
 	RegistryPushOptions = core.RegistryPushOptions
+
+	// IndexManifest describes a platform-specific manifest of an image index.
+	IndexManifest = core.IndexManifest
+
+	// TagCondition makes tagging conditional on the current state of the tag.
+	TagCondition = core.TagCondition
 )
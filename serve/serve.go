@@ -0,0 +1,273 @@
+// Package serve exposes blobber images over HTTP.
+//
+// Files are served with directory listings, Range requests and conditional
+// requests. Each file's ETag is its content digest from the eStargz TOC, so
+// it only changes when the file content does, across image versions. With a
+// lazily loaded image (blobber.WithLazyLoading), a request fetches only the
+// byte ranges it returns, which makes it practical to host static sites and
+// model files straight from registry artifacts.
+//
+// A Server serves the current version of an image and reopens it
+// periodically, so pushes to a tag are picked up without a restart.
+package serve
+
+import (
+	"context"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"path"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/meigma/blobber"
+)
+
+// Compile-time interface check.
+var _ Image = (*blobber.Image)(nil)
+
+// FileServer returns a handler that serves the files of fsys, as
+// http.FileServerFS does, with ETags taken from the TOC content digests.
+//
+// fsys is typically the view returned by blobber.Image.FS. Files whose info
+// does not carry a blobber.FileEntry from Sys are served without an ETag.
+// Methods other than GET and HEAD fail with 405 Method Not Allowed.
+func FileServer(fsys fs.FS) http.Handler {
+	files := http.FileServerFS(fsys)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET, HEAD")
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+		// http.FileServerFS answers If-None-Match, If-Match and If-Range
+		// from the ETag set on the response.
+		if etag := fileETag(fsys, r.URL.Path); etag != "" {
+			w.Header().Set("ETag", etag)
+		}
+		files.ServeHTTP(w, r)
+	})
+}
+
+// fileETag returns the ETag of the file served for urlPath, or "" if there
+// is none. Directory URLs ending in a slash serve their index.html.
+func fileETag(fsys fs.FS, urlPath string) string {
+	name := strings.TrimPrefix(path.Clean("/"+urlPath), "/")
+	if name == "" {
+		name = "."
+	}
+	info, err := fs.Stat(fsys, name)
+	if err != nil {
+		return ""
+	}
+	if info.IsDir() {
+		if !strings.HasSuffix(urlPath, "/") {
+			return ""
+		}
+		if info, err = fs.Stat(fsys, path.Join(name, "index.html")); err != nil {
+			return ""
+		}
+	}
+
+	entry, ok := info.Sys().(blobber.FileEntry)
+	if !ok || entry.Digest == "" || !info.Mode().IsRegular() {
+		return ""
+	}
+	return `"` + entry.Digest + `"`
+}
+
+// Image is an image served by a Server.
+// *blobber.Image implements Image.
+type Image interface {
+	// FS returns the files of the image.
+	FS() fs.FS
+
+	// LayerDigests identifies the image content. The Server only switches
+	// to a reopened image when its layer digests differ.
+	LayerDigests() []string
+
+	// Close releases the image once no request is using it.
+	Close() error
+}
+
+// OpenFunc opens the current version of the served image, for example by
+// calling blobber.Client.OpenImage with a tag.
+type OpenFunc func(ctx context.Context) (Image, error)
+
+// Option configures a Server.
+type Option func(*Server)
+
+// WithRefresh sets how often the image is reopened to pick up new versions.
+// Zero or negative disables refreshing, which suits digest references.
+// Defaults to DefaultRefresh.
+func WithRefresh(interval time.Duration) Option {
+	return func(s *Server) {
+		s.refresh = interval
+	}
+}
+
+// WithLogger sets the logger for refresh events and failures.
+// Defaults to discarding logs.
+func WithLogger(logger *slog.Logger) Option {
+	return func(s *Server) {
+		s.logger = logger
+	}
+}
+
+// DefaultRefresh is the default interval between reopens of the image.
+const DefaultRefresh = time.Minute
+
+// Server is an http.Handler serving the current version of an image.
+// Server is safe for concurrent use.
+type Server struct {
+	open    OpenFunc
+	refresh time.Duration
+	logger  *slog.Logger
+
+	mu      sync.RWMutex
+	current *version
+	closed  bool
+
+	stop context.CancelFunc
+	done chan struct{}
+}
+
+// version is an opened image and the requests using it.
+type version struct {
+	img     Image
+	files   http.Handler
+	digests []string
+	active  sync.WaitGroup
+}
+
+// New opens the image and returns a Server for it.
+//
+// Unless refreshing is disabled, the image is reopened in the background
+// until ctx is done or Close is called. A reopened image with new content
+// replaces the served one; requests in progress finish on the image they
+// started with, which is closed afterwards. Failed reopens are logged and
+// the current image keeps being served.
+func New(ctx context.Context, open OpenFunc, opts ...Option) (*Server, error) {
+	s := &Server{
+		open:    open,
+		refresh: DefaultRefresh,
+		logger:  slog.New(slog.DiscardHandler),
+		done:    make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	img, err := open(ctx)
+	if err != nil {
+		return nil, err
+	}
+	s.current = newVersion(img)
+
+	ctx, s.stop = context.WithCancel(ctx)
+	if s.refresh > 0 {
+		go s.refreshLoop(ctx)
+	} else {
+		close(s.done)
+	}
+	return s, nil
+}
+
+func newVersion(img Image) *version {
+	return &version{
+		img:     img,
+		files:   FileServer(img.FS()),
+		digests: img.LayerDigests(),
+	}
+}
+
+// ServeHTTP serves a request from the current version of the image.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.RLock()
+	if s.closed {
+		s.mu.RUnlock()
+		http.Error(w, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
+		return
+	}
+	v := s.current
+	v.active.Add(1)
+	s.mu.RUnlock()
+	defer v.active.Done()
+
+	v.files.ServeHTTP(w, r)
+}
+
+// Close stops refreshing and closes the image once the requests in
+// progress have finished. Later requests fail with 503 Service Unavailable.
+func (s *Server) Close() error {
+	s.stop()
+	<-s.done
+
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return nil
+	}
+	s.closed = true
+	v := s.current
+	s.mu.Unlock()
+
+	v.active.Wait()
+	return v.img.Close()
+}
+
+// refreshLoop reopens the image every refresh interval until ctx is done.
+func (s *Server) refreshLoop(ctx context.Context) {
+	defer close(s.done)
+
+	ticker := time.NewTicker(s.refresh)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.reload(ctx)
+		}
+	}
+}
+
+// reload reopens the image and switches to it if its content changed.
+func (s *Server) reload(ctx context.Context) {
+	img, err := s.open(ctx)
+	if err != nil {
+		if ctx.Err() == nil {
+			s.logger.Warn("refresh failed, serving previous version", "error", err)
+		}
+		return
+	}
+
+	s.mu.RLock()
+	unchanged := slices.Equal(img.LayerDigests(), s.current.digests)
+	s.mu.RUnlock()
+	if unchanged {
+		s.closeImage(img)
+		return
+	}
+
+	next := newVersion(img)
+	s.mu.Lock()
+	prev := s.current
+	s.current = next
+	s.mu.Unlock()
+	s.logger.Info("serving new version", "layers", next.digests)
+
+	// Requests only join the current version, so prev gains no new ones.
+	go func() {
+		prev.active.Wait()
+		s.closeImage(prev.img)
+	}()
+}
+
+func (s *Server) closeImage(img Image) {
+	if err := img.Close(); err != nil {
+		s.logger.Debug("failed to close image", "error", err)
+	}
+}
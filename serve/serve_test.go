@@ -0,0 +1,229 @@
+package serve
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/meigma/blobber"
+)
+
+// file returns a MapFile whose info carries a FileEntry with the given digest,
+// as the files of blobber.Image.FS do.
+func file(data, digest string) *fstest.MapFile {
+	return &fstest.MapFile{
+		Data: []byte(data),
+		Mode: 0o644,
+		Sys:  blobber.FileEntry{Digest: digest},
+	}
+}
+
+func get(t *testing.T, h http.Handler, target string, header http.Header) *http.Response {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodGet, target, http.NoBody)
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec.Result()
+}
+
+func body(t *testing.T, resp *http.Response) string {
+	t.Helper()
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	return string(data)
+}
+
+func TestFileServer(t *testing.T) {
+	t.Parallel()
+
+	h := FileServer(fstest.MapFS{
+		"model.bin":       file("0123456789", "sha256:aaaa"),
+		"site/index.html": file("<h1>hi</h1>", "sha256:bbbb"),
+		"docs/a.txt":      file("a", "sha256:cccc"),
+		"docs/b.txt":      file("b", "sha256:dddd"),
+		"plain.txt":       {Data: []byte("plain"), Mode: 0o644},
+	})
+
+	t.Run("serves files with digest ETags", func(t *testing.T) {
+		t.Parallel()
+
+		resp := get(t, h, "/model.bin", nil)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, `"sha256:aaaa"`, resp.Header.Get("ETag"))
+		assert.Equal(t, "bytes", resp.Header.Get("Accept-Ranges"))
+		assert.Equal(t, "0123456789", body(t, resp))
+	})
+
+	t.Run("answers conditional requests", func(t *testing.T) {
+		t.Parallel()
+
+		resp := get(t, h, "/model.bin", http.Header{"If-None-Match": {`"sha256:aaaa"`}})
+		assert.Equal(t, http.StatusNotModified, resp.StatusCode)
+
+		resp = get(t, h, "/model.bin", http.Header{"If-None-Match": {`"sha256:other"`}})
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+	})
+
+	t.Run("serves ranges", func(t *testing.T) {
+		t.Parallel()
+
+		resp := get(t, h, "/model.bin", http.Header{"Range": {"bytes=2-5"}})
+		assert.Equal(t, http.StatusPartialContent, resp.StatusCode)
+		assert.Equal(t, "bytes 2-5/10", resp.Header.Get("Content-Range"))
+		assert.Equal(t, "2345", body(t, resp))
+
+		// A stale If-Range validator returns the whole file.
+		resp = get(t, h, "/model.bin", http.Header{"Range": {"bytes=2-5"}, "If-Range": {`"sha256:old"`}})
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, "0123456789", body(t, resp))
+	})
+
+	t.Run("serves index.html and listings", func(t *testing.T) {
+		t.Parallel()
+
+		resp := get(t, h, "/site/", nil)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, `"sha256:bbbb"`, resp.Header.Get("ETag"))
+		assert.Equal(t, "<h1>hi</h1>", body(t, resp))
+
+		resp = get(t, h, "/docs/", nil)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Empty(t, resp.Header.Get("ETag"))
+		listing := body(t, resp)
+		assert.Contains(t, listing, `href="a.txt"`)
+		assert.Contains(t, listing, `href="b.txt"`)
+
+		resp = get(t, h, "/docs", nil)
+		assert.Equal(t, http.StatusMovedPermanently, resp.StatusCode)
+	})
+
+	t.Run("omits ETags without digests", func(t *testing.T) {
+		t.Parallel()
+
+		resp := get(t, h, "/plain.txt", nil)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Empty(t, resp.Header.Get("ETag"))
+
+		resp = get(t, h, "/missing", nil)
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	})
+
+	t.Run("is read-only", func(t *testing.T) {
+		t.Parallel()
+
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodPut, "/model.bin", http.NoBody))
+		assert.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+		assert.Equal(t, "GET, HEAD", rec.Header().Get("Allow"))
+	})
+}
+
+// fakeImage implements Image over an fstest.MapFS.
+type fakeImage struct {
+	fsys    fstest.MapFS
+	digests []string
+	closed  atomic.Bool
+}
+
+func (f *fakeImage) FS() fs.FS              { return f.fsys }
+func (f *fakeImage) LayerDigests() []string { return f.digests }
+func (f *fakeImage) Close() error           { f.closed.Store(true); return nil }
+
+// versions returns an OpenFunc returning the image whose digest is held in
+// *current, and a function that lists every image opened so far.
+func versions(current *atomic.Value) (OpenFunc, func() []*fakeImage) {
+	var mu sync.Mutex
+	var opened []*fakeImage
+	open := func(context.Context) (Image, error) {
+		d := current.Load().(string)
+		img := &fakeImage{
+			fsys:    fstest.MapFS{"version.txt": file(d, "sha256:"+d)},
+			digests: []string{"sha256:" + d},
+		}
+		mu.Lock()
+		opened = append(opened, img)
+		mu.Unlock()
+		return img, nil
+	}
+	list := func() []*fakeImage {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]*fakeImage(nil), opened...)
+	}
+	return open, list
+}
+
+func TestServer_Refresh(t *testing.T) {
+	t.Parallel()
+
+	var current atomic.Value
+	current.Store("v1")
+	open, opened := versions(&current)
+
+	srv, err := New(context.Background(), open, WithRefresh(10*time.Millisecond))
+	require.NoError(t, err)
+	defer srv.Close()
+
+	assert.Equal(t, "v1", body(t, get(t, srv, "/version.txt", nil)))
+
+	// Reopening the same content keeps serving, and closes, the duplicates.
+	require.Eventually(t, func() bool { return len(opened()) >= 3 }, 5*time.Second, 5*time.Millisecond)
+	first := opened()[0]
+	assert.False(t, first.closed.Load(), "served image must stay open")
+	assert.True(t, opened()[1].closed.Load(), "unchanged reopen must be closed")
+
+	// A new push is picked up and the old version is closed.
+	current.Store("v2")
+	require.Eventually(t, func() bool {
+		return body(t, get(t, srv, "/version.txt", nil)) == "v2"
+	}, 5*time.Second, 5*time.Millisecond)
+	require.Eventually(t, first.closed.Load, 5*time.Second, 5*time.Millisecond)
+
+	require.NoError(t, srv.Close())
+	for _, img := range opened() {
+		assert.True(t, img.closed.Load(), "Close must close every image")
+	}
+	assert.Equal(t, http.StatusServiceUnavailable, get(t, srv, "/version.txt", nil).StatusCode)
+}
+
+func TestServer_RefreshDisabled(t *testing.T) {
+	t.Parallel()
+
+	var current atomic.Value
+	current.Store("v1")
+	open, opened := versions(&current)
+
+	srv, err := New(context.Background(), open, WithRefresh(0))
+	require.NoError(t, err)
+
+	current.Store("v2")
+	time.Sleep(20 * time.Millisecond)
+	assert.Equal(t, "v1", body(t, get(t, srv, "/version.txt", nil)))
+	assert.Len(t, opened(), 1)
+
+	require.NoError(t, srv.Close())
+	assert.True(t, opened()[0].closed.Load())
+}
+
+func TestServer_OpenError(t *testing.T) {
+	t.Parallel()
+
+	errOpen := errors.New("not found")
+	_, err := New(context.Background(), func(context.Context) (Image, error) { return nil, errOpen })
+	require.ErrorIs(t, err, errOpen)
+}
@@ -0,0 +1,260 @@
+package blobber
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/opencontainers/go-digest"
+
+	"github.com/meigma/blobber/internal/archive"
+)
+
+// Sync makes destDir mirror the image at ref and returns the changes it made,
+// sorted by path. The changes are those of Diff, with Old describing the
+// local entry and New the image entry.
+//
+// The local tree is compared with the image TOC by type, permissions, size,
+// and content digest, so unchanged files are not downloaded. Changed files
+// are fetched individually with range requests where available, local
+// entries absent from the image are removed, and permission changes are
+// applied in place.
+//
+// Pull options apply to the files that are extracted. With WithInclude or
+// WithExclude, only the selected paths are synchronized: other local files
+// are left alone, and so are the directories that contain them, even when
+// the image does not. WithAtomic is not supported.
+func (c *Client) Sync(ctx context.Context, ref, destDir string, opts ...PullOption) ([]Change, error) {
+	return c.sync(ctx, ref, destDir, opts, false)
+}
+
+// PlanSync returns the changes Sync would make to destDir, without changing
+// it or downloading any file content.
+func (c *Client) PlanSync(ctx context.Context, ref, destDir string, opts ...PullOption) ([]Change, error) {
+	return c.sync(ctx, ref, destDir, opts, true)
+}
+
+// sync plans the changes that make destDir mirror ref and applies them
+// unless dryRun is set.
+func (c *Client) sync(ctx context.Context, ref, destDir string, opts []PullOption, dryRun bool) ([]Change, error) {
+	if c.verifier != nil {
+		verifiedRef, err := c.verifySignature(ctx, ref)
+		if err != nil {
+			return nil, err
+		}
+		ref = verifiedRef
+	}
+
+	cfg := &pullConfig{}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	if cfg.atomic {
+		return nil, errors.New("sync does not support atomic pulls")
+	}
+	filter, err := archive.NewFilter(cfg.include, cfg.exclude)
+	if err != nil {
+		return nil, err
+	}
+	cfg.filter = filter
+
+	img, err := c.openSelectiveImage(ctx, ref)
+	if err != nil {
+		return nil, err
+	}
+	defer img.Close()
+
+	imageEntries, err := img.List()
+	if err != nil {
+		return nil, err
+	}
+	localEntries, err := listLocal(destDir, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	changes, err := planSync(destDir, localEntries, imageEntries, filter)
+	if err != nil {
+		return nil, err
+	}
+	if dryRun || len(changes) == 0 {
+		return changes, nil
+	}
+	if err := c.applySync(ctx, ref, img, destDir, changes, cfg); err != nil {
+		return nil, err
+	}
+	return changes, nil
+}
+
+// listLocal returns the entries below destDir selected by filter, sorted by
+// path. A missing destDir has no entries.
+func listLocal(destDir string, filter *archive.Filter) ([]FileEntry, error) {
+	var entries []FileEntry
+	err := filepath.WalkDir(destDir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if p == destDir && errors.Is(err, fs.ErrNotExist) {
+				return fs.SkipAll
+			}
+			return err
+		}
+		if p == destDir {
+			return nil
+		}
+		rel, err := filepath.Rel(destDir, p)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		// Unselected directories are still walked: their contents may be selected.
+		if !filter.Match(rel) {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		entry := FileEntry{FilePath: rel, FileMode: info.Mode(), FileModTime: info.ModTime()}
+		switch {
+		case info.Mode().IsRegular():
+			entry.FileSize = info.Size()
+		case info.Mode()&fs.ModeSymlink != 0:
+			if entry.LinkTarget, err = os.Readlink(p); err != nil {
+				return err
+			}
+		}
+		entries = append(entries, entry)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("list %s: %w", destDir, err)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].FilePath < entries[j].FilePath
+	})
+	return entries, nil
+}
+
+// planSync merges the sorted local and image listings into the changes that
+// make the local tree match the image. Local regular files are only hashed
+// when their size matches the image entry.
+func planSync(destDir string, local, image []FileEntry, filter *archive.Filter) ([]Change, error) {
+	var changes []Change
+	i, j := 0, 0
+	for i < len(local) || j < len(image) {
+		switch {
+		case j == len(image) || (i < len(local) && local[i].FilePath < image[j].FilePath):
+			changes = append(changes, Change{Path: local[i].FilePath, Kind: ChangeRemoved, Old: &local[i]})
+			i++
+		case i == len(local) || image[j].FilePath < local[i].FilePath:
+			if filter.Match(image[j].FilePath) {
+				changes = append(changes, Change{Path: image[j].FilePath, Kind: ChangeAdded, New: &image[j]})
+			}
+			j++
+		default:
+			oldEntry, newEntry := &local[i], &image[j]
+			if err := hashLocal(destDir, oldEntry, newEntry); err != nil {
+				return nil, err
+			}
+			kind, changed := compareEntries(oldEntry, newEntry)
+			// Symbolic link permissions cannot be changed, and are not compared.
+			if changed && !(kind == ChangeModeChanged && newEntry.Type()&fs.ModeSymlink != 0) {
+				changes = append(changes, Change{Path: oldEntry.FilePath, Kind: kind, Old: oldEntry, New: newEntry})
+			}
+			i++
+			j++
+		}
+	}
+	return changes, nil
+}
+
+// hashLocal sets the digest of a local regular file that may have the same
+// content as the image entry.
+func hashLocal(destDir string, local, image *FileEntry) error {
+	if !local.Type().IsRegular() || !image.Type().IsRegular() || local.FileSize != image.FileSize || image.Digest == "" {
+		return nil
+	}
+	//nolint:gosec // G304: Path comes from walking destDir
+	f, err := os.Open(filepath.Join(destDir, filepath.FromSlash(local.FilePath)))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	d, err := digest.FromReader(f)
+	if err != nil {
+		return fmt.Errorf("read %s: %w", local.FilePath, err)
+	}
+	local.Digest = d.String()
+	return nil
+}
+
+// applySync applies changes to destDir. Removed and replaced entries are
+// deleted first, then added and modified entries are extracted from img,
+// and finally permissions are updated.
+func (c *Client) applySync(ctx context.Context, ref string, img *Image, destDir string, changes []Change, cfg *pullConfig) error {
+	if err := os.MkdirAll(destDir, 0o750); err != nil {
+		return fmt.Errorf("create %s: %w", destDir, err)
+	}
+
+	// Children sort after their parents, so delete in reverse order.
+	extract := make(map[string]bool)
+	for i := len(changes) - 1; i >= 0; i-- {
+		ch := changes[i]
+		if ch.Kind == ChangeRemoved || ch.Kind == ChangeModified {
+			if err := removeLocal(filepath.Join(destDir, filepath.FromSlash(ch.Path)), ch.Kind == ChangeRemoved); err != nil {
+				return fmt.Errorf("remove %s: %w", ch.Path, err)
+			}
+		}
+		if ch.Kind == ChangeAdded || ch.Kind == ChangeModified {
+			extract[ch.Path] = true
+		}
+	}
+
+	if len(extract) > 0 {
+		exportCfg := &exportConfig{format: ExportTar, filter: cfg.filter, paths: extract}
+		if err := c.extractSelected(ctx, ref, img, destDir, cfg, exportCfg); err != nil {
+			return err
+		}
+	}
+
+	for _, ch := range changes {
+		if ch.Kind != ChangeModeChanged {
+			continue
+		}
+		mode := ch.New.FileMode & (fs.ModePerm | fs.ModeSetuid | fs.ModeSetgid | fs.ModeSticky)
+		if err := os.Chmod(filepath.Join(destDir, filepath.FromSlash(ch.Path)), mode); err != nil {
+			return fmt.Errorf("chmod %s: %w", ch.Path, err)
+		}
+	}
+	return nil
+}
+
+// removeLocal deletes a single local entry. The selected entries below a
+// directory are deleted before it, so a directory that is not empty holds
+// files the filters did not select. It is kept if keepNonEmpty is set.
+func removeLocal(p string, keepNonEmpty bool) error {
+	err := os.Remove(p)
+	if err == nil || errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if keepNonEmpty && hasEntries(p) {
+		return nil
+	}
+	return err
+}
+
+// hasEntries reports whether p is a directory with at least one entry.
+func hasEntries(p string) bool {
+	f, err := os.Open(p)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	_, err = f.Readdirnames(1)
+	return err == nil
+}
@@ -0,0 +1,171 @@
+package blobber
+
+import (
+	"context"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/meigma/blobber/internal/safepath"
+)
+
+func TestSync(t *testing.T) {
+	t.Parallel()
+
+	fsys := fstest.MapFS{
+		"same.txt":        &fstest.MapFile{Data: []byte("same"), Mode: 0o644},
+		"config.yaml":     &fstest.MapFile{Data: []byte("replicas: 3"), Mode: 0o644},
+		"run.sh":          &fstest.MapFile{Data: []byte("#!/bin/sh"), Mode: 0o755},
+		"added/file.txt":  &fstest.MapFile{Data: []byte("new"), Mode: 0o644},
+		"becomes-file":    &fstest.MapFile{Data: []byte("file"), Mode: 0o644},
+		"logs/keep.log":   &fstest.MapFile{Data: []byte("log"), Mode: 0o644},
+		"nested/same.txt": &fstest.MapFile{Data: []byte("nested"), Mode: 0o644},
+		"nested":          &fstest.MapFile{Mode: fs.ModeDir | 0o755},
+	}
+
+	// writeLocal creates the local tree to synchronize.
+	writeLocal := func(t *testing.T) string {
+		t.Helper()
+		dir := t.TempDir()
+		files := map[string]string{
+			"same.txt":            "same",
+			"config.yaml":         "replicas: 1", // same size, different content
+			"run.sh":              "#!/bin/sh",
+			"stale.txt":           "stale",
+			"becomes-file/a.txt":  "dir",
+			"nested/same.txt":     "nested",
+			"nested/old/file.txt": "old",
+			"local.log":           "local",
+		}
+		for name, data := range files {
+			p := filepath.Join(dir, filepath.FromSlash(name))
+			require.NoError(t, os.MkdirAll(filepath.Dir(p), 0o755))
+			require.NoError(t, os.WriteFile(p, []byte(data), 0o644))
+		}
+		return dir
+	}
+
+	newClient := func(t *testing.T) (*Client, *mockPullRegistry) {
+		t.Helper()
+		reg := newMockPullRegistry(t, fsys)
+		return &Client{registry: reg, validator: safepath.NewValidator(), logger: slog.New(slog.DiscardHandler)}, reg
+	}
+
+	t.Run("mirrors the image", func(t *testing.T) {
+		t.Parallel()
+
+		c, reg := newClient(t)
+		destDir := writeLocal(t)
+
+		changes, err := c.Sync(context.Background(), "test/repo:v1", destDir)
+		require.NoError(t, err)
+
+		got := make(map[string]ChangeKind)
+		for _, ch := range changes {
+			got[ch.Path] = ch.Kind
+		}
+		assert.Equal(t, map[string]ChangeKind{
+			"added":               ChangeAdded,
+			"added/file.txt":      ChangeAdded,
+			"becomes-file":        ChangeModified,
+			"becomes-file/a.txt":  ChangeRemoved,
+			"config.yaml":         ChangeModified,
+			"local.log":           ChangeRemoved,
+			"logs":                ChangeAdded,
+			"logs/keep.log":       ChangeAdded,
+			"nested/old":          ChangeRemoved,
+			"nested/old/file.txt": ChangeRemoved,
+			"run.sh":              ChangeModeChanged,
+			"stale.txt":           ChangeRemoved,
+		}, got)
+		assert.Zero(t, reg.fullFetches, "changed files are fetched with range requests")
+
+		local, err := listLocal(destDir, nil)
+		require.NoError(t, err)
+		var paths []string
+		for _, e := range local {
+			paths = append(paths, e.FilePath)
+		}
+		assert.Equal(t, []string{
+			"added", "added/file.txt", "becomes-file", "config.yaml", "logs", "logs/keep.log",
+			"nested", "nested/same.txt", "run.sh", "same.txt",
+		}, paths)
+
+		//nolint:gosec // G304: Test file path is constructed from t.TempDir()
+		content, err := os.ReadFile(filepath.Join(destDir, "config.yaml"))
+		require.NoError(t, err)
+		assert.Equal(t, "replicas: 3", string(content))
+		info, err := os.Stat(filepath.Join(destDir, "run.sh"))
+		require.NoError(t, err)
+		assert.Equal(t, os.FileMode(0o755), info.Mode().Perm())
+
+		// A synchronized tree has no changes.
+		changes, err = c.Sync(context.Background(), "test/repo:v1", destDir)
+		require.NoError(t, err)
+		assert.Empty(t, changes)
+	})
+
+	t.Run("plan leaves the tree untouched", func(t *testing.T) {
+		t.Parallel()
+
+		c, reg := newClient(t)
+		destDir := writeLocal(t)
+
+		changes, err := c.PlanSync(context.Background(), "test/repo:v1", destDir)
+		require.NoError(t, err)
+		assert.NotEmpty(t, changes)
+		assert.FileExists(t, filepath.Join(destDir, "stale.txt"))
+		assert.NoDirExists(t, filepath.Join(destDir, "added"))
+		assert.Zero(t, reg.fullFetches)
+	})
+
+	t.Run("only synchronizes selected paths", func(t *testing.T) {
+		t.Parallel()
+
+		c, _ := newClient(t)
+		destDir := writeLocal(t)
+
+		changes, err := c.Sync(context.Background(), "test/repo:v1", destDir, WithInclude("*.log"))
+		require.NoError(t, err)
+
+		got := make(map[string]ChangeKind)
+		for _, ch := range changes {
+			got[ch.Path] = ch.Kind
+		}
+		assert.Equal(t, map[string]ChangeKind{
+			"local.log":     ChangeRemoved,
+			"logs/keep.log": ChangeAdded,
+		}, got)
+		assert.FileExists(t, filepath.Join(destDir, "stale.txt"), "unselected files are left alone")
+	})
+
+	t.Run("keeps excluded files in removed directories", func(t *testing.T) {
+		t.Parallel()
+
+		c, _ := newClient(t)
+		destDir := writeLocal(t)
+		extra := filepath.Join(destDir, "nested", "old", "extra.txt")
+		require.NoError(t, os.WriteFile(extra, []byte("extra"), 0o644))
+
+		// nested/old is not in the image, but holds an excluded file.
+		_, err := c.Sync(context.Background(), "test/repo:v1", destDir, WithExclude("nested/old/file.txt"))
+		require.NoError(t, err)
+		assert.FileExists(t, filepath.Join(destDir, "nested", "old", "file.txt"), "excluded files are left alone")
+		assert.NoFileExists(t, extra, "selected files are removed")
+		assert.NoFileExists(t, filepath.Join(destDir, "stale.txt"))
+	})
+
+	t.Run("rejects atomic pulls", func(t *testing.T) {
+		t.Parallel()
+
+		c, _ := newClient(t)
+		_, err := c.Sync(context.Background(), "test/repo:v1", t.TempDir(), WithAtomic())
+		require.Error(t, err)
+	})
+}
@@ -0,0 +1,85 @@
+package blobber
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+
+	"github.com/containerd/stargz-snapshotter/estargz"
+)
+
+// verifiedFile reads a regular file from an eStargz layer, verifying each
+// chunk against its digest in the TOC before returning any of its data.
+// The last chunk read is kept, so sequential reads decompress and verify
+// each chunk once.
+type verifiedFile struct {
+	name     string
+	ra       io.ReaderAt         // unverified file content
+	chunks   []*estargz.TOCEntry // ordered by offset
+	verifier estargz.TOCEntryVerifier
+
+	mu   sync.Mutex
+	last *estargz.TOCEntry
+	data []byte
+}
+
+// ReadAt implements io.ReaderAt.
+func (f *verifiedFile) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, errors.New("negative offset")
+	}
+	n := 0
+	for n < len(p) {
+		ce, data, err := f.chunk(off)
+		if err != nil {
+			return n, err
+		}
+		n += copy(p[n:], data[off-ce.ChunkOffset:])
+		off = ce.ChunkOffset + int64(len(data))
+	}
+	return n, nil
+}
+
+// chunk returns the verified chunk containing off and its data.
+// Returns io.EOF if off is past the last chunk.
+func (f *verifiedFile) chunk(off int64) (*estargz.TOCEntry, []byte, error) {
+	i := sort.Search(len(f.chunks), func(i int) bool {
+		return f.chunks[i].ChunkOffset+f.chunks[i].ChunkSize > off
+	})
+	if i == len(f.chunks) {
+		return nil, nil, io.EOF
+	}
+	ce := f.chunks[i]
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.last == ce {
+		return ce, f.data, nil
+	}
+
+	// A new buffer is allocated for each chunk because concurrent readers
+	// may still be copying from the previous one.
+	data := make([]byte, ce.ChunkSize)
+	if n, err := f.ra.ReadAt(data, ce.ChunkOffset); n < len(data) {
+		if err == nil || errors.Is(err, io.EOF) {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, nil, fmt.Errorf("read %s: %w", f.name, err)
+	}
+
+	v, err := f.verifier.Verifier(ce)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s: %w: %v", f.name, ErrIntegrity, err)
+	}
+	if _, err := v.Write(data); err != nil {
+		return nil, nil, fmt.Errorf("%s: %w: %v", f.name, ErrIntegrity, err)
+	}
+	if !v.Verified() {
+		return nil, nil, fmt.Errorf("%s: %w: chunk at offset %d does not match its digest", f.name, ErrIntegrity, ce.ChunkOffset)
+	}
+
+	f.last, f.data = ce, data
+	return ce, data, nil
+}